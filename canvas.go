@@ -188,6 +188,53 @@ type Renderer interface {
 	RenderImage(img image.Image, m Matrix)
 }
 
+// LayeredRenderer is a renderer that is notified of the z-index of the layers that follow when a canvas is rendered to it, which allows grouping elements by z-index.
+type LayeredRenderer interface {
+	Renderer
+	SetLayer(zindex int)
+}
+
+// GroupRenderer is a renderer that is notified when a context pushes or pops its state, which allows nesting elements in groups. It receives the attributes of each group, and the attributes of the elements that follow until a group is started or ended, such as identifiers and links.
+type GroupRenderer interface {
+	Renderer
+	PushGroup(attrs Attributes)
+	PopGroup()
+	SetAttributes(attrs Attributes)
+}
+
+// Attributes are the attributes of groups and elements for renderers that support them (see GroupRenderer), such as SVG where they allow binding events to elements and adding tooltips and links.
+type Attributes struct {
+	ID    string
+	Title string            // tooltip
+	Desc  string            // description
+	Href  string            // link
+	Data  map[string]string // custom data, such as data-* attributes in SVG
+}
+
+// Empty returns true if no attributes are set.
+func (attrs Attributes) Empty() bool {
+	return attrs.ID == "" && attrs.Title == "" && attrs.Desc == "" && attrs.Href == "" && len(attrs.Data) == 0
+}
+
+// Equal returns true if the attributes are equal.
+func (attrs Attributes) Equal(b Attributes) bool {
+	if attrs.ID != b.ID || attrs.Title != b.Title || attrs.Desc != b.Desc || attrs.Href != b.Href || len(attrs.Data) != len(b.Data) {
+		return false
+	}
+	for key, val := range attrs.Data {
+		if bval, ok := b.Data[key]; !ok || val != bval {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterRenderer is a renderer that supports filter effects, which are applied to a group of layers as a whole. Groups with a filter are rendered without it to other renderers.
+type FilterRenderer interface {
+	Renderer
+	RenderFilter(group *Canvas, filter *Filter, m Matrix)
+}
+
 ////////////////////////////////////////////////////////////////
 
 // CoordSystem is the coordinate system, which can be either of the four cartesian quadrants. Most useful are the I'th and IV'th quadrants. CartesianI is the default quadrant with the zero-point in the bottom-left (the default for mathematics). The CartesianII has its zero-point in the bottom-right, CartesianIII in the top-right, and CartesianIV in the top-left (often used as default for printing devices). See https://en.wikipedia.org/wiki/Cartesian_coordinate_system#Quadrants_and_octants for an explanation.
@@ -204,9 +251,11 @@ const (
 // ContextState defines the state of the context, including fill or stroke style, view and coordinate view.
 type ContextState struct {
 	Style
-	view        Matrix
-	coordView   Matrix
-	coordSystem CoordSystem
+	view          Matrix
+	coordView     Matrix
+	coordSystem   CoordSystem
+	interpolation Interpolation
+	attrs         Attributes
 }
 
 // Context maintains the state for the current path, path style, and view transformation matrix.
@@ -250,18 +299,26 @@ func (c *Context) Size() (float64, float64) {
 	return c.Renderer.Size()
 }
 
-// Push saves the current draw state so that it can be popped later on.
+// Push saves the current draw state so that it can be popped later on. For renderers that support groups, it starts a group that ends when popped, and the current attributes are moved to the group.
 func (c *Context) Push() {
 	c.stack = append(c.stack, c.ContextState)
+	if grouper, ok := c.Renderer.(GroupRenderer); ok {
+		grouper.PushGroup(c.attrs)
+	}
+	c.attrs = Attributes{}
 }
 
-// Pop restores the last pushed draw state and uses that as the current draw state. If there are no states on the stack, this will do nothing.
+// Pop restores the last pushed draw state and uses that as the current draw state. If there are no states on the stack, this will do nothing. The attributes are not restored, as they belong to the popped group.
 func (c *Context) Pop() {
 	if len(c.stack) == 0 {
 		return
 	}
 	c.ContextState = c.stack[len(c.stack)-1]
 	c.stack = c.stack[:len(c.stack)-1]
+	c.attrs = Attributes{}
+	if grouper, ok := c.Renderer.(GroupRenderer); ok {
+		grouper.PopGroup()
+	}
 }
 
 // CoordView returns the current affine transformation matrix through which all operation coordinates will be transformed.
@@ -452,6 +509,11 @@ func (c *Context) SetDashes(offset float64, dashes ...float64) {
 	c.Style.Dashes = dashes
 }
 
+// SetImageInterpolation sets the resampling kernel to be used for drawing images.
+func (c *Context) SetImageInterpolation(interpolation Interpolation) {
+	c.interpolation = interpolation
+}
+
 // SetFillRule sets the fill rule to be used for filling paths.
 func (c *Context) SetFillRule(rule FillRule) {
 	c.Style.FillRule = rule
@@ -462,6 +524,62 @@ func (c *Context) ResetStyle() {
 	c.Style = DefaultStyle
 }
 
+// Attributes returns the attributes of the elements that follow.
+func (c *Context) Attributes() Attributes {
+	return c.attrs
+}
+
+// SetAttributes sets the attributes of the elements that follow, or of the group when followed by Push. Attributes are ignored by renderers that don't support them.
+func (c *Context) SetAttributes(attrs Attributes) {
+	c.attrs = attrs
+}
+
+// ResetAttributes resets the attributes of the elements that follow.
+func (c *Context) ResetAttributes() {
+	c.attrs = Attributes{}
+}
+
+// SetID sets the identifier of the elements that follow, or of the group when followed by Push.
+func (c *Context) SetID(id string) {
+	c.attrs.ID = id
+}
+
+// SetTitle sets the title of the elements that follow, or of the group when followed by Push, which is usually shown as a tooltip.
+func (c *Context) SetTitle(title string) {
+	c.attrs.Title = title
+}
+
+// SetDesc sets the description of the elements that follow, or of the group when followed by Push.
+func (c *Context) SetDesc(desc string) {
+	c.attrs.Desc = desc
+}
+
+// SetHref sets the link of the elements that follow, or of the group when followed by Push.
+func (c *Context) SetHref(href string) {
+	c.attrs.Href = href
+}
+
+// SetData sets custom data of the elements that follow, or of the group when followed by Push. An empty value removes the key.
+func (c *Context) SetData(key, val string) {
+	data := make(map[string]string, len(c.attrs.Data)+1)
+	for k, v := range c.attrs.Data {
+		data[k] = v
+	}
+	if val == "" {
+		delete(data, key)
+	} else {
+		data[key] = val
+	}
+	c.attrs.Data = data
+}
+
+// setAttributes passes the attributes to the renderer before drawing.
+func (c *Context) setAttributes() {
+	if grouper, ok := c.Renderer.(GroupRenderer); ok {
+		grouper.SetAttributes(c.attrs)
+	}
+}
+
 // SetZIndex sets the z-index. This will call the renderer's `SetZIndex` function only if it exists (in this case only for `Canvas`).
 func (c *Context) SetZIndex(zindex int) {
 	if zindexer, ok := c.Renderer.(interface{ SetZIndex(int) }); ok {
@@ -607,6 +725,7 @@ func (c *Context) FitImage(img image.Image, rect Rect, fit ImageFit) {
 	if c.coordSystem == CartesianII || c.coordSystem == CartesianIII {
 		m = m.ReflectXAbout(float64(img.Bounds().Size().X) / 2.0)
 	}
+	c.setAttributes()
 	c.RenderImage(img, m)
 }
 
@@ -649,6 +768,7 @@ func (c *Context) DrawPath(x, y float64, paths ...*Path) {
 	}
 	m = m.Mul(c.view)
 
+	c.setAttributes()
 	dashes := style.Dashes
 	for _, path := range paths {
 		var ok bool
@@ -681,6 +801,7 @@ func (c *Context) DrawText(x, y float64, text *Text) {
 	if c.coordSystem == CartesianII || c.coordSystem == CartesianIII {
 		m = m.ReflectX()
 	}
+	c.setAttributes()
 	c.RenderText(text, m)
 }
 
@@ -705,27 +826,70 @@ func (c *Context) DrawImage(x, y float64, img image.Image, resolution Resolution
 	if c.coordSystem == CartesianII || c.coordSystem == CartesianIII {
 		m = m.ReflectXAbout(float64(img.Bounds().Size().X) / 2.0)
 	}
+	if c.interpolation != DefaultInterpolation {
+		img = WithInterpolation(img, c.interpolation)
+	}
+	c.setAttributes()
 	c.RenderImage(img, m)
 }
 
+// DrawGroup draws a canvas as a group at position (x,y) using the current view, with a filter effect applied to the group as a whole. The canvas is drawn with its origin at (x,y) and its y-axis pointing upwards. The filter may be nil, and is ignored for renderers that don't support filter effects.
+func (c *Context) DrawGroup(x, y float64, group *Canvas, filter *Filter) {
+	if group.Empty() {
+		return
+	}
+
+	coord := c.coord(x, y)
+	m := Identity.Translate(coord.X, coord.Y)
+	if c.coordSystem == CartesianIII || c.coordSystem == CartesianIV {
+		m = m.ReflectY()
+	}
+	if c.coordSystem == CartesianII || c.coordSystem == CartesianIII {
+		m = m.ReflectX()
+	}
+	m = m.Mul(c.view)
+	if c.coordSystem == CartesianIII || c.coordSystem == CartesianIV {
+		m = m.ReflectY()
+	}
+	if c.coordSystem == CartesianII || c.coordSystem == CartesianIII {
+		m = m.ReflectX()
+	}
+	c.setAttributes()
+	renderGroup(c.Renderer, group, filter, m)
+}
+
 ////////////////////////////////////////////////////////////////
 ////////////////////////////////////////////////////////////////
 ////////////////////////////////////////////////////////////////
 
 type layer struct {
-	// path, text OR img is set
-	path *Path
-	text *Text
-	img  image.Image
+	// path, text, img OR group is set
+	path  *Path
+	text  *Text
+	img   image.Image
+	group *Canvas
+
+	m      Matrix
+	style  Style   // only for path
+	filter *Filter // only for group
 
-	m     Matrix
-	style Style // only for path
+	node  *layerGroup // group pushed by a context
+	attrs *Attributes // nil if empty
+}
+
+// layerGroup is a group of layers that was pushed by a context, with the attributes of the group.
+type layerGroup struct {
+	parent *layerGroup
+	attrs  *Attributes // nil if empty
+	n      int         // number of layers and non-empty groups directly within
 }
 
 // Canvas stores all drawing operations as layers that can be re-rendered to other renderers.
 type Canvas struct {
 	layers map[int][]layer
 	zindex int
+	node   *layerGroup
+	attrs  *Attributes
 	W, H   float64
 }
 
@@ -751,17 +915,62 @@ func (c *Canvas) Size() (float64, float64) {
 // RenderPath renders a path to the canvas using a style and a transformation matrix.
 func (c *Canvas) RenderPath(path *Path, style Style, m Matrix) {
 	path = path.Copy()
-	c.layers[c.zindex] = append(c.layers[c.zindex], layer{path: path, m: m, style: style})
+	c.addLayer(layer{path: path, m: m, style: style})
 }
 
 // RenderText renders a text object to the canvas using a transformation matrix.
 func (c *Canvas) RenderText(text *Text, m Matrix) {
-	c.layers[c.zindex] = append(c.layers[c.zindex], layer{text: text, m: m})
+	c.addLayer(layer{text: text, m: m})
 }
 
 // RenderImage renders an image to the canvas using a transformation matrix.
 func (c *Canvas) RenderImage(img image.Image, m Matrix) {
-	c.layers[c.zindex] = append(c.layers[c.zindex], layer{img: img, m: m})
+	c.addLayer(layer{img: img, m: m})
+}
+
+// RenderFilter renders a group with a filter effect to the canvas using a transformation matrix.
+func (c *Canvas) RenderFilter(group *Canvas, filter *Filter, m Matrix) {
+	c.addLayer(layer{group: group, m: m, filter: filter})
+}
+
+// PushGroup starts a group with the given attributes, groups are recorded for renderers that support them.
+func (c *Canvas) PushGroup(attrs Attributes) {
+	c.node = &layerGroup{parent: c.node, attrs: newAttributes(attrs)}
+	c.attrs = nil
+}
+
+// PopGroup ends the last started group.
+func (c *Canvas) PopGroup() {
+	if c.node != nil {
+		c.node = c.node.parent
+	}
+	c.attrs = nil
+}
+
+// SetAttributes sets the attributes of the layers that follow.
+func (c *Canvas) SetAttributes(attrs Attributes) {
+	if c.attrs == nil || !c.attrs.Equal(attrs) {
+		c.attrs = newAttributes(attrs)
+	}
+}
+
+func newAttributes(attrs Attributes) *Attributes {
+	if attrs.Empty() {
+		return nil
+	}
+	return &attrs
+}
+
+func (c *Canvas) addLayer(l layer) {
+	l.node = c.node
+	l.attrs = c.attrs
+	c.layers[c.zindex] = append(c.layers[c.zindex], l)
+	for node := c.node; node != nil; node = node.parent {
+		node.n++
+		if 1 < node.n {
+			break // parent already counts this group
+		}
+	}
 }
 
 // Empty return true if the canvas is empty.
@@ -772,6 +981,8 @@ func (c *Canvas) Empty() bool {
 // Reset empties the canvas.
 func (c *Canvas) Reset() {
 	c.layers = map[int][]layer{}
+	c.node = nil
+	c.attrs = nil
 }
 
 // SetZIndex sets the z-index.
@@ -795,12 +1006,13 @@ func (c *Canvas) Clip(rect Rect) {
 	c.H = rect.H
 }
 
-// Fit shrinks the canvas' size that so all elements fit with a given margin in millimeters.
-func (c *Canvas) Fit(margin float64) {
+// Bounds returns the bounding box of all elements in the canvas, including the regions affected by filter effects.
+func (c *Canvas) Bounds() Rect {
 	rect := Rect{}
+	first := true
 	// TODO: slow when we have many paths (see Graph example)
 	for _, layers := range c.layers {
-		for i, l := range layers {
+		for _, l := range layers {
 			bounds := Rect{}
 			if l.path != nil {
 				bounds = l.path.Bounds()
@@ -815,15 +1027,30 @@ func (c *Canvas) Fit(margin float64) {
 			} else if l.img != nil {
 				size := l.img.Bounds().Size()
 				bounds = Rect{0.0, 0.0, float64(size.X), float64(size.Y)}
+			} else if l.group != nil {
+				if l.group.Empty() {
+					continue
+				}
+				bounds = l.group.Bounds()
+				if l.filter != nil {
+					bounds = l.filter.Bounds(bounds)
+				}
 			}
 			bounds = bounds.Transform(l.m)
-			if i == 0 {
+			if first {
 				rect = bounds
+				first = false
 			} else {
 				rect = rect.Add(bounds)
 			}
 		}
 	}
+	return rect
+}
+
+// Fit shrinks the canvas' size that so all elements fit with a given margin in millimeters.
+func (c *Canvas) Fit(margin float64) {
+	rect := c.Bounds()
 	rect.X -= margin
 	rect.Y -= margin
 	rect.W += 2.0 * margin
@@ -838,24 +1065,97 @@ func (c *Canvas) RenderTo(r Renderer) {
 
 // RenderViewTo transforms and renders the accumulated canvas drawing operations to another renderer.
 func (c *Canvas) RenderViewTo(r Renderer, view Matrix) {
+	layered, isLayered := r.(LayeredRenderer)
+	pushed := map[*layerGroup]bool{}
+	for _, zindex := range c.zindices() {
+		if isLayered {
+			layered.SetLayer(zindex)
+		}
+		renderLayers(r, c.layers[zindex], view, pushed)
+	}
+}
+
+func (c *Canvas) zindices() []int {
 	zindices := []int{}
 	for zindex := range c.layers {
 		zindices = append(zindices, zindex)
 	}
 	sort.Ints(zindices)
-
-	for _, zindex := range zindices {
-		for _, l := range c.layers[zindex] {
-			m := view.Mul(l.m)
-			if l.path != nil {
-				r.RenderPath(l.path, l.style, m)
-			} else if l.text != nil {
-				r.RenderText(l.text, m)
-			} else if l.img != nil {
-				r.RenderImage(l.img, m)
+	return zindices
+}
+
+// renderLayers renders layers in order. For renderers that support groups, the groups of the layers are started and ended around them, where groups without attributes that contain a single layer or group are omitted. Groups that are split over z-indices are started again without attributes, pushed records the groups that were started before.
+func renderLayers(r Renderer, layers []layer, view Matrix, pushed map[*layerGroup]bool) {
+	grouper, isGrouper := r.(GroupRenderer)
+	groups := []*layerGroup{}
+	var attrs *Attributes
+	for _, l := range layers {
+		if isGrouper {
+			path := []*layerGroup{}
+			for node := l.node; node != nil; node = node.parent {
+				if node.attrs != nil || 1 < node.n {
+					path = append(path, node)
+				}
+			}
+			i := 0
+			for i < len(groups) && i < len(path) && groups[i] == path[len(path)-1-i] {
+				i++
 			}
+			for len(groups) > i {
+				grouper.PopGroup()
+				groups = groups[:len(groups)-1]
+				attrs = nil
+			}
+			for ; i < len(path); i++ {
+				node := path[len(path)-1-i]
+				if node.attrs != nil && !pushed[node] {
+					grouper.PushGroup(*node.attrs)
+				} else {
+					grouper.PushGroup(Attributes{})
+				}
+				pushed[node] = true
+				groups = append(groups, node)
+				attrs = nil
+			}
+			if l.attrs != attrs {
+				if l.attrs != nil {
+					grouper.SetAttributes(*l.attrs)
+				} else {
+					grouper.SetAttributes(Attributes{})
+				}
+				attrs = l.attrs
+			}
+		}
+
+		m := view.Mul(l.m)
+		if l.path != nil {
+			r.RenderPath(l.path, l.style, m)
+		} else if l.text != nil {
+			r.RenderText(l.text, m)
+		} else if l.img != nil {
+			r.RenderImage(l.img, m)
+		} else if l.group != nil {
+			renderGroup(r, l.group, l.filter, m)
 		}
 	}
+	for range groups {
+		grouper.PopGroup()
+	}
+	if isGrouper && attrs != nil {
+		grouper.SetAttributes(Attributes{})
+	}
+}
+
+// renderGroup renders a group with a filter effect if the renderer supports it, otherwise the layers of the group are rendered without the filter in order of their z-index.
+func renderGroup(r Renderer, group *Canvas, filter *Filter, m Matrix) {
+	if filterer, ok := r.(FilterRenderer); ok && filter != nil {
+		filterer.RenderFilter(group, filter, m)
+		return
+	}
+	pushed := map[*layerGroup]bool{}
+	for _, zindex := range group.zindices() {
+		renderLayers(r, group.layers[zindex], m, pushed)
+	}
 }
 
 // Writer can write a canvas to a writer.
@@ -2,6 +2,7 @@ package canvas
 
 import (
 	"image"
+	"strings"
 	"testing"
 
 	"github.com/tdewolff/test"
@@ -75,3 +76,87 @@ func TestCanvasFit(t *testing.T) {
 	test.Float(t, c.W, 20)
 	test.Float(t, c.H, 20)
 }
+
+func TestCanvasFilter(t *testing.T) {
+	group := New(10, 10)
+	ctxGroup := NewContext(group)
+	ctxGroup.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+
+	c := New(100, 100)
+	ctx := NewContext(c)
+	ctx.DrawGroup(20.0, 20.0, group, DropShadow(2.0, -2.0, 1.0, Black))
+	test.T(t, len(c.layers[0]), 1)
+
+	c.Fit(0.0)
+	test.Float(t, c.W, 18.0) // blur reaches 3 standard deviations and the offset extends to the right
+	test.Float(t, c.H, 18.0)
+
+	// renderers without filter support draw the group as is
+	r := New(100, 100)
+	c.RenderTo(r)
+	test.T(t, len(r.layers[0]), 1)
+	test.T(t, r.layers[0][0].group, group)
+	r = New(100, 100)
+	c.RenderTo(struct{ Renderer }{r})
+	test.T(t, len(r.layers[0]), 1)
+	test.That(t, r.layers[0][0].path != nil)
+}
+
+type groupRecorder struct {
+	Renderer
+	ops []string
+}
+
+func (r *groupRecorder) PushGroup(attrs Attributes) {
+	r.ops = append(r.ops, "push "+attrs.ID)
+}
+
+func (r *groupRecorder) PopGroup() {
+	r.ops = append(r.ops, "pop")
+}
+
+func (r *groupRecorder) SetAttributes(attrs Attributes) {
+	r.ops = append(r.ops, "attrs "+attrs.ID)
+}
+
+func (r *groupRecorder) RenderPath(path *Path, style Style, m Matrix) {
+	r.ops = append(r.ops, "path")
+}
+
+func TestCanvasGroups(t *testing.T) {
+	c := New(100, 100)
+	ctx := NewContext(c)
+	ctx.SetID("chart")
+	ctx.Push()
+	ctx.SetID("bar")
+	ctx.SetData("value", "5")
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.ResetAttributes()
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.Push() // without attributes and with a single layer
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.Pop()
+	ctx.Pop()
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	test.T(t, ctx.Attributes().ID, "")
+
+	r := &groupRecorder{}
+	c.RenderTo(r)
+	test.T(t, strings.Join(r.ops, ","), "push chart,attrs bar,path,attrs ,path,path,pop,path")
+}
+
+func TestCanvasGroupsZIndex(t *testing.T) {
+	c := New(100, 100)
+	ctx := NewContext(c)
+	ctx.SetID("g")
+	ctx.Push()
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.SetZIndex(1)
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.Pop()
+
+	r := &groupRecorder{}
+	c.RenderTo(r)
+	test.T(t, strings.Join(r.ops, ","), "push g,path,pop,push ,path,path,pop")
+}
@@ -71,6 +71,11 @@ type Gradient interface {
 	At(float64, float64) color.RGBA
 }
 
+// Gradient64 is implemented by gradients that can return colors with 16 bits per channel, which is used for high precision rasterization.
+type Gradient64 interface {
+	At64(float64, float64, ColorSpace) color.RGBA64
+}
+
 // Stop is a color and offset for gradient patterns.
 type Stop struct {
 	Offset float64
@@ -114,6 +119,31 @@ func (stops Stops) At(t float64) color.RGBA {
 	return stops[len(stops)-1].Color
 }
 
+// At64 returns the color at position t ∈ [0,1] with 16 bits per channel, where the colors of the stops are converted to the linear color space of the given color space before interpolation.
+func (stops Stops) At64(t float64, colorSpace ColorSpace) color.RGBA64 {
+	if len(stops) == 0 {
+		return color.RGBA64{}
+	} else if t <= 0.0 || len(stops) == 1 {
+		return ToLinear64(colorSpace, stops[0].Color)
+	} else if 1.0 <= t {
+		return ToLinear64(colorSpace, stops[len(stops)-1].Color)
+	}
+	for i, stop := range stops[1:] {
+		if t < stop.Offset {
+			t = (t - stops[i].Offset) / (stop.Offset - stops[i].Offset)
+			c0 := ToLinear64(colorSpace, stops[i].Color)
+			c1 := ToLinear64(colorSpace, stop.Color)
+			return color.RGBA64{
+				lerp64(c0.R, c1.R, t),
+				lerp64(c0.G, c1.G, t),
+				lerp64(c0.B, c1.B, t),
+				lerp64(c0.A, c1.A, t),
+			}
+		}
+	}
+	return ToLinear64(colorSpace, stops[len(stops)-1].Color)
+}
+
 func colorLerp(c0, c1 color.RGBA, t float64) color.RGBA {
 	r0, g0, b0, a0 := c0.RGBA()
 	r1, g1, b1, a1 := c1.RGBA()
@@ -129,6 +159,10 @@ func lerp(a, b uint32, t float64) uint8 {
 	return uint8(uint32((1.0-t)*float64(a)+t*float64(b)) >> 8)
 }
 
+func lerp64(a, b uint16, t float64) uint16 {
+	return uint16((1.0-t)*float64(a) + t*float64(b) + 0.5)
+}
+
 // LinearGradient is a linear gradient pattern between the given start and end points. The color at offset 0 corresponds to the start position, and offset 1 to the end position. Start and end points are in the canvas's coordinate system.
 type LinearGradient struct {
 	Start, End Point
@@ -171,8 +205,9 @@ func (g *LinearGradient) SetColorSpace(colorSpace ColorSpace) Gradient {
 	}
 
 	gradient := *g
-	for i := range gradient.Stops {
-		gradient.Stops[i].Color = colorSpace.ToLinear(gradient.Stops[i].Color)
+	gradient.Stops = make(Stops, len(g.Stops))
+	for i := range g.Stops {
+		gradient.Stops[i] = Stop{g.Stops[i].Offset, colorSpace.ToLinear(g.Stops[i].Color)}
 	}
 	return &gradient
 }
@@ -182,15 +217,25 @@ func (g *LinearGradient) At(x, y float64) color.RGBA {
 	if len(g.Stops) == 0 {
 		return Transparent
 	}
+	return g.Stops.At(g.offset(x, y))
+}
+
+// At64 returns the color at position (x,y) with 16 bits per channel in the linear color space of the given color space. The gradient must not have been converted by SetColorSpace.
+func (g *LinearGradient) At64(x, y float64, colorSpace ColorSpace) color.RGBA64 {
+	if len(g.Stops) == 0 {
+		return color.RGBA64{}
+	}
+	return g.Stops.At64(g.offset(x, y), colorSpace)
+}
 
+func (g *LinearGradient) offset(x, y float64) float64 {
 	p := Point{x, y}.Sub(g.Start)
 	if Equal(g.d.Y, 0.0) && !Equal(g.d.X, 0.0) {
-		return g.Stops.At(p.X / g.d.X) // horizontal
+		return p.X / g.d.X // horizontal
 	} else if !Equal(g.d.Y, 0.0) && Equal(g.d.X, 0.0) {
-		return g.Stops.At(p.Y / g.d.Y) // vertical
+		return p.Y / g.d.Y // vertical
 	}
-	t := p.Dot(g.d) / g.d2
-	return g.Stops.At(t)
+	return p.Dot(g.d) / g.d2
 }
 
 // RadialGradient is a radial gradient pattern between two circles defined by their center points and radii. Color stop at offset 0 corresponds to the first circle and offset 1 to the second circle.
@@ -240,8 +285,9 @@ func (g *RadialGradient) SetColorSpace(colorSpace ColorSpace) Gradient {
 	}
 
 	gradient := *g
-	for i := range gradient.Stops {
-		gradient.Stops[i].Color = colorSpace.ToLinear(gradient.Stops[i].Color)
+	gradient.Stops = make(Stops, len(g.Stops))
+	for i := range g.Stops {
+		gradient.Stops[i] = Stop{g.Stops[i].Offset, colorSpace.ToLinear(g.Stops[i].Color)}
 	}
 	return &gradient
 }
@@ -252,6 +298,24 @@ func (g *RadialGradient) At(x, y float64) color.RGBA {
 		return Transparent
 	}
 
+	if t, ok := g.offset(x, y); ok {
+		return g.Stops.At(t)
+	}
+	return Transparent
+}
+
+// At64 returns the color at position (x,y) with 16 bits per channel in the linear color space of the given color space. The gradient must not have been converted by SetColorSpace.
+func (g *RadialGradient) At64(x, y float64, colorSpace ColorSpace) color.RGBA64 {
+	if len(g.Stops) == 0 {
+		return color.RGBA64{}
+	}
+	if t, ok := g.offset(x, y); ok {
+		return g.Stops.At64(t, colorSpace)
+	}
+	return color.RGBA64{}
+}
+
+func (g *RadialGradient) offset(x, y float64) (float64, bool) {
 	// see reference implementation of pixman-radial-gradient
 	// https://github.com/servo/pixman/blob/master/pixman/pixman-radial-gradient.c#L161
 	pd := Point{x, y}.Sub(g.C0)
@@ -259,11 +323,11 @@ func (g *RadialGradient) At(x, y float64) color.RGBA {
 	c := pd.Dot(pd) - g.R0*g.R0
 	t0, t1 := solveQuadraticFormula(g.a, -2.0*b, c)
 	if !math.IsNaN(t1) {
-		return g.Stops.At(t1)
+		return t1, true
 	} else if !math.IsNaN(t0) {
-		return g.Stops.At(t0)
+		return t0, true
 	}
-	return Transparent
+	return 0.0, false
 }
 
 // ImagePattern is an image tiling pattern of an image drawn from an origin with a certain resolution. Higher resolution will give smaller tilings.
@@ -337,6 +401,43 @@ type ColorSpace interface {
 	FromLinear(color.Color) color.RGBA
 }
 
+// ColorSpace64 is implemented by color spaces that can convert colors with 16 bits per channel, which avoids the loss of precision of dark colors in the linear color space.
+type ColorSpace64 interface {
+	ToLinear64(color.Color) color.RGBA64
+	FromLinear64(color.Color) color.RGBA64
+}
+
+// ToLinear64 encodes color to the color space with 16 bits per channel. If the color space does not implement ColorSpace64, the color is converted with 8 bits per channel.
+func ToLinear64(colorSpace ColorSpace, col color.Color) color.RGBA64 {
+	if cs, ok := colorSpace.(ColorSpace64); ok {
+		return cs.ToLinear64(col)
+	}
+	return color.RGBA64Model.Convert(colorSpace.ToLinear(col)).(color.RGBA64)
+}
+
+// FromLinear64 decodes color from the color space with 16 bits per channel. If the color space does not implement ColorSpace64, the color is converted with 8 bits per channel.
+func FromLinear64(colorSpace ColorSpace, col color.Color) color.RGBA64 {
+	if cs, ok := colorSpace.(ColorSpace64); ok {
+		return cs.FromLinear64(col)
+	}
+	return color.RGBA64Model.Convert(colorSpace.FromLinear(col)).(color.RGBA64)
+}
+
+// transfer64 applies a transfer function to the unpremultiplied color channels.
+func transfer64(col color.Color, f func(float64) float64) color.RGBA64 {
+	R, G, B, A := col.RGBA()
+	if A == 0 {
+		return color.RGBA64{}
+	}
+	a := float64(A)
+	return color.RGBA64{
+		uint16(f(float64(R)/a)*a + 0.5),
+		uint16(f(float64(G)/a)*a + 0.5),
+		uint16(f(float64(B)/a)*a + 0.5),
+		uint16(A),
+	}
+}
+
 // DefaultColorSpace is set to LinearColorSpace to match other renderers.
 var DefaultColorSpace ColorSpace = LinearColorSpace{}
 
@@ -361,6 +462,16 @@ func (LinearColorSpace) FromLinear(col color.Color) color.RGBA {
 	return color.RGBA{uint8(R >> 8), uint8(G >> 8), uint8(B >> 8), uint8(A >> 8)}
 }
 
+// ToLinear64 encodes color to color space with 16 bits per channel.
+func (LinearColorSpace) ToLinear64(col color.Color) color.RGBA64 {
+	return color.RGBA64Model.Convert(col).(color.RGBA64)
+}
+
+// FromLinear64 decodes color from color space with 16 bits per channel.
+func (LinearColorSpace) FromLinear64(col color.Color) color.RGBA64 {
+	return color.RGBA64Model.Convert(col).(color.RGBA64)
+}
+
 // GammaColorSpace assumes that input colors and output images are gamma-corrected with the given gamma value. The sRGB space uses a gamma=2.4 for most of the curve, but will on average have a gamma=2.2 best approximating the sRGB curve. See https://en.wikipedia.org/wiki/SRGB#The_sRGB_transfer_function_(%22gamma%22). According to https://www.puredevsoftware.com/blog/2019/01/22/sub-pixel-gamma-correct-font-rendering/, a gamma=1.43 is recommended for fonts.
 type GammaColorSpace struct {
 	Gamma float64
@@ -396,19 +507,46 @@ func (cs GammaColorSpace) FromLinear(col color.Color) color.RGBA {
 	}
 }
 
+// ToLinear64 encodes color to color space with 16 bits per channel.
+func (cs GammaColorSpace) ToLinear64(col color.Color) color.RGBA64 {
+	return transfer64(col, func(c float64) float64 {
+		return math.Pow(c, cs.Gamma)
+	})
+}
+
+// FromLinear64 decodes color from color space with 16 bits per channel.
+func (cs GammaColorSpace) FromLinear64(col color.Color) color.RGBA64 {
+	return transfer64(col, func(c float64) float64 {
+		return math.Pow(c, 1.0/cs.Gamma)
+	})
+}
+
+func sRGBToLinear(c float64) float64 {
+	// Formula from EXT_sRGB.
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearTosRGB(c float64) float64 {
+	// Formula from EXT_sRGB.
+	switch {
+	case c <= 0.0:
+		return 0.0
+	case 0 < c && c < 0.0031308:
+		return 12.92 * c
+	case 0.0031308 <= c && c < 1:
+		return 1.055*math.Pow(c, 0.41666) - 0.055
+	}
+	return 1.0
+}
+
 // SRGBColorSpace assumes that input colors and output images are in the sRGB color space (ubiquitous in almost all applications), which implies that for blending we need to convert to the linear color space, do blending, and then convert back to the sRGB color space. This will give technically correct blending, but may differ from common PDF viewer and browsers (which are wrong).
 type SRGBColorSpace struct{}
 
 // ToLinear encodes color to color space.
 func (SRGBColorSpace) ToLinear(col color.Color) color.RGBA {
-	sRGBToLinear := func(c float64) float64 {
-		// Formula from EXT_sRGB.
-		if c <= 0.04045 {
-			return c / 12.92
-		}
-		return math.Pow((c+0.055)/1.055, 2.4)
-	}
-
 	R, G, B, A := col.RGBA()
 	r := sRGBToLinear(float64(R) / float64(A))
 	g := sRGBToLinear(float64(G) / float64(A))
@@ -424,19 +562,6 @@ func (SRGBColorSpace) ToLinear(col color.Color) color.RGBA {
 
 // FromLinear decodes color from color space.
 func (SRGBColorSpace) FromLinear(col color.Color) color.RGBA {
-	linearTosRGB := func(c float64) float64 {
-		// Formula from EXT_sRGB.
-		switch {
-		case c <= 0.0:
-			return 0.0
-		case 0 < c && c < 0.0031308:
-			return 12.92 * c
-		case 0.0031308 <= c && c < 1:
-			return 1.055*math.Pow(c, 0.41666) - 0.055
-		}
-		return 1.0
-	}
-
 	R, G, B, A := col.RGBA()
 	r := linearTosRGB(float64(R) / float64(A))
 	g := linearTosRGB(float64(G) / float64(A))
@@ -450,6 +575,16 @@ func (SRGBColorSpace) FromLinear(col color.Color) color.RGBA {
 	}
 }
 
+// ToLinear64 encodes color to color space with 16 bits per channel.
+func (SRGBColorSpace) ToLinear64(col color.Color) color.RGBA64 {
+	return transfer64(col, sRGBToLinear)
+}
+
+// FromLinear64 decodes color from color space with 16 bits per channel.
+func (SRGBColorSpace) FromLinear64(col color.Color) color.RGBA64 {
+	return transfer64(col, linearTosRGB)
+}
+
 // Transparent when used as a fill or stroke color will indicate that the fill or stroke will not be drawn.
 var Transparent = color.RGBA{0x00, 0x00, 0x00, 0x00} // rgba(0, 0, 0, 0)
 
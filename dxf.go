@@ -0,0 +1,842 @@
+package canvas
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type dxfGroup struct {
+	code  int
+	value string
+}
+
+func (g dxfGroup) float() float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(g.value), 64)
+	return f
+}
+
+func (g dxfGroup) int() int {
+	i, _ := strconv.Atoi(strings.TrimSpace(g.value))
+	return i
+}
+
+type dxfLayer struct {
+	zindex     int
+	color      color.RGBA
+	lineweight int
+}
+
+type dxfParser struct {
+	scale      float64 // to millimeters
+	origin     Point
+	layers     map[string]*dxfLayer
+	styles     map[string]string // text style to font name
+	fonts      map[string]*FontFamily
+	layerNames []string
+}
+
+// dxfUnits are the scale factors to millimeters of the $INSUNITS header variable.
+var dxfUnits = map[int]float64{
+	1:  25.4,    // inches
+	2:  304.8,   // feet
+	4:  1.0,     // millimeters
+	5:  10.0,    // centimeters
+	6:  1000.0,  // meters
+	8:  25.4e-6, // microinches
+	9:  0.0254,  // mils
+	10: 914.4,   // yards
+	13: 1e-3,    // microns
+	14: 100.0,   // decimeters
+}
+
+// dxfColors are the first nine colors of the AutoCAD Color Index, where 7 is black on a white background.
+var dxfColors = []color.RGBA{
+	{0, 0, 0, 255},
+	{255, 0, 0, 255},
+	{255, 255, 0, 255},
+	{0, 255, 0, 255},
+	{0, 255, 255, 255},
+	{0, 0, 255, 255},
+	{255, 0, 255, 255},
+	{0, 0, 0, 255},
+	{128, 128, 128, 255},
+	{192, 192, 192, 255},
+}
+
+// ParseDXF parses an AutoCAD DXF file and returns a canvas. Supported entities are LINE, LWPOLYLINE, POLYLINE, CIRCLE, ARC, ELLIPSE, SPLINE, HATCH, TEXT, and MTEXT, other entities such as block references are skipped. Layers are mapped to z-indices, either by their name if it is an integer or by their order in the layer table. Text requires the fonts of the text styles to be installed on the system.
+func ParseDXF(r io.Reader) (*Canvas, error) {
+	groups, err := readDXFGroups(r)
+	if err != nil {
+		return nil, err
+	}
+
+	dxf := &dxfParser{
+		scale:  1.0,
+		layers: map[string]*dxfLayer{},
+		styles: map[string]string{},
+		fonts:  map[string]*FontFamily{},
+	}
+
+	// split in sections
+	var header, tables, entities []dxfGroup
+	for i := 0; i+1 < len(groups); i++ {
+		if groups[i].code == 0 && groups[i].value == "SECTION" && groups[i+1].code == 2 {
+			j := i + 2
+			for j < len(groups) && !(groups[j].code == 0 && groups[j].value == "ENDSEC") {
+				j++
+			}
+			switch groups[i+1].value {
+			case "HEADER":
+				header = groups[i+2 : j]
+			case "TABLES":
+				tables = groups[i+2 : j]
+			case "ENTITIES":
+				entities = groups[i+2 : j]
+			}
+			i = j
+		}
+	}
+
+	extMin, extMax, hasExtents := dxf.parseHeader(header)
+	dxf.parseTables(tables)
+
+	c := New(0.0, 0.0)
+	if hasExtents && extMin.X < extMax.X && extMin.Y < extMax.Y {
+		c = New((extMax.X-extMin.X)*dxf.scale, (extMax.Y-extMin.Y)*dxf.scale)
+		dxf.origin = extMin
+	}
+	ctx := NewContext(c)
+
+	for _, entity := range splitDXFEntities(entities) {
+		if err := dxf.drawEntity(ctx, entity); err != nil {
+			return nil, err
+		}
+	}
+	if c.W == 0.0 || c.H == 0.0 {
+		c.Fit(0.0)
+	}
+	return c, nil
+}
+
+func readDXFGroups(r io.Reader) ([]dxfGroup, error) {
+	groups := []dxfGroup{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		code, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("bad DXF group code '%s'", line)
+		} else if !scanner.Scan() {
+			return nil, fmt.Errorf("unexpected end of DXF file")
+		}
+		groups = append(groups, dxfGroup{code, strings.TrimRight(scanner.Text(), "\r")})
+		if code == 0 && groups[len(groups)-1].value == "EOF" {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	} else if len(groups) == 0 {
+		return nil, fmt.Errorf("empty DXF file")
+	}
+	for i := range groups {
+		if groups[i].code == 0 || groups[i].code == 2 {
+			groups[i].value = strings.TrimSpace(groups[i].value)
+		}
+	}
+	return groups, nil
+}
+
+// splitDXFEntities splits the groups by entity, where POLYLINE entities include their VERTEX entities.
+func splitDXFEntities(groups []dxfGroup) [][]dxfGroup {
+	entities := [][]dxfGroup{}
+	for i := 0; i < len(groups); {
+		j := i + 1
+		for j < len(groups) && groups[j].code != 0 {
+			j++
+		}
+		if groups[i].code == 0 && groups[i].value == "POLYLINE" {
+			for j < len(groups) && !(groups[j].code == 0 && groups[j].value == "SEQEND") {
+				j++
+			}
+		}
+		if groups[i].code == 0 {
+			entities = append(entities, groups[i:j])
+		}
+		i = j
+		if i < len(groups) && groups[i].value == "SEQEND" {
+			i++
+			for i < len(groups) && groups[i].code != 0 {
+				i++
+			}
+		}
+	}
+	return entities
+}
+
+func (dxf *dxfParser) parseHeader(groups []dxfGroup) (Point, Point, bool) {
+	var extMin, extMax Point
+	hasMin, hasMax := false, false
+	for i := 0; i < len(groups); i++ {
+		if groups[i].code != 9 {
+			continue
+		}
+		switch groups[i].value {
+		case "$INSUNITS":
+			if i+1 < len(groups) {
+				if scale, ok := dxfUnits[groups[i+1].int()]; ok {
+					dxf.scale = scale
+				}
+			}
+		case "$EXTMIN":
+			extMin, hasMin = dxfPoint(groups[i+1:], 10), true
+		case "$EXTMAX":
+			extMax, hasMax = dxfPoint(groups[i+1:], 10), true
+		}
+	}
+	return extMin, extMax, hasMin && hasMax
+}
+
+func (dxf *dxfParser) parseTables(groups []dxfGroup) {
+	for _, entry := range splitDXFEntities(groups) {
+		switch entry[0].value {
+		case "LAYER":
+			name := ""
+			for _, g := range entry[1:] {
+				if g.code == 2 {
+					name = g.value
+					break
+				}
+			}
+			layer := dxf.layer(name)
+			for _, g := range entry[1:] {
+				switch g.code {
+				case 62:
+					layer.color = dxfACIColor(g.int())
+				case 420:
+					layer.color = dxfTrueColor(g.int())
+				case 370:
+					layer.lineweight = g.int()
+				}
+			}
+		case "STYLE":
+			name, font := "", ""
+			for _, g := range entry[1:] {
+				switch g.code {
+				case 2:
+					name = g.value
+				case 3:
+					font = g.value
+				}
+			}
+			if i := strings.LastIndexByte(font, '.'); i != -1 {
+				font = font[:i]
+			}
+			dxf.styles[name] = font
+		}
+	}
+}
+
+func (dxf *dxfParser) layer(name string) *dxfLayer {
+	layer, ok := dxf.layers[name]
+	if !ok {
+		layer = &dxfLayer{color: Black, lineweight: -3}
+		if zindex, err := strconv.Atoi(name); err == nil {
+			layer.zindex = zindex
+		} else {
+			layer.zindex = len(dxf.layerNames)
+		}
+		dxf.layers[name] = layer
+		dxf.layerNames = append(dxf.layerNames, name)
+	}
+	return layer
+}
+
+// point converts a point in drawing units to the canvas.
+func (dxf *dxfParser) point(p Point) Point {
+	return p.Sub(dxf.origin).Mul(dxf.scale)
+}
+
+func (dxf *dxfParser) drawEntity(ctx *Context, groups []dxfGroup) error {
+	// common properties
+	layer := dxf.layer("0")
+	col, hasColor := color.RGBA{}, false
+	alpha := uint8(255)
+	lineweight := -1
+	for _, g := range groups[1:] {
+		switch g.code {
+		case 8:
+			layer = dxf.layer(g.value)
+		case 62:
+			if i := g.int(); i != 256 {
+				col, hasColor = dxfACIColor(i), true
+			}
+		case 420:
+			col, hasColor = dxfTrueColor(g.int()), true
+		case 440:
+			if v := g.int(); v&0x02000000 != 0 {
+				alpha = uint8(v & 0xff)
+			}
+		case 370:
+			lineweight = g.int()
+		}
+		if g.code == 100 && g.value != "AcDbEntity" {
+			break // entity specific groups follow
+		}
+	}
+	if !hasColor {
+		col = layer.color
+	}
+	if alpha != 255 {
+		col = RGBA(col.R, col.G, col.B, float64(alpha)/255.0)
+	}
+	if lineweight == -1 {
+		lineweight = layer.lineweight
+	}
+	strokeWidth := 0.25 // default lineweight
+	if 0 <= lineweight {
+		strokeWidth = float64(lineweight) / 100.0
+	}
+
+	ctx.SetZIndex(layer.zindex)
+	ctx.ResetStyle()
+	ctx.SetFill(Transparent)
+	ctx.SetStrokeColor(col)
+	ctx.SetStrokeWidth(strokeWidth)
+	ctx.SetStrokeCapper(RoundCap)
+	ctx.SetStrokeJoiner(RoundJoin)
+
+	p := &Path{}
+	switch groups[0].value {
+	case "LINE":
+		p0, p1 := dxf.point(dxfPoint(groups, 10)), dxf.point(dxfPoint(groups, 11))
+		p.MoveTo(p0.X, p0.Y)
+		p.LineTo(p1.X, p1.Y)
+	case "LWPOLYLINE":
+		vertices := []dxfVertex{}
+		closed := false
+		for _, g := range groups {
+			switch g.code {
+			case 10:
+				vertices = append(vertices, dxfVertex{Point: Point{g.float(), 0.0}})
+			case 20:
+				if 0 < len(vertices) {
+					vertices[len(vertices)-1].Y = g.float()
+				}
+			case 42:
+				if 0 < len(vertices) {
+					vertices[len(vertices)-1].bulge = g.float()
+				}
+			case 43:
+				if width := g.float() * dxf.scale; 0.0 < width {
+					ctx.SetStrokeWidth(width)
+				}
+			case 70:
+				closed = g.int()&1 != 0
+			}
+		}
+		p = dxf.polyline(vertices, closed)
+	case "POLYLINE":
+		vertices := []dxfVertex{}
+		closed := false
+		for _, entity := range splitDXFEntities(groups) {
+			if entity[0].value == "POLYLINE" {
+				for _, g := range entity {
+					if g.code == 70 {
+						closed = g.int()&1 != 0
+					}
+				}
+			} else if entity[0].value == "VERTEX" {
+				v := dxfVertex{Point: dxfPoint(entity, 10)}
+				for _, g := range entity {
+					if g.code == 42 {
+						v.bulge = g.float()
+					}
+				}
+				vertices = append(vertices, v)
+			}
+		}
+		p = dxf.polyline(vertices, closed)
+	case "CIRCLE":
+		center := dxf.point(dxfPoint(groups, 10))
+		radius := dxfFloat(groups, 40) * dxf.scale
+		p = Circle(radius).Translate(center.X, center.Y)
+	case "ARC":
+		center := dxf.point(dxfPoint(groups, 10))
+		radius := dxfFloat(groups, 40) * dxf.scale
+		theta0, theta1 := dxfFloat(groups, 50), dxfFloat(groups, 51)
+		for theta1 <= theta0 {
+			theta1 += 360.0
+		}
+		start := EllipsePos(radius, radius, 0.0, center.X, center.Y, theta0*math.Pi/180.0)
+		p.MoveTo(start.X, start.Y)
+		p.Arc(radius, radius, 0.0, theta0, theta1)
+	case "ELLIPSE":
+		center := dxf.point(dxfPoint(groups, 10))
+		major := dxfPoint(groups, 11).Mul(dxf.scale)
+		rx := major.Length()
+		ry := rx * dxfFloat(groups, 40)
+		phi := major.Angle()
+		theta0, theta1 := dxfFloat(groups, 41), dxfFloat(groups, 42)
+		for theta1 <= theta0 {
+			theta1 += 2.0 * math.Pi
+		}
+		start := EllipsePos(rx, ry, phi, center.X, center.Y, theta0)
+		p.MoveTo(start.X, start.Y)
+		p.Arc(rx, ry, phi*180.0/math.Pi, theta0*180.0/math.Pi, theta1*180.0/math.Pi)
+		if Equal(theta1-theta0, 2.0*math.Pi) {
+			p.Close()
+		}
+	case "SPLINE":
+		degree, closed := 3, false
+		knots, points := []float64{}, []Point{}
+		for _, g := range groups {
+			switch g.code {
+			case 70:
+				closed = g.int()&1 != 0
+			case 71:
+				degree = g.int()
+			case 40:
+				knots = append(knots, g.float())
+			case 10:
+				points = append(points, Point{g.float(), 0.0})
+			case 20:
+				if 0 < len(points) {
+					points[len(points)-1].Y = g.float()
+				}
+			}
+		}
+		for i := range points {
+			points[i] = dxf.point(points[i])
+		}
+		p = dxfSpline(degree, knots, points)
+		if closed {
+			p.Close()
+		}
+	case "HATCH":
+		var err error
+		if p, err = dxf.hatch(groups); err != nil {
+			return err
+		}
+		ctx.SetFillColor(col)
+		ctx.SetStroke(Transparent)
+		ctx.SetFillRule(EvenOdd)
+	case "TEXT", "MTEXT":
+		return dxf.drawText(ctx, groups, col)
+	default:
+		return nil // unsupported entity
+	}
+	if !p.Empty() {
+		ctx.DrawPath(0.0, 0.0, p)
+	}
+	return nil
+}
+
+type dxfVertex struct {
+	Point
+	bulge float64
+}
+
+// polyline returns the path of polyline vertices, where the bulge is the tangent of a quarter of the included angle of the arc to the next vertex.
+func (dxf *dxfParser) polyline(vertices []dxfVertex, closed bool) *Path {
+	p := &Path{}
+	if len(vertices) == 0 {
+		return p
+	}
+	for i := range vertices {
+		vertices[i].Point = dxf.point(vertices[i].Point)
+	}
+	p.MoveTo(vertices[0].X, vertices[0].Y)
+	n := len(vertices)
+	if !closed {
+		n--
+	}
+	for i := 0; i < n; i++ {
+		v0, v1 := vertices[i], vertices[(i+1)%len(vertices)]
+		if v0.bulge == 0.0 || v0.Point.Equals(v1.Point) {
+			p.LineTo(v1.X, v1.Y)
+		} else {
+			theta := 4.0 * math.Atan(math.Abs(v0.bulge))
+			radius := v1.Sub(v0.Point).Length() / (2.0 * math.Sin(theta/2.0))
+			p.ArcTo(radius, radius, 0.0, math.Pi < theta, 0.0 < v0.bulge, v1.X, v1.Y)
+		}
+	}
+	if closed {
+		p.Close()
+	}
+	return p
+}
+
+// hatch returns the boundary path of a HATCH entity. Counts of loops, edges, vertices, knots, and control points are bounded by the number of remaining groups, as each item takes at least one group.
+func (dxf *dxfParser) hatch(groups []dxfGroup) (*Path, error) {
+	p := &Path{}
+	i := 0
+	next := func(code int) (dxfGroup, bool) {
+		for i < len(groups) {
+			g := groups[i]
+			i++
+			if g.code == code {
+				return g, true
+			}
+		}
+		return dxfGroup{}, false
+	}
+	nextPoint := func(code int) Point {
+		x, _ := next(code)
+		y, _ := next(code + 10)
+		return Point{x.float(), y.float()}
+	}
+	count := func(code int) (int, error) {
+		g, _ := next(code)
+		n := g.int()
+		if n < 0 || len(groups)-i < n {
+			return 0, fmt.Errorf("bad DXF hatch count %d for group code %d", n, code)
+		}
+		return n, nil
+	}
+
+	loops, err := count(91)
+	if err != nil {
+		return nil, err
+	}
+	for l := 0; l < loops; l++ {
+		flags, _ := next(92)
+		if flags.int()&2 != 0 {
+			// polyline
+			hasBulge, _ := next(72)
+			next(73)
+			n, err := count(93)
+			if err != nil {
+				return nil, err
+			}
+			vertices := make([]dxfVertex, n)
+			for k := range vertices {
+				vertices[k].Point = nextPoint(10)
+				if hasBulge.int() != 0 {
+					bulge, _ := next(42)
+					vertices[k].bulge = bulge.float()
+				}
+			}
+			p = p.Append(dxf.polyline(vertices, true))
+		} else {
+			n, err := count(93)
+			if err != nil {
+				return nil, err
+			}
+			loop := &Path{}
+			for e := 0; e < n; e++ {
+				typ, _ := next(72)
+				var edge *Path
+				switch typ.int() {
+				case 1: // line
+					p0, p1 := dxf.point(nextPoint(10)), dxf.point(nextPoint(11))
+					edge = &Path{}
+					edge.MoveTo(p0.X, p0.Y)
+					edge.LineTo(p1.X, p1.Y)
+				case 2: // circular arc
+					center := dxf.point(nextPoint(10))
+					r, _ := next(40)
+					a0, _ := next(50)
+					a1, _ := next(51)
+					ccw, _ := next(73)
+					edge = dxfArc(center, r.float()*dxf.scale, r.float()*dxf.scale, 0.0, a0.float(), a1.float(), ccw.int() != 0)
+				case 3: // elliptic arc
+					center := dxf.point(nextPoint(10))
+					major := nextPoint(11).Mul(dxf.scale)
+					ratio, _ := next(40)
+					a0, _ := next(50)
+					a1, _ := next(51)
+					ccw, _ := next(73)
+					rx := major.Length()
+					edge = dxfArc(center, rx, rx*ratio.float(), major.Angle()*180.0/math.Pi, a0.float(), a1.float(), ccw.int() != 0)
+				case 4: // spline
+					degree, _ := next(94)
+					nKnots, err := count(95)
+					if err != nil {
+						return nil, err
+					}
+					nPoints, err := count(96)
+					if err != nil {
+						return nil, err
+					}
+					knots := make([]float64, nKnots)
+					for k := range knots {
+						knot, _ := next(40)
+						knots[k] = knot.float()
+					}
+					points := make([]Point, nPoints)
+					for k := range points {
+						points[k] = dxf.point(nextPoint(10))
+					}
+					edge = dxfSpline(degree.int(), knots, points)
+				default:
+					continue
+				}
+				if loop.Empty() {
+					loop = edge
+				} else {
+					loop = loop.Join(edge)
+				}
+			}
+			if !loop.Empty() {
+				loop.Close()
+				p = p.Append(loop)
+			}
+		}
+		// skip source boundary objects
+		if n, ok := next(97); ok {
+			for k := 0; k < n.int() && i < len(groups); k++ {
+				next(330)
+			}
+		}
+	}
+	return p, nil
+}
+
+// dxfArc returns an elliptical arc between two angles in degrees, where clockwise arcs have their angles negated.
+func dxfArc(center Point, rx, ry, rot, theta0, theta1 float64, ccw bool) *Path {
+	if !ccw {
+		theta0, theta1 = -theta0, -theta1
+		for theta0 <= theta1 {
+			theta1 -= 360.0
+		}
+	} else {
+		for theta1 <= theta0 {
+			theta1 += 360.0
+		}
+	}
+	start := EllipsePos(rx, ry, rot*math.Pi/180.0, center.X, center.Y, theta0*math.Pi/180.0)
+	p := &Path{}
+	p.MoveTo(start.X, start.Y)
+	p.Arc(rx, ry, rot, theta0, theta1)
+	return p
+}
+
+// dxfSpline returns the path of a non-rational B-spline. Cubic splines in Bézier form are converted exactly, others are sampled.
+func dxfSpline(degree int, knots []float64, points []Point) *Path {
+	p := &Path{}
+	if len(points) < 2 || degree < 1 || len(knots) != len(points)+degree+1 {
+		return p
+	}
+
+	p.MoveTo(points[0].X, points[0].Y)
+	if degree == 1 {
+		for _, pt := range points[1:] {
+			p.LineTo(pt.X, pt.Y)
+		}
+		return p
+	} else if degree == 3 && (len(points)-1)%3 == 0 {
+		// check if knots are clamped and interior knots have multiplicity 3
+		n := len(knots)
+		bezier := knots[0] == knots[3] && knots[n-4] == knots[n-1]
+		for i := 4; i+4 < n && bezier; i += 3 {
+			bezier = knots[i] == knots[i+1] && knots[i] == knots[i+2]
+		}
+		if bezier {
+			for i := 1; i+2 < len(points); i += 3 {
+				p.CubeTo(points[i].X, points[i].Y, points[i+1].X, points[i+1].Y, points[i+2].X, points[i+2].Y)
+			}
+			return p
+		}
+	}
+
+	// sample using de Boor's algorithm
+	const samples = 16
+	t0, t1 := knots[degree], knots[len(knots)-degree-1]
+	for k := degree; k < len(knots)-degree-1; k++ {
+		if knots[k] == knots[k+1] {
+			continue
+		}
+		for s := 1; s <= samples; s++ {
+			t := knots[k] + (knots[k+1]-knots[k])*float64(s)/samples
+			if t1 < t {
+				t = t1
+			} else if t < t0 {
+				t = t0
+			}
+			pt := deBoor(k, t, degree, knots, points)
+			p.LineTo(pt.X, pt.Y)
+		}
+	}
+	return p
+}
+
+func deBoor(k int, t float64, degree int, knots []float64, points []Point) Point {
+	d := make([]Point, degree+1)
+	copy(d, points[k-degree:k+1])
+	for r := 1; r <= degree; r++ {
+		for j := degree; r <= j; j-- {
+			denom := knots[j+1+k-r] - knots[j+k-degree]
+			alpha := 0.0
+			if denom != 0.0 {
+				alpha = (t - knots[j+k-degree]) / denom
+			}
+			d[j] = d[j-1].Mul(1.0 - alpha).Add(d[j].Mul(alpha))
+		}
+	}
+	return d[degree]
+}
+
+// font returns the font family by name, or the sans-serif family if it cannot be loaded, which is common for SHX fonts. It returns nil if neither can be loaded.
+func (dxf *dxfParser) font(name string) *FontFamily {
+	family, ok := dxf.fonts[name]
+	if !ok {
+		family = NewFontFamily(name)
+		if err := family.LoadSystemFont(name, FontRegular); err != nil {
+			family = nil
+			if name != "sans-serif" {
+				family = dxf.font("sans-serif")
+			}
+		}
+		dxf.fonts[name] = family
+	}
+	return family
+}
+
+func (dxf *dxfParser) drawText(ctx *Context, groups []dxfGroup, col color.RGBA) error {
+	isMText := groups[0].value == "MTEXT"
+	pos := dxfPoint(groups, 10)
+	height := dxfFloat(groups, 40) * dxf.scale
+	rotation := dxfFloat(groups, 50)
+	style := "STANDARD"
+	s := ""
+	align := Left
+	valign := 0 // baseline, top, middle, bottom
+	hasAlignPoint := false
+	for _, g := range groups {
+		switch g.code {
+		case 1:
+			s += g.value
+		case 3:
+			if isMText {
+				s += g.value // chunks of 250 characters that precede group code 1
+			}
+		case 7:
+			style = g.value
+		case 11:
+			if isMText {
+				dir := dxfPoint(groups, 11)
+				rotation = dir.Angle() * 180.0 / math.Pi
+			} else {
+				hasAlignPoint = true
+			}
+		case 71:
+			if isMText {
+				// attachment point
+				switch (g.int() - 1) % 3 {
+				case 1:
+					align = Center
+				case 2:
+					align = Right
+				}
+				switch (g.int() - 1) / 3 {
+				case 0:
+					valign = 1
+				case 1:
+					valign = 2
+				case 2:
+					valign = 3
+				}
+			}
+		case 72:
+			if !isMText {
+				switch g.int() {
+				case 1, 4:
+					align = Center
+				case 2:
+					align = Right
+				}
+			}
+		}
+	}
+	if hasAlignPoint && align != Left {
+		pos = dxfPoint(groups, 11)
+	}
+	if isMText {
+		s = dxfMTextReplacer.Replace(s)
+	}
+	if s == "" || height == 0.0 {
+		return nil
+	}
+
+	fontName := dxf.styles[style]
+	if fontName == "" || fontName == "txt" {
+		fontName = "sans-serif"
+	}
+	family := dxf.font(fontName)
+	if family == nil {
+		return nil // no font available to draw the text
+	}
+
+	// the text height is the cap height
+	face := family.Face(ptPerMm, col)
+	if capHeight := face.Metrics().CapHeight; 0.0 < capHeight {
+		face = family.Face(ptPerMm*height/capHeight, col)
+	}
+
+	text := NewTextLine(face, s, align)
+	pos = dxf.point(pos)
+	ctx.SetView(Identity.Rotate(rotation))
+	y := 0.0
+	if isMText {
+		// position relative to the first line's baseline
+		lines := float64(strings.Count(s, "\n") + 1)
+		metrics := face.Metrics()
+		switch valign {
+		case 1:
+			y = -metrics.Ascent
+		case 2:
+			y = (metrics.LineHeight*(lines-1) - metrics.Ascent + metrics.Descent) / 2.0
+		case 3:
+			y = metrics.LineHeight*(lines-1) + metrics.Descent
+		}
+	}
+	ctx.DrawText(pos.X, pos.Y+y, text)
+	ctx.ResetView()
+	return nil
+}
+
+var dxfMTextReplacer = strings.NewReplacer(`\P`, "\n", `\~`, " ", `\\`, `\`, `\{`, "{", `\}`, "}", "{", "", "}", "")
+
+func dxfPoint(groups []dxfGroup, code int) Point {
+	p := Point{}
+	hasX := false
+	for _, g := range groups {
+		if g.code == code && !hasX {
+			p.X, hasX = g.float(), true
+		} else if g.code == code+10 && hasX {
+			p.Y = g.float()
+			break
+		}
+	}
+	return p
+}
+
+func dxfFloat(groups []dxfGroup, code int) float64 {
+	for _, g := range groups {
+		if g.code == code {
+			return g.float()
+		}
+	}
+	return 0.0
+}
+
+func dxfACIColor(i int) color.RGBA {
+	if i < 0 {
+		i = -i // layer is off
+	}
+	if i < len(dxfColors) {
+		return dxfColors[i]
+	}
+	return Black
+}
+
+func dxfTrueColor(i int) color.RGBA {
+	return color.RGBA{uint8(i >> 16), uint8(i >> 8), uint8(i), 255}
+}
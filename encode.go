@@ -0,0 +1,987 @@
+package canvas
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/tdewolff/canvas/font"
+	canvasText "github.com/tdewolff/canvas/text"
+)
+
+// EncodingVersion is the version of the serialization format written by Encode and EncodeJSON. Decode accepts any version up to and including this one.
+const EncodingVersion = 2
+
+// encodingMagic is the header of the binary serialization format, followed by a big-endian uint16 version number.
+var encodingMagic = []byte("CNVS")
+
+type encodedFile struct {
+	Version  int
+	Fonts    []encodedFont     `json:",omitempty"`
+	FontData map[string][]byte `json:",omitempty"` // by content hash
+	Faces    []encodedFace     `json:",omitempty"`
+	Canvas   encodedCanvas
+}
+
+type encodedFont struct {
+	Hash       string
+	Name       string
+	Style      FontStyle
+	Variations string `json:",omitempty"`
+	Features   string `json:",omitempty"`
+}
+
+type encodedFace struct {
+	Font       int
+	Size       float64
+	Style      FontStyle
+	Variant    FontVariant
+	Fill       encodedPaint
+	Deco       []string `json:",omitempty"`
+	Hinting    font.Hinting
+	FauxBold   float64
+	FauxItalic float64
+	XOffset    int32
+	YOffset    int32
+	Language   string
+	Script     canvasText.Script
+	Direction  canvasText.Direction
+	MmPerEm    float64
+}
+
+type encodedCanvas struct {
+	W, H       float64
+	Layers     []encodedLayer
+	Groups     []encodedGroup `json:",omitempty"` // since version 2
+	Attributes []Attributes   `json:",omitempty"` // since version 2
+}
+
+type encodedLayer struct {
+	ZIndex int
+	M      Matrix
+	Path   []float64     `json:",omitempty"`
+	Style  *encodedStyle `json:",omitempty"` // set for paths
+	Text   *encodedText  `json:",omitempty"`
+	Image  *encodedImage `json:",omitempty"`
+	Group  int           `json:",omitempty"` // index+1 into Groups, zero if none
+	Attrs  int           `json:",omitempty"` // index+1 into Attributes, zero if none
+}
+
+// encodedGroup is a group pushed by a context, its parent is always encoded before the group itself.
+type encodedGroup struct {
+	Parent int `json:",omitempty"` // index+1 into Groups, zero if none
+	Attrs  int `json:",omitempty"` // index+1 into Attributes, zero if none
+	N      int
+}
+
+type encodedStyle struct {
+	Fill         encodedPaint
+	Stroke       encodedPaint
+	StrokeWidth  float64
+	StrokeCapper string
+	StrokeJoiner encodedJoiner
+	DashOffset   float64
+	Dashes       []float64 `json:",omitempty"`
+	FillRule     FillRule
+}
+
+type encodedPaint struct {
+	Color    color.RGBA
+	Gradient *encodedGradient `json:",omitempty"`
+}
+
+type encodedGradient struct {
+	Linear     bool
+	Start, End Point   // linear
+	C0, C1     Point   // radial
+	R0, R1     float64 // radial
+	Stops      Stops
+}
+
+type encodedJoiner struct {
+	Type      string
+	GapJoiner *encodedJoiner `json:",omitempty"`
+	Limit     *float64       `json:",omitempty"` // nil means NaN
+}
+
+type encodedText struct {
+	WritingMode     WritingMode
+	TextOrientation TextOrientation
+	Width, Height   float64
+	Text            string
+	Overflows       bool
+	Lines           []encodedLine
+}
+
+type encodedLine struct {
+	Y     float64
+	Spans []encodedSpan
+}
+
+type encodedSpan struct {
+	X         float64
+	Width     float64
+	Face      int
+	Text      string
+	Glyphs    []encodedGlyph `json:",omitempty"`
+	Direction canvasText.Direction
+	Rotation  canvasText.Rotation
+	Level     int
+	Objects   []encodedSpanObject `json:",omitempty"`
+}
+
+type encodedGlyph struct {
+	Size     float64
+	Script   canvasText.Script
+	Vertical bool
+	ID       uint16
+	Cluster  uint32
+	XAdvance int32
+	YAdvance int32
+	XOffset  int32
+	YOffset  int32
+	Text     rune
+}
+
+type encodedSpanObject struct {
+	Canvas        encodedCanvas
+	X, Y          float64
+	Width, Height float64
+	VAlign        VerticalAlign
+}
+
+type encodedImage struct {
+	Mimetype      string
+	Data          []byte
+	Encoded       bool          // image was a canvas.Image holding its original bytes
+	Interpolation Interpolation `json:",omitempty"`
+}
+
+////////////////////////////////////////////////////////////////
+
+// Encode writes the canvas in a compact binary format to w, which can be read back using Decode. Fonts are embedded once and referenced by their content hash. Groups and attributes are kept, but the layers of groups with filter effects are inlined. Hatch patterns are expanded into paths, other patterns and custom cappers, joiners, or font decorators cannot be encoded.
+func Encode(w io.Writer, c *Canvas) error {
+	file, err := newCanvasEncoder().encode(c)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, len(encodingMagic)+2)
+	copy(header, encodingMagic)
+	binary.BigEndian.PutUint16(header[len(encodingMagic):], uint16(file.Version))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(file)
+}
+
+// EncodeJSON writes the canvas in JSON format to w, which can be read back using Decode. It is the same as Encode but is human-readable, which helps debugging.
+func EncodeJSON(w io.Writer, c *Canvas) error {
+	file, err := newCanvasEncoder().encode(c)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(file)
+}
+
+// Decode reads a canvas that was written by either Encode or EncodeJSON.
+func Decode(r io.Reader) (*Canvas, error) {
+	br := bufio.NewReader(r)
+	file := &encodedFile{}
+	if magic, _ := br.Peek(len(encodingMagic)); bytes.Equal(magic, encodingMagic) {
+		header := make([]byte, len(encodingMagic)+2)
+		if _, err := io.ReadFull(br, header); err != nil {
+			return nil, err
+		} else if version := int(binary.BigEndian.Uint16(header[len(encodingMagic):])); EncodingVersion < version {
+			return nil, fmt.Errorf("unsupported canvas encoding version %d", version)
+		}
+		if err := gob.NewDecoder(br).Decode(file); err != nil {
+			return nil, err
+		}
+	} else if err := json.NewDecoder(br).Decode(file); err != nil {
+		return nil, err
+	}
+	if file.Version < 1 || EncodingVersion < file.Version {
+		return nil, fmt.Errorf("unsupported canvas encoding version %d", file.Version)
+	}
+	return newCanvasDecoder(file).decode()
+}
+
+////////////////////////////////////////////////////////////////
+
+type canvasEncoder struct {
+	file  *encodedFile
+	fonts map[*Font]int
+	faces map[*FontFace]int
+}
+
+func newCanvasEncoder() *canvasEncoder {
+	return &canvasEncoder{
+		file: &encodedFile{
+			Version:  EncodingVersion,
+			FontData: map[string][]byte{},
+		},
+		fonts: map[*Font]int{},
+		faces: map[*FontFace]int{},
+	}
+}
+
+func (enc *canvasEncoder) encode(c *Canvas) (*encodedFile, error) {
+	var err error
+	if enc.file.Canvas, err = enc.canvas(c); err != nil {
+		return nil, err
+	}
+	return enc.file, nil
+}
+
+func (enc *canvasEncoder) canvas(c *Canvas) (encodedCanvas, error) {
+	zindices := []int{}
+	for zindex := range c.layers {
+		zindices = append(zindices, zindex)
+	}
+	sort.Ints(zindices)
+
+	ec := encodedCanvas{W: c.W, H: c.H}
+	groups := map[*layerGroup]int{}
+	attrs := map[*Attributes]int{}
+	for _, zindex := range zindices {
+		for _, l := range c.layers[zindex] {
+			layers, err := enc.layer(l)
+			if err != nil {
+				return ec, err
+			}
+			group := encodeGroup(&ec, groups, attrs, l.node)
+			attr := encodeAttributes(&ec, attrs, l.attrs)
+			for _, el := range layers {
+				el.ZIndex = zindex
+				el.Group = group
+				el.Attrs = attr
+				ec.Layers = append(ec.Layers, el)
+			}
+		}
+	}
+	return ec, nil
+}
+
+// encodeGroup returns the index+1 of the group and adds it and its parents if they were not encoded before. Layers share the same groups and attributes, which must remain shared after decoding so that they are rendered in the same group.
+func encodeGroup(ec *encodedCanvas, groups map[*layerGroup]int, attrs map[*Attributes]int, node *layerGroup) int {
+	if node == nil {
+		return 0
+	} else if i, ok := groups[node]; ok {
+		return i
+	}
+	parent := encodeGroup(ec, groups, attrs, node.parent)
+	ec.Groups = append(ec.Groups, encodedGroup{
+		Parent: parent,
+		Attrs:  encodeAttributes(ec, attrs, node.attrs),
+		N:      node.n,
+	})
+	groups[node] = len(ec.Groups)
+	return len(ec.Groups)
+}
+
+func encodeAttributes(ec *encodedCanvas, attrs map[*Attributes]int, a *Attributes) int {
+	if a == nil {
+		return 0
+	} else if i, ok := attrs[a]; ok {
+		return i
+	}
+	ec.Attributes = append(ec.Attributes, *a)
+	attrs[a] = len(ec.Attributes)
+	return len(ec.Attributes)
+}
+
+func (enc *canvasEncoder) layer(l layer) ([]encodedLayer, error) {
+	if l.path != nil {
+		return enc.pathLayer(l.path, l.style, l.m)
+	} else if l.text != nil {
+		text, err := enc.text(l.text)
+		if err != nil {
+			return nil, err
+		}
+		return []encodedLayer{{M: l.m, Text: text}}, nil
+	} else if l.img != nil {
+		img, err := encodeImage(l.img)
+		if err != nil {
+			return nil, err
+		}
+		return []encodedLayer{{M: l.m, Image: img}}, nil
+	} else if l.group != nil {
+		// filter effects are not encoded, the layers of the group are inlined
+		layers := []encodedLayer{}
+		for _, zindex := range l.group.zindices() {
+			for _, gl := range l.group.layers[zindex] {
+				gl.m = l.m.Mul(gl.m)
+				els, err := enc.layer(gl)
+				if err != nil {
+					return nil, err
+				}
+				layers = append(layers, els...)
+			}
+		}
+		return layers, nil
+	}
+	return nil, nil
+}
+
+// pathLayer encodes a path layer. Hatch patterns are expanded into paths in the same way as the rasterizer does, so that fills and strokes may end up in separate layers.
+func (enc *canvasEncoder) pathLayer(path *Path, style Style, m Matrix) ([]encodedLayer, error) {
+	var fillHatch, strokeHatch *Path
+	fillHatchStyle, strokeHatchStyle := DefaultStyle, DefaultStyle
+	if hatch, ok := style.Fill.Pattern.(*HatchPattern); ok && style.HasFill() {
+		fillHatch = hatch.Tile(path.Transform(m))
+		fillHatchStyle.Fill = hatch.Fill
+		style.Fill = Paint{}
+	}
+	if hatch, ok := style.Stroke.Pattern.(*HatchPattern); ok && style.HasStroke() {
+		stroke := path
+		if style.IsDashed() {
+			stroke = stroke.Dash(style.DashOffset, style.Dashes...)
+		}
+		stroke = stroke.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner, Tolerance)
+		strokeHatch = hatch.Tile(stroke.Transform(m))
+		strokeHatchStyle.Fill = hatch.Fill
+		style.Stroke = Paint{}
+	}
+
+	layers := []encodedLayer{}
+	if fillHatch != nil {
+		l, err := enc.pathStyleLayer(fillHatch, fillHatchStyle, Identity)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+	if style.HasFill() || style.HasStroke() || fillHatch == nil && strokeHatch == nil {
+		l, err := enc.pathStyleLayer(path, style, m)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+	if strokeHatch != nil {
+		l, err := enc.pathStyleLayer(strokeHatch, strokeHatchStyle, Identity)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+func (enc *canvasEncoder) pathStyleLayer(path *Path, style Style, m Matrix) (encodedLayer, error) {
+	fill, err := encodePaint(style.Fill)
+	if err != nil {
+		return encodedLayer{}, err
+	}
+	stroke, err := encodePaint(style.Stroke)
+	if err != nil {
+		return encodedLayer{}, err
+	}
+	capper, err := encodeCapper(style.StrokeCapper)
+	if err != nil {
+		return encodedLayer{}, err
+	}
+	joiner, err := encodeJoiner(style.StrokeJoiner)
+	if err != nil {
+		return encodedLayer{}, err
+	}
+	return encodedLayer{
+		M:    m,
+		Path: path.d,
+		Style: &encodedStyle{
+			Fill:         fill,
+			Stroke:       stroke,
+			StrokeWidth:  style.StrokeWidth,
+			StrokeCapper: capper,
+			StrokeJoiner: joiner,
+			DashOffset:   style.DashOffset,
+			Dashes:       style.Dashes,
+			FillRule:     style.FillRule,
+		},
+	}, nil
+}
+
+func (enc *canvasEncoder) text(t *Text) (*encodedText, error) {
+	et := &encodedText{
+		WritingMode:     t.WritingMode,
+		TextOrientation: t.TextOrientation,
+		Width:           t.Width,
+		Height:          t.Height,
+		Text:            t.Text,
+		Overflows:       t.Overflows,
+	}
+	for _, line := range t.lines {
+		el := encodedLine{Y: line.y}
+		for _, span := range line.spans {
+			face, err := enc.face(span.Face)
+			if err != nil {
+				return nil, err
+			}
+			es := encodedSpan{
+				X:         span.X,
+				Width:     span.Width,
+				Face:      face,
+				Text:      span.Text,
+				Direction: span.Direction,
+				Rotation:  span.Rotation,
+				Level:     span.Level,
+			}
+			for _, glyph := range span.Glyphs {
+				es.Glyphs = append(es.Glyphs, encodedGlyph{
+					Size:     glyph.Size,
+					Script:   glyph.Script,
+					Vertical: glyph.Vertical,
+					ID:       glyph.ID,
+					Cluster:  glyph.Cluster,
+					XAdvance: glyph.XAdvance,
+					YAdvance: glyph.YAdvance,
+					XOffset:  glyph.XOffset,
+					YOffset:  glyph.YOffset,
+					Text:     glyph.Text,
+				})
+			}
+			for _, obj := range span.Objects {
+				c, err := enc.canvas(obj.Canvas)
+				if err != nil {
+					return nil, err
+				}
+				es.Objects = append(es.Objects, encodedSpanObject{
+					Canvas: c,
+					X:      obj.X,
+					Y:      obj.Y,
+					Width:  obj.Width,
+					Height: obj.Height,
+					VAlign: obj.VAlign,
+				})
+			}
+			el.Spans = append(el.Spans, es)
+		}
+		et.Lines = append(et.Lines, el)
+	}
+	return et, nil
+}
+
+func (enc *canvasEncoder) face(face *FontFace) (int, error) {
+	if i, ok := enc.faces[face]; ok {
+		return i, nil
+	}
+
+	fontIndex, ok := enc.fonts[face.Font]
+	if !ok {
+		hash := sha256.Sum256(face.Font.SFNT.Data)
+		key := hex.EncodeToString(hash[:])
+		enc.file.FontData[key] = face.Font.SFNT.Data
+		enc.file.Fonts = append(enc.file.Fonts, encodedFont{
+			Hash:       key,
+			Name:       face.Font.name,
+			Style:      face.Font.style,
+			Variations: face.Font.variations,
+			Features:   face.Font.features,
+		})
+		fontIndex = len(enc.file.Fonts) - 1
+		enc.fonts[face.Font] = fontIndex
+	}
+
+	fill, err := encodePaint(face.Fill)
+	if err != nil {
+		return 0, err
+	}
+	deco := []string{}
+	for _, d := range face.Deco {
+		var name string
+		var ok bool
+		if d != nil && reflect.TypeOf(d).Comparable() {
+			name, ok = decoratorNames[d] // map lookups panic for non-comparable keys
+		}
+		if !ok {
+			return 0, fmt.Errorf("unsupported font decorator %T", d)
+		}
+		deco = append(deco, name)
+	}
+	enc.file.Faces = append(enc.file.Faces, encodedFace{
+		Font:       fontIndex,
+		Size:       face.Size,
+		Style:      face.Style,
+		Variant:    face.Variant,
+		Fill:       fill,
+		Deco:       deco,
+		Hinting:    face.Hinting,
+		FauxBold:   face.FauxBold,
+		FauxItalic: face.FauxItalic,
+		XOffset:    face.XOffset,
+		YOffset:    face.YOffset,
+		Language:   face.Language,
+		Script:     face.Script,
+		Direction:  face.Direction,
+		MmPerEm:    face.MmPerEm,
+	})
+	enc.faces[face] = len(enc.file.Faces) - 1
+	return len(enc.file.Faces) - 1, nil
+}
+
+var decoratorNames = map[FontDecorator]string{
+	FontUnderline:         "Underline",
+	FontOverline:          "Overline",
+	FontStrikethrough:     "Strikethrough",
+	FontDoubleUnderline:   "DoubleUnderline",
+	FontDottedUnderline:   "DottedUnderline",
+	FontDashedUnderline:   "DashedUnderline",
+	FontWavyUnderline:     "WavyUnderline",
+	FontSineUnderline:     "SineUnderline",
+	FontSawtoothUnderline: "SawtoothUnderline",
+}
+
+func encodePaint(paint Paint) (encodedPaint, error) {
+	if paint.IsPattern() {
+		return encodedPaint{}, fmt.Errorf("unsupported pattern %T", paint.Pattern)
+	} else if paint.IsGradient() {
+		switch g := paint.Gradient.(type) {
+		case *LinearGradient:
+			return encodedPaint{Color: paint.Color, Gradient: &encodedGradient{
+				Linear: true,
+				Start:  g.Start,
+				End:    g.End,
+				Stops:  g.Stops,
+			}}, nil
+		case *RadialGradient:
+			return encodedPaint{Color: paint.Color, Gradient: &encodedGradient{
+				C0:    g.C0,
+				C1:    g.C1,
+				R0:    g.R0,
+				R1:    g.R1,
+				Stops: g.Stops,
+			}}, nil
+		}
+		return encodedPaint{}, fmt.Errorf("unsupported gradient %T", paint.Gradient)
+	}
+	return encodedPaint{Color: paint.Color}, nil
+}
+
+func encodeCapper(capper Capper) (string, error) {
+	switch capper.(type) {
+	case nil:
+		return "", nil
+	case ButtCapper:
+		return "Butt", nil
+	case RoundCapper:
+		return "Round", nil
+	case SquareCapper:
+		return "Square", nil
+	}
+	return "", fmt.Errorf("unsupported capper %T", capper)
+}
+
+func encodeJoiner(joiner Joiner) (encodedJoiner, error) {
+	var gapJoiner Joiner
+	var limit float64
+	ej := encodedJoiner{}
+	switch j := joiner.(type) {
+	case nil:
+		return ej, nil
+	case BevelJoiner:
+		ej.Type = "Bevel"
+		return ej, nil
+	case RoundJoiner:
+		ej.Type = "Round"
+		return ej, nil
+	case MiterJoiner:
+		ej.Type = "Miter"
+		gapJoiner, limit = j.GapJoiner, j.Limit
+	case ArcsJoiner:
+		ej.Type = "Arcs"
+		gapJoiner, limit = j.GapJoiner, j.Limit
+	default:
+		return ej, fmt.Errorf("unsupported joiner %T", joiner)
+	}
+
+	if gapJoiner != nil {
+		gap, err := encodeJoiner(gapJoiner)
+		if err != nil {
+			return ej, err
+		}
+		ej.GapJoiner = &gap
+	}
+	if !math.IsNaN(limit) {
+		ej.Limit = &limit
+	}
+	return ej, nil
+}
+
+func encodeImage(img image.Image) (*encodedImage, error) {
+	if cimg, ok := img.(Image); ok && 0 < len(cimg.Bytes) && (cimg.Mimetype == "image/png" || cimg.Mimetype == "image/jpeg" || cimg.Mimetype == "image/webp") {
+		return &encodedImage{
+			Mimetype:      cimg.Mimetype,
+			Data:          cimg.Bytes,
+			Encoded:       true,
+			Interpolation: cimg.Interpolation,
+		}, nil
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &encodedImage{
+		Mimetype:      "image/png",
+		Data:          buf.Bytes(),
+		Interpolation: ImageInterpolation(img),
+	}, nil
+}
+
+////////////////////////////////////////////////////////////////
+
+type canvasDecoder struct {
+	file  *encodedFile
+	fonts []*Font
+	faces []*FontFace
+}
+
+func newCanvasDecoder(file *encodedFile) *canvasDecoder {
+	return &canvasDecoder{
+		file: file,
+	}
+}
+
+func (dec *canvasDecoder) decode() (*Canvas, error) {
+	for _, ef := range dec.file.Fonts {
+		data, ok := dec.file.FontData[ef.Hash]
+		if !ok {
+			return nil, fmt.Errorf("missing data for font '%s'", ef.Name)
+		} else if hash := sha256.Sum256(data); hex.EncodeToString(hash[:]) != ef.Hash {
+			return nil, fmt.Errorf("bad content hash for font '%s'", ef.Name)
+		}
+		font, err := LoadFont(data, 0, ef.Style)
+		if err != nil {
+			return nil, err
+		}
+		font.name = ef.Name
+		font.variations = ef.Variations
+		font.features = ef.Features
+		dec.fonts = append(dec.fonts, font)
+	}
+
+	for _, ef := range dec.file.Faces {
+		if ef.Font < 0 || len(dec.fonts) <= ef.Font {
+			return nil, fmt.Errorf("bad font index %d", ef.Font)
+		}
+		fill, err := decodePaint(ef.Fill)
+		if err != nil {
+			return nil, err
+		}
+		var deco []FontDecorator
+		for _, name := range ef.Deco {
+			d, ok := decodeDecorator(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown font decorator '%s'", name)
+			}
+			deco = append(deco, d)
+		}
+		dec.faces = append(dec.faces, &FontFace{
+			Font:       dec.fonts[ef.Font],
+			Size:       ef.Size,
+			Style:      ef.Style,
+			Variant:    ef.Variant,
+			Fill:       fill,
+			Deco:       deco,
+			Hinting:    ef.Hinting,
+			FauxBold:   ef.FauxBold,
+			FauxItalic: ef.FauxItalic,
+			XOffset:    ef.XOffset,
+			YOffset:    ef.YOffset,
+			Language:   ef.Language,
+			Script:     ef.Script,
+			Direction:  ef.Direction,
+			MmPerEm:    ef.MmPerEm,
+		})
+	}
+	return dec.canvas(dec.file.Canvas)
+}
+
+func (dec *canvasDecoder) canvas(ec encodedCanvas) (*Canvas, error) {
+	c := New(ec.W, ec.H)
+	attrs := make([]*Attributes, len(ec.Attributes))
+	for i := range ec.Attributes {
+		attrs[i] = &ec.Attributes[i]
+	}
+	groups := make([]*layerGroup, len(ec.Groups))
+	for i, eg := range ec.Groups {
+		if eg.Parent < 0 || i < eg.Parent {
+			return nil, fmt.Errorf("bad group index %d", eg.Parent)
+		} else if eg.Attrs < 0 || len(attrs) < eg.Attrs {
+			return nil, fmt.Errorf("bad attributes index %d", eg.Attrs)
+		}
+		groups[i] = &layerGroup{n: eg.N}
+		if 0 < eg.Parent {
+			groups[i].parent = groups[eg.Parent-1]
+		}
+		if 0 < eg.Attrs {
+			groups[i].attrs = attrs[eg.Attrs-1]
+		}
+	}
+
+	for _, el := range ec.Layers {
+		l := layer{m: el.M}
+		if el.Group < 0 || len(groups) < el.Group {
+			return nil, fmt.Errorf("bad group index %d", el.Group)
+		} else if el.Attrs < 0 || len(attrs) < el.Attrs {
+			return nil, fmt.Errorf("bad attributes index %d", el.Attrs)
+		}
+		if 0 < el.Group {
+			l.node = groups[el.Group-1]
+		}
+		if 0 < el.Attrs {
+			l.attrs = attrs[el.Attrs-1]
+		}
+		if el.Style != nil {
+			path, err := decodePath(el.Path)
+			if err != nil {
+				return nil, err
+			}
+			style, err := decodeStyle(*el.Style)
+			if err != nil {
+				return nil, err
+			}
+			l.path = path
+			l.style = style
+		} else if el.Text != nil {
+			text, err := dec.text(el.Text)
+			if err != nil {
+				return nil, err
+			}
+			l.text = text
+		} else if el.Image != nil {
+			img, err := decodeImage(el.Image)
+			if err != nil {
+				return nil, err
+			}
+			l.img = img
+		} else {
+			return nil, fmt.Errorf("empty layer")
+		}
+		c.layers[el.ZIndex] = append(c.layers[el.ZIndex], l)
+	}
+	return c, nil
+}
+
+func (dec *canvasDecoder) text(et *encodedText) (*Text, error) {
+	t := &Text{
+		fonts:           map[*Font]bool{},
+		WritingMode:     et.WritingMode,
+		TextOrientation: et.TextOrientation,
+		Width:           et.Width,
+		Height:          et.Height,
+		Text:            et.Text,
+		Overflows:       et.Overflows,
+	}
+	for _, el := range et.Lines {
+		l := line{y: el.Y}
+		for _, es := range el.Spans {
+			if es.Face < 0 || len(dec.faces) <= es.Face {
+				return nil, fmt.Errorf("bad font face index %d", es.Face)
+			}
+			face := dec.faces[es.Face]
+			span := TextSpan{
+				X:         es.X,
+				Width:     es.Width,
+				Face:      face,
+				Text:      es.Text,
+				Direction: es.Direction,
+				Rotation:  es.Rotation,
+				Level:     es.Level,
+			}
+			for _, eg := range es.Glyphs {
+				span.Glyphs = append(span.Glyphs, canvasText.Glyph{
+					SFNT:     face.Font.SFNT,
+					Size:     eg.Size,
+					Script:   eg.Script,
+					Vertical: eg.Vertical,
+					ID:       eg.ID,
+					Cluster:  eg.Cluster,
+					XAdvance: eg.XAdvance,
+					YAdvance: eg.YAdvance,
+					XOffset:  eg.XOffset,
+					YOffset:  eg.YOffset,
+					Text:     eg.Text,
+				})
+			}
+			for _, eo := range es.Objects {
+				c, err := dec.canvas(eo.Canvas)
+				if err != nil {
+					return nil, err
+				}
+				span.Objects = append(span.Objects, TextSpanObject{
+					Canvas: c,
+					X:      eo.X,
+					Y:      eo.Y,
+					Width:  eo.Width,
+					Height: eo.Height,
+					VAlign: eo.VAlign,
+				})
+			}
+			t.fonts[face.Font] = true
+			l.spans = append(l.spans, span)
+		}
+		t.lines = append(t.lines, l)
+	}
+	return t, nil
+}
+
+func decodePath(d []float64) (*Path, error) {
+	for i := 0; i < len(d); {
+		cmd := d[i]
+		switch cmd {
+		case MoveToCmd, LineToCmd, QuadToCmd, CubeToCmd, ArcToCmd, CloseCmd:
+		default:
+			return nil, fmt.Errorf("bad path command %v", cmd)
+		}
+		n := cmdLen(cmd)
+		if len(d) < i+n || d[i+n-1] != cmd {
+			return nil, fmt.Errorf("bad path data")
+		}
+		i += n
+	}
+	return &Path{d}, nil
+}
+
+func decodeStyle(es encodedStyle) (Style, error) {
+	fill, err := decodePaint(es.Fill)
+	if err != nil {
+		return Style{}, err
+	}
+	stroke, err := decodePaint(es.Stroke)
+	if err != nil {
+		return Style{}, err
+	}
+	capper, err := decodeCapper(es.StrokeCapper)
+	if err != nil {
+		return Style{}, err
+	}
+	joiner, err := decodeJoiner(es.StrokeJoiner)
+	if err != nil {
+		return Style{}, err
+	}
+	dashes := es.Dashes
+	if dashes == nil {
+		dashes = []float64{}
+	}
+	return Style{
+		Fill:         fill,
+		Stroke:       stroke,
+		StrokeWidth:  es.StrokeWidth,
+		StrokeCapper: capper,
+		StrokeJoiner: joiner,
+		DashOffset:   es.DashOffset,
+		Dashes:       dashes,
+		FillRule:     es.FillRule,
+	}, nil
+}
+
+func decodePaint(ep encodedPaint) (Paint, error) {
+	paint := Paint{Color: ep.Color}
+	if eg := ep.Gradient; eg != nil {
+		if eg.Linear {
+			g := NewLinearGradient(eg.Start, eg.End)
+			g.Stops = eg.Stops
+			paint.Gradient = g
+		} else {
+			g := NewRadialGradient(eg.C0, eg.R0, eg.C1, eg.R1)
+			g.Stops = eg.Stops
+			paint.Gradient = g
+		}
+	}
+	return paint, nil
+}
+
+func decodeCapper(name string) (Capper, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "Butt":
+		return ButtCap, nil
+	case "Round":
+		return RoundCap, nil
+	case "Square":
+		return SquareCap, nil
+	}
+	return nil, fmt.Errorf("unknown capper '%s'", name)
+}
+
+func decodeJoiner(ej encodedJoiner) (Joiner, error) {
+	switch ej.Type {
+	case "":
+		return nil, nil
+	case "Bevel":
+		return BevelJoin, nil
+	case "Round":
+		return RoundJoin, nil
+	case "Miter", "Arcs":
+		var gapJoiner Joiner
+		if ej.GapJoiner != nil {
+			var err error
+			if gapJoiner, err = decodeJoiner(*ej.GapJoiner); err != nil {
+				return nil, err
+			}
+		}
+		limit := math.NaN()
+		if ej.Limit != nil {
+			limit = *ej.Limit
+		}
+		if ej.Type == "Miter" {
+			return MiterJoiner{gapJoiner, limit}, nil
+		}
+		return ArcsJoiner{gapJoiner, limit}, nil
+	}
+	return nil, fmt.Errorf("unknown joiner '%s'", ej.Type)
+}
+
+func decodeDecorator(name string) (FontDecorator, bool) {
+	for deco, decoName := range decoratorNames {
+		if decoName == name {
+			return deco, true
+		}
+	}
+	return nil, false
+}
+
+func decodeImage(ei *encodedImage) (image.Image, error) {
+	img, err := decodeImageData(ei)
+	if err != nil {
+		return nil, err
+	} else if ei.Interpolation != DefaultInterpolation {
+		img = WithInterpolation(img, ei.Interpolation)
+	}
+	return img, nil
+}
+
+func decodeImageData(ei *encodedImage) (image.Image, error) {
+	r := bytes.NewReader(ei.Data)
+	if ei.Encoded {
+		switch ei.Mimetype {
+		case "image/png":
+			return NewPNGImage(r)
+		case "image/jpeg":
+			return NewJPEGImage(r)
+		case "image/webp":
+			return NewWEBPImage(r)
+		}
+	} else if ei.Mimetype == "image/png" {
+		return png.Decode(r)
+	}
+	return nil, fmt.Errorf("unsupported image type '%s'", ei.Mimetype)
+}
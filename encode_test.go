@@ -0,0 +1,173 @@
+package canvas
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/tdewolff/test"
+)
+
+func newEncodeTestCanvas(t *testing.T) *Canvas {
+	family := NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular); err != nil {
+		test.Error(t, err)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, Black)
+	img.Set(1, 0, Red)
+	img.Set(0, 1, Green)
+	img.Set(1, 1, Black)
+
+	gradient := NewLinearGradient(Point{0.0, 0.0}, Point{10.0, 0.0})
+	gradient.Add(0.0, Red)
+	gradient.Add(1.0, Blue)
+
+	c := New(100, 100)
+	ctx := NewContext(c)
+	ctx.SetFillGradient(gradient)
+	ctx.SetStrokeColor(Gray)
+	ctx.SetStrokeJoiner(MiterClipJoin(RoundJoin, 3.0))
+	ctx.SetDashes(1.0, 2.0, 3.0)
+	ctx.DrawPath(10.0, 10.0, MustParseSVGPath("M0 0L10 0Q15 10 20 0C20 10 30 10 30 0A5 5 0 0 0 40 0z"))
+
+	ctx.SetZIndex(-1)
+	ctx.DrawText(30.0, 30.0, NewTextLine(family.Face(12.0, Black, FontRegular, FontNormal, FontUnderline), "Text\nline", Left))
+	ctx.DrawText(30.0, 50.0, NewTextLine(family.Face(10.0, Black, FontBold, FontNormal), "Bold", Left))
+
+	ctx.SetZIndex(1)
+	ctx.DrawImage(50.0, 50.0, img, 1.0)
+	return c
+}
+
+func TestEncode(t *testing.T) {
+	c := newEncodeTestCanvas(t)
+
+	var buf bytes.Buffer
+	test.Error(t, Encode(&buf, c))
+	c2, err := Decode(&buf)
+	test.Error(t, err)
+
+	test.T(t, c2.W, c.W)
+	test.T(t, c2.H, c.H)
+	test.T(t, len(c2.layers), 3)
+	test.T(t, len(c2.layers[0]), 1)
+	test.T(t, len(c2.layers[-1]), 2)
+	test.T(t, len(c2.layers[1]), 1)
+
+	l, l2 := c.layers[0][0], c2.layers[0][0]
+	test.T(t, l2.m, l.m)
+	test.T(t, l2.path.String(), l.path.String())
+	test.T(t, l2.style.Fill.Gradient, l.style.Fill.Gradient)
+	test.T(t, l2.style.Stroke.Color, l.style.Stroke.Color)
+	test.T(t, l2.style.StrokeJoiner, l.style.StrokeJoiner)
+	test.T(t, l2.style.Dashes, l.style.Dashes)
+
+	text, text2 := c.layers[-1][0].text, c2.layers[-1][0].text
+	test.T(t, text2.Text, text.Text)
+	test.T(t, len(text2.lines), len(text.lines))
+	test.T(t, text2.lines[1].spans[0].Glyphs[0].ID, text.lines[1].spans[0].Glyphs[0].ID)
+	test.T(t, text2.lines[0].spans[0].Face.Deco[0], FontUnderline)
+	test.T(t, text2.Fonts()[0].Name(), text.Fonts()[0].Name())
+
+	img := c2.layers[1][0].img
+	test.T(t, img.Bounds().Size(), image.Point{2, 2})
+	test.T(t, rgbaColor(img.At(1, 0)), Red)
+}
+
+func TestEncodeJSON(t *testing.T) {
+	c := newEncodeTestCanvas(t)
+
+	var buf bytes.Buffer
+	test.Error(t, EncodeJSON(&buf, c))
+	s := buf.String()
+	test.T(t, strings.Count(s, `"Hash"`), 1) // font embedded once
+	c2, err := Decode(&buf)
+	test.Error(t, err)
+
+	// round-trip is stable
+	var buf2 bytes.Buffer
+	test.Error(t, EncodeJSON(&buf2, c2))
+	test.String(t, buf2.String(), s)
+}
+
+func TestEncodeHatch(t *testing.T) {
+	c := New(100, 100)
+	ctx := NewContext(c)
+	ctx.SetFill(NewLineHatch(Black, 45.0, 2.0, 0.1))
+	ctx.SetStrokeColor(Red)
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+
+	var buf bytes.Buffer
+	test.Error(t, Encode(&buf, c))
+	c2, err := Decode(&buf)
+	test.Error(t, err)
+	test.T(t, len(c2.layers[0]), 2)
+	test.T(t, c2.layers[0][0].style.Fill.Color, Black)
+	test.T(t, c2.layers[0][1].style.HasFill(), false)
+	test.T(t, c2.layers[0][1].style.Stroke.Color, Red)
+}
+
+func TestEncodeGroups(t *testing.T) {
+	c := New(100, 100)
+	ctx := NewContext(c)
+	ctx.SetID("chart")
+	ctx.Push()
+	ctx.SetID("bar")
+	ctx.SetData("value", "5")
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.ResetAttributes()
+	ctx.SetZIndex(1)
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+	ctx.Pop()
+	ctx.DrawPath(0.0, 0.0, Rectangle(10.0, 10.0))
+
+	r := &groupRecorder{}
+	c.RenderTo(r)
+	ops := strings.Join(r.ops, ",")
+
+	for _, encode := range []Writer{Encode, EncodeJSON} {
+		var buf bytes.Buffer
+		test.Error(t, encode(&buf, c))
+		c2, err := Decode(&buf)
+		test.Error(t, err)
+		test.T(t, c2.layers[0][0].node.attrs.ID, "chart")
+		test.T(t, c2.layers[0][0].attrs.Data["value"], "5")
+
+		r2 := &groupRecorder{}
+		c2.RenderTo(r2)
+		test.String(t, strings.Join(r2.ops, ","), ops)
+	}
+
+	_, err := Decode(strings.NewReader(`{"Version":2,"Canvas":{"Groups":[{"Parent":1,"N":1}]}}`))
+	test.That(t, err != nil)
+}
+
+type sliceDecorator []float64
+
+func (d sliceDecorator) Decorate(face *FontFace, width float64) *Path {
+	return &Path{}
+}
+
+func TestEncodeDecorator(t *testing.T) {
+	family := NewFontFamily("dejavu-serif")
+	test.Error(t, family.LoadFontFile("resources/DejaVuSerif.ttf", FontRegular))
+
+	c := New(100, 100)
+	ctx := NewContext(c)
+	ctx.DrawText(0.0, 0.0, NewTextLine(family.Face(12.0, Black, FontRegular, FontNormal, sliceDecorator{1.0}), "Text", Left))
+
+	var buf bytes.Buffer
+	test.That(t, Encode(&buf, c) != nil, "non-comparable decorator must give an error")
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, err := Decode(strings.NewReader(`{"Version":3}`))
+	test.That(t, err != nil)
+
+	_, err = Decode(strings.NewReader(`{"Version":1,"Canvas":{"Layers":[{"Path":[2,0,0],"Style":{}}]}}`))
+	test.That(t, err != nil)
+}
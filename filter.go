@@ -0,0 +1,187 @@
+package canvas
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+)
+
+// Filter inputs that refer to the group that the filter applies to, see FilterPrimitive.
+const (
+	SourceGraphic = "SourceGraphic" // the group as drawn
+	SourceAlpha   = "SourceAlpha"   // the alpha channel of the group as drawn, with black color
+)
+
+// Filter is a filter effect that is applied to a group of layers, such as a drop shadow. It consists of a chain of primitives as in SVG, the result of the last primitive is drawn instead of the group. Lengths are in millimeters in the coordinate system of the group, with the y-axis pointing upwards. Filter effects are rendered natively by the SVG renderer, are rasterized by the rasterizer and the PDF renderer, and are ignored by other renderers.
+type Filter struct {
+	Primitives []FilterPrimitive
+}
+
+// FilterPrimitive is a primitive of a filter with its inputs, which refer to SourceGraphic, SourceAlpha, or to the Result name of a previous primitive. An empty input refers to the result of the previous primitive, or to SourceGraphic for the first primitive.
+type FilterPrimitive struct {
+	In, In2 string
+	Result  string
+	Effect  FilterEffect
+}
+
+// FilterEffect is the operation of a filter primitive, which is one of GaussianBlurEffect, OffsetEffect, FloodEffect, CompositeEffect, MergeEffect, or ColorMatrixEffect.
+type FilterEffect interface {
+	filterEffect()
+}
+
+// GaussianBlurEffect blurs its input with the standard deviations along the x and y axes.
+type GaussianBlurEffect struct {
+	StdDevX, StdDevY float64
+}
+
+// OffsetEffect translates its input.
+type OffsetEffect struct {
+	DX, DY float64
+}
+
+// FloodEffect fills the filter region with a color, it takes no input.
+type FloodEffect struct {
+	Color color.RGBA
+}
+
+// CompositeOperator is the Porter-Duff operator of a composite effect.
+type CompositeOperator int
+
+// see CompositeOperator
+const (
+	CompositeOver CompositeOperator = iota
+	CompositeIn
+	CompositeOut
+	CompositeAtop
+	CompositeXor
+	CompositeArithmetic // k1*In*In2 + k2*In + k3*In2 + k4
+)
+
+func (op CompositeOperator) String() string {
+	switch op {
+	case CompositeOver:
+		return "over"
+	case CompositeIn:
+		return "in"
+	case CompositeOut:
+		return "out"
+	case CompositeAtop:
+		return "atop"
+	case CompositeXor:
+		return "xor"
+	case CompositeArithmetic:
+		return "arithmetic"
+	}
+	return "Invalid(" + strconv.Itoa(int(op)) + ")"
+}
+
+// CompositeEffect composites its first input (In) on top of its second input (In2) using an operator, where K1 to K4 are the coefficients for the arithmetic operator.
+type CompositeEffect struct {
+	Operator       CompositeOperator
+	K1, K2, K3, K4 float64
+}
+
+// MergeEffect draws its inputs on top of each other in order, it ignores the In and In2 inputs of the primitive.
+type MergeEffect struct {
+	In []string
+}
+
+// ColorMatrixEffect transforms the unpremultiplied color and alpha of each pixel by a 4x5 matrix in row-major order, where the last column is the translation. See SaturateColorMatrix, HueRotateColorMatrix, and LuminanceToAlphaColorMatrix for common matrices.
+type ColorMatrixEffect struct {
+	Matrix [20]float64
+}
+
+func (GaussianBlurEffect) filterEffect() {}
+func (OffsetEffect) filterEffect()       {}
+func (FloodEffect) filterEffect()        {}
+func (CompositeEffect) filterEffect()    {}
+func (MergeEffect) filterEffect()        {}
+func (ColorMatrixEffect) filterEffect()  {}
+
+// IdentityColorMatrix is the color matrix that leaves colors unchanged.
+var IdentityColorMatrix = ColorMatrixEffect{[20]float64{
+	1.0, 0.0, 0.0, 0.0, 0.0,
+	0.0, 1.0, 0.0, 0.0, 0.0,
+	0.0, 0.0, 1.0, 0.0, 0.0,
+	0.0, 0.0, 0.0, 1.0, 0.0,
+}}
+
+// SaturateColorMatrix returns the color matrix that (de)saturates colors, where zero gives grayscale and one leaves colors unchanged.
+func SaturateColorMatrix(s float64) ColorMatrixEffect {
+	return ColorMatrixEffect{[20]float64{
+		0.213 + 0.787*s, 0.715 - 0.715*s, 0.072 - 0.072*s, 0.0, 0.0,
+		0.213 - 0.213*s, 0.715 + 0.285*s, 0.072 - 0.072*s, 0.0, 0.0,
+		0.213 - 0.213*s, 0.715 - 0.715*s, 0.072 + 0.928*s, 0.0, 0.0,
+		0.0, 0.0, 0.0, 1.0, 0.0,
+	}}
+}
+
+// HueRotateColorMatrix returns the color matrix that rotates the hue of colors by an angle in degrees.
+func HueRotateColorMatrix(rot float64) ColorMatrixEffect {
+	sin, cos := math.Sincos(rot * math.Pi / 180.0)
+	return ColorMatrixEffect{[20]float64{
+		0.213 + 0.787*cos - 0.213*sin, 0.715 - 0.715*cos - 0.715*sin, 0.072 - 0.072*cos + 0.928*sin, 0.0, 0.0,
+		0.213 - 0.213*cos + 0.143*sin, 0.715 + 0.285*cos + 0.140*sin, 0.072 - 0.072*cos - 0.283*sin, 0.0, 0.0,
+		0.213 - 0.213*cos - 0.787*sin, 0.715 - 0.715*cos + 0.715*sin, 0.072 + 0.928*cos + 0.072*sin, 0.0, 0.0,
+		0.0, 0.0, 0.0, 1.0, 0.0,
+	}}
+}
+
+// LuminanceToAlphaColorMatrix returns the color matrix that converts the luminance of colors to alpha, with black color.
+func LuminanceToAlphaColorMatrix() ColorMatrixEffect {
+	return ColorMatrixEffect{[20]float64{
+		0.0, 0.0, 0.0, 0.0, 0.0,
+		0.0, 0.0, 0.0, 0.0, 0.0,
+		0.0, 0.0, 0.0, 0.0, 0.0,
+		0.2125, 0.7154, 0.0721, 0.0, 0.0,
+	}}
+}
+
+// DropShadow returns a filter that draws a blurred shadow with the given color below the group, offset by (dx,dy) and with the standard deviation of the blur.
+func DropShadow(dx, dy, stdDev float64, col color.RGBA) *Filter {
+	return &Filter{[]FilterPrimitive{
+		{In: SourceAlpha, Effect: GaussianBlurEffect{stdDev, stdDev}},
+		{Effect: OffsetEffect{dx, dy}, Result: "offset"},
+		{Effect: FloodEffect{col}},
+		{In2: "offset", Effect: CompositeEffect{Operator: CompositeIn}},
+		{Effect: MergeEffect{[]string{"", SourceGraphic}}},
+	}}
+}
+
+// Transform returns the filter with its lengths transformed by the linear part of a transformation matrix. Blurs are scaled along the x and y axes only, so that rotations and skews are approximated.
+func (f *Filter) Transform(m Matrix) *Filter {
+	sx := math.Hypot(m[0][0], m[1][0])
+	sy := math.Hypot(m[0][1], m[1][1])
+	primitives := make([]FilterPrimitive, len(f.Primitives))
+	for i, primitive := range f.Primitives {
+		switch effect := primitive.Effect.(type) {
+		case GaussianBlurEffect:
+			primitive.Effect = GaussianBlurEffect{effect.StdDevX * sx, effect.StdDevY * sy}
+		case OffsetEffect:
+			d := m.Dot(Point{effect.DX, effect.DY}).Sub(m.Dot(Point{}))
+			primitive.Effect = OffsetEffect{d.X, d.Y}
+		}
+		primitives[i] = primitive
+	}
+	return &Filter{primitives}
+}
+
+// Bounds returns the region affected by the filter for a group with the given bounds, which is extended by the reach of blurs and offsets.
+func (f *Filter) Bounds(rect Rect) Rect {
+	x0, y0, x1, y1 := rect.X, rect.Y, rect.X+rect.W, rect.Y+rect.H
+	for _, primitive := range f.Primitives {
+		switch effect := primitive.Effect.(type) {
+		case GaussianBlurEffect:
+			x0 -= 3.0 * math.Abs(effect.StdDevX)
+			x1 += 3.0 * math.Abs(effect.StdDevX)
+			y0 -= 3.0 * math.Abs(effect.StdDevY)
+			y1 += 3.0 * math.Abs(effect.StdDevY)
+		case OffsetEffect:
+			x0 = math.Min(x0, x0+effect.DX)
+			x1 = math.Max(x1, x1+effect.DX)
+			y0 = math.Min(y0, y0+effect.DY)
+			y1 = math.Max(y1, y1+effect.DY)
+		}
+	}
+	return Rect{x0, y0, x1 - x0, y1 - y0}
+}
@@ -83,9 +83,17 @@ func (sfnt *SFNT) GlyphIndex(r rune) uint16 {
 	return sfnt.Cmap.Get(r)
 }
 
-// GlyphName returns the name of the glyph.
+// GlyphName returns the name of the glyph. It uses the post table and falls back to the charset for CFF fonts.
 func (sfnt *SFNT) GlyphName(glyphID uint16) string {
-	return sfnt.Post.Get(glyphID)
+	if sfnt.Post != nil {
+		if name := sfnt.Post.Get(glyphID); name != "" {
+			return name
+		}
+	}
+	if sfnt.CFF != nil {
+		return sfnt.CFF.GlyphName(glyphID)
+	}
+	return ""
 }
 
 // VerticalMetrics returns the ascender, descender, and line gap values. It returns the "win" values, or the "typo" values if OS/2.FsSelection.USE_TYPO_METRICS is set. If those are zero or not set, default to the "hhea" values.
@@ -11,6 +11,8 @@ import (
 
 type cffTable struct {
 	version     int
+	name        string
+	charset     []string // glyph names, nil for CID fonts
 	top         *cffTopDICT
 	charStrings *cffINDEX
 	globalSubrs *cffINDEX
@@ -95,8 +97,15 @@ func (sfnt *SFNT) parseCFF() error {
 			}
 		}
 
+		charset, err := parseCharset(b, topDICT.Charset, charStringsINDEX.Len(), stringINDEX)
+		if err != nil {
+			return fmt.Errorf("CFF: %w", err)
+		}
+
 		sfnt.CFF = &cffTable{
 			version:     1,
+			name:        string(nameINDEX.Get(0)),
+			charset:     charset,
 			charStrings: charStringsINDEX,
 			globalSubrs: globalSubrsINDEX,
 			fonts: &cffFontINDEX{
@@ -115,6 +124,7 @@ func (sfnt *SFNT) parseCFF() error {
 
 		sfnt.CFF = &cffTable{
 			version:     1,
+			name:        string(nameINDEX.Get(0)),
 			charStrings: charStringsINDEX,
 			globalSubrs: globalSubrsINDEX,
 			fonts:       fonts,
@@ -181,6 +191,19 @@ func (cff *cffTable) TopDICT() *cffTopDICT {
 	return cff.top
 }
 
+// FontName returns the PostScript font name from the Name INDEX.
+func (cff *cffTable) FontName() string {
+	return cff.name
+}
+
+// GlyphName returns the glyph name from the charset. It returns an empty string for CID-keyed fonts, which identify glyphs by CID instead of by name.
+func (cff *cffTable) GlyphName(glyphID uint16) string {
+	if int(glyphID) < len(cff.charset) {
+		return cff.charset[glyphID]
+	}
+	return ""
+}
+
 func (cff *cffTable) PrivateDICT(glyphID uint16) (*cffPrivateDICT, error) {
 	return cff.fonts.GetPrivate(uint32(glyphID))
 }
@@ -661,6 +684,55 @@ func (cff *cffTable) ToPath(p Pather, glyphID, ppem uint16, x0, y0, f float64, h
 	return nil
 }
 
+func parseCharset(b []byte, offset, numGlyphs int, stringINDEX *cffINDEX) ([]string, error) {
+	if numGlyphs == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, numGlyphs)
+	names[0] = ".notdef"
+	if offset == 0 {
+		// ISOAdobe charset, SIDs equal glyph IDs
+		for glyphID := 1; glyphID < numGlyphs; glyphID++ {
+			names[glyphID] = stringINDEX.GetSID(glyphID)
+		}
+		return names, nil
+	} else if offset == 1 || offset == 2 {
+		// Expert and ExpertSubset charsets are not supported
+		return nil, nil
+	} else if len(b) <= offset {
+		return nil, fmt.Errorf("Charset: bad offset")
+	}
+
+	r := NewBinaryReader(b[offset:])
+	format := r.ReadUint8()
+	if format == 0 {
+		for glyphID := 1; glyphID < numGlyphs; glyphID++ {
+			names[glyphID] = stringINDEX.GetSID(int(r.ReadUint16()))
+		}
+	} else if format == 1 || format == 2 {
+		for glyphID := 1; glyphID < numGlyphs; {
+			first := int(r.ReadUint16())
+			var nLeft int
+			if format == 1 {
+				nLeft = int(r.ReadUint8())
+			} else {
+				nLeft = int(r.ReadUint16())
+			}
+			for i := 0; i <= nLeft && glyphID < numGlyphs; i++ {
+				names[glyphID] = stringINDEX.GetSID(first + i)
+				glyphID++
+			}
+		}
+	} else {
+		return nil, fmt.Errorf("Charset: bad format")
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("Charset: bad data")
+	}
+	return names, nil
+}
+
 type cffINDEX struct {
 	offset []uint32
 	data   []byte
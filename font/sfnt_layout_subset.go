@@ -0,0 +1,1916 @@
+package font
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// otTable is an OpenType layout table that refers to other tables by offsets, which are resolved upon serialization.
+type otTable struct {
+	*BinaryWriter
+	links []otLink
+}
+
+type otLink struct {
+	pos   uint32
+	large bool // Offset32 instead of Offset16
+	table *otTable
+}
+
+func newOTTable() *otTable {
+	return &otTable{BinaryWriter: NewBinaryWriter([]byte{})}
+}
+
+// WriteOffset16 writes a 16-bit offset to a table, or a null offset if the table is nil.
+func (t *otTable) WriteOffset16(table *otTable) {
+	if table != nil {
+		t.links = append(t.links, otLink{t.Len(), false, table})
+	}
+	t.WriteUint16(0)
+}
+
+// WriteOffset32 writes a 32-bit offset to a table, or a null offset if the table is nil.
+func (t *otTable) WriteOffset32(table *otTable) {
+	if table != nil {
+		t.links = append(t.links, otLink{t.Len(), true, table})
+	}
+	t.WriteUint32(0)
+}
+
+// serialize writes the table and the tables it refers to. Tables are placed after all tables that refer to them, where tables referred to by 16-bit offsets are placed depth-first to keep offsets small and tables referred to by 32-bit offsets are placed at the end.
+func (t *otTable) serialize() ([]byte, error) {
+	refs := map[*otTable]int{}
+	var count func(*otTable)
+	count = func(t *otTable) {
+		for _, link := range t.links {
+			refs[link.table]++
+			if refs[link.table] == 1 {
+				count(link.table)
+			}
+		}
+	}
+	count(t)
+
+	order := []*otTable{}
+	stack, deferred := []*otTable{t}, []*otTable{}
+	for 0 < len(stack) || 0 < len(deferred) {
+		var table *otTable
+		if 0 < len(stack) {
+			table = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		} else {
+			table = deferred[0]
+			deferred = deferred[1:]
+		}
+		order = append(order, table)
+
+		ready := []*otTable{}
+		for _, link := range table.links {
+			refs[link.table]--
+			if refs[link.table] == 0 {
+				if link.large {
+					deferred = append(deferred, link.table)
+				} else {
+					ready = append(ready, link.table)
+				}
+			}
+		}
+		for i := len(ready) - 1; 0 <= i; i-- {
+			stack = append(stack, ready[i])
+		}
+	}
+
+	pos := make(map[*otTable]uint32, len(order))
+	n := uint32(0)
+	for _, table := range order {
+		pos[table] = n
+		n += table.Len()
+	}
+
+	w := NewBinaryWriter(make([]byte, 0, n))
+	for _, table := range order {
+		start := w.Len()
+		w.WriteBytes(table.Bytes())
+		for _, link := range table.links {
+			offset := pos[link.table] - pos[table]
+			if link.large {
+				binary.BigEndian.PutUint32(w.buf[start+link.pos:], offset)
+			} else if 0xFFFF < offset {
+				return nil, fmt.Errorf("offset overflow")
+			} else {
+				binary.BigEndian.PutUint16(w.buf[start+link.pos:], uint16(offset))
+			}
+		}
+	}
+	return w.Bytes(), nil
+}
+
+////////////////////////////////////////////////////////////////
+
+// otSubtable returns the data of a subtable at an offset, or nil for a null offset.
+func otSubtable(b []byte, offset uint32) ([]byte, error) {
+	if offset == 0 {
+		return nil, nil
+	} else if uint32(len(b)) <= offset {
+		return nil, fmt.Errorf("bad offset")
+	}
+	return b[offset:], nil
+}
+
+// readCoverage returns the glyphs of a coverage table in the order of their coverage index.
+func readCoverage(b []byte) ([]uint16, error) {
+	r := NewBinaryReader(b)
+	format := r.ReadUint16()
+	glyphs := []uint16{}
+	if format == 1 {
+		glyphCount := r.ReadUint16()
+		for i := 0; i < int(glyphCount) && !r.EOF(); i++ {
+			glyphs = append(glyphs, r.ReadUint16())
+		}
+	} else if format == 2 {
+		rangeCount := r.ReadUint16()
+		for i := 0; i < int(rangeCount) && !r.EOF(); i++ {
+			startGlyphID := r.ReadUint16()
+			endGlyphID := r.ReadUint16()
+			startCoverageIndex := r.ReadUint16()
+			if endGlyphID < startGlyphID || int(startCoverageIndex) != len(glyphs) {
+				return nil, fmt.Errorf("bad coverage table")
+			}
+			for glyphID := uint32(startGlyphID); glyphID <= uint32(endGlyphID); glyphID++ {
+				glyphs = append(glyphs, uint16(glyphID))
+			}
+		}
+	} else {
+		return nil, fmt.Errorf("bad coverage table format")
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad coverage table")
+	}
+	return glyphs, nil
+}
+
+// readClassDef returns the non-zero classes of glyphs of a class definition table.
+func readClassDef(b []byte) (map[uint16]uint16, error) {
+	r := NewBinaryReader(b)
+	format := r.ReadUint16()
+	classes := map[uint16]uint16{}
+	if format == 1 {
+		startGlyphID := r.ReadUint16()
+		glyphCount := r.ReadUint16()
+		for i := 0; i < int(glyphCount) && !r.EOF(); i++ {
+			if class := r.ReadUint16(); class != 0 {
+				classes[startGlyphID+uint16(i)] = class
+			}
+		}
+	} else if format == 2 {
+		rangeCount := r.ReadUint16()
+		for i := 0; i < int(rangeCount) && !r.EOF(); i++ {
+			startGlyphID := r.ReadUint16()
+			endGlyphID := r.ReadUint16()
+			class := r.ReadUint16()
+			if endGlyphID < startGlyphID {
+				return nil, fmt.Errorf("bad class definition table")
+			}
+			for glyphID := uint32(startGlyphID); glyphID <= uint32(endGlyphID) && class != 0; glyphID++ {
+				classes[uint16(glyphID)] = class
+			}
+		}
+	} else {
+		return nil, fmt.Errorf("bad class definition table format")
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad class definition table")
+	}
+	return classes, nil
+}
+
+// readLookups returns the type and data of the subtables of each lookup of a GSUB or GPOS table, where extension subtables are resolved. The type is zero for lookups without subtables.
+func readLookups(b []byte, extensionType uint16) ([]uint16, [][][]byte, error) {
+	r := NewBinaryReader(b)
+	if majorVersion := r.ReadUint16(); majorVersion != 1 {
+		return nil, nil, fmt.Errorf("bad version")
+	}
+	_ = r.ReadUint16() // minorVersion
+	_ = r.ReadUint16() // scriptListOffset
+	_ = r.ReadUint16() // featureListOffset
+	lookupList, err := otSubtable(b, uint32(r.ReadUint16()))
+	if err != nil || lookupList == nil {
+		return nil, nil, err
+	}
+
+	r = NewBinaryReader(lookupList)
+	lookupCount := r.ReadUint16()
+	types := make([]uint16, lookupCount)
+	subtables := make([][][]byte, lookupCount)
+	for i := 0; i < int(lookupCount); i++ {
+		lookup, err := otSubtable(lookupList, uint32(r.ReadUint16()))
+		if err != nil || lookup == nil {
+			return nil, nil, fmt.Errorf("bad lookup offset")
+		}
+		rLookup := NewBinaryReader(lookup)
+		types[i] = rLookup.ReadUint16()
+		_ = rLookup.ReadUint16() // lookupFlag
+		subtableCount := rLookup.ReadUint16()
+		for j := 0; j < int(subtableCount); j++ {
+			subtable, err := otSubtable(lookup, uint32(rLookup.ReadUint16()))
+			if err != nil || subtable == nil {
+				return nil, nil, fmt.Errorf("bad subtable offset")
+			}
+			if types[i] == extensionType {
+				rExt := NewBinaryReader(subtable)
+				_ = rExt.ReadUint16() // format
+				lookupType := rExt.ReadUint16()
+				subtable, err = otSubtable(subtable, rExt.ReadUint32())
+				if err != nil || subtable == nil || rExt.EOF() {
+					return nil, nil, fmt.Errorf("bad extension subtable")
+				}
+				if j == 0 {
+					types[i] = lookupType
+				}
+			}
+			subtables[i] = append(subtables[i], subtable)
+		}
+		if types[i] == extensionType {
+			types[i] = 0
+		}
+		if rLookup.EOF() {
+			return nil, nil, fmt.Errorf("bad lookup table")
+		}
+	}
+	if r.EOF() {
+		return nil, nil, fmt.Errorf("bad lookup list")
+	}
+	return types, subtables, nil
+}
+
+////////////////////////////////////////////////////////////////
+
+// layoutClosure adds the glyphs to the set that may be produced by GSUB substitutions of glyphs in the set, such as alternates and ligatures of which all components are in the set. Contextual substitutions are assumed to apply to any glyph, so that the closure may contain more glyphs than strictly needed.
+func (sfnt *SFNT) layoutClosure(glyphs map[uint16]bool) error {
+	b, ok := sfnt.Tables["GSUB"]
+	if !ok {
+		return nil
+	}
+	types, subtables, err := readLookups(b, 7)
+	if err != nil {
+		return fmt.Errorf("GSUB: %w", err)
+	}
+
+	for {
+		n := len(glyphs)
+		for i, lookupType := range types {
+			for _, subtable := range subtables[i] {
+				if err := closeSubtable(glyphs, subtable, lookupType); err != nil {
+					return fmt.Errorf("GSUB: %w", err)
+				}
+			}
+		}
+		if len(glyphs) == n {
+			return nil
+		}
+	}
+}
+
+func closeSubtable(glyphs map[uint16]bool, b []byte, lookupType uint16) error {
+	r := NewBinaryReader(b)
+	format := r.ReadUint16()
+	coverageOffset := r.ReadUint16()
+	if (lookupType < 1 || 4 < lookupType) && lookupType != 8 {
+		return nil // contextual substitutions apply other lookups
+	}
+	coverageTable, err := otSubtable(b, uint32(coverageOffset))
+	if err != nil || coverageTable == nil {
+		return fmt.Errorf("bad coverage offset")
+	}
+	coverage, err := readCoverage(coverageTable)
+	if err != nil {
+		return err
+	}
+
+	switch lookupType {
+	case 1:
+		if format == 1 {
+			deltaGlyphID := r.ReadUint16()
+			for _, glyphID := range coverage {
+				if glyphs[glyphID] {
+					glyphs[glyphID+deltaGlyphID] = true
+				}
+			}
+		} else if format == 2 {
+			glyphCount := r.ReadUint16()
+			for i := 0; i < int(glyphCount) && i < len(coverage); i++ {
+				substitute := r.ReadUint16()
+				if glyphs[coverage[i]] {
+					glyphs[substitute] = true
+				}
+			}
+		} else {
+			return fmt.Errorf("bad single substitution format")
+		}
+	case 2, 3:
+		count := r.ReadUint16()
+		for i := 0; i < int(count) && i < len(coverage); i++ {
+			offset := r.ReadUint16()
+			if !glyphs[coverage[i]] {
+				continue
+			}
+			sequence, err := otSubtable(b, uint32(offset))
+			if err != nil || sequence == nil {
+				return fmt.Errorf("bad sequence offset")
+			}
+			rSequence := NewBinaryReader(sequence)
+			glyphCount := rSequence.ReadUint16()
+			for j := 0; j < int(glyphCount); j++ {
+				glyphs[rSequence.ReadUint16()] = true
+			}
+		}
+	case 4:
+		count := r.ReadUint16()
+		for i := 0; i < int(count) && i < len(coverage); i++ {
+			offset := r.ReadUint16()
+			if !glyphs[coverage[i]] {
+				continue
+			}
+			ligatureSet, err := otSubtable(b, uint32(offset))
+			if err != nil || ligatureSet == nil {
+				return fmt.Errorf("bad ligature set offset")
+			}
+			rSet := NewBinaryReader(ligatureSet)
+			ligatureCount := rSet.ReadUint16()
+			for j := 0; j < int(ligatureCount); j++ {
+				ligature, err := otSubtable(ligatureSet, uint32(rSet.ReadUint16()))
+				if err != nil || ligature == nil {
+					return fmt.Errorf("bad ligature offset")
+				}
+				rLigature := NewBinaryReader(ligature)
+				ligatureGlyph := rLigature.ReadUint16()
+				componentCount := rLigature.ReadUint16()
+				complete := true
+				for k := 1; k < int(componentCount); k++ {
+					if !glyphs[rLigature.ReadUint16()] {
+						complete = false
+					}
+				}
+				if complete && !rLigature.EOF() {
+					glyphs[ligatureGlyph] = true
+				}
+			}
+		}
+	case 8:
+		backtrackCount := r.ReadUint16()
+		r.ReadBytes(2 * uint32(backtrackCount))
+		lookaheadCount := r.ReadUint16()
+		r.ReadBytes(2 * uint32(lookaheadCount))
+		glyphCount := r.ReadUint16()
+		for i := 0; i < int(glyphCount) && i < len(coverage); i++ {
+			substitute := r.ReadUint16()
+			if glyphs[coverage[i]] {
+				glyphs[substitute] = true
+			}
+		}
+	}
+	if r.EOF() {
+		return fmt.Errorf("bad substitution table")
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+// layoutSubsetter rewrites the GSUB, GPOS, and GDEF tables for a subset of glyphs, where glyph IDs are remapped and glyphs that are not in the subset are removed. Scripts, features, and lookups retain their indices, and subtables that no longer apply to any glyph are removed. Feature variations, feature parameters, and variation data are removed as the subsetted font has no font variations.
+type layoutSubsetter struct {
+	glyphMap  map[uint16]uint16
+	extension bool                // write all lookups as extension lookups
+	cache     map[string]*otTable // coverage and class definition tables shared within a lookup
+}
+
+// subsetLayout returns the GSUB or GPOS table for the subset. Lookups are written as extension lookups when offsets would overflow otherwise.
+func (sfnt *SFNT) subsetLayout(tag string, glyphMap map[uint16]uint16) ([]byte, error) {
+	s := &layoutSubsetter{glyphMap: glyphMap}
+	table, err := s.layout(sfnt.Tables[tag], tag == "GSUB")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", tag, err)
+	}
+	b, err := table.serialize()
+	if err != nil {
+		s.extension = true
+		if table, err = s.layout(sfnt.Tables[tag], tag == "GSUB"); err == nil {
+			b, err = table.serialize()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", tag, err)
+		}
+	}
+	return b, nil
+}
+
+// subsetGDEF returns the GDEF table for the subset.
+func (sfnt *SFNT) subsetGDEF(glyphMap map[uint16]uint16) ([]byte, error) {
+	s := &layoutSubsetter{glyphMap: glyphMap, cache: map[string]*otTable{}}
+	table, err := s.gdef(sfnt.Tables["GDEF"])
+	if err == nil {
+		var b []byte
+		if b, err = table.serialize(); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("GDEF: %w", err)
+}
+
+// mapGlyphs maps glyphs to the subset, it returns false if any glyph is not in the subset.
+func (s *layoutSubsetter) mapGlyphs(glyphs []uint16) ([]uint16, bool) {
+	mapped := make([]uint16, len(glyphs))
+	for i, glyphID := range glyphs {
+		var ok bool
+		if mapped[i], ok = s.glyphMap[glyphID]; !ok {
+			return nil, false
+		}
+	}
+	return mapped, true
+}
+
+// mapCoverage returns the glyphs of a coverage table that are in the subset sorted by their new glyph ID, together with their original coverage indices.
+func (s *layoutSubsetter) mapCoverage(b []byte, offset uint16) ([]uint16, []int, error) {
+	table, err := otSubtable(b, uint32(offset))
+	if err != nil || table == nil {
+		return nil, nil, fmt.Errorf("bad coverage offset")
+	}
+	return s.subsetCoverage(table)
+}
+
+// subsetCoverage returns the glyphs of a coverage table that are in the subset sorted by their new glyph ID, together with their original coverage indices.
+func (s *layoutSubsetter) subsetCoverage(table []byte) ([]uint16, []int, error) {
+	coverage, err := readCoverage(table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	glyphs, indices := []uint16{}, []int{}
+	for i, glyphID := range coverage {
+		if subsetGlyphID, ok := s.glyphMap[glyphID]; ok {
+			glyphs = append(glyphs, subsetGlyphID)
+			indices = append(indices, i)
+		}
+	}
+	sort.Sort(coverageSorter{glyphs, indices})
+	return glyphs, indices, nil
+}
+
+type coverageSorter struct {
+	glyphs  []uint16
+	indices []int
+}
+
+func (a coverageSorter) Len() int           { return len(a.glyphs) }
+func (a coverageSorter) Less(i, j int) bool { return a.glyphs[i] < a.glyphs[j] }
+func (a coverageSorter) Swap(i, j int) {
+	a.glyphs[i], a.glyphs[j] = a.glyphs[j], a.glyphs[i]
+	a.indices[i], a.indices[j] = a.indices[j], a.indices[i]
+}
+
+// shared returns an identical table that was written before within the same lookup, or the table itself.
+func (s *layoutSubsetter) shared(table *otTable) *otTable {
+	key := string(table.Bytes())
+	if cached, ok := s.cache[key]; ok {
+		return cached
+	}
+	s.cache[key] = table
+	return table
+}
+
+// coverage returns a coverage table for sorted glyphs in the format that is smallest.
+func (s *layoutSubsetter) coverage(glyphs []uint16) *otTable {
+	rangeCount := 0
+	for i := range glyphs {
+		if i == 0 || glyphs[i-1]+1 != glyphs[i] {
+			rangeCount++
+		}
+	}
+
+	t := newOTTable()
+	if len(glyphs) <= 3*rangeCount {
+		t.WriteUint16(1) // format
+		t.WriteUint16(uint16(len(glyphs)))
+		for _, glyphID := range glyphs {
+			t.WriteUint16(glyphID)
+		}
+	} else {
+		t.WriteUint16(2) // format
+		t.WriteUint16(uint16(rangeCount))
+		for i := 0; i < len(glyphs); {
+			j := i + 1
+			for j < len(glyphs) && glyphs[j-1]+1 == glyphs[j] {
+				j++
+			}
+			t.WriteUint16(glyphs[i])   // startGlyphID
+			t.WriteUint16(glyphs[j-1]) // endGlyphID
+			t.WriteUint16(uint16(i))   // startCoverageIndex
+			i = j
+		}
+	}
+	return s.shared(t)
+}
+
+// mapCoverageTable returns the coverage table mapped to the subset, or nil if no glyph is in the subset.
+func (s *layoutSubsetter) mapCoverageTable(b []byte, offset uint16) (*otTable, error) {
+	glyphs, _, err := s.mapCoverage(b, offset)
+	if err != nil || len(glyphs) == 0 {
+		return nil, err
+	}
+	return s.coverage(glyphs), nil
+}
+
+// classDef returns the class definition table at an offset mapped to the subset, or nil for a null offset.
+func (s *layoutSubsetter) classDef(b []byte, offset uint16) (*otTable, error) {
+	table, err := otSubtable(b, uint32(offset))
+	if err != nil || table == nil {
+		return nil, err
+	}
+	classes, err := readClassDef(table)
+	if err != nil {
+		return nil, err
+	}
+
+	glyphs := []uint16{}
+	subsetClasses := map[uint16]uint16{}
+	for glyphID, class := range classes {
+		if subsetGlyphID, ok := s.glyphMap[glyphID]; ok {
+			glyphs = append(glyphs, subsetGlyphID)
+			subsetClasses[subsetGlyphID] = class
+		}
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+
+	t := newOTTable()
+	t.WriteUint16(2) // format
+	t.WriteUint16(0) // classRangeCount
+	rangeCount := uint16(0)
+	for i := 0; i < len(glyphs); {
+		j := i + 1
+		for j < len(glyphs) && glyphs[j-1]+1 == glyphs[j] && subsetClasses[glyphs[j]] == subsetClasses[glyphs[i]] {
+			j++
+		}
+		t.WriteUint16(glyphs[i])                // startGlyphID
+		t.WriteUint16(glyphs[j-1])              // endGlyphID
+		t.WriteUint16(subsetClasses[glyphs[i]]) // class
+		rangeCount++
+		i = j
+	}
+	binary.BigEndian.PutUint16(t.buf[2:], rangeCount)
+	return s.shared(t), nil
+}
+
+// device copies a device table, or returns nil for a null offset or a variation index table as the item variation store is removed.
+func device(b []byte, offset uint16) *otTable {
+	table, err := otSubtable(b, uint32(offset))
+	if err != nil || len(table) < 6 {
+		return nil
+	}
+	startSize := binary.BigEndian.Uint16(table)
+	endSize := binary.BigEndian.Uint16(table[2:])
+	deltaFormat := binary.BigEndian.Uint16(table[4:])
+	if deltaFormat < 1 || 3 < deltaFormat || endSize < startSize {
+		return nil
+	}
+	n := 6 + 2*(((int(endSize-startSize)+1)*(1<<deltaFormat)+15)/16)
+	if len(table) < n {
+		return nil
+	}
+	t := newOTTable()
+	t.WriteBytes(table[:n])
+	return t
+}
+
+// anchor copies an anchor table, or returns nil for a null offset.
+func anchor(b []byte, offset uint16) (*otTable, error) {
+	table, err := otSubtable(b, uint32(offset))
+	if err != nil || table == nil {
+		return nil, err
+	}
+	r := NewBinaryReader(table)
+	format := r.ReadUint16()
+	t := newOTTable()
+	t.WriteUint16(format)
+	t.WriteBytes(r.ReadBytes(4)) // xCoordinate and yCoordinate
+	if format == 2 {
+		t.WriteUint16(r.ReadUint16()) // anchorPoint
+	} else if format == 3 {
+		t.WriteOffset16(device(table, r.ReadUint16())) // xDeviceOffset
+		t.WriteOffset16(device(table, r.ReadUint16())) // yDeviceOffset
+	} else if format != 1 {
+		return nil, fmt.Errorf("bad anchor table format")
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad anchor table")
+	}
+	return t, nil
+}
+
+// valueRecord copies a value record, where device tables are relative to the table b.
+func valueRecord(t *otTable, r *BinaryReader, b []byte, valueFormat uint16) {
+	for i := 0; i < 8; i++ {
+		if valueFormat&(1<<i) != 0 {
+			if i < 4 {
+				t.WriteUint16(r.ReadUint16())
+			} else {
+				t.WriteOffset16(device(b, r.ReadUint16()))
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////
+
+// layout rewrites a GSUB or GPOS table.
+func (s *layoutSubsetter) layout(b []byte, gsub bool) (*otTable, error) {
+	r := NewBinaryReader(b)
+	if majorVersion := r.ReadUint16(); majorVersion != 1 {
+		return nil, fmt.Errorf("bad version")
+	}
+	_ = r.ReadUint16() // minorVersion
+	scriptListOffset := r.ReadUint16()
+	featureListOffset := r.ReadUint16()
+	lookupListOffset := r.ReadUint16()
+	if r.EOF() {
+		return nil, fmt.Errorf("bad table")
+	}
+
+	scriptList, err := s.scriptList(b, scriptListOffset)
+	if err != nil {
+		return nil, err
+	}
+	featureList, err := s.featureList(b, featureListOffset)
+	if err != nil {
+		return nil, err
+	}
+	lookupList, err := s.lookupList(b, lookupListOffset, gsub)
+	if err != nil {
+		return nil, err
+	}
+
+	t := newOTTable()
+	t.WriteUint16(1) // majorVersion
+	t.WriteUint16(0) // minorVersion
+	t.WriteOffset16(scriptList)
+	t.WriteOffset16(featureList)
+	t.WriteOffset16(lookupList)
+	return t, nil
+}
+
+func (s *layoutSubsetter) scriptList(b []byte, offset uint16) (*otTable, error) {
+	table, err := otSubtable(b, uint32(offset))
+	if err != nil || table == nil {
+		return nil, err
+	}
+
+	r := NewBinaryReader(table)
+	scriptCount := r.ReadUint16()
+	t := newOTTable()
+	t.WriteUint16(scriptCount)
+	for i := 0; i < int(scriptCount); i++ {
+		t.WriteBytes(r.ReadBytes(4)) // scriptTag
+		script, err := otSubtable(table, uint32(r.ReadUint16()))
+		if err != nil || script == nil {
+			return nil, fmt.Errorf("bad script offset")
+		}
+
+		rScript := NewBinaryReader(script)
+		tScript := newOTTable()
+		tScript.WriteOffset16(copyLangSys(script, rScript.ReadUint16())) // defaultLangSysOffset
+		langSysCount := rScript.ReadUint16()
+		tScript.WriteUint16(langSysCount)
+		for j := 0; j < int(langSysCount); j++ {
+			tScript.WriteBytes(rScript.ReadBytes(4)) // langSysTag
+			tLangSys := copyLangSys(script, rScript.ReadUint16())
+			if tLangSys == nil {
+				return nil, fmt.Errorf("bad language system offset")
+			}
+			tScript.WriteOffset16(tLangSys)
+		}
+		if rScript.EOF() {
+			return nil, fmt.Errorf("bad script table")
+		}
+		t.WriteOffset16(tScript)
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad script list")
+	}
+	return t, nil
+}
+
+func copyLangSys(b []byte, offset uint16) *otTable {
+	table, err := otSubtable(b, uint32(offset))
+	if err != nil || len(table) < 6 {
+		return nil
+	}
+	n := 6 + 2*int(binary.BigEndian.Uint16(table[4:]))
+	if len(table) < n {
+		return nil
+	}
+	t := newOTTable()
+	t.WriteBytes(table[:n])
+	return t
+}
+
+func (s *layoutSubsetter) featureList(b []byte, offset uint16) (*otTable, error) {
+	table, err := otSubtable(b, uint32(offset))
+	if err != nil || table == nil {
+		return nil, err
+	}
+
+	r := NewBinaryReader(table)
+	featureCount := r.ReadUint16()
+	t := newOTTable()
+	t.WriteUint16(featureCount)
+	for i := 0; i < int(featureCount); i++ {
+		t.WriteBytes(r.ReadBytes(4)) // featureTag
+		feature, err := otSubtable(table, uint32(r.ReadUint16()))
+		if err != nil || len(feature) < 4 {
+			return nil, fmt.Errorf("bad feature offset")
+		}
+		n := 4 + 2*int(binary.BigEndian.Uint16(feature[2:]))
+		if len(feature) < n {
+			return nil, fmt.Errorf("bad feature table")
+		}
+
+		tFeature := newOTTable()
+		tFeature.WriteUint16(0) // featureParamsOffset
+		tFeature.WriteBytes(feature[2:n])
+		t.WriteOffset16(tFeature)
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad feature list")
+	}
+	return t, nil
+}
+
+func (s *layoutSubsetter) lookupList(b []byte, offset uint16, gsub bool) (*otTable, error) {
+	table, err := otSubtable(b, uint32(offset))
+	if err != nil || table == nil {
+		return nil, err
+	}
+
+	r := NewBinaryReader(table)
+	lookupCount := r.ReadUint16()
+	t := newOTTable()
+	t.WriteUint16(lookupCount)
+	for i := 0; i < int(lookupCount); i++ {
+		lookup, err := otSubtable(table, uint32(r.ReadUint16()))
+		if err != nil || lookup == nil {
+			return nil, fmt.Errorf("bad lookup offset")
+		}
+		tLookup, err := s.lookup(lookup, gsub)
+		if err != nil {
+			return nil, err
+		}
+		t.WriteOffset16(tLookup)
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad lookup list")
+	}
+	return t, nil
+}
+
+func (s *layoutSubsetter) lookup(b []byte, gsub bool) (*otTable, error) {
+	extensionType := uint16(9)
+	if gsub {
+		extensionType = 7
+	}
+
+	r := NewBinaryReader(b)
+	lookupType := r.ReadUint16()
+	lookupFlag := r.ReadUint16()
+	subtableCount := r.ReadUint16()
+	extension := lookupType == extensionType
+	s.cache = map[string]*otTable{}
+	subtables := []*otTable{}
+	for i := 0; i < int(subtableCount); i++ {
+		subtable, err := otSubtable(b, uint32(r.ReadUint16()))
+		if err != nil || subtable == nil {
+			return nil, fmt.Errorf("bad subtable offset")
+		}
+		subtableType := lookupType
+		if extension {
+			rExt := NewBinaryReader(subtable)
+			_ = rExt.ReadUint16() // format
+			subtableType = rExt.ReadUint16()
+			subtable, err = otSubtable(subtable, rExt.ReadUint32())
+			if err != nil || subtable == nil || rExt.EOF() || subtableType == extensionType {
+				return nil, fmt.Errorf("bad extension subtable")
+			}
+			if i == 0 {
+				lookupType = subtableType
+			} else if subtableType != lookupType {
+				return nil, fmt.Errorf("bad extension lookup type")
+			}
+		}
+
+		var t *otTable
+		if gsub {
+			t, err = s.substitution(subtable, subtableType)
+		} else {
+			t, err = s.positioning(subtable, subtableType)
+		}
+		if err != nil {
+			return nil, err
+		} else if t != nil {
+			subtables = append(subtables, t)
+		}
+	}
+	markFilteringSet := r.ReadUint16()
+	if r.EOF() && lookupFlag&0x0010 != 0 {
+		return nil, fmt.Errorf("bad lookup table")
+	}
+
+	t := newOTTable()
+	if (extension || s.extension) && lookupType != extensionType && 0 < len(subtables) {
+		t.WriteUint16(extensionType)
+		t.WriteUint16(lookupFlag)
+		t.WriteUint16(uint16(len(subtables)))
+		for _, subtable := range subtables {
+			tExt := newOTTable()
+			tExt.WriteUint16(1) // format
+			tExt.WriteUint16(lookupType)
+			tExt.WriteOffset32(subtable)
+			t.WriteOffset16(tExt)
+		}
+	} else {
+		t.WriteUint16(lookupType)
+		t.WriteUint16(lookupFlag)
+		t.WriteUint16(uint16(len(subtables)))
+		for _, subtable := range subtables {
+			t.WriteOffset16(subtable)
+		}
+	}
+	if lookupFlag&0x0010 == 0 {
+		markFilteringSet = 0
+	}
+	t.WriteUint16(markFilteringSet) // always written, as some parsers read it regardless of the lookup flag
+	return t, nil
+}
+
+// substitution rewrites a GSUB subtable, or returns nil if it no longer applies to any glyph.
+func (s *layoutSubsetter) substitution(b []byte, lookupType uint16) (*otTable, error) {
+	switch lookupType {
+	case 1:
+		return s.singleSubst(b)
+	case 2, 3:
+		return s.sequenceSubst(b, lookupType == 3)
+	case 4:
+		return s.ligatureSubst(b)
+	case 5:
+		return s.context(b)
+	case 6:
+		return s.chainedContext(b)
+	case 8:
+		return s.reverseChainedSubst(b)
+	}
+	return nil, fmt.Errorf("bad lookup type")
+}
+
+// positioning rewrites a GPOS subtable, or returns nil if it no longer applies to any glyph.
+func (s *layoutSubsetter) positioning(b []byte, lookupType uint16) (*otTable, error) {
+	switch lookupType {
+	case 1:
+		return s.singlePos(b)
+	case 2:
+		return s.pairPos(b)
+	case 3:
+		return s.cursivePos(b)
+	case 4, 6:
+		return s.markBasePos(b)
+	case 5:
+		return s.markLigPos(b)
+	case 7:
+		return s.context(b)
+	case 8:
+		return s.chainedContext(b)
+	}
+	return nil, fmt.Errorf("bad lookup type")
+}
+
+func (s *layoutSubsetter) singleSubst(b []byte) (*otTable, error) {
+	r := NewBinaryReader(b)
+	format := r.ReadUint16()
+	glyphs, indices, err := s.mapCoverage(b, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	}
+
+	substitutes := map[int]uint16{}
+	if format == 1 {
+		deltaGlyphID := r.ReadUint16()
+		coverage, _ := readCoverage(b[binary.BigEndian.Uint16(b[2:]):]) // validated by mapCoverage
+		for _, index := range indices {
+			substitutes[index] = coverage[index] + deltaGlyphID
+		}
+	} else if format == 2 {
+		glyphCount := r.ReadUint16()
+		for i := 0; i < int(glyphCount); i++ {
+			substitutes[i] = r.ReadUint16()
+		}
+	} else {
+		return nil, fmt.Errorf("bad single substitution format")
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad single substitution table")
+	}
+
+	subsetGlyphs, subsetSubstitutes := []uint16{}, []uint16{}
+	for i, index := range indices {
+		substitute, ok := substitutes[index]
+		if subsetSubstitute, ok2 := s.glyphMap[substitute]; ok && ok2 {
+			subsetGlyphs = append(subsetGlyphs, glyphs[i])
+			subsetSubstitutes = append(subsetSubstitutes, subsetSubstitute)
+		}
+	}
+	if len(subsetGlyphs) == 0 {
+		return nil, nil
+	}
+
+	t := newOTTable()
+	t.WriteUint16(2) // format
+	t.WriteOffset16(s.coverage(subsetGlyphs))
+	t.WriteUint16(uint16(len(subsetSubstitutes)))
+	for _, substitute := range subsetSubstitutes {
+		t.WriteUint16(substitute)
+	}
+	return t, nil
+}
+
+// sequenceSubst rewrites a multiple or alternate substitution subtable. Alternates that are not in the subset are removed.
+func (s *layoutSubsetter) sequenceSubst(b []byte, alternate bool) (*otTable, error) {
+	r := NewBinaryReader(b)
+	if format := r.ReadUint16(); format != 1 {
+		return nil, fmt.Errorf("bad substitution format")
+	}
+	glyphs, indices, err := s.mapCoverage(b, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	}
+	count := r.ReadUint16()
+	if r.EOF() {
+		return nil, fmt.Errorf("bad substitution table")
+	}
+
+	subsetGlyphs, sequences := []uint16{}, []*otTable{}
+	for i, index := range indices {
+		if int(count) <= index || len(b) < 8+2*index {
+			return nil, fmt.Errorf("bad substitution table")
+		}
+		sequence, err := otSubtable(b, uint32(binary.BigEndian.Uint16(b[6+2*index:])))
+		if err != nil || sequence == nil {
+			return nil, fmt.Errorf("bad sequence offset")
+		}
+		rSequence := NewBinaryReader(sequence)
+		glyphCount := rSequence.ReadUint16()
+		subsetSequence := []uint16{}
+		complete := true
+		for j := 0; j < int(glyphCount); j++ {
+			if subsetGlyphID, ok := s.glyphMap[rSequence.ReadUint16()]; ok {
+				subsetSequence = append(subsetSequence, subsetGlyphID)
+			} else {
+				complete = false
+			}
+		}
+		if rSequence.EOF() {
+			return nil, fmt.Errorf("bad sequence table")
+		} else if alternate && len(subsetSequence) == 0 || !alternate && !complete {
+			continue
+		}
+
+		tSequence := newOTTable()
+		tSequence.WriteUint16(uint16(len(subsetSequence)))
+		for _, glyphID := range subsetSequence {
+			tSequence.WriteUint16(glyphID)
+		}
+		subsetGlyphs = append(subsetGlyphs, glyphs[i])
+		sequences = append(sequences, tSequence)
+	}
+	if len(subsetGlyphs) == 0 {
+		return nil, nil
+	}
+
+	t := newOTTable()
+	t.WriteUint16(1) // format
+	t.WriteOffset16(s.coverage(subsetGlyphs))
+	t.WriteUint16(uint16(len(sequences)))
+	for _, sequence := range sequences {
+		t.WriteOffset16(sequence)
+	}
+	return t, nil
+}
+
+func (s *layoutSubsetter) ligatureSubst(b []byte) (*otTable, error) {
+	r := NewBinaryReader(b)
+	if format := r.ReadUint16(); format != 1 {
+		return nil, fmt.Errorf("bad ligature substitution format")
+	}
+	glyphs, indices, err := s.mapCoverage(b, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	}
+	ligatureSetCount := r.ReadUint16()
+	if r.EOF() {
+		return nil, fmt.Errorf("bad ligature substitution table")
+	}
+
+	subsetGlyphs, ligatureSets := []uint16{}, []*otTable{}
+	for i, index := range indices {
+		if int(ligatureSetCount) <= index || len(b) < 8+2*index {
+			return nil, fmt.Errorf("bad ligature substitution table")
+		}
+		ligatureSet, err := otSubtable(b, uint32(binary.BigEndian.Uint16(b[6+2*index:])))
+		if err != nil || ligatureSet == nil {
+			return nil, fmt.Errorf("bad ligature set offset")
+		}
+
+		rSet := NewBinaryReader(ligatureSet)
+		ligatureCount := rSet.ReadUint16()
+		ligatures := []*otTable{}
+		for j := 0; j < int(ligatureCount); j++ {
+			ligature, err := otSubtable(ligatureSet, uint32(rSet.ReadUint16()))
+			if err != nil || ligature == nil {
+				return nil, fmt.Errorf("bad ligature offset")
+			}
+			rLigature := NewBinaryReader(ligature)
+			ligatureGlyph := rLigature.ReadUint16()
+			componentCount := rLigature.ReadUint16()
+			components := make([]uint16, 0, componentCount)
+			for k := 1; k < int(componentCount); k++ {
+				components = append(components, rLigature.ReadUint16())
+			}
+			if rLigature.EOF() {
+				return nil, fmt.Errorf("bad ligature table")
+			}
+			subsetLigatureGlyph, ok := s.glyphMap[ligatureGlyph]
+			subsetComponents, ok2 := s.mapGlyphs(components)
+			if !ok || !ok2 {
+				continue
+			}
+
+			tLigature := newOTTable()
+			tLigature.WriteUint16(subsetLigatureGlyph)
+			tLigature.WriteUint16(componentCount)
+			for _, glyphID := range subsetComponents {
+				tLigature.WriteUint16(glyphID)
+			}
+			ligatures = append(ligatures, tLigature)
+		}
+		if rSet.EOF() {
+			return nil, fmt.Errorf("bad ligature set")
+		} else if len(ligatures) == 0 {
+			continue
+		}
+
+		tSet := newOTTable()
+		tSet.WriteUint16(uint16(len(ligatures)))
+		for _, ligature := range ligatures {
+			tSet.WriteOffset16(ligature)
+		}
+		subsetGlyphs = append(subsetGlyphs, glyphs[i])
+		ligatureSets = append(ligatureSets, tSet)
+	}
+	if len(subsetGlyphs) == 0 {
+		return nil, nil
+	}
+
+	t := newOTTable()
+	t.WriteUint16(1) // format
+	t.WriteOffset16(s.coverage(subsetGlyphs))
+	t.WriteUint16(uint16(len(ligatureSets)))
+	for _, ligatureSet := range ligatureSets {
+		t.WriteOffset16(ligatureSet)
+	}
+	return t, nil
+}
+
+// ruleSets rewrites the rule sets of a (chained) context subtable that are indexed by coverage index or class. For glyph-based rules, rules with glyphs that are not in the subset are removed. Rule sets that are indexed by class are kept as the classes remain unchanged.
+func (s *layoutSubsetter) ruleSets(b []byte, r *BinaryReader, indices []int, chained, glyphBased bool) ([]*otTable, []bool, error) {
+	count := r.ReadUint16()
+	offsets := make([]uint16, count)
+	for i := range offsets {
+		offsets[i] = r.ReadUint16()
+	}
+	if r.EOF() {
+		return nil, nil, fmt.Errorf("bad context table")
+	}
+	if indices == nil {
+		indices = make([]int, count)
+		for i := range indices {
+			indices[i] = i
+		}
+	}
+
+	ruleSets, keep := []*otTable{}, []bool{}
+	for _, index := range indices {
+		if int(count) <= index {
+			return nil, nil, fmt.Errorf("bad context table")
+		}
+		ruleSet, err := otSubtable(b, uint32(offsets[index]))
+		if err != nil {
+			return nil, nil, err
+		} else if ruleSet == nil {
+			ruleSets = append(ruleSets, nil)
+			keep = append(keep, !glyphBased)
+			continue
+		}
+
+		rSet := NewBinaryReader(ruleSet)
+		ruleCount := rSet.ReadUint16()
+		rules := []*otTable{}
+		for j := 0; j < int(ruleCount); j++ {
+			rule, err := otSubtable(ruleSet, uint32(rSet.ReadUint16()))
+			if err != nil || rule == nil {
+				return nil, nil, fmt.Errorf("bad rule offset")
+			}
+			tRule, err := s.rule(rule, chained, glyphBased)
+			if err != nil {
+				return nil, nil, err
+			} else if tRule != nil {
+				rules = append(rules, tRule)
+			}
+		}
+		if rSet.EOF() {
+			return nil, nil, fmt.Errorf("bad rule set")
+		}
+
+		tSet := newOTTable()
+		tSet.WriteUint16(uint16(len(rules)))
+		for _, rule := range rules {
+			tSet.WriteOffset16(rule)
+		}
+		ruleSets = append(ruleSets, tSet)
+		keep = append(keep, !glyphBased || 0 < len(rules))
+	}
+	return ruleSets, keep, nil
+}
+
+// rule rewrites a (chained) sequence rule, or returns nil if a glyph is not in the subset.
+func (s *layoutSubsetter) rule(b []byte, chained, glyphBased bool) (*otTable, error) {
+	r := NewBinaryReader(b)
+	t := newOTTable()
+	sequence := func(n int) bool {
+		glyphs := make([]uint16, n)
+		for i := range glyphs {
+			glyphs[i] = r.ReadUint16()
+		}
+		if glyphBased {
+			var ok bool
+			if glyphs, ok = s.mapGlyphs(glyphs); !ok {
+				return false
+			}
+		}
+		for _, glyph := range glyphs {
+			t.WriteUint16(glyph)
+		}
+		return true
+	}
+
+	ok := true
+	var seqLookupCount uint16
+	if chained {
+		backtrackCount := r.ReadUint16()
+		t.WriteUint16(backtrackCount)
+		ok = sequence(int(backtrackCount)) && ok
+		inputCount := r.ReadUint16()
+		t.WriteUint16(inputCount)
+		if inputCount == 0 {
+			return nil, fmt.Errorf("bad rule table")
+		}
+		ok = sequence(int(inputCount)-1) && ok
+		lookaheadCount := r.ReadUint16()
+		t.WriteUint16(lookaheadCount)
+		ok = sequence(int(lookaheadCount)) && ok
+		seqLookupCount = r.ReadUint16()
+		t.WriteUint16(seqLookupCount)
+	} else {
+		glyphCount := r.ReadUint16()
+		seqLookupCount = r.ReadUint16()
+		t.WriteUint16(glyphCount)
+		t.WriteUint16(seqLookupCount)
+		if glyphCount == 0 {
+			return nil, fmt.Errorf("bad rule table")
+		}
+		ok = sequence(int(glyphCount) - 1)
+	}
+	t.WriteBytes(r.ReadBytes(4 * uint32(seqLookupCount))) // seqLookupRecords
+	if r.EOF() {
+		return nil, fmt.Errorf("bad rule table")
+	} else if !ok {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// coverages rewrites an array of coverage offsets, it returns false if any coverage table no longer covers glyphs.
+func (s *layoutSubsetter) coverages(t *otTable, r *BinaryReader, b []byte) (bool, error) {
+	count := r.ReadUint16()
+	t.WriteUint16(count)
+	ok := true
+	for i := 0; i < int(count); i++ {
+		coverage, err := s.mapCoverageTable(b, r.ReadUint16())
+		if err != nil {
+			return false, err
+		} else if coverage == nil {
+			ok = false
+		}
+		t.WriteOffset16(coverage)
+	}
+	return ok, nil
+}
+
+// context rewrites a GSUB or GPOS context subtable.
+func (s *layoutSubsetter) context(b []byte) (*otTable, error) {
+	r := NewBinaryReader(b)
+	format := r.ReadUint16()
+	t := newOTTable()
+	t.WriteUint16(format)
+	switch format {
+	case 1, 2:
+		glyphs, indices, err := s.mapCoverage(b, r.ReadUint16())
+		if err != nil {
+			return nil, err
+		}
+		var classDef *otTable
+		if format == 2 {
+			if classDef, err = s.classDef(b, r.ReadUint16()); err != nil {
+				return nil, err
+			}
+			return s.classContext(t, b, r, glyphs, false, classDef)
+		}
+		ruleSets, keep, err := s.ruleSets(b, r, indices, false, true)
+		if err != nil {
+			return nil, err
+		}
+		return s.glyphContext(t, glyphs, ruleSets, keep)
+	case 3:
+		glyphCount := r.ReadUint16()
+		seqLookupCount := r.ReadUint16()
+		t.WriteUint16(glyphCount)
+		t.WriteUint16(seqLookupCount)
+		for i := 0; i < int(glyphCount); i++ {
+			coverage, err := s.mapCoverageTable(b, r.ReadUint16())
+			if err != nil {
+				return nil, err
+			} else if coverage == nil {
+				return nil, nil
+			}
+			t.WriteOffset16(coverage)
+		}
+		t.WriteBytes(r.ReadBytes(4 * uint32(seqLookupCount))) // seqLookupRecords
+	default:
+		return nil, fmt.Errorf("bad context format")
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad context table")
+	}
+	return t, nil
+}
+
+// chainedContext rewrites a GSUB or GPOS chained context subtable.
+func (s *layoutSubsetter) chainedContext(b []byte) (*otTable, error) {
+	r := NewBinaryReader(b)
+	format := r.ReadUint16()
+	t := newOTTable()
+	t.WriteUint16(format)
+	switch format {
+	case 1, 2:
+		glyphs, indices, err := s.mapCoverage(b, r.ReadUint16())
+		if err != nil {
+			return nil, err
+		}
+		if format == 2 {
+			var classDefs [3]*otTable
+			for i := range classDefs {
+				if classDefs[i], err = s.classDef(b, r.ReadUint16()); err != nil {
+					return nil, err
+				}
+			}
+			return s.classContext(t, b, r, glyphs, true, classDefs[:]...)
+		}
+		ruleSets, keep, err := s.ruleSets(b, r, indices, true, true)
+		if err != nil {
+			return nil, err
+		}
+		return s.glyphContext(t, glyphs, ruleSets, keep)
+	case 3:
+		for i := 0; i < 3; i++ {
+			if ok, err := s.coverages(t, r, b); err != nil {
+				return nil, err
+			} else if !ok {
+				return nil, nil
+			}
+		}
+		seqLookupCount := r.ReadUint16()
+		t.WriteUint16(seqLookupCount)
+		t.WriteBytes(r.ReadBytes(4 * uint32(seqLookupCount))) // seqLookupRecords
+	default:
+		return nil, fmt.Errorf("bad chained context format")
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad chained context table")
+	}
+	return t, nil
+}
+
+// glyphContext writes a glyph-based (chained) context subtable of which the format and coverage offset have been read.
+func (s *layoutSubsetter) glyphContext(t *otTable, glyphs []uint16, ruleSets []*otTable, keep []bool) (*otTable, error) {
+	subsetGlyphs, subsetRuleSets := []uint16{}, []*otTable{}
+	for i := range glyphs {
+		if keep[i] {
+			subsetGlyphs = append(subsetGlyphs, glyphs[i])
+			subsetRuleSets = append(subsetRuleSets, ruleSets[i])
+		}
+	}
+	if len(subsetGlyphs) == 0 {
+		return nil, nil
+	}
+	t.WriteOffset16(s.coverage(subsetGlyphs))
+	t.WriteUint16(uint16(len(subsetRuleSets)))
+	for _, ruleSet := range subsetRuleSets {
+		t.WriteOffset16(ruleSet)
+	}
+	return t, nil
+}
+
+// classContext writes a class-based (chained) context subtable of which the format, coverage offset, and class definition offsets have been read.
+func (s *layoutSubsetter) classContext(t *otTable, b []byte, r *BinaryReader, glyphs []uint16, chained bool, classDefs ...*otTable) (*otTable, error) {
+	if len(glyphs) == 0 {
+		return nil, nil
+	}
+	ruleSets, _, err := s.ruleSets(b, r, nil, chained, false)
+	if err != nil {
+		return nil, err
+	}
+	t.WriteOffset16(s.coverage(glyphs))
+	for _, classDef := range classDefs {
+		t.WriteOffset16(classDef)
+	}
+	t.WriteUint16(uint16(len(ruleSets)))
+	for _, ruleSet := range ruleSets {
+		t.WriteOffset16(ruleSet)
+	}
+	return t, nil
+}
+
+func (s *layoutSubsetter) reverseChainedSubst(b []byte) (*otTable, error) {
+	r := NewBinaryReader(b)
+	if format := r.ReadUint16(); format != 1 {
+		return nil, fmt.Errorf("bad reverse chained substitution format")
+	}
+	glyphs, indices, err := s.mapCoverage(b, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	}
+
+	tCoverages := newOTTable()
+	for i := 0; i < 2; i++ {
+		if ok, err := s.coverages(tCoverages, r, b); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, nil
+		}
+	}
+	glyphCount := r.ReadUint16()
+	substitutes := make([]uint16, glyphCount)
+	for i := range substitutes {
+		substitutes[i] = r.ReadUint16()
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad reverse chained substitution table")
+	}
+
+	subsetGlyphs, subsetSubstitutes := []uint16{}, []uint16{}
+	for i, index := range indices {
+		if index < len(substitutes) {
+			if substitute, ok := s.glyphMap[substitutes[index]]; ok {
+				subsetGlyphs = append(subsetGlyphs, glyphs[i])
+				subsetSubstitutes = append(subsetSubstitutes, substitute)
+			}
+		}
+	}
+	if len(subsetGlyphs) == 0 {
+		return nil, nil
+	}
+
+	t := newOTTable()
+	t.WriteUint16(1) // format
+	t.WriteOffset16(s.coverage(subsetGlyphs))
+	for _, link := range tCoverages.links {
+		link.pos += t.Len()
+		t.links = append(t.links, link)
+	}
+	t.WriteBytes(tCoverages.Bytes())
+	t.WriteUint16(uint16(len(subsetSubstitutes)))
+	for _, substitute := range subsetSubstitutes {
+		t.WriteUint16(substitute)
+	}
+	return t, nil
+}
+
+func (s *layoutSubsetter) singlePos(b []byte) (*otTable, error) {
+	r := NewBinaryReader(b)
+	format := r.ReadUint16()
+	glyphs, indices, err := s.mapCoverage(b, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	} else if len(glyphs) == 0 {
+		return nil, nil
+	}
+	valueFormat := r.ReadUint16()
+
+	t := newOTTable()
+	t.WriteUint16(format)
+	t.WriteOffset16(s.coverage(glyphs))
+	t.WriteUint16(valueFormat)
+	if format == 1 {
+		valueRecord(t, r, b, valueFormat)
+	} else if format == 2 {
+		valueCount := r.ReadUint16()
+		size := 2 * uint32(bits.OnesCount16(valueFormat&0xFF))
+		t.WriteUint16(uint16(len(indices)))
+		for _, index := range indices {
+			if int(valueCount) <= index {
+				return nil, fmt.Errorf("bad single positioning table")
+			}
+			r.Seek(8 + uint32(index)*size)
+			valueRecord(t, r, b, valueFormat)
+		}
+	} else {
+		return nil, fmt.Errorf("bad single positioning format")
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad single positioning table")
+	}
+	return t, nil
+}
+
+func (s *layoutSubsetter) pairPos(b []byte) (*otTable, error) {
+	r := NewBinaryReader(b)
+	format := r.ReadUint16()
+	glyphs, indices, err := s.mapCoverage(b, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	}
+	valueFormat1 := r.ReadUint16()
+	valueFormat2 := r.ReadUint16()
+	size1 := 2 * uint32(bits.OnesCount16(valueFormat1&0xFF))
+	size2 := 2 * uint32(bits.OnesCount16(valueFormat2&0xFF))
+
+	t := newOTTable()
+	t.WriteUint16(format)
+	if format == 1 {
+		pairSetCount := r.ReadUint16()
+		if r.EOF() {
+			return nil, fmt.Errorf("bad pair positioning table")
+		}
+		subsetGlyphs, pairSets := []uint16{}, []*otTable{}
+		for i, index := range indices {
+			if int(pairSetCount) <= index || len(b) < 12+2*index {
+				return nil, fmt.Errorf("bad pair positioning table")
+			}
+			pairSet, err := otSubtable(b, uint32(binary.BigEndian.Uint16(b[10+2*index:])))
+			if err != nil || pairSet == nil {
+				return nil, fmt.Errorf("bad pair set offset")
+			}
+
+			// sort pairs by the new glyph ID of the second glyph
+			rSet := NewBinaryReader(pairSet)
+			pairValueCount := rSet.ReadUint16()
+			secondGlyphs, records := []uint16{}, []int{}
+			for j := 0; j < int(pairValueCount); j++ {
+				rSet.Seek(2 + uint32(j)*(2+size1+size2))
+				if secondGlyph, ok := s.glyphMap[rSet.ReadUint16()]; ok {
+					secondGlyphs = append(secondGlyphs, secondGlyph)
+					records = append(records, j)
+				}
+			}
+			if rSet.EOF() {
+				return nil, fmt.Errorf("bad pair set")
+			} else if len(secondGlyphs) == 0 {
+				continue
+			}
+			sort.Sort(coverageSorter{secondGlyphs, records})
+
+			tSet := newOTTable()
+			tSet.WriteUint16(uint16(len(records)))
+			for j, record := range records {
+				rSet.Seek(4 + uint32(record)*(2+size1+size2))
+				tSet.WriteUint16(secondGlyphs[j])
+				valueRecord(tSet, rSet, pairSet, valueFormat1)
+				valueRecord(tSet, rSet, pairSet, valueFormat2)
+			}
+			if rSet.EOF() {
+				return nil, fmt.Errorf("bad pair set")
+			}
+			subsetGlyphs = append(subsetGlyphs, glyphs[i])
+			pairSets = append(pairSets, tSet)
+		}
+		if len(subsetGlyphs) == 0 {
+			return nil, nil
+		}
+		t.WriteOffset16(s.coverage(subsetGlyphs))
+		t.WriteUint16(valueFormat1)
+		t.WriteUint16(valueFormat2)
+		t.WriteUint16(uint16(len(pairSets)))
+		for _, pairSet := range pairSets {
+			t.WriteOffset16(pairSet)
+		}
+	} else if format == 2 {
+		if len(glyphs) == 0 {
+			return nil, nil
+		}
+		classDef1, err := s.classDef(b, r.ReadUint16())
+		if err != nil {
+			return nil, err
+		}
+		classDef2, err := s.classDef(b, r.ReadUint16())
+		if err != nil {
+			return nil, err
+		}
+		class1Count := r.ReadUint16()
+		class2Count := r.ReadUint16()
+
+		t.WriteOffset16(s.coverage(glyphs))
+		t.WriteUint16(valueFormat1)
+		t.WriteUint16(valueFormat2)
+		t.WriteOffset16(classDef1)
+		t.WriteOffset16(classDef2)
+		t.WriteUint16(class1Count)
+		t.WriteUint16(class2Count)
+		for i := 0; i < int(class1Count)*int(class2Count); i++ {
+			valueRecord(t, r, b, valueFormat1)
+			valueRecord(t, r, b, valueFormat2)
+		}
+	} else {
+		return nil, fmt.Errorf("bad pair positioning format")
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad pair positioning table")
+	}
+	return t, nil
+}
+
+func (s *layoutSubsetter) cursivePos(b []byte) (*otTable, error) {
+	r := NewBinaryReader(b)
+	if format := r.ReadUint16(); format != 1 {
+		return nil, fmt.Errorf("bad cursive positioning format")
+	}
+	glyphs, indices, err := s.mapCoverage(b, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	} else if len(glyphs) == 0 {
+		return nil, nil
+	}
+	entryExitCount := r.ReadUint16()
+
+	t := newOTTable()
+	t.WriteUint16(1) // format
+	t.WriteOffset16(s.coverage(glyphs))
+	t.WriteUint16(uint16(len(indices)))
+	for _, index := range indices {
+		if int(entryExitCount) <= index {
+			return nil, fmt.Errorf("bad cursive positioning table")
+		}
+		r.Seek(6 + 4*uint32(index))
+		for j := 0; j < 2; j++ {
+			tAnchor, err := anchor(b, r.ReadUint16())
+			if err != nil {
+				return nil, err
+			}
+			t.WriteOffset16(tAnchor)
+		}
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad cursive positioning table")
+	}
+	return t, nil
+}
+
+// anchorArray rewrites a mark, base, mark2, or component array for the records at the given indices, where each record has a number of anchors. Mark records are preceded by their class.
+func anchorArray(table []byte, indices []int, anchorCount int, mark bool) (*otTable, error) {
+	r := NewBinaryReader(table)
+	count := r.ReadUint16()
+	size := 2 * uint32(anchorCount)
+	if mark {
+		size += 2
+	}
+
+	t := newOTTable()
+	t.WriteUint16(uint16(len(indices)))
+	for _, index := range indices {
+		if int(count) <= index {
+			return nil, fmt.Errorf("bad anchor array")
+		}
+		r.Seek(2 + uint32(index)*size)
+		if mark {
+			t.WriteUint16(r.ReadUint16()) // markClass
+		}
+		for j := 0; j < anchorCount; j++ {
+			tAnchor, err := anchor(table, r.ReadUint16())
+			if err != nil {
+				return nil, err
+			}
+			t.WriteOffset16(tAnchor)
+		}
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad anchor array")
+	}
+	return t, nil
+}
+
+// markBasePos rewrites a mark-to-base or mark-to-mark positioning subtable.
+func (s *layoutSubsetter) markBasePos(b []byte) (*otTable, error) {
+	r := NewBinaryReader(b)
+	if format := r.ReadUint16(); format != 1 {
+		return nil, fmt.Errorf("bad mark positioning format")
+	}
+	markGlyphs, markIndices, err := s.mapCoverage(b, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	}
+	baseGlyphs, baseIndices, err := s.mapCoverage(b, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	}
+	markClassCount := r.ReadUint16()
+	markArrayOffset := r.ReadUint16()
+	baseArrayOffset := r.ReadUint16()
+	if r.EOF() {
+		return nil, fmt.Errorf("bad mark positioning table")
+	} else if len(markGlyphs) == 0 || len(baseGlyphs) == 0 {
+		return nil, nil
+	}
+
+	markArray, err := otSubtable(b, uint32(markArrayOffset))
+	if err != nil || markArray == nil {
+		return nil, fmt.Errorf("bad mark array offset")
+	}
+	tMarkArray, err := anchorArray(markArray, markIndices, 1, true)
+	if err != nil {
+		return nil, err
+	}
+	baseArray, err := otSubtable(b, uint32(baseArrayOffset))
+	if err != nil || baseArray == nil {
+		return nil, fmt.Errorf("bad base array offset")
+	}
+	tBaseArray, err := anchorArray(baseArray, baseIndices, int(markClassCount), false)
+	if err != nil {
+		return nil, err
+	}
+
+	t := newOTTable()
+	t.WriteUint16(1) // format
+	t.WriteOffset16(s.coverage(markGlyphs))
+	t.WriteOffset16(s.coverage(baseGlyphs))
+	t.WriteUint16(markClassCount)
+	t.WriteOffset16(tMarkArray)
+	t.WriteOffset16(tBaseArray)
+	return t, nil
+}
+
+func (s *layoutSubsetter) markLigPos(b []byte) (*otTable, error) {
+	r := NewBinaryReader(b)
+	if format := r.ReadUint16(); format != 1 {
+		return nil, fmt.Errorf("bad mark-to-ligature positioning format")
+	}
+	markGlyphs, markIndices, err := s.mapCoverage(b, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	}
+	ligatureGlyphs, ligatureIndices, err := s.mapCoverage(b, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	}
+	markClassCount := r.ReadUint16()
+	markArrayOffset := r.ReadUint16()
+	ligatureArrayOffset := r.ReadUint16()
+	if r.EOF() {
+		return nil, fmt.Errorf("bad mark-to-ligature positioning table")
+	} else if len(markGlyphs) == 0 || len(ligatureGlyphs) == 0 {
+		return nil, nil
+	}
+
+	markArray, err := otSubtable(b, uint32(markArrayOffset))
+	if err != nil || markArray == nil {
+		return nil, fmt.Errorf("bad mark array offset")
+	}
+	tMarkArray, err := anchorArray(markArray, markIndices, 1, true)
+	if err != nil {
+		return nil, err
+	}
+
+	ligatureArray, err := otSubtable(b, uint32(ligatureArrayOffset))
+	if err != nil || ligatureArray == nil {
+		return nil, fmt.Errorf("bad ligature array offset")
+	}
+	rArray := NewBinaryReader(ligatureArray)
+	ligatureCount := rArray.ReadUint16()
+	tArray := newOTTable()
+	tArray.WriteUint16(uint16(len(ligatureIndices)))
+	for _, index := range ligatureIndices {
+		if int(ligatureCount) <= index {
+			return nil, fmt.Errorf("bad ligature array")
+		}
+		rArray.Seek(2 + 2*uint32(index))
+		ligatureAttach, err := otSubtable(ligatureArray, uint32(rArray.ReadUint16()))
+		if err != nil || len(ligatureAttach) < 2 {
+			return nil, fmt.Errorf("bad ligature attach offset")
+		}
+		componentCount := binary.BigEndian.Uint16(ligatureAttach)
+		indices := make([]int, componentCount)
+		for i := range indices {
+			indices[i] = i
+		}
+		tAttach, err := anchorArray(ligatureAttach, indices, int(markClassCount), false)
+		if err != nil {
+			return nil, err
+		}
+		tArray.WriteOffset16(tAttach)
+	}
+	if rArray.EOF() {
+		return nil, fmt.Errorf("bad ligature array")
+	}
+
+	t := newOTTable()
+	t.WriteUint16(1) // format
+	t.WriteOffset16(s.coverage(markGlyphs))
+	t.WriteOffset16(s.coverage(ligatureGlyphs))
+	t.WriteUint16(markClassCount)
+	t.WriteOffset16(tMarkArray)
+	t.WriteOffset16(tArray)
+	return t, nil
+}
+
+// gdef rewrites a GDEF table. The item variation store is removed.
+func (s *layoutSubsetter) gdef(b []byte) (*otTable, error) {
+	r := NewBinaryReader(b)
+	majorVersion := r.ReadUint16()
+	minorVersion := r.ReadUint16()
+	if majorVersion != 1 {
+		return nil, fmt.Errorf("bad version")
+	}
+	glyphClassDefOffset := r.ReadUint16()
+	attachListOffset := r.ReadUint16()
+	ligCaretListOffset := r.ReadUint16()
+	markAttachClassDefOffset := r.ReadUint16()
+	var markGlyphSetsDefOffset uint16
+	if 2 <= minorVersion {
+		markGlyphSetsDefOffset = r.ReadUint16()
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad table")
+	}
+
+	glyphClassDef, err := s.classDef(b, glyphClassDefOffset)
+	if err != nil {
+		return nil, err
+	}
+	attachList, err := s.attachList(b, attachListOffset)
+	if err != nil {
+		return nil, err
+	}
+	ligCaretList, err := s.ligCaretList(b, ligCaretListOffset)
+	if err != nil {
+		return nil, err
+	}
+	markAttachClassDef, err := s.classDef(b, markAttachClassDefOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	t := newOTTable()
+	t.WriteUint16(1) // majorVersion
+	if 2 <= minorVersion {
+		t.WriteUint16(2) // minorVersion
+	} else {
+		t.WriteUint16(0) // minorVersion
+	}
+	t.WriteOffset16(glyphClassDef)
+	t.WriteOffset16(attachList)
+	t.WriteOffset16(ligCaretList)
+	t.WriteOffset16(markAttachClassDef)
+	if 2 <= minorVersion {
+		markGlyphSetsDef, err := s.markGlyphSetsDef(b, markGlyphSetsDefOffset)
+		if err != nil {
+			return nil, err
+		}
+		t.WriteOffset16(markGlyphSetsDef)
+	}
+	return t, nil
+}
+
+// glyphTables rewrites an attachment point list or ligature caret list, where the table of each glyph is copied by the given function.
+func (s *layoutSubsetter) glyphTables(b []byte, offset uint16, copyTable func([]byte) (*otTable, error)) (*otTable, error) {
+	table, err := otSubtable(b, uint32(offset))
+	if err != nil || table == nil {
+		return nil, err
+	}
+	r := NewBinaryReader(table)
+	glyphs, indices, err := s.mapCoverage(table, r.ReadUint16())
+	if err != nil {
+		return nil, err
+	} else if len(glyphs) == 0 {
+		return nil, nil
+	}
+	count := r.ReadUint16()
+
+	t := newOTTable()
+	t.WriteOffset16(s.coverage(glyphs))
+	t.WriteUint16(uint16(len(indices)))
+	for _, index := range indices {
+		if int(count) <= index {
+			return nil, fmt.Errorf("bad glyph table list")
+		}
+		r.Seek(4 + 2*uint32(index))
+		glyphTable, err := otSubtable(table, uint32(r.ReadUint16()))
+		if err != nil || glyphTable == nil {
+			return nil, fmt.Errorf("bad glyph table offset")
+		}
+		tGlyph, err := copyTable(glyphTable)
+		if err != nil {
+			return nil, err
+		}
+		t.WriteOffset16(tGlyph)
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad glyph table list")
+	}
+	return t, nil
+}
+
+func (s *layoutSubsetter) attachList(b []byte, offset uint16) (*otTable, error) {
+	return s.glyphTables(b, offset, func(b []byte) (*otTable, error) {
+		if len(b) < 2 || len(b) < 2+2*int(binary.BigEndian.Uint16(b)) {
+			return nil, fmt.Errorf("bad attach point table")
+		}
+		t := newOTTable()
+		t.WriteBytes(b[:2+2*int(binary.BigEndian.Uint16(b))])
+		return t, nil
+	})
+}
+
+func (s *layoutSubsetter) ligCaretList(b []byte, offset uint16) (*otTable, error) {
+	return s.glyphTables(b, offset, func(b []byte) (*otTable, error) {
+		r := NewBinaryReader(b)
+		caretCount := r.ReadUint16()
+		t := newOTTable()
+		t.WriteUint16(caretCount)
+		for i := 0; i < int(caretCount); i++ {
+			caretValue, err := otSubtable(b, uint32(r.ReadUint16()))
+			if err != nil || len(caretValue) < 4 {
+				return nil, fmt.Errorf("bad caret value offset")
+			}
+			tCaret := newOTTable()
+			tCaret.WriteBytes(caretValue[:4]) // format and coordinate or point index
+			if format := binary.BigEndian.Uint16(caretValue); format == 3 {
+				if len(caretValue) < 6 {
+					return nil, fmt.Errorf("bad caret value")
+				}
+				tCaret.WriteOffset16(device(caretValue, binary.BigEndian.Uint16(caretValue[4:])))
+			} else if format != 1 && format != 2 {
+				return nil, fmt.Errorf("bad caret value format")
+			}
+			t.WriteOffset16(tCaret)
+		}
+		if r.EOF() {
+			return nil, fmt.Errorf("bad ligature glyph table")
+		}
+		return t, nil
+	})
+}
+
+func (s *layoutSubsetter) markGlyphSetsDef(b []byte, offset uint16) (*otTable, error) {
+	table, err := otSubtable(b, uint32(offset))
+	if err != nil || table == nil {
+		return nil, err
+	}
+	r := NewBinaryReader(table)
+	if format := r.ReadUint16(); format != 1 {
+		return nil, fmt.Errorf("bad mark glyph sets format")
+	}
+	markGlyphSetCount := r.ReadUint16()
+
+	t := newOTTable()
+	t.WriteUint16(1) // format
+	t.WriteUint16(markGlyphSetCount)
+	for i := 0; i < int(markGlyphSetCount); i++ {
+		coverage, err := otSubtable(table, r.ReadUint32())
+		if err != nil || coverage == nil {
+			return nil, fmt.Errorf("bad coverage offset")
+		}
+		glyphs, _, err := s.subsetCoverage(coverage)
+		if err != nil {
+			return nil, err
+		}
+		t.WriteOffset32(s.coverage(glyphs))
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad mark glyph sets")
+	}
+	return t, nil
+}
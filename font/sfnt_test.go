@@ -30,6 +30,19 @@ func TestSFNTDejaVuSerifTTF(t *testing.T) {
 	test.T(t, len(contour.XCoordinates), 0)
 }
 
+func TestSFNTCFFGlyphName(t *testing.T) {
+	b, err := ioutil.ReadFile("../resources/EBGaramond12-Regular.otf")
+	test.Error(t, err)
+
+	sfnt, err := ParseSFNT(b, 0)
+	test.Error(t, err)
+
+	test.T(t, sfnt.CFF.FontName(), "EBGaramond12-Regular")
+	test.T(t, sfnt.CFF.GlyphName(0), ".notdef")
+	test.T(t, sfnt.GlyphName(sfnt.GlyphIndex('a')), "a")
+	test.T(t, sfnt.GlyphName(sfnt.GlyphIndex('\uFB01')), "uniFB01")
+}
+
 func TestSFNTWrite(t *testing.T) {
 	b, err := ioutil.ReadFile("../resources/DejaVuSerif.ttf")
 	test.Error(t, err)
@@ -68,3 +81,32 @@ func TestSFNTSubset(t *testing.T) {
 
 	//ioutil.WriteFile("out.otf", subset, 0644)
 }
+
+func TestSFNTSubsetLayout(t *testing.T) {
+	b, err := ioutil.ReadFile("../resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	sfnt, err := ParseSFNT(b, 0)
+	test.Error(t, err)
+
+	f, i, fi := sfnt.GlyphIndex('f'), sfnt.GlyphIndex('i'), sfnt.GlyphIndex('\uFB01')
+	subset, glyphIDs := sfnt.Subset([]uint16{0, f, i}, WriteMinTables)
+	sfntSubset, err := ParseSFNT(subset, 0)
+	test.Error(t, err)
+
+	glyphMap := map[uint16]uint16{}
+	for subsetGlyphID, glyphID := range glyphIDs {
+		glyphMap[glyphID] = uint16(subsetGlyphID)
+	}
+	_, ok := glyphMap[fi]
+	test.That(t, ok, "fi ligature must be in subset")
+	for _, tag := range []string{"GDEF", "GPOS", "GSUB"} {
+		_, ok := sfntSubset.Tables[tag]
+		test.That(t, ok, tag, "table must be in subset")
+	}
+
+	glyphs := map[uint16]bool{glyphMap[f]: true, glyphMap[i]: true}
+	test.Error(t, sfntSubset.layoutClosure(glyphs))
+	test.That(t, glyphs[glyphMap[fi]], "fi ligature must be substituted in subset")
+	test.T(t, len(glyphs), len(glyphIDs)-1)
+}
@@ -96,6 +96,27 @@ func (sfnt *SFNT) Subset(glyphIDs []uint16, writeTables WriteTables) ([]byte, []
 		glyphMap[glyphID] = uint16(subsetGlyphID)
 	}
 
+	// add glyphs that may be substituted for the glyphs, such as ligatures
+	if writeTables != WritePDFTables {
+		closure := make(map[uint16]bool, len(glyphIDs))
+		for _, glyphID := range glyphIDs {
+			closure[glyphID] = true
+		}
+		if err := sfnt.layoutClosure(closure); err == nil {
+			closureIDs := []uint16{}
+			for glyphID := range closure {
+				if _, ok := glyphMap[glyphID]; !ok && glyphID < sfnt.Maxp.NumGlyphs {
+					closureIDs = append(closureIDs, glyphID)
+				}
+			}
+			sort.Slice(closureIDs, func(i, j int) bool { return closureIDs[i] < closureIDs[j] })
+			for _, glyphID := range closureIDs {
+				glyphMap[glyphID] = uint16(len(glyphIDs))
+				glyphIDs = append(glyphIDs, glyphID)
+			}
+		}
+	}
+
 	// add dependencies for composite glyphs
 	origLen := len(glyphIDs)
 	for i := 0; i < origLen; i++ {
@@ -115,7 +136,7 @@ func (sfnt *SFNT) Subset(glyphIDs []uint16, writeTables WriteTables) ([]byte, []
 	// specify tables to include
 	var tags []string
 	if writeTables == WriteMinTables {
-		tags := []string{"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post"}
+		tags = []string{"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post"}
 		if sfnt.IsTrueType {
 			tags = append(tags, "glyf", "loca")
 		} else if sfnt.IsCFF {
@@ -125,6 +146,11 @@ func (sfnt *SFNT) Subset(glyphIDs []uint16, writeTables WriteTables) ([]byte, []
 				tags = append(tags, "CFF ")
 			}
 		}
+		for _, tag := range []string{"GDEF", "GPOS", "GSUB"} {
+			if _, ok := sfnt.Tables[tag]; ok {
+				tags = append(tags, tag)
+			}
+		}
 	} else if writeTables == WritePDFTables {
 		if sfnt.IsTrueType {
 			tags = append(tags, "glyf", "head", "hhea", "hmtx", "loca", "maxp")
@@ -174,6 +200,27 @@ func (sfnt *SFNT) Subset(glyphIDs []uint16, writeTables WriteTables) ([]byte, []
 	}
 	sort.Strings(tags)
 
+	// subset layout tables, tables that cannot be subset are removed
+	layoutTables := map[string][]byte{}
+	for i := 0; i < len(tags); i++ {
+		var b []byte
+		var err error
+		switch tags[i] {
+		case "GDEF":
+			b, err = sfnt.subsetGDEF(glyphMap)
+		case "GPOS", "GSUB":
+			b, err = sfnt.subsetLayout(tags[i], glyphMap)
+		default:
+			continue
+		}
+		if err != nil {
+			tags = append(tags[:i], tags[i+1:]...)
+			i--
+			continue
+		}
+		layoutTables[tags[i]] = b
+	}
+
 	// write header
 	w := NewBinaryWriter([]byte{})
 	if sfnt.IsTrueType {
@@ -398,9 +445,10 @@ func (sfnt *SFNT) Subset(glyphIDs []uint16, writeTables WriteTables) ([]byte, []
 					w.WriteInt16(pair.Value)
 				}
 			}
+		case "GDEF", "GPOS", "GSUB":
+			w.WriteBytes(layoutTables[tag])
 		default:
 			// TODO: compress name table
-			// TODO: GDEF, GSUB, GPOS tables for ligatures
 			w.WriteBytes(sfnt.Tables[tag])
 		}
 		lengths[i] = w.Len() - offsets[i]
@@ -62,6 +62,6 @@ require (
 	golang.org/x/exp/shiny v0.0.0-20230315142452-642cacee5cc0 // indirect
 	golang.org/x/mobile v0.0.0-20230301163155-e0f57694e12c // indirect
 	golang.org/x/net v0.8.0
-	golang.org/x/sys v0.6.0 // indirect
+	golang.org/x/sys v0.6.0
 	star-tex.org/x/tex v0.4.0
 )
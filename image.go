@@ -2,10 +2,13 @@ package canvas
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
 	"io"
+
+	"golang.org/x/image/webp"
 )
 
 // ImageEncoding defines whether the embedded image shall be embedded as lossless (typically PNG) or lossy (typically JPG).
@@ -17,11 +20,60 @@ const (
 	Lossy
 )
 
-// Image is a raster image. Keeping the original bytes allows the renderer to optimize rendering in some cases.
+// Interpolation is the resampling kernel used when drawing a scaled or transformed image.
+type Interpolation int
+
+// see Interpolation
+const (
+	DefaultInterpolation  Interpolation = iota // renderer's default, bicubic for the rasterizer
+	NearestInterpolation                       // nearest neighbor, for pixel art
+	BilinearInterpolation                      // linear interpolation between the nearest 2x2 pixels
+	BicubicInterpolation                       // Catmull-Rom interpolation between the nearest 4x4 pixels
+	LanczosInterpolation                       // Lanczos-3 windowed sinc
+	AreaInterpolation                          // averages the covered pixels, for downscaling
+)
+
+func (interpolation Interpolation) String() string {
+	switch interpolation {
+	case DefaultInterpolation:
+		return "Default"
+	case NearestInterpolation:
+		return "Nearest"
+	case BilinearInterpolation:
+		return "Bilinear"
+	case BicubicInterpolation:
+		return "Bicubic"
+	case LanczosInterpolation:
+		return "Lanczos"
+	case AreaInterpolation:
+		return "Area"
+	}
+	return fmt.Sprintf("Interpolation(%d)", int(interpolation))
+}
+
+// Image is a raster image. Keeping the original bytes allows the renderer to optimize rendering in some cases. The interpolation is a hint to the renderer for which resampling kernel to use.
 type Image struct {
 	image.Image
-	Mimetype string
-	Bytes    []byte
+	Mimetype      string
+	Bytes         []byte
+	Interpolation Interpolation
+}
+
+// ImageInterpolation returns the interpolation hint of an image, which is only set for an Image.
+func ImageInterpolation(img image.Image) Interpolation {
+	if cimg, ok := img.(Image); ok {
+		return cimg.Interpolation
+	}
+	return DefaultInterpolation
+}
+
+// WithInterpolation returns the image with the given interpolation hint. The original bytes of an Image are kept.
+func WithInterpolation(img image.Image, interpolation Interpolation) Image {
+	if cimg, ok := img.(Image); ok {
+		cimg.Interpolation = interpolation
+		return cimg
+	}
+	return Image{Image: img, Interpolation: interpolation}
 }
 
 // NewJPEGImage parses a JPEG image.
@@ -34,6 +86,11 @@ func NewPNGImage(r io.Reader) (Image, error) {
 	return newImage("image/png", png.Decode, r)
 }
 
+// NewWEBPImage parses a WebP image, both lossy and lossless.
+func NewWEBPImage(r io.Reader) (Image, error) {
+	return newImage("image/webp", webp.Decode, r)
+}
+
 func newImage(mimetype string, decode func(io.Reader) (image.Image, error), r io.Reader) (Image, error) {
 	// TODO: use lazy decoding
 	var buffer bytes.Buffer
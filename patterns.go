@@ -88,12 +88,23 @@ func (p *HatchPattern) SetColorSpace(colorSpace ColorSpace) Pattern {
 		return p
 	}
 
+	pattern := *p
 	if p.Fill.IsGradient() {
-		p.Fill.Gradient.SetColorSpace(colorSpace)
+		pattern.Fill.Gradient = p.Fill.Gradient.SetColorSpace(colorSpace)
 	} else if p.Fill.IsColor() {
-		p.Fill.Color = colorSpace.ToLinear(p.Fill.Color)
+		pattern.Fill.Color = colorSpace.ToLinear(p.Fill.Color)
 	}
-	return p
+	return &pattern
+}
+
+// Cell returns the primitive cell of the hatch pattern. The hatch repeats itself along the cell's axes with unit steps, which allows renderers to use native tiling patterns.
+func (p *HatchPattern) Cell() Matrix {
+	return p.cell
+}
+
+// Hatch returns the unclipped and unstroked hatch that covers the rectangle (x0,y0)-(x1,y1) in the cell's coordinate system. The returned path is transformed by the cell.
+func (p *HatchPattern) Hatch(x0, y0, x1, y1 float64) *Path {
+	return p.hatch(x0, y0, x1, y1).Transform(p.cell)
 }
 
 // Tile tiles the hatch pattern within the clipping path.
@@ -168,15 +179,19 @@ func NewCrossHatch(ifill interface{}, angle0, angle1, distance0, distance1, thic
 // NewShapeHatch returns a new shape hatch that repeats the given shape over a rhombus primitive cell with sides of length distance. Thickness is the stroke thickness applied to the shape; stroking is ignored with thickness is zero.
 func NewShapeHatch(ifill interface{}, shape *Path, distance, thickness float64) *HatchPattern {
 	d := distance * math.Sin(60.0*math.Pi/180.0)
-	cell := SquareCell(1.0)
+	cell := PrimitiveCell(Point{distance, 0.0}, Point{distance / 2.0, d})
+	return NewTileHatch(ifill, shape.Transform(cell.Inv()), cell, thickness)
+}
+
+// NewTileHatch returns a new hatch pattern that repeats the given tile along the axes of the primitive cell. The tile is expressed in the unit cell's coordinate system and may extend beyond the unit cell. Thickness is the stroke thickness applied to the tile; stroking is ignored with thickness is zero.
+func NewTileHatch(ifill interface{}, tile *Path, cell Matrix, thickness float64) *HatchPattern {
+	bounds := tile.FastBounds()
 	return NewHatchPattern(ifill, thickness, cell, func(x0, y0, x1, y1 float64) *Path {
+		// tiles are placed on the lattice points, include the neighbouring cells for tiles that extend beyond the rectangle
 		p := &Path{}
-		for y := math.Floor(y0/distance) * distance; y <= y1; y += 2.0 * d {
-			for x := math.Floor(x0/distance) * distance; x <= x1; x += distance {
-				p = p.Append(shape.Translate(x, y))
-			}
-			for x := (math.Floor(x0/distance) + 0.5) * distance; x <= x1; x += distance {
-				p = p.Append(shape.Translate(x, y+d))
+		for y := math.Floor(y0-bounds.Y-bounds.H) - 1.0; y <= y1-bounds.Y+1.0; y += 1.0 {
+			for x := math.Floor(x0-bounds.X-bounds.W) - 1.0; x <= x1-bounds.X+1.0; x += 1.0 {
+				p = p.Append(tile.Translate(x, y))
 			}
 		}
 		return p
@@ -0,0 +1,493 @@
+package renderers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/lottie"
+	"github.com/tdewolff/canvas/renderers/rasterizer"
+	"github.com/tdewolff/canvas/renderers/svg"
+)
+
+// AnimationOptions are options for animated output.
+type AnimationOptions struct {
+	LoopCount    int  // number of times the animation is played, zero plays indefinitely
+	SVGKeyframes bool // use CSS keyframes instead of SMIL animations for SVG
+}
+
+// AnimationWriter can write a sequence of canvases as an animation to a writer.
+type AnimationWriter func(w io.Writer, frames []*canvas.Canvas, delays []time.Duration) error
+
+func animationErrorWriter(err error) AnimationWriter {
+	return func(_ io.Writer, _ []*canvas.Canvas, _ []time.Duration) error {
+		return err
+	}
+}
+
+// WriteAnimation writes a sequence of canvases to an animated APNG, GIF, or SVG file, depending on the file extension. Lottie animations have no distinct file extension and are written using AnimatedLottie. Each frame is shown for the duration of its delay, or all frames are shown for the same duration if only one delay is given. All frames must have the same size.
+func WriteAnimation(filename string, frames []*canvas.Canvas, delays []time.Duration, opts ...interface{}) error {
+	var writer AnimationWriter
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".png", ".apng":
+		writer = APNG(opts...)
+	case ".gif":
+		writer = AnimatedGIF(opts...)
+	case ".svg", ".svgz":
+		if ext == ".svgz" {
+			options := svg.DefaultOptions
+			options.Compression = -1
+			for _, opt := range opts {
+				if o, ok := opt.(*svg.Options); ok {
+					options = *o
+					options.Compression = -1
+				}
+			}
+			opts = append(opts, &options)
+		}
+		writer = AnimatedSVG(opts...)
+	default:
+		return fmt.Errorf("unknown animation file extension: %v", ext)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = writer(f, frames, delays); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func animationDelays(frames []*canvas.Canvas, delays []time.Duration) ([]time.Duration, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frames")
+	} else if len(delays) == 1 && len(frames) != 1 {
+		delay := delays[0]
+		delays = make([]time.Duration, len(frames))
+		for i := range delays {
+			delays[i] = delay
+		}
+	} else if len(delays) != len(frames) {
+		return nil, fmt.Errorf("number of delays must equal the number of frames")
+	}
+	for i, frame := range frames {
+		if delays[i] < 0 {
+			return nil, fmt.Errorf("negative delay for frame %d", i)
+		} else if frame.W != frames[0].W || frame.H != frames[0].H {
+			return nil, fmt.Errorf("frame %d has a different size than the first frame", i)
+		}
+	}
+	return delays, nil
+}
+
+// APNG returns an animation writer for animated portable network graphics. Frames after the first only store the region that changed with respect to the previous frame.
+func APNG(opts ...interface{}) AnimationWriter {
+	resolution := canvas.DPMM(1.0)
+	colorSpace := canvas.DefaultColorSpace
+	var rasterOptions *rasterizer.Options
+	var options AnimationOptions
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case canvas.Resolution:
+			resolution = o
+		case canvas.ColorSpace:
+			colorSpace = o
+		case *rasterizer.Options:
+			rasterOptions = o
+		case *AnimationOptions:
+			options = *o
+		default:
+			return animationErrorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, frames []*canvas.Canvas, delays []time.Duration) error {
+		delays, err := animationDelays(frames, delays)
+		if err != nil {
+			return err
+		}
+
+		bw := bufio.NewWriter(w)
+		bw.WriteString("\x89PNG\r\n\x1a\n")
+
+		var prev *image.RGBA
+		seq := uint32(0)
+		for i, frame := range frames {
+			img := rasterizer.DrawWithOptions(frame, resolution, colorSpace, rasterOptions)
+			if i == 0 {
+				size := img.Bounds().Size()
+				ihdr := make([]byte, 13)
+				binary.BigEndian.PutUint32(ihdr[0:], uint32(size.X))
+				binary.BigEndian.PutUint32(ihdr[4:], uint32(size.Y))
+				ihdr[8] = 8 // bit depth
+				ihdr[9] = 6 // truecolor with alpha
+				writePNGChunk(bw, "IHDR", ihdr)
+
+				actl := make([]byte, 8)
+				binary.BigEndian.PutUint32(actl[0:], uint32(len(frames)))
+				binary.BigEndian.PutUint32(actl[4:], uint32(options.LoopCount))
+				writePNGChunk(bw, "acTL", actl)
+			}
+
+			rect := img.Bounds()
+			if prev != nil {
+				rect = changedRect(prev, img)
+			}
+			num, den := apngDelay(delays[i])
+			fctl := make([]byte, 26)
+			binary.BigEndian.PutUint32(fctl[0:], seq)
+			binary.BigEndian.PutUint32(fctl[4:], uint32(rect.Dx()))
+			binary.BigEndian.PutUint32(fctl[8:], uint32(rect.Dy()))
+			binary.BigEndian.PutUint32(fctl[12:], uint32(rect.Min.X))
+			binary.BigEndian.PutUint32(fctl[16:], uint32(rect.Min.Y))
+			binary.BigEndian.PutUint16(fctl[20:], num)
+			binary.BigEndian.PutUint16(fctl[22:], den)
+			fctl[24] = 0 // dispose op: none
+			fctl[25] = 0 // blend op: source
+			writePNGChunk(bw, "fcTL", fctl)
+			seq++
+
+			data, err := encodePNGData(img, rect)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				writePNGChunk(bw, "IDAT", data)
+			} else {
+				fdat := make([]byte, 4+len(data))
+				binary.BigEndian.PutUint32(fdat, seq)
+				copy(fdat[4:], data)
+				writePNGChunk(bw, "fdAT", fdat)
+				seq++
+			}
+			prev = img
+		}
+		writePNGChunk(bw, "IEND", nil)
+		return bw.Flush()
+	}
+}
+
+// apngDelay returns the delay as a fraction of 16-bit integers.
+func apngDelay(delay time.Duration) (uint16, uint16) {
+	ms := delay.Milliseconds()
+	if ms <= 0xFFFF {
+		return uint16(ms), 1000
+	} else if ms/10 <= 0xFFFF {
+		return uint16(ms / 10), 100
+	} else if ms/1000 <= 0xFFFF {
+		return uint16(ms / 1000), 1
+	}
+	return 0xFFFF, 1
+}
+
+func writePNGChunk(w io.Writer, typ string, data []byte) {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	footer := make([]byte, 4)
+	binary.BigEndian.PutUint32(footer, crc.Sum32())
+	w.Write(header)
+	w.Write(data)
+	w.Write(footer)
+}
+
+// encodePNGData returns the compressed non-premultiplied RGBA scanlines of a region of the image, using the sub filter for each scanline.
+func encodePNGData(img *image.RGBA, rect image.Rectangle) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	cur := make([]byte, 4*rect.Dx())
+	line := make([]byte, 1+4*rect.Dx())
+	line[0] = 1 // sub filter
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.RGBAAt(x, y)).(color.NRGBA)
+			i := 4 * (x - rect.Min.X)
+			cur[i+0], cur[i+1], cur[i+2], cur[i+3] = c.R, c.G, c.B, c.A
+		}
+		for i := range cur {
+			if i < 4 {
+				line[1+i] = cur[i]
+			} else {
+				line[1+i] = cur[i] - cur[i-4]
+			}
+		}
+		if _, err := zw.Write(line); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// changedRect returns the bounding box of the pixels that differ between two images of the same size, or a single pixel if they are equal.
+func changedRect(a, b *image.RGBA) image.Rectangle {
+	bounds := b.Bounds()
+	rect := image.Rectangle{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		i, j := a.PixOffset(bounds.Min.X, y), b.PixOffset(bounds.Min.X, y)
+		if bytes.Equal(a.Pix[i:i+4*bounds.Dx()], b.Pix[j:j+4*bounds.Dx()]) {
+			continue
+		}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if a.RGBAAt(x, y) != b.RGBAAt(x, y) {
+				rect = rect.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if rect.Empty() {
+		rect = image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+1, bounds.Min.Y+1)
+	}
+	return rect
+}
+
+// AnimatedGIF returns an animation writer for animated GIF images. All frames share a global palette of the gif.Options.NumColors most representative colors found by median cut quantization, and are drawn using the gif.Options.Drawer (Floyd-Steinberg dithering by default). Pixels that are less than half opaque are transparent.
+func AnimatedGIF(opts ...interface{}) AnimationWriter {
+	resolution := canvas.DPMM(1.0)
+	colorSpace := canvas.DefaultColorSpace
+	var rasterOptions *rasterizer.Options
+	var gifOptions *gif.Options
+	var options AnimationOptions
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case canvas.Resolution:
+			resolution = o
+		case canvas.ColorSpace:
+			colorSpace = o
+		case *rasterizer.Options:
+			rasterOptions = o
+		case *gif.Options:
+			gifOptions = o
+		case *AnimationOptions:
+			options = *o
+		default:
+			return animationErrorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, frames []*canvas.Canvas, delays []time.Duration) error {
+		delays, err := animationDelays(frames, delays)
+		if err != nil {
+			return err
+		}
+
+		numColors := 256
+		var drawer draw.Drawer = draw.FloydSteinberg
+		if gifOptions != nil {
+			if 1 < gifOptions.NumColors && gifOptions.NumColors < 256 {
+				numColors = gifOptions.NumColors
+			}
+			if gifOptions.Drawer != nil {
+				drawer = gifOptions.Drawer
+			}
+		}
+
+		// binarize transparency
+		imgs := make([]*image.RGBA, len(frames))
+		transparent := false
+		for i, frame := range frames {
+			img := rasterizer.DrawWithOptions(frame, resolution, colorSpace, rasterOptions)
+			for j := 0; j < len(img.Pix); j += 4 {
+				if img.Pix[j+3] < 128 {
+					img.Pix[j+0], img.Pix[j+1], img.Pix[j+2], img.Pix[j+3] = 0, 0, 0, 0
+					transparent = true
+				} else if img.Pix[j+3] != 255 {
+					c := color.NRGBAModel.Convert(color.RGBA{img.Pix[j+0], img.Pix[j+1], img.Pix[j+2], img.Pix[j+3]}).(color.NRGBA)
+					img.Pix[j+0], img.Pix[j+1], img.Pix[j+2], img.Pix[j+3] = c.R, c.G, c.B, 255
+				}
+			}
+			imgs[i] = img
+		}
+
+		var palette color.Palette
+		if transparent {
+			palette = append(medianCut(imgs, numColors-1), color.RGBA{})
+		} else {
+			palette = medianCut(imgs, numColors)
+		}
+
+		disposal := byte(gif.DisposalNone)
+		if transparent {
+			disposal = gif.DisposalBackground
+		}
+		anim := &gif.GIF{}
+		if options.LoopCount == 1 {
+			anim.LoopCount = -1 // play once
+		} else if 1 < options.LoopCount {
+			anim.LoopCount = options.LoopCount - 1 // number of repeats
+		}
+		for i, img := range imgs {
+			paletted := image.NewPaletted(img.Bounds(), palette)
+			drawer.Draw(paletted, img.Bounds(), img, img.Bounds().Min)
+			anim.Image = append(anim.Image, paletted)
+			anim.Delay = append(anim.Delay, int((delays[i]+5*time.Millisecond)/(10*time.Millisecond)))
+			anim.Disposal = append(anim.Disposal, disposal)
+		}
+		return gif.EncodeAll(w, anim)
+	}
+}
+
+type colorCount struct {
+	c     [3]uint8
+	count int
+}
+
+type colorBox []colorCount
+
+// widest returns the channel with the largest range and the range.
+func (box colorBox) widest() (int, int) {
+	channel, width := 0, -1
+	for k := 0; k < 3; k++ {
+		lo, hi := 255, 0
+		for _, cc := range box {
+			if int(cc.c[k]) < lo {
+				lo = int(cc.c[k])
+			}
+			if hi < int(cc.c[k]) {
+				hi = int(cc.c[k])
+			}
+		}
+		if width < hi-lo {
+			channel, width = k, hi-lo
+		}
+	}
+	return channel, width
+}
+
+// medianCut returns a palette of at most n colors that represents the opaque pixels of the images, by recursively splitting the box with the widest color range at its weighted median.
+func medianCut(imgs []*image.RGBA, n int) color.Palette {
+	counts := map[[3]uint8]int{}
+	for _, img := range imgs {
+		for j := 0; j < len(img.Pix); j += 4 {
+			if img.Pix[j+3] != 0 {
+				counts[[3]uint8{img.Pix[j+0], img.Pix[j+1], img.Pix[j+2]}]++
+			}
+		}
+	}
+	colors := make(colorBox, 0, len(counts))
+	for c, count := range counts {
+		colors = append(colors, colorCount{c, count})
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i].c, colors[j].c
+		return a[0] < b[0] || a[0] == b[0] && (a[1] < b[1] || a[1] == b[1] && a[2] < b[2])
+	})
+
+	boxes := []colorBox{}
+	if 0 < len(colors) {
+		boxes = append(boxes, colors)
+	}
+	for len(boxes) < n {
+		// split the box with the widest range
+		split, channel, width := -1, 0, 0
+		for i, box := range boxes {
+			if 1 < len(box) {
+				if k, w := box.widest(); width < w {
+					split, channel, width = i, k, w
+				}
+			}
+		}
+		if split == -1 {
+			break
+		}
+
+		box := boxes[split]
+		sort.SliceStable(box, func(i, j int) bool {
+			return box[i].c[channel] < box[j].c[channel]
+		})
+		total := 0
+		for _, cc := range box {
+			total += cc.count
+		}
+		median, sum := 1, box[0].count
+		for median < len(box)-1 && sum+box[median].count <= total/2 {
+			sum += box[median].count
+			median++
+		}
+		boxes[split] = box[:median]
+		boxes = append(boxes, box[median:])
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var r, g, b, total int
+		for _, cc := range box {
+			r += int(cc.c[0]) * cc.count
+			g += int(cc.c[1]) * cc.count
+			b += int(cc.c[2]) * cc.count
+			total += cc.count
+		}
+		palette = append(palette, color.RGBA{uint8((r + total/2) / total), uint8((g + total/2) / total), uint8((b + total/2) / total), 255})
+	}
+	if len(palette) == 0 {
+		palette = append(palette, color.RGBA{0, 0, 0, 255})
+	}
+	return palette
+}
+
+// AnimatedSVG returns an animation writer for scalable vector graphics, see svg.SVG.RenderFrames.
+func AnimatedSVG(opts ...interface{}) AnimationWriter {
+	var svgOptions *svg.Options
+	var options AnimationOptions
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *svg.Options:
+			svgOptions = o
+		case *AnimationOptions:
+			options = *o
+		default:
+			return animationErrorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, frames []*canvas.Canvas, delays []time.Duration) error {
+		delays, err := animationDelays(frames, delays)
+		if err != nil {
+			return err
+		}
+		svg := svg.New(w, frames[0].W, frames[0].H, svgOptions)
+		svg.RenderFrames(frames, delays, options.LoopCount, options.SVGKeyframes)
+		return svg.Close()
+	}
+}
+
+// AnimatedLottie returns an animation writer for Lottie JSON animations. Compatible frames are interpolated using keyframes, see lottie.RenderFrames. The loop count is ignored as looping is controlled by the player.
+func AnimatedLottie(opts ...interface{}) AnimationWriter {
+	var lottieOptions *lottie.Options
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *lottie.Options:
+			lottieOptions = o
+		case *AnimationOptions:
+		default:
+			return animationErrorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, frames []*canvas.Canvas, delays []time.Duration) error {
+		delays, err := animationDelays(frames, delays)
+		if err != nil {
+			return err
+		}
+		lottie := lottie.New(w, frames[0].W, frames[0].H, lottieOptions)
+		lottie.RenderFrames(frames, delays)
+		return lottie.Close()
+	}
+}
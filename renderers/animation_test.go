@@ -0,0 +1,114 @@
+package renderers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/gif"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/svg"
+	"github.com/tdewolff/test"
+)
+
+func animationFrames() []*canvas.Canvas {
+	frames := []*canvas.Canvas{}
+	for i := 0; i < 3; i++ {
+		c := canvas.New(10.0, 10.0)
+		ctx := canvas.NewContext(c)
+		ctx.SetFillColor(canvas.Red)
+		ctx.DrawPath(float64(2*i), 2.0, canvas.Rectangle(2.0, 2.0))
+		frames = append(frames, c)
+	}
+	return frames
+}
+
+func TestAPNG(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := APNG(&AnimationOptions{LoopCount: 2})(buf, animationFrames(), []time.Duration{100 * time.Millisecond})
+	test.Error(t, err)
+
+	// first frame is a regular PNG
+	img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	test.Error(t, err)
+	test.T(t, img.Bounds().Dx(), 10)
+	_, _, _, a := img.At(1, 7).RGBA()
+	test.T(t, a, uint32(0xFFFF))
+
+	chunks := []string{}
+	b := buf.Bytes()[8:]
+	for 0 < len(b) {
+		n := int(binary.BigEndian.Uint32(b))
+		typ := string(b[4:8])
+		chunks = append(chunks, typ)
+		if typ == "acTL" {
+			test.T(t, binary.BigEndian.Uint32(b[8:]), uint32(3), "number of frames")
+			test.T(t, binary.BigEndian.Uint32(b[12:]), uint32(2), "number of plays")
+		} else if typ == "fcTL" && binary.BigEndian.Uint32(b[8:]) == 2 {
+			// second frame only contains the changed region
+			test.T(t, binary.BigEndian.Uint32(b[12:]), uint32(4), "width")
+			test.T(t, binary.BigEndian.Uint32(b[20:]), uint32(2), "x offset")
+			test.T(t, binary.BigEndian.Uint16(b[28:]), uint16(100), "delay")
+		}
+		b = b[12+n:]
+	}
+	test.T(t, strings.Join(chunks, ","), "IHDR,acTL,fcTL,IDAT,fcTL,fdAT,fcTL,fdAT,IEND")
+}
+
+func TestAnimatedGIF(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := AnimatedGIF()(buf, animationFrames(), []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond})
+	test.Error(t, err)
+
+	anim, err := gif.DecodeAll(buf)
+	test.Error(t, err)
+	test.T(t, len(anim.Image), 3)
+	test.T(t, anim.Delay, []int{10, 20, 30})
+	test.T(t, anim.LoopCount, 0)
+	test.T(t, len(anim.Image[0].Palette), 2) // red and transparent
+	test.T(t, anim.Image[1].At(3, 7), anim.Image[0].Palette[0])
+	test.T(t, anim.Image[1].At(1, 7), anim.Image[0].Palette[1])
+}
+
+func TestAnimatedSVG(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := AnimatedSVG()(buf, animationFrames(), []time.Duration{time.Second})
+	test.Error(t, err)
+	s := buf.String()
+	test.That(t, strings.Contains(s, `<g visibility="visible"><animate attributeName="visibility" calcMode="discrete" dur="3s" repeatCount="indefinite" fill="freeze" values="visible;hidden" keyTimes="0;.33333333"/>`), s)
+	test.That(t, strings.Contains(s, `values="hidden;visible;hidden" keyTimes="0;.33333333;.66666667"/>`), s)
+	test.That(t, strings.Contains(s, `values="hidden;visible" keyTimes="0;.66666667"/>`), s)
+
+	buf.Reset()
+	err = AnimatedSVG(&AnimationOptions{LoopCount: 1, SVGKeyframes: true})(buf, animationFrames(), []time.Duration{time.Second})
+	test.Error(t, err)
+	s = buf.String()
+	test.That(t, strings.Contains(s, `@keyframes frame1{0%{visibility:hidden}33.333333%{visibility:visible}66.666667%,100%{visibility:hidden}}.frame1{animation:frame1 3s step-end 1 forwards}`), s)
+	test.That(t, strings.Contains(s, `<g class="frame2" visibility="hidden">`), s)
+
+	err = AnimatedSVG()(buf, animationFrames(), []time.Duration{time.Second, time.Second})
+	test.That(t, err != nil, "expected error for number of delays")
+
+	// merged paths stay within their frame
+	frames := []*canvas.Canvas{}
+	for i := 0; i < 2; i++ {
+		c := canvas.New(10.0, 10.0)
+		ctx := canvas.NewContext(c)
+		ctx.DrawPath(float64(i), 0.0, canvas.Rectangle(1.0, 1.0))
+		ctx.DrawPath(float64(i), 5.0, canvas.Rectangle(1.0, 1.0))
+		frames = append(frames, c)
+	}
+	buf.Reset()
+	err = AnimatedSVG(&svg.Options{MergePaths: true})(buf, frames, []time.Duration{time.Second})
+	test.Error(t, err)
+	s = buf.String()
+	s = s[strings.Index(s, "<g "):]
+	groups := strings.Split(s, "</g>")
+	test.T(t, len(groups), 3)
+	test.T(t, strings.Count(groups[0], "<path"), 1)
+	test.T(t, strings.Count(groups[1], "<path"), 1)
+	test.String(t, groups[2], "</svg>")
+}
@@ -0,0 +1,557 @@
+package dxf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+)
+
+// Options are the DXF renderer options.
+type Options struct {
+	TextAsPath bool // render text as filled paths instead of TEXT entities
+}
+
+// DefaultOptions are the default DXF renderer options.
+var DefaultOptions = Options{
+	TextAsPath: false,
+}
+
+// DXF is an AutoCAD DXF (R2000) renderer. Paths are written as LWPOLYLINE entities with bulges for circular arcs, SPLINE entities for Béziers, and HATCH entities for fills. Layers follow the z-index of the canvas. Be aware that DXF does not support gradients, patterns, line caps and joins, and embedded images. Images are not written since DXF can only reference external image files.
+type DXF struct {
+	w             io.Writer
+	width, height float64
+	opts          *Options
+
+	layer    string
+	layers   []string
+	styles   map[string]string // text style name to font name
+	entities bytes.Buffer
+	handle   int
+}
+
+// New returns a DXF renderer. Units are in millimeters.
+func New(w io.Writer, width, height float64, opts *Options) *DXF {
+	if opts == nil {
+		defaultOptions := DefaultOptions
+		opts = &defaultOptions
+	}
+	return &DXF{
+		w:      w,
+		width:  width,
+		height: height,
+		opts:   opts,
+		layer:  "0",
+		layers: []string{"0"},
+		styles: map[string]string{},
+		handle: 0x100,
+	}
+}
+
+// Close writes the header, tables, and entities and closes the DXF file.
+func (r *DXF) Close() error {
+	b := &bytes.Buffer{}
+	writeGroup(b, 0, "SECTION")
+	writeGroup(b, 2, "HEADER")
+	writeGroup(b, 9, "$ACADVER")
+	writeGroup(b, 1, "AC1015")
+	writeGroup(b, 9, "$INSUNITS")
+	writeGroup(b, 70, 4) // millimeters
+	writeGroup(b, 9, "$MEASUREMENT")
+	writeGroup(b, 70, 1) // metric
+	writeGroup(b, 9, "$EXTMIN")
+	writeGroup(b, 10, 0.0)
+	writeGroup(b, 20, 0.0)
+	writeGroup(b, 30, 0.0)
+	writeGroup(b, 9, "$EXTMAX")
+	writeGroup(b, 10, r.width)
+	writeGroup(b, 20, r.height)
+	writeGroup(b, 30, 0.0)
+	writeGroup(b, 9, "$HANDSEED")
+	writeGroup(b, 5, strconv.FormatInt(int64(r.handle), 16))
+	writeGroup(b, 0, "ENDSEC")
+
+	writeGroup(b, 0, "SECTION")
+	writeGroup(b, 2, "TABLES")
+	writeGroup(b, 0, "TABLE")
+	writeGroup(b, 2, "LAYER")
+	writeGroup(b, 70, len(r.layers))
+	for _, layer := range r.layers {
+		writeGroup(b, 0, "LAYER")
+		writeGroup(b, 2, layer)
+		writeGroup(b, 70, 0)
+		writeGroup(b, 62, 7)
+		writeGroup(b, 6, "CONTINUOUS")
+	}
+	writeGroup(b, 0, "ENDTAB")
+	writeGroup(b, 0, "TABLE")
+	writeGroup(b, 2, "STYLE")
+	writeGroup(b, 70, len(r.styles)+1)
+	writeStyle(b, "STANDARD", "txt")
+	for _, name := range sortedKeys(r.styles) {
+		writeStyle(b, name, r.styles[name])
+	}
+	writeGroup(b, 0, "ENDTAB")
+	writeGroup(b, 0, "ENDSEC")
+
+	writeGroup(b, 0, "SECTION")
+	writeGroup(b, 2, "ENTITIES")
+	b.Write(r.entities.Bytes())
+	writeGroup(b, 0, "ENDSEC")
+	writeGroup(b, 0, "EOF")
+	_, err := r.w.Write(b.Bytes())
+	return err
+}
+
+// Size returns the size of the canvas in millimeters.
+func (r *DXF) Size() (float64, float64) {
+	return r.width, r.height
+}
+
+// SetLayer sets the DXF layer for the elements that follow to the given z-index.
+func (r *DXF) SetLayer(zindex int) {
+	r.layer = strconv.Itoa(zindex)
+	for _, layer := range r.layers {
+		if layer == r.layer {
+			return
+		}
+	}
+	r.layers = append(r.layers, r.layer)
+}
+
+func (r *DXF) group(code int, value interface{}) {
+	writeGroup(&r.entities, code, value)
+}
+
+// entity writes the common groups of an entity.
+func (r *DXF) entity(typ, subclass string, col color.RGBA) {
+	r.group(0, typ)
+	r.group(5, strconv.FormatInt(int64(r.handle), 16))
+	r.handle++
+	r.group(100, "AcDbEntity")
+	r.group(8, r.layer)
+	if col.A != 0 {
+		A := float64(col.A) / 255.0
+		R := int(float64(col.R)/A + 0.5)
+		G := int(float64(col.G)/A + 0.5)
+		B := int(float64(col.B)/A + 0.5)
+		r.group(62, nearestACI(R, G, B))
+		r.group(420, R<<16|G<<8|B)
+		if col.A != 255 {
+			r.group(440, 0x02000000|int(col.A))
+		}
+	}
+	if subclass != "" {
+		r.group(100, subclass)
+	}
+}
+
+// RenderPath renders a path to the canvas using a style and a transformation matrix.
+func (r *DXF) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	if path.Empty() {
+		return
+	}
+
+	if style.HasFill() {
+		fill := path
+		if style.Fill.IsPattern() {
+			if hatch, ok := style.Fill.Pattern.(*canvas.HatchPattern); ok {
+				style.Fill = hatch.Fill
+				fill = hatch.Tile(fill)
+			}
+		}
+		if style.Fill.IsColor() {
+			r.writeHatch(fill.Transform(m), style.Fill.Color, style.FillRule)
+		}
+	}
+
+	if style.HasStroke() && style.Stroke.IsColor() {
+		if style.IsDashed() {
+			path = path.Dash(style.DashOffset, style.Dashes...)
+		}
+		if m.IsSimilarity() {
+			width := style.StrokeWidth * math.Sqrt(math.Abs(m.Det()))
+			for _, subpath := range path.Transform(m).Split() {
+				r.writeStroke(subpath, style.Stroke.Color, width)
+			}
+		} else {
+			// stroke widths are uniform in DXF, draw stroke explicitly
+			path = path.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner, canvas.Tolerance)
+			r.writeHatch(path.Transform(m), style.Stroke.Color, canvas.NonZero)
+		}
+	}
+}
+
+// writeStroke writes a subpath as LWPOLYLINE entities for runs of lines and circular arcs, and SPLINE entities for runs of Béziers and elliptical arcs.
+func (r *DXF) writeStroke(path *canvas.Path, col color.RGBA, width float64) {
+	vertices := []vertex{}
+	beziers := []canvas.Point{}
+	flushPolyline := func() {
+		if 1 < len(vertices) {
+			r.writePolyline(vertices, false, col, width)
+		}
+		vertices = vertices[:0]
+	}
+	flushSpline := func() {
+		if 1 < len(beziers) {
+			r.writeSpline(beziers, col, width)
+		}
+		beziers = beziers[:0]
+	}
+
+	onlyPolyline := true
+	for scanner := path.Scanner(); scanner.Scan(); {
+		start, end := scanner.Start(), scanner.End()
+		switch scanner.Cmd() {
+		case canvas.LineToCmd, canvas.CloseCmd:
+			flushSpline()
+			vertices = appendVertex(vertices, start, end, 0.0)
+		case canvas.ArcToCmd:
+			rx, ry, rot, large, sweep := scanner.Arc()
+			if canvas.Equal(rx, ry) {
+				flushSpline()
+				vertices = appendVertex(vertices, start, end, arcBulge(start, end, rx, large, sweep))
+			} else {
+				flushPolyline()
+				onlyPolyline = false
+				arc := &canvas.Path{}
+				arc.MoveTo(start.X, start.Y)
+				arc.ArcTo(rx, ry, rot, large, sweep, end.X, end.Y)
+				beziers = appendBeziers(beziers, arc.ReplaceArcs())
+			}
+		case canvas.QuadToCmd, canvas.CubeToCmd:
+			flushPolyline()
+			onlyPolyline = false
+			cp1, cp2 := scanner.CP1(), canvas.Point{}
+			if scanner.Cmd() == canvas.QuadToCmd {
+				cp1, cp2 = quadraticToCubic(start, cp1, end)
+			} else {
+				cp2 = scanner.CP2()
+			}
+			if len(beziers) == 0 {
+				beziers = append(beziers, start)
+			}
+			beziers = append(beziers, cp1, cp2, end)
+		}
+	}
+	if onlyPolyline && path.Closed() && 2 < len(vertices) {
+		// the last vertex coincides with the first
+		r.writePolyline(vertices[:len(vertices)-1], true, col, width)
+		return
+	}
+	flushPolyline()
+	flushSpline()
+}
+
+// writePolyline writes an LWPOLYLINE entity.
+func (r *DXF) writePolyline(vertices []vertex, closed bool, col color.RGBA, width float64) {
+	r.entity("LWPOLYLINE", "AcDbPolyline", col)
+	r.group(90, len(vertices))
+	if closed {
+		r.group(70, 1)
+	} else {
+		r.group(70, 0)
+	}
+	r.group(43, width)
+	for _, v := range vertices {
+		r.group(10, v.X)
+		r.group(20, v.Y)
+		if v.bulge != 0.0 {
+			r.group(42, v.bulge)
+		}
+	}
+}
+
+// writeSpline writes a SPLINE entity of degree 3 for a sequence of cubic Béziers that share their end points.
+func (r *DXF) writeSpline(points []canvas.Point, col color.RGBA, width float64) {
+	n := (len(points) - 1) / 3
+	r.entity("SPLINE", "", col)
+	r.group(370, lineweight(width))
+	r.group(100, "AcDbSpline")
+	r.group(70, 8) // planar
+	r.group(71, 3)
+	r.group(72, 3*n+5)
+	r.group(73, len(points))
+	r.group(74, 0)
+	r.group(40, 0.0)
+	for i := 0; i <= n; i++ {
+		for j := 0; j < 3; j++ {
+			r.group(40, float64(i))
+		}
+	}
+	r.group(40, float64(n))
+	for _, p := range points {
+		r.group(10, p.X)
+		r.group(20, p.Y)
+		r.group(30, 0.0)
+	}
+}
+
+// writeHatch writes a solid HATCH entity, where each subpath is a boundary loop. Béziers and elliptical arcs are flattened.
+func (r *DXF) writeHatch(path *canvas.Path, col color.RGBA, fillRule canvas.FillRule) {
+	loops := [][]vertex{}
+	for _, subpath := range path.Split() {
+		loop := []vertex{}
+		for scanner := subpath.Scanner(); scanner.Scan(); {
+			end := scanner.End()
+			switch scanner.Cmd() {
+			case canvas.MoveToCmd:
+				loop = append(loop, vertex{Point: end})
+			case canvas.LineToCmd, canvas.CloseCmd:
+				loop = append(loop, vertex{Point: end})
+			case canvas.ArcToCmd:
+				if rx, ry, rot, large, sweep := scanner.Arc(); canvas.Equal(rx, ry) {
+					loop[len(loop)-1].bulge = arcBulge(scanner.Start(), end, rx, large, sweep)
+					loop = append(loop, vertex{Point: end})
+				} else {
+					arc := &canvas.Path{}
+					arc.MoveTo(scanner.Start().X, scanner.Start().Y)
+					arc.ArcTo(rx, ry, rot, large, sweep, end.X, end.Y)
+					loop = appendFlattened(loop, arc)
+				}
+			case canvas.QuadToCmd, canvas.CubeToCmd:
+				curve := &canvas.Path{}
+				curve.MoveTo(scanner.Start().X, scanner.Start().Y)
+				if scanner.Cmd() == canvas.QuadToCmd {
+					cp := scanner.CP1()
+					curve.QuadTo(cp.X, cp.Y, end.X, end.Y)
+				} else {
+					cp1, cp2 := scanner.CP1(), scanner.CP2()
+					curve.CubeTo(cp1.X, cp1.Y, cp2.X, cp2.Y, end.X, end.Y)
+				}
+				loop = appendFlattened(loop, curve)
+			}
+		}
+		if 1 < len(loop) && loop[len(loop)-1].Point.Equals(loop[0].Point) {
+			loop = loop[:len(loop)-1]
+		}
+		if 2 < len(loop) {
+			loops = append(loops, loop)
+		}
+	}
+	if len(loops) == 0 {
+		return
+	}
+
+	r.entity("HATCH", "AcDbHatch", col)
+	r.group(10, 0.0)
+	r.group(20, 0.0)
+	r.group(30, 0.0)
+	r.group(210, 0.0)
+	r.group(220, 0.0)
+	r.group(230, 1.0)
+	r.group(2, "SOLID")
+	r.group(70, 1) // solid fill
+	r.group(71, 0) // not associative
+	r.group(91, len(loops))
+	for _, loop := range loops {
+		r.group(92, 2) // polyline
+		r.group(72, 1) // has bulge
+		r.group(73, 1) // closed
+		r.group(93, len(loop))
+		for _, v := range loop {
+			r.group(10, v.X)
+			r.group(20, v.Y)
+			r.group(42, v.bulge)
+		}
+		r.group(97, 0)
+	}
+	if fillRule == canvas.EvenOdd {
+		r.group(75, 0) // odd parity
+	} else {
+		r.group(75, 1) // outermost
+	}
+	r.group(76, 1)
+	r.group(98, 0)
+}
+
+// RenderText renders a text object to the canvas using a transformation matrix. Text spans are written as TEXT entities, where the text height is the cap height of the font.
+func (r *DXF) RenderText(text *canvas.Text, m canvas.Matrix) {
+	if r.opts.TextAsPath {
+		text.RenderAsPath(r, m, 0.0)
+		return
+	}
+
+	text.WalkDecorations(func(paint canvas.Paint, p *canvas.Path) {
+		style := canvas.DefaultStyle
+		style.Fill = paint
+		r.RenderPath(p, style, m)
+	})
+
+	layer := r.layer
+	text.WalkSpans(func(x, y float64, span canvas.TextSpan) {
+		if !span.IsText() {
+			for _, obj := range span.Objects {
+				obj.Canvas.RenderViewTo(r, m.Mul(obj.View(x, y, span.Face)))
+			}
+			r.layer = layer
+			return
+		}
+
+		style := styleName(span.Face.Name())
+		r.styles[style] = span.Face.Name()
+
+		pos := m.Dot(canvas.Point{X: x, Y: y})
+		scale := math.Sqrt(math.Abs(m.Det()))
+		rotation := math.Atan2(m[1][0], m[0][0]) * 180.0 / math.Pi
+		col := canvas.Black
+		if span.Face.Fill.IsColor() {
+			col = span.Face.Fill.Color
+		}
+		r.entity("TEXT", "AcDbText", col)
+		r.group(10, pos.X)
+		r.group(20, pos.Y)
+		r.group(30, 0.0)
+		r.group(40, span.Face.Metrics().CapHeight*scale)
+		r.group(1, escapeText(span.Text))
+		if rotation != 0.0 {
+			r.group(50, rotation)
+		}
+		r.group(7, style)
+		r.group(100, "AcDbText")
+	})
+}
+
+// RenderImage renders an image to the canvas using a transformation matrix. Images are skipped, see DXF.
+func (r *DXF) RenderImage(img image.Image, m canvas.Matrix) {}
+
+////////////////////////////////////////////////////////////////
+
+type vertex struct {
+	canvas.Point
+	bulge float64 // of the segment starting at this vertex
+}
+
+// appendVertex appends a segment from start to end with the given bulge.
+func appendVertex(vertices []vertex, start, end canvas.Point, bulge float64) []vertex {
+	if len(vertices) == 0 {
+		vertices = append(vertices, vertex{Point: start})
+	}
+	vertices[len(vertices)-1].bulge = bulge
+	return append(vertices, vertex{Point: end})
+}
+
+// arcBulge returns the bulge of a circular arc, which is the tangent of a quarter of the included angle. It is positive for counter clockwise arcs.
+func arcBulge(start, end canvas.Point, radius float64, large, sweep bool) float64 {
+	d := end.Sub(start).Length()
+	theta := 2.0 * math.Asin(math.Min(1.0, d/(2.0*radius)))
+	if large {
+		theta = 2.0*math.Pi - theta
+	}
+	bulge := math.Tan(theta / 4.0)
+	if !sweep {
+		bulge = -bulge
+	}
+	return bulge
+}
+
+func quadraticToCubic(p0, p1, p2 canvas.Point) (canvas.Point, canvas.Point) {
+	c1 := p0.Interpolate(p1, 2.0/3.0)
+	c2 := p2.Interpolate(p1, 2.0/3.0)
+	return c1, c2
+}
+
+// appendBeziers appends the control and end points of a path consisting of cubic Béziers.
+func appendBeziers(points []canvas.Point, path *canvas.Path) []canvas.Point {
+	for scanner := path.Scanner(); scanner.Scan(); {
+		if scanner.Cmd() == canvas.CubeToCmd {
+			if len(points) == 0 {
+				points = append(points, scanner.Start())
+			}
+			points = append(points, scanner.CP1(), scanner.CP2(), scanner.End())
+		}
+	}
+	return points
+}
+
+// appendFlattened appends the flattened path, without its starting point, to the vertices.
+func appendFlattened(vertices []vertex, path *canvas.Path) []vertex {
+	for scanner := path.Flatten(canvas.Tolerance).Scanner(); scanner.Scan(); {
+		if scanner.Cmd() != canvas.MoveToCmd {
+			vertices = append(vertices, vertex{Point: scanner.End()})
+		}
+	}
+	return vertices
+}
+
+// standardLineweights are the lineweights allowed by DXF in hundredths of a millimeter.
+var standardLineweights = []int{0, 5, 9, 13, 15, 18, 20, 25, 30, 35, 40, 50, 53, 60, 70, 80, 90, 100, 106, 120, 140, 158, 200, 211}
+
+// lineweight returns the nearest standard lineweight for a stroke width in millimeters.
+func lineweight(width float64) int {
+	w := width * 100.0
+	nearest := standardLineweights[0]
+	for _, lw := range standardLineweights[1:] {
+		if math.Abs(float64(lw)-w) < math.Abs(float64(nearest)-w) {
+			nearest = lw
+		}
+	}
+	return nearest
+}
+
+// aciColors are the first nine colors of the AutoCAD Color Index, where 7 is black or white depending on the background.
+var aciColors = [][3]int{
+	{255, 0, 0},
+	{255, 255, 0},
+	{0, 255, 0},
+	{0, 255, 255},
+	{0, 0, 255},
+	{255, 0, 255},
+	{0, 0, 0},
+	{128, 128, 128},
+	{192, 192, 192},
+}
+
+// nearestACI returns the nearest color of the AutoCAD Color Index, for readers that do not support true color.
+func nearestACI(r, g, b int) int {
+	nearest, dist := 0, math.MaxInt32
+	for i, c := range aciColors {
+		d := (r-c[0])*(r-c[0]) + (g-c[1])*(g-c[1]) + (b-c[2])*(b-c[2])
+		if d < dist {
+			nearest, dist = i+1, d
+		}
+	}
+	return nearest
+}
+
+func styleName(font string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>/\":;?*|=,`+"`", r) {
+			return '_'
+		}
+		return r
+	}, font)
+}
+
+func escapeText(s string) string {
+	s = strings.ReplaceAll(s, "\r", "")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func writeStyle(w io.Writer, name, font string) {
+	writeGroup(w, 0, "STYLE")
+	writeGroup(w, 2, name)
+	writeGroup(w, 70, 0)
+	writeGroup(w, 40, 0.0)
+	writeGroup(w, 41, 1.0)
+	writeGroup(w, 50, 0.0)
+	writeGroup(w, 71, 0)
+	writeGroup(w, 42, 2.5)
+	writeGroup(w, 3, font)
+	writeGroup(w, 4, "")
+}
+
+func writeGroup(w io.Writer, code int, value interface{}) {
+	switch v := value.(type) {
+	case float64:
+		fmt.Fprintf(w, "%3d\n%v\n", code, dec(v))
+	default:
+		fmt.Fprintf(w, "%3d\n%v\n", code, v)
+	}
+}
@@ -0,0 +1,104 @@
+package dxf
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/test"
+)
+
+func TestDXF(t *testing.T) {
+	c := canvas.New(100.0, 50.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetFillColor(canvas.Red)
+	ctx.SetStroke(canvas.Transparent)
+	ctx.DrawPath(10.0, 10.0, canvas.Rectangle(20.0, 10.0))
+	ctx.SetZIndex(1)
+	ctx.SetFill(canvas.Transparent)
+	ctx.SetStrokeColor(canvas.Blue)
+	ctx.SetStrokeWidth(0.5)
+	ctx.DrawPath(50.0, 25.0, canvas.Circle(10.0))
+	ctx.SetZIndex(2)
+	ctx.DrawPath(0.0, 0.0, canvas.MustParseSVGPath("M70 10C80 40 90 0 95 30"))
+
+	buf := &bytes.Buffer{}
+	dxf := New(buf, c.W, c.H, nil)
+	c.RenderTo(dxf)
+	test.Error(t, dxf.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, "  0\nHATCH\n"), "no HATCH")
+	test.That(t, strings.Contains(s, "  0\nLWPOLYLINE\n"), "no LWPOLYLINE")
+	test.That(t, strings.Contains(s, " 42\n1\n"), "no semicircle bulge")
+	test.That(t, strings.Contains(s, "  0\nSPLINE\n"), "no SPLINE")
+	for _, layer := range []string{"0", "1", "2"} {
+		test.That(t, strings.Contains(s, "  0\nLAYER\n  2\n"+layer+"\n") && strings.Contains(s, "  8\n"+layer+"\n"), "no layer", layer)
+	}
+	test.That(t, strings.HasSuffix(s, "  0\nEOF\n"), "no EOF")
+
+	// round trip
+	c2, err := canvas.ParseDXF(strings.NewReader(s))
+	test.Error(t, err)
+	test.Float(t, c2.W, 100.0)
+	test.Float(t, c2.H, 50.0)
+
+	rec := &recorder{}
+	c2.RenderTo(rec)
+	test.T(t, len(rec.paths), 3)
+	test.T(t, rec.paths[0].Bounds(), canvas.Rect{X: 10.0, Y: 10.0, W: 20.0, H: 10.0})
+	test.T(t, rec.styles[0].Fill.Color, canvas.Red)
+	test.T(t, rec.paths[1].Bounds(), canvas.Rect{X: 40.0, Y: 15.0, W: 20.0, H: 20.0})
+	test.T(t, rec.styles[1].Stroke.Color, canvas.Blue)
+	test.Float(t, rec.styles[1].StrokeWidth, 0.5)
+	test.That(t, rec.paths[2].Equals(canvas.MustParseSVGPath("M70 10C80 40 90 0 95 30")), "spline differs:", rec.paths[2])
+}
+
+type recorder struct {
+	paths  []*canvas.Path
+	styles []canvas.Style
+	texts  []*canvas.Text
+}
+
+func (r *recorder) Size() (float64, float64) {
+	return 0.0, 0.0
+}
+
+func (r *recorder) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	r.paths = append(r.paths, path.Transform(m))
+	r.styles = append(r.styles, style)
+}
+
+func (r *recorder) RenderText(text *canvas.Text, m canvas.Matrix) {
+	r.texts = append(r.texts, text)
+}
+
+func (r *recorder) RenderImage(img image.Image, m canvas.Matrix) {}
+
+func TestParseDXFHatchCounts(t *testing.T) {
+	for _, n := range []string{"-1", "2000000000000"} {
+		for _, code := range []string{" 93", " 95", " 96"} {
+			hatch := " 91\n1\n 92\n2\n 72\n0\n 73\n1\n 93\n" + n + "\n"
+			if code != " 93" {
+				hatch = " 91\n1\n 92\n0\n 93\n1\n 72\n4\n 94\n3\n 95\n4\n 96\n4\n"
+				hatch = strings.Replace(hatch, code+"\n4\n", code+"\n"+n+"\n", 1)
+			}
+			_, err := canvas.ParseDXF(strings.NewReader("  0\nSECTION\n  2\nENTITIES\n  0\nHATCH\n" + hatch + "  0\nENDSEC\n  0\nEOF\n"))
+			test.That(t, err != nil, "count", n, "for group code", code, "must give an error")
+		}
+	}
+}
+
+func TestParseDXFMText(t *testing.T) {
+	tables := "  0\nSECTION\n  2\nTABLES\n  0\nTABLE\n  2\nSTYLE\n  0\nSTYLE\n  2\nSHX\n  3\nromans.shx\n  0\nENDTAB\n  0\nENDSEC\n"
+	mtext := "  0\nMTEXT\n 10\n0\n 20\n0\n 40\n2\n  7\nSHX\n  3\nA\n  3\nB\n  1\nC\n"
+	c, err := canvas.ParseDXF(strings.NewReader(tables + "  0\nSECTION\n  2\nENTITIES\n" + mtext + "  0\nENDSEC\n  0\nEOF\n"))
+	test.Error(t, err) // unavailable fonts fall back to sans-serif
+
+	rec := &recorder{}
+	c.RenderTo(rec)
+	test.T(t, len(rec.texts), 1)
+	test.T(t, rec.texts[0].Text, "ABC")
+}
@@ -0,0 +1,844 @@
+package emf
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"unicode/utf16"
+
+	"github.com/tdewolff/canvas"
+)
+
+// unitsPerMm is the number of device units per millimeter of the reference device.
+const unitsPerMm = 100.0
+
+// EMF record types
+const (
+	emrHeader                = 1
+	emrPolyBezierTo          = 5
+	emrPolylineTo            = 6
+	emrEOF                   = 14
+	emrSetBkMode             = 18
+	emrSetPolyFillMode       = 19
+	emrSetStretchBltMode     = 21
+	emrSetTextAlign          = 22
+	emrSetTextColor          = 24
+	emrMoveToEx              = 27
+	emrSaveDC                = 33
+	emrRestoreDC             = 34
+	emrSetWorldTransform     = 35
+	emrSelectObject          = 37
+	emrCreateBrushIndirect   = 39
+	emrDeleteObject          = 40
+	emrSetMiterLimit         = 58
+	emrBeginPath             = 59
+	emrEndPath               = 60
+	emrCloseFigure           = 61
+	emrFillPath              = 62
+	emrStrokePath            = 64
+	emrSelectClipPath        = 67
+	emrComment               = 70
+	emrExtCreateFontIndirect = 82
+	emrExtTextOutW           = 84
+	emrExtCreatePen          = 95
+	emrAlphaBlend            = 114
+)
+
+// EMF+ record types
+const (
+	emfPlusHeader           = 0x4001
+	emfPlusEndOfFile        = 0x4002
+	emfPlusGetDC            = 0x4004
+	emfPlusObject           = 0x4008
+	emfPlusFillPath         = 0x4014
+	emfPlusDrawPath         = 0x4015
+	emfPlusSetAntiAliasMode = 0x401E
+	emfPlusSetPageTransform = 0x4030
+)
+
+// object table indices and stock objects
+const (
+	brushHandle = 1
+	penHandle   = 2
+	fontHandle  = 3
+	numHandles  = 4
+
+	stockNullBrush  = 0x80000005
+	stockNullPen    = 0x80000008
+	stockSystemFont = 0x8000000D
+)
+
+// Options are the EMF renderer options.
+type Options struct {
+	EMFPlus       bool // add EMF+ records for anti-aliasing and transparency
+	TextAsPath    bool // render text as glyph outlines instead of EMR_EXTTEXTOUTW records
+	GradientSteps int  // number of solid color bands that approximate a gradient
+}
+
+// DefaultOptions are the default EMF renderer options.
+var DefaultOptions = Options{
+	EMFPlus:       true,
+	TextAsPath:    false,
+	GradientSteps: 64,
+}
+
+// EMF is an Enhanced Metafile renderer, which is the vector format best supported by Microsoft Office. Paths are written as GDI path records with solid brushes and geometric pens. With EMF+ enabled, the file is an EMF+ dual file where paths are additionally written as EMF+ records that are drawn anti-aliased and with transparency by EMF+ aware applications, while other applications draw the GDI records. Gradients are approximated by bands of solid colors, and text is written using EMR_EXTTEXTOUTW records and requires the fonts to be installed on the viewing system. Be aware that GDI records do not support transparency, and that EMF+ records are only used for fills with the even-odd fill rule or a single subpath.
+type EMF struct {
+	w             io.Writer
+	width, height float64
+	opts          *Options
+
+	records   buffer
+	nRecords  int
+	plus      buffer // pending EMF+ records
+	bounds    canvas.Rect
+	hasBounds bool
+}
+
+// New returns an EMF renderer. Units are in millimeters.
+func New(w io.Writer, width, height float64, opts *Options) *EMF {
+	options := DefaultOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.GradientSteps < 1 {
+		options.GradientSteps = 1
+	}
+
+	r := &EMF{
+		w:      w,
+		width:  width,
+		height: height,
+		opts:   &options,
+	}
+	r.record(emrSetBkMode, 1)     // transparent
+	r.record(emrSetTextAlign, 24) // baseline
+	return r
+}
+
+// Close writes the header and the records and closes the EMF file.
+func (r *EMF) Close() error {
+	b := &buffer{}
+
+	// EMF+ header and end of file
+	start := &buffer{}
+	if r.opts.EMFPlus {
+		plus := &buffer{}
+		writePlusRecord(plus, emfPlusHeader, 0x0001, func(b *buffer) {
+			b.uint32(0xDBC01002) // version
+			b.uint32(0x00000001) // reference device is a video display
+			b.uint32(uint32(unitsPerMm * 25.4))
+			b.uint32(uint32(unitsPerMm * 25.4))
+		})
+		writePlusRecord(plus, emfPlusSetPageTransform, 2, func(b *buffer) {
+			b.float32(1.0) // page unit is device pixel
+		})
+		writePlusRecord(plus, emfPlusSetAntiAliasMode, 4<<1|1, nil) // anti-alias 8x4
+		writeRecord(start, emrComment, func(b *buffer) {
+			b.uint32(uint32(4 + plus.Len()))
+			b.uint32(0x2B464D45) // EMF+
+			b.Write(plus.Bytes())
+		})
+		r.plusRecord(emfPlusEndOfFile, 0, nil)
+		r.flushPlus()
+	}
+	end := &buffer{}
+	writeRecord(end, emrEOF, func(b *buffer) {
+		b.uint32(0)  // number of palette entries
+		b.uint32(16) // offset to palette entries
+		b.uint32(20) // size of this record
+	})
+
+	// device size is rounded to millimeters
+	mmW := int32(math.Ceil(r.width))
+	mmH := int32(math.Ceil(r.height))
+	bounds := canvas.Rect{}
+	if r.hasBounds {
+		bounds = r.bounds
+	}
+	frame := canvas.Rect{X: 0.0, Y: 0.0, W: r.width * unitsPerMm, H: r.height * unitsPerMm}
+
+	const headerSize = 108
+	b.uint32(emrHeader)
+	b.uint32(headerSize)
+	b.rect(bounds)
+	b.rect(frame)
+	b.uint32(0x464D4520) // signature
+	b.uint32(0x00010000) // version
+	b.uint32(uint32(headerSize + start.Len() + r.records.Len() + end.Len()))
+	if r.opts.EMFPlus {
+		b.uint32(uint32(3 + r.nRecords))
+	} else {
+		b.uint32(uint32(2 + r.nRecords))
+	}
+	b.uint16(numHandles)
+	b.uint16(0) // reserved
+	b.uint32(0) // number of description characters
+	b.uint32(0) // offset to description
+	b.uint32(0) // number of palette entries
+	b.int32(mmW * unitsPerMm)
+	b.int32(mmH * unitsPerMm)
+	b.int32(mmW)
+	b.int32(mmH)
+	b.uint32(0) // size of pixel format
+	b.uint32(0) // offset to pixel format
+	b.uint32(0) // no OpenGL records
+	b.int32(mmW * 1000)
+	b.int32(mmH * 1000)
+
+	b.Write(start.Bytes())
+	b.Write(r.records.Bytes())
+	b.Write(end.Bytes())
+	_, err := r.w.Write(b.Bytes())
+	return err
+}
+
+// Size returns the size of the canvas in millimeters.
+func (r *EMF) Size() (float64, float64) {
+	return r.width, r.height
+}
+
+// device returns the transformation from canvas coordinates to device coordinates, which have their origin in the top-left corner.
+func (r *EMF) device() canvas.Matrix {
+	return canvas.Identity.Scale(unitsPerMm, -unitsPerMm).Translate(0.0, -r.height)
+}
+
+// record writes a GDI record, preceded by any pending EMF+ records.
+func (r *EMF) record(typ uint32, values ...int) {
+	r.recordFunc(typ, func(b *buffer) {
+		for _, v := range values {
+			b.uint32(uint32(v))
+		}
+	})
+}
+
+func (r *EMF) recordFunc(typ uint32, f func(*buffer)) {
+	r.flushPlus()
+	writeRecord(&r.records, typ, f)
+	r.nRecords++
+}
+
+// plusRecord adds an EMF+ record, which is written in an EMR_COMMENT record before the next GDI record.
+func (r *EMF) plusRecord(typ, flags uint16, f func(*buffer)) {
+	writePlusRecord(&r.plus, typ, flags, f)
+}
+
+func (r *EMF) flushPlus() {
+	if r.plus.Len() == 0 {
+		return
+	}
+	writeRecord(&r.records, emrComment, func(b *buffer) {
+		b.uint32(uint32(4 + r.plus.Len()))
+		b.uint32(0x2B464D45) // EMF+
+		b.Write(r.plus.Bytes())
+	})
+	r.nRecords++
+	r.plus.Reset()
+}
+
+// getDC makes EMF+ aware applications process the following GDI records.
+func (r *EMF) getDC() {
+	if r.opts.EMFPlus {
+		r.plusRecord(emfPlusGetDC, 0, nil)
+	}
+}
+
+func (r *EMF) addBounds(rect canvas.Rect) {
+	if !r.hasBounds {
+		r.bounds = rect
+		r.hasBounds = true
+	} else {
+		r.bounds = r.bounds.Add(rect)
+	}
+}
+
+func writeRecord(w *buffer, typ uint32, f func(*buffer)) {
+	b := &buffer{}
+	if f != nil {
+		f(b)
+	}
+	b.pad()
+	w.uint32(typ)
+	w.uint32(uint32(8 + b.Len()))
+	w.Write(b.Bytes())
+}
+
+func writePlusRecord(w *buffer, typ, flags uint16, f func(*buffer)) {
+	b := &buffer{}
+	if f != nil {
+		f(b)
+	}
+	b.pad()
+	w.uint16(typ)
+	w.uint16(flags)
+	w.uint32(uint32(12 + b.Len()))
+	w.uint32(uint32(b.Len()))
+	w.Write(b.Bytes())
+}
+
+// RenderPath renders a path to the canvas using a style and a transformation matrix.
+func (r *EMF) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	if path.Empty() {
+		return
+	}
+
+	// GDI doesn't support the arcs joiner, miter joiner (not clipped), miter joiner (clipped) with non-bevel fallback, non-uniform stroke widths, or gradient strokes
+	strokeUnsupported := !m.IsSimilarity() || !style.Stroke.IsColor()
+	if _, ok := style.StrokeJoiner.(canvas.ArcsJoiner); ok {
+		strokeUnsupported = true
+	} else if miter, ok := style.StrokeJoiner.(canvas.MiterJoiner); ok {
+		if math.IsNaN(miter.Limit) {
+			strokeUnsupported = true
+		} else if _, ok := miter.GapJoiner.(canvas.BevelJoiner); !ok {
+			strokeUnsupported = true
+		}
+	}
+
+	m = r.device().Mul(m)
+	if style.HasFill() {
+		r.fill(path.Transform(m), style.Fill, style.FillRule)
+	}
+	if style.HasStroke() {
+		if style.IsDashed() {
+			path = path.Dash(style.DashOffset, style.Dashes...)
+		}
+		if strokeUnsupported {
+			path = path.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner, canvas.Tolerance)
+			r.fill(path.Transform(m), style.Stroke, canvas.NonZero)
+		} else {
+			style.StrokeWidth *= math.Sqrt(math.Abs(m.Det()))
+			r.stroke(path.Transform(m), style)
+		}
+	}
+}
+
+// fill fills a path in device coordinates.
+func (r *EMF) fill(path *canvas.Path, paint canvas.Paint, fillRule canvas.FillRule) {
+	if paint.IsPattern() {
+		hatch, ok := paint.Pattern.(*canvas.HatchPattern)
+		if !ok {
+			return
+		}
+		// hatch patterns are defined in canvas coordinates
+		device := r.device()
+		path = hatch.Tile(path.Transform(device.Inv())).Transform(device)
+		paint = hatch.Fill
+		fillRule = canvas.NonZero
+		if !paint.IsColor() {
+			return
+		}
+	}
+	path = path.ReplaceArcs()
+	r.addBounds(path.FastBounds())
+
+	if paint.IsGradient() {
+		r.getDC()
+		r.record(emrSaveDC)
+		r.setFillRule(fillRule)
+		r.writePath(path)
+		r.record(emrSelectClipPath, 1) // intersect
+		r.fillGradient(path.FastBounds(), paint.Gradient)
+		r.record(emrRestoreDC, -1)
+		return
+	}
+
+	if r.opts.EMFPlus && (fillRule == canvas.EvenOdd || len(path.Split()) == 1) {
+		// EMF+ paths are filled using the even-odd rule
+		r.writePlusPath(path)
+		r.plusRecord(emfPlusFillPath, 0x8000, func(b *buffer) {
+			b.uint32(argb(paint.Color))
+		})
+	} else {
+		r.getDC()
+	}
+	r.setFillRule(fillRule)
+	r.fillColor(path, paint.Color)
+}
+
+func (r *EMF) setFillRule(fillRule canvas.FillRule) {
+	if fillRule == canvas.EvenOdd {
+		r.record(emrSetPolyFillMode, 1) // alternate
+	} else {
+		r.record(emrSetPolyFillMode, 2) // winding
+	}
+}
+
+// fillColor fills a path in device coordinates with a solid GDI brush.
+func (r *EMF) fillColor(path *canvas.Path, col color.RGBA) {
+	r.recordFunc(emrCreateBrushIndirect, func(b *buffer) {
+		b.uint32(brushHandle)
+		b.uint32(0) // solid brush
+		b.uint32(colorRef(col))
+		b.uint32(0) // hatch
+	})
+	r.record(emrSelectObject, brushHandle)
+	r.writePath(path)
+	r.recordFunc(emrFillPath, func(b *buffer) {
+		b.rect(path.FastBounds())
+	})
+	r.record(emrSelectObject, stockNullBrush)
+	r.record(emrDeleteObject, brushHandle)
+}
+
+// fillGradient fills the bounds in device coordinates with bands of solid colors that approximate the gradient.
+func (r *EMF) fillGradient(bounds canvas.Rect, gradient canvas.Gradient) {
+	device := r.device()
+	corners := []canvas.Point{
+		{X: bounds.X, Y: bounds.Y},
+		{X: bounds.X + bounds.W, Y: bounds.Y},
+		{X: bounds.X + bounds.W, Y: bounds.Y + bounds.H},
+		{X: bounds.X, Y: bounds.Y + bounds.H},
+	}
+	n := r.opts.GradientSteps
+	switch g := gradient.(type) {
+	case *canvas.LinearGradient:
+		start, end := device.Dot(g.Start), device.Dot(g.End)
+		d := end.Sub(start)
+		if d.Length() == 0.0 {
+			r.fillColor(canvas.Rectangle(bounds.W, bounds.H).Translate(bounds.X, bounds.Y), g.Stops.At(1.0))
+			return
+		}
+		normal := canvas.Point{X: -d.Y, Y: d.X}.Norm(1.0)
+
+		// extent of the bounds along and across the gradient
+		t0, t1 := math.Inf(1), math.Inf(-1)
+		s0, s1 := math.Inf(1), math.Inf(-1)
+		for _, corner := range corners {
+			t := corner.Sub(start).Dot(d) / d.Dot(d)
+			s := corner.Sub(start).Dot(normal)
+			t0, t1 = math.Min(t0, t), math.Max(t1, t)
+			s0, s1 = math.Min(s0, s), math.Max(s1, s)
+		}
+		for i := 0; i < n; i++ {
+			ta := t0 + (t1-t0)*float64(i)/float64(n)
+			tb := t0 + (t1-t0)*float64(i+1)/float64(n)
+			band := &canvas.Path{}
+			for j, p := range []canvas.Point{
+				start.Add(d.Mul(ta)).Add(normal.Mul(s0)),
+				start.Add(d.Mul(tb)).Add(normal.Mul(s0)),
+				start.Add(d.Mul(tb)).Add(normal.Mul(s1)),
+				start.Add(d.Mul(ta)).Add(normal.Mul(s1)),
+			} {
+				if j == 0 {
+					band.MoveTo(p.X, p.Y)
+				} else {
+					band.LineTo(p.X, p.Y)
+				}
+			}
+			band.Close()
+			r.fillColor(band, g.Stops.At((ta+tb)/2.0))
+		}
+	case *canvas.RadialGradient:
+		scale := math.Sqrt(math.Abs(device.Det()))
+		c0, c1 := device.Dot(g.C0), device.Dot(g.C1)
+		r0, r1 := g.R0*scale, g.R1*scale
+
+		// fill the outside with the last color and draw circles from the outside in
+		r.fillColor(canvas.Rectangle(bounds.W, bounds.H).Translate(bounds.X, bounds.Y), g.Stops.At(1.0))
+		for i := n - 1; -1 <= i; i-- {
+			t := float64(i+1) / float64(n)
+			center := c0.Interpolate(c1, t)
+			radius := r0 + (r1-r0)*t
+			if radius <= 0.0 {
+				continue
+			}
+			col := g.Stops.At((float64(i) + 0.5) / float64(n))
+			if i == -1 {
+				col = g.Stops.At(0.0)
+			}
+			r.fillColor(canvas.Circle(radius).Translate(center.X, center.Y).ReplaceArcs(), col)
+		}
+	default:
+		center := device.Inv().Dot(canvas.Point{X: bounds.X + bounds.W/2.0, Y: bounds.Y + bounds.H/2.0})
+		r.fillColor(canvas.Rectangle(bounds.W, bounds.H).Translate(bounds.X, bounds.Y), gradient.At(center.X, center.Y))
+	}
+}
+
+// stroke strokes a path in device coordinates, where the stroke width is in device units.
+func (r *EMF) stroke(path *canvas.Path, style canvas.Style) {
+	path = path.ReplaceArcs()
+	bounds := path.FastBounds()
+	bounds = canvas.Rect{X: bounds.X - style.StrokeWidth, Y: bounds.Y - style.StrokeWidth, W: bounds.W + 2.0*style.StrokeWidth, H: bounds.H + 2.0*style.StrokeWidth}
+	r.addBounds(bounds)
+
+	penStyle := uint32(0x00010000) // geometric
+	plusCap, plusJoin := uint32(2), uint32(2)
+	miterLimit := 0.0
+	if _, ok := style.StrokeCapper.(canvas.ButtCapper); ok {
+		penStyle |= 0x0200
+		plusCap = 0
+	} else if _, ok := style.StrokeCapper.(canvas.SquareCapper); ok {
+		penStyle |= 0x0100
+		plusCap = 1
+	}
+	if _, ok := style.StrokeJoiner.(canvas.BevelJoiner); ok {
+		penStyle |= 0x1000
+		plusJoin = 1
+	} else if miter, ok := style.StrokeJoiner.(canvas.MiterJoiner); ok {
+		penStyle |= 0x2000
+		plusJoin = 0
+		miterLimit = miter.Limit
+	}
+
+	if r.opts.EMFPlus {
+		r.writePlusPath(path)
+		r.plusRecord(emfPlusObject, 2<<8|1, func(b *buffer) {
+			b.uint32(0xDBC01002) // version
+			b.uint32(0)          // type
+			flags := uint32(0x02 | 0x04 | 0x08)
+			if plusJoin == 0 {
+				flags |= 0x10
+			}
+			b.uint32(flags)
+			b.uint32(0) // world units
+			b.float32(style.StrokeWidth)
+			b.uint32(plusCap)
+			b.uint32(plusCap)
+			b.uint32(plusJoin)
+			if plusJoin == 0 {
+				b.float32(miterLimit)
+			}
+			b.uint32(0xDBC01002) // brush version
+			b.uint32(0)          // solid color brush
+			b.uint32(argb(style.Stroke.Color))
+		})
+		r.plusRecord(emfPlusDrawPath, 0, func(b *buffer) {
+			b.uint32(1) // pen
+		})
+	}
+
+	r.recordFunc(emrExtCreatePen, func(b *buffer) {
+		b.uint32(penHandle)
+		b.uint32(0) // offset to bitmap
+		b.uint32(0) // size of bitmap
+		b.uint32(0) // offset to bits
+		b.uint32(0) // size of bits
+		b.uint32(penStyle)
+		b.uint32(uint32(math.Max(1.0, math.Round(style.StrokeWidth))))
+		b.uint32(0) // solid brush
+		b.uint32(colorRef(style.Stroke.Color))
+		b.uint32(0) // hatch
+		b.uint32(0) // number of style entries
+	})
+	if miterLimit != 0.0 {
+		r.record(emrSetMiterLimit, int(math.Ceil(miterLimit)))
+	}
+	r.record(emrSelectObject, penHandle)
+	r.writePath(path)
+	r.recordFunc(emrStrokePath, func(b *buffer) {
+		b.rect(bounds)
+	})
+	r.record(emrSelectObject, stockNullPen)
+	r.record(emrDeleteObject, penHandle)
+}
+
+// writePath writes a path in device coordinates as a GDI path bracket. Arcs must have been replaced.
+func (r *EMF) writePath(path *canvas.Path) {
+	r.record(emrBeginPath)
+	points, typ := []canvas.Point{}, uint32(0)
+	flush := func() {
+		if len(points) == 0 {
+			return
+		}
+		r.recordFunc(typ, func(b *buffer) {
+			b.rect(pointsBounds(points))
+			b.uint32(uint32(len(points)))
+			for _, p := range points {
+				b.int32(round(p.X))
+				b.int32(round(p.Y))
+			}
+		})
+		points = points[:0]
+	}
+	for scanner := path.Scanner(); scanner.Scan(); {
+		end := scanner.End()
+		switch scanner.Cmd() {
+		case canvas.MoveToCmd:
+			flush()
+			r.record(emrMoveToEx, int(round(end.X)), int(round(end.Y)))
+		case canvas.LineToCmd:
+			if typ != emrPolylineTo {
+				flush()
+				typ = emrPolylineTo
+			}
+			points = append(points, end)
+		case canvas.QuadToCmd, canvas.CubeToCmd:
+			if typ != emrPolyBezierTo {
+				flush()
+				typ = emrPolyBezierTo
+			}
+			var cp1, cp2 canvas.Point
+			if scanner.Cmd() == canvas.QuadToCmd {
+				cp := scanner.CP1()
+				cp1, cp2 = scanner.Start().Interpolate(cp, 2.0/3.0), end.Interpolate(cp, 2.0/3.0)
+			} else {
+				cp1, cp2 = scanner.CP1(), scanner.CP2()
+			}
+			points = append(points, cp1, cp2, end)
+		case canvas.CloseCmd:
+			flush()
+			r.record(emrCloseFigure)
+		}
+	}
+	flush()
+	r.record(emrEndPath)
+}
+
+// writePlusPath writes a path in device coordinates as an EMF+ path object with ID 0. Arcs must have been replaced.
+func (r *EMF) writePlusPath(path *canvas.Path) {
+	points, types := []canvas.Point{}, []uint8{}
+	for scanner := path.Scanner(); scanner.Scan(); {
+		end := scanner.End()
+		switch scanner.Cmd() {
+		case canvas.MoveToCmd:
+			points = append(points, end)
+			types = append(types, 0x00)
+		case canvas.LineToCmd:
+			points = append(points, end)
+			types = append(types, 0x01)
+		case canvas.QuadToCmd, canvas.CubeToCmd:
+			var cp1, cp2 canvas.Point
+			if scanner.Cmd() == canvas.QuadToCmd {
+				cp := scanner.CP1()
+				cp1, cp2 = scanner.Start().Interpolate(cp, 2.0/3.0), end.Interpolate(cp, 2.0/3.0)
+			} else {
+				cp1, cp2 = scanner.CP1(), scanner.CP2()
+			}
+			points = append(points, cp1, cp2, end)
+			types = append(types, 0x03, 0x03, 0x03)
+		case canvas.CloseCmd:
+			if !end.Equals(points[len(points)-1]) {
+				points = append(points, end)
+				types = append(types, 0x01)
+			}
+			types[len(types)-1] |= 0x80
+		}
+	}
+	r.plusRecord(emfPlusObject, 3<<8|0, func(b *buffer) {
+		b.uint32(0xDBC01002) // version
+		b.uint32(uint32(len(points)))
+		b.uint32(0) // uncompressed absolute points
+		for _, p := range points {
+			b.float32(p.X)
+			b.float32(p.Y)
+		}
+		b.Write(types)
+	})
+}
+
+func pointsBounds(points []canvas.Point) canvas.Rect {
+	x0, y0, x1, y1 := points[0].X, points[0].Y, points[0].X, points[0].Y
+	for _, p := range points[1:] {
+		x0, y0 = math.Min(x0, p.X), math.Min(y0, p.Y)
+		x1, y1 = math.Max(x1, p.X), math.Max(y1, p.Y)
+	}
+	return canvas.Rect{X: x0, Y: y0, W: x1 - x0, H: y1 - y0}
+}
+
+// RenderText renders a text object to the canvas using a transformation matrix.
+func (r *EMF) RenderText(text *canvas.Text, m canvas.Matrix) {
+	if r.opts.TextAsPath || !m.IsSimilarity() || m.Det() < 0.0 {
+		text.RenderAsPath(r, m, canvas.DefaultResolution)
+		return
+	}
+
+	text.WalkDecorations(func(paint canvas.Paint, p *canvas.Path) {
+		style := canvas.DefaultStyle
+		style.Fill = paint
+		r.RenderPath(p, style, m)
+	})
+
+	text.WalkSpans(func(x, y float64, span canvas.TextSpan) {
+		if !span.IsText() {
+			for _, obj := range span.Objects {
+				obj.Canvas.RenderViewTo(r, m.Mul(obj.View(x, y, span.Face)))
+			}
+		} else if !span.Face.Fill.IsColor() {
+			style := canvas.DefaultStyle
+			style.Fill = span.Face.Fill
+			p, _, err := span.Face.ToPath(span.Text)
+			if err == nil {
+				r.RenderPath(p, style, m.Translate(x, y))
+			}
+		} else {
+			r.writeText(x, y, span, m)
+		}
+	})
+}
+
+// writeText writes a text span as an EMR_EXTTEXTOUTW record.
+func (r *EMF) writeText(x, y float64, span canvas.TextSpan, m canvas.Matrix) {
+	m = r.device().Mul(m)
+	scale := math.Sqrt(math.Abs(m.Det()))
+	theta := -math.Atan2(m[1][0], m[0][0]) * 180.0 / math.Pi // counter clockwise in y-down coordinates
+	pos := m.Dot(canvas.Point{X: x, Y: y})
+	face := span.Face
+
+	// character advances from the glyph clusters
+	chars := utf16.Encode([]rune(span.Text))
+	dx := make([]int32, len(chars))
+	if 0 < len(span.Glyphs) && 0 < len(chars) {
+		offsets := map[uint32]int{} // byte offset to UTF-16 index
+		i := 0
+		for offset, r := range span.Text {
+			offsets[uint32(offset)] = i
+			i += len(utf16.Encode([]rune{r}))
+		}
+		advances := make([]float64, len(chars))
+		cluster0 := span.Glyphs[0].Cluster
+		for _, glyph := range span.Glyphs {
+			i, ok := offsets[glyph.Cluster-cluster0]
+			if !ok {
+				i = len(chars) - 1
+			}
+			advances[i] += face.MmPerEm * float64(glyph.XAdvance) * scale
+		}
+		pos := 0.0
+		for i, advance := range advances {
+			dx[i] = round(pos+advance) - round(pos)
+			pos += advance
+		}
+	}
+
+	height := face.Size * scale
+	width := span.Width * scale
+	bounds := canvas.Rect{X: pos.X, Y: pos.Y - height, W: width, H: 2.0 * height}
+	if theta != 0.0 {
+		bounds = canvas.Rect{X: pos.X - width - height, Y: pos.Y - width - height, W: 2.0 * (width + height), H: 2.0 * (width + height)}
+	}
+	r.addBounds(bounds)
+
+	r.getDC()
+	r.recordFunc(emrExtCreateFontIndirect, func(b *buffer) {
+		b.uint32(fontHandle)
+		b.int32(-round(height))
+		b.int32(0) // width
+		b.int32(round(theta * 10.0))
+		b.int32(round(theta * 10.0))
+		b.int32(int32(face.Style.CSS()))
+		if face.Style&canvas.FontItalic != 0 {
+			b.uint8(1)
+		} else {
+			b.uint8(0)
+		}
+		b.uint8(0) // underline
+		b.uint8(0) // strike out
+		b.uint8(1) // default charset
+		b.uint8(4) // TrueType output precision
+		b.uint8(0) // default clip precision
+		b.uint8(4) // anti-aliased quality
+		b.uint8(0) // default pitch and family
+		name := utf16.Encode([]rune(face.Name()))
+		for i := 0; i < 32; i++ {
+			if i < len(name) && i < 31 {
+				b.uint16(name[i])
+			} else {
+				b.uint16(0)
+			}
+		}
+	})
+	r.record(emrSelectObject, fontHandle)
+	r.record(emrSetTextColor, int(colorRef(face.Fill.Color)))
+	r.recordFunc(emrExtTextOutW, func(b *buffer) {
+		b.rect(bounds)
+		b.uint32(2) // advanced graphics mode
+		b.float32(0.0)
+		b.float32(0.0)
+		b.int32(round(pos.X))
+		b.int32(round(pos.Y))
+		b.uint32(uint32(len(chars)))
+		offString := 76
+		b.uint32(uint32(offString))
+		b.uint32(0)           // options
+		b.rect(canvas.Rect{}) // clipping rectangle
+		b.uint32(uint32(offString + (2*len(chars)+3)/4*4))
+		for _, c := range chars {
+			b.uint16(c)
+		}
+		b.pad()
+		for _, d := range dx {
+			b.int32(d)
+		}
+	})
+	r.record(emrSelectObject, stockSystemFont)
+	r.record(emrDeleteObject, fontHandle)
+}
+
+// RenderImage renders an image to the canvas using a transformation matrix.
+func (r *EMF) RenderImage(img image.Image, m canvas.Matrix) {
+	size := img.Bounds().Size()
+	if size.X == 0 || size.Y == 0 {
+		return
+	}
+
+	// premultiplied BGRA pixels from the bottom row up
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Bounds().Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+	bits := make([]byte, 0, 4*size.X*size.Y)
+	for y := size.Y - 1; 0 <= y; y-- {
+		for x := 0; x < size.X; x++ {
+			i := rgba.PixOffset(x, y)
+			bits = append(bits, rgba.Pix[i+2], rgba.Pix[i+1], rgba.Pix[i+0], rgba.Pix[i+3])
+		}
+	}
+
+	// transformation from pixel coordinates with a top-left origin to device coordinates
+	m = r.device().Mul(m).Translate(0.0, float64(size.Y)).Scale(1.0, -1.0)
+	bounds := canvas.Rectangle(float64(size.X), float64(size.Y)).Transform(m).FastBounds()
+	r.addBounds(bounds)
+
+	r.getDC()
+	r.record(emrSaveDC)
+	if canvas.ImageInterpolation(img) == canvas.NearestInterpolation {
+		r.record(emrSetStretchBltMode, 3) // color on color
+	} else {
+		r.record(emrSetStretchBltMode, 4) // halftone
+	}
+	r.recordFunc(emrSetWorldTransform, func(b *buffer) {
+		b.xform(m)
+	})
+	r.recordFunc(emrAlphaBlend, func(b *buffer) {
+		const offBmi = 108
+		const sizeBmi = 40
+		b.rect(bounds)
+		b.int32(0)
+		b.int32(0)
+		b.int32(int32(size.X))
+		b.int32(int32(size.Y))
+		b.uint8(0)    // source over
+		b.uint8(0)    // flags
+		b.uint8(0xFF) // constant alpha
+		b.uint8(1)    // per-pixel alpha
+		b.int32(0)
+		b.int32(0)
+		b.xform(canvas.Identity)
+		b.uint32(0) // background color
+		b.uint32(0) // RGB colors
+		b.uint32(offBmi)
+		b.uint32(sizeBmi)
+		b.uint32(offBmi + sizeBmi)
+		b.uint32(uint32(len(bits)))
+		b.int32(int32(size.X))
+		b.int32(int32(size.Y))
+
+		// BITMAPINFOHEADER
+		b.uint32(sizeBmi)
+		b.int32(int32(size.X))
+		b.int32(int32(size.Y))
+		b.uint16(1)  // planes
+		b.uint16(32) // bits per pixel
+		b.uint32(0)  // uncompressed
+		b.uint32(uint32(len(bits)))
+		b.int32(0)
+		b.int32(0)
+		b.uint32(0)
+		b.uint32(0)
+		b.Write(bits)
+	})
+	r.record(emrRestoreDC, -1)
+}
@@ -0,0 +1,132 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/test"
+)
+
+// parseRecords returns the record types of an EMF file and the EMF+ record types within comments.
+func parseRecords(t *testing.T, b []byte) ([]uint32, []uint16) {
+	test.That(t, 108 <= len(b), "no header")
+	test.T(t, binary.LittleEndian.Uint32(b[0:]), uint32(emrHeader))
+	test.T(t, binary.LittleEndian.Uint32(b[40:]), uint32(0x464D4520), "signature")
+	test.T(t, int(binary.LittleEndian.Uint32(b[48:])), len(b), "file size")
+	nRecords := int(binary.LittleEndian.Uint32(b[52:]))
+
+	types, plusTypes := []uint32{}, []uint16{}
+	for i := 0; i < len(b); {
+		typ := binary.LittleEndian.Uint32(b[i:])
+		size := int(binary.LittleEndian.Uint32(b[i+4:]))
+		test.That(t, size%4 == 0 && 8 <= size && i+size <= len(b), "bad record size", size)
+		if typ == emrComment && binary.LittleEndian.Uint32(b[i+12:]) == 0x2B464D45 {
+			data := b[i+16 : i+12+int(binary.LittleEndian.Uint32(b[i+8:]))]
+			for j := 0; j < len(data); {
+				plusTypes = append(plusTypes, binary.LittleEndian.Uint16(data[j:]))
+				plusSize := int(binary.LittleEndian.Uint32(data[j+4:]))
+				test.T(t, plusSize, 12+int(binary.LittleEndian.Uint32(data[j+8:])), "bad EMF+ record size")
+				j += plusSize
+			}
+		}
+		types = append(types, typ)
+		i += size
+	}
+	test.T(t, len(types), nRecords, "number of records")
+	test.T(t, types[len(types)-1], uint32(emrEOF))
+	return types, plusTypes
+}
+
+func contains(types []uint32, typ uint32) bool {
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEMF(t *testing.T) {
+	gradient := canvas.NewLinearGradient(canvas.Point{X: 0.0, Y: 0.0}, canvas.Point{X: 10.0, Y: 0.0})
+	gradient.Add(0.0, canvas.Red)
+	gradient.Add(1.0, canvas.Blue)
+
+	c := canvas.New(50.0, 30.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetFillColor(canvas.RGBA(255, 0, 0, 0.5))
+	ctx.SetStrokeColor(canvas.Black)
+	ctx.SetStrokeWidth(0.5)
+	ctx.DrawPath(5.0, 5.0, canvas.Circle(5.0))
+	ctx.SetFillGradient(gradient)
+	ctx.SetStroke(canvas.Transparent)
+	ctx.DrawPath(20.0, 5.0, canvas.Rectangle(10.0, 10.0))
+	ctx.DrawImage(35.0, 5.0, image.NewRGBA(image.Rect(0, 0, 2, 2)), canvas.DPMM(1.0))
+
+	buf := &bytes.Buffer{}
+	emf := New(buf, c.W, c.H, nil)
+	c.RenderTo(emf)
+	test.Error(t, emf.Close())
+
+	types, plusTypes := parseRecords(t, buf.Bytes())
+	for _, typ := range []uint32{emrPolyBezierTo, emrFillPath, emrStrokePath, emrExtCreatePen, emrSelectClipPath, emrAlphaBlend} {
+		test.That(t, contains(types, typ), "record", typ, "missing")
+	}
+	test.T(t, plusTypes[0], uint16(emfPlusHeader))
+	test.T(t, plusTypes[len(plusTypes)-1], uint16(emfPlusEndOfFile))
+	test.T(t, plusTypes[1:8], []uint16{emfPlusSetPageTransform, emfPlusSetAntiAliasMode, emfPlusObject, emfPlusFillPath, emfPlusObject, emfPlusObject, emfPlusDrawPath})
+
+	// header bounds and frame
+	b := buf.Bytes()
+	test.T(t, int32(binary.LittleEndian.Uint32(b[24:])), int32(0))
+	test.T(t, int32(binary.LittleEndian.Uint32(b[32:])), int32(5000))
+	test.T(t, int32(binary.LittleEndian.Uint32(b[36:])), int32(3000))
+
+	// GDI only
+	buf.Reset()
+	emf = New(buf, c.W, c.H, &Options{GradientSteps: 4})
+	c.RenderTo(emf)
+	test.Error(t, emf.Close())
+	types, plusTypes = parseRecords(t, buf.Bytes())
+	test.T(t, len(plusTypes), 0)
+	test.That(t, !contains(types, emrComment), "has comment records")
+}
+
+func TestEMFText(t *testing.T) {
+	family := canvas.NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	c := canvas.New(50.0, 30.0)
+	ctx := canvas.NewContext(c)
+	ctx.DrawText(5.0, 5.0, canvas.NewTextLine(face, "Office", canvas.Left))
+
+	buf := &bytes.Buffer{}
+	emf := New(buf, c.W, c.H, nil)
+	c.RenderTo(emf)
+	test.Error(t, emf.Close())
+	types, plusTypes := parseRecords(t, buf.Bytes())
+	test.That(t, contains(types, emrExtCreateFontIndirect), "no font")
+	test.That(t, contains(types, emrExtTextOutW), "no text")
+	test.That(t, bytes.Contains(buf.Bytes(), []byte("O\x00f\x00f\x00i\x00c\x00e\x00")), "no UTF-16 text")
+	test.T(t, plusTypes[len(plusTypes)-2], uint16(emfPlusGetDC))
+
+	buf.Reset()
+	emf = New(buf, c.W, c.H, &Options{TextAsPath: true})
+	c.RenderTo(emf)
+	test.Error(t, emf.Close())
+	types, _ = parseRecords(t, buf.Bytes())
+	test.That(t, !contains(types, emrExtTextOutW), "text is not converted to paths")
+	test.That(t, contains(types, emrFillPath), "no glyph outlines")
+}
+
+func TestEMFOptions(t *testing.T) {
+	opts := &Options{GradientSteps: 0}
+	r := New(&bytes.Buffer{}, 10.0, 10.0, opts)
+	test.T(t, r.opts.GradientSteps, 1)
+	test.T(t, opts.GradientSteps, 0) // options of the caller are not changed
+}
@@ -0,0 +1,91 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"math"
+
+	"github.com/tdewolff/canvas"
+)
+
+// buffer is a little-endian binary buffer for record data.
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) uint8(v uint8) {
+	b.WriteByte(v)
+}
+
+func (b *buffer) uint16(v uint16) {
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], v)
+	b.Write(buf[:])
+}
+
+func (b *buffer) uint32(v uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	b.Write(buf[:])
+}
+
+func (b *buffer) int32(v int32) {
+	b.uint32(uint32(v))
+}
+
+func (b *buffer) float32(v float64) {
+	b.uint32(math.Float32bits(float32(v)))
+}
+
+// rect writes a rectangle as its left, top, right, and bottom edges in device units.
+func (b *buffer) rect(rect canvas.Rect) {
+	b.int32(round(rect.X))
+	b.int32(round(rect.Y))
+	b.int32(round(rect.X + rect.W))
+	b.int32(round(rect.Y + rect.H))
+}
+
+// xform writes a transformation matrix as an XFORM.
+func (b *buffer) xform(m canvas.Matrix) {
+	b.float32(m[0][0])
+	b.float32(m[1][0])
+	b.float32(m[0][1])
+	b.float32(m[1][1])
+	b.float32(m[0][2])
+	b.float32(m[1][2])
+}
+
+// pad pads the buffer to a multiple of four bytes.
+func (b *buffer) pad() {
+	for b.Len()%4 != 0 {
+		b.WriteByte(0)
+	}
+}
+
+func round(f float64) int32 {
+	return int32(math.Round(f))
+}
+
+// unpremultiply returns the non-premultiplied color components.
+func unpremultiply(c color.RGBA) (uint8, uint8, uint8, uint8) {
+	if c.A == 0 {
+		return 0, 0, 0, 0
+	} else if c.A == 255 {
+		return c.R, c.G, c.B, c.A
+	}
+	a := uint32(c.A)
+	return uint8(uint32(c.R) * 255 / a), uint8(uint32(c.G) * 255 / a), uint8(uint32(c.B) * 255 / a), c.A
+}
+
+// colorRef returns a GDI COLORREF, which ignores alpha.
+func colorRef(c color.RGBA) uint32 {
+	r, g, b, _ := unpremultiply(c)
+	return uint32(b)<<16 | uint32(g)<<8 | uint32(r)
+}
+
+// argb returns an EMF+ ARGB color.
+func argb(c color.RGBA) uint32 {
+	r, g, b, a := unpremultiply(c)
+	return uint32(a)<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+}
@@ -0,0 +1,245 @@
+package gcode
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/internal/plotter"
+)
+
+// Tool are the tool settings of a layer.
+type Tool struct {
+	Feed  float64 // feed rate in mm/min, zero to use the default feed rate
+	Power float64 // spindle speed or laser power (S word), zero to omit
+}
+
+// Options are the G-code renderer options.
+type Options struct {
+	Tolerance  float64      // maximum deviation in mm when flattening curves
+	Arcs       bool         // write circular arcs as G2/G3 moves instead of flattening them
+	PenWidth   float64      // tool width in mm used to hatch fills, zero disables fills
+	HatchAngle float64      // angle in degrees of the hatch lines of fills
+	Optimize   bool         // reorder and reverse paths per layer to minimize travel
+	Feed       float64      // default feed rate in mm/min
+	ToolOn     string       // command to lower the pen or turn on the laser or spindle
+	ToolOff    string       // command to raise the pen or turn off the laser or spindle
+	Tools      map[int]Tool // tool settings per z-index
+}
+
+// DefaultOptions are the default G-code renderer options.
+var DefaultOptions = Options{
+	Tolerance:  0.05,
+	Arcs:       true,
+	PenWidth:   0.3,
+	HatchAngle: 45.0,
+	Optimize:   true,
+	Feed:       1000.0,
+	ToolOn:     "M3",
+	ToolOff:    "M5",
+}
+
+// GCode is a G-code renderer for CNC machines, laser cutters, and pen plotters. Paths are written as rapid (G0) travel moves and linear (G1) or circular (G2/G3) cutting moves, fills are converted to hatch lines, and text is converted to paths. Each z-index can have a different feed rate and power. Be aware that stroke widths, colors, and images are not supported.
+type GCode struct {
+	w             io.Writer
+	width, height float64
+	opts          *Options
+
+	layer  int
+	layers []int
+	paths  map[int][]*canvas.Path
+}
+
+// New returns a G-code renderer. Units are in millimeters.
+func New(w io.Writer, width, height float64, opts *Options) *GCode {
+	if opts == nil {
+		defaultOptions := DefaultOptions
+		opts = &defaultOptions
+	}
+	return &GCode{
+		w:      w,
+		width:  width,
+		height: height,
+		opts:   opts,
+		layers: []int{0},
+		paths:  map[int][]*canvas.Path{},
+	}
+}
+
+// Close writes the toolpaths of all layers and closes the G-code file.
+func (r *GCode) Close() error {
+	w := bufio.NewWriter(r.w)
+	fmt.Fprintf(w, "G21\nG90\n%s\n", r.opts.ToolOff)
+
+	pos := canvas.Point{}
+	sort.Ints(r.layers)
+	for _, layer := range r.layers {
+		paths := r.paths[layer]
+		if len(paths) == 0 {
+			continue
+		}
+
+		tool := r.opts.Tools[layer]
+		if tool.Feed == 0.0 {
+			tool.Feed = r.opts.Feed
+		}
+		toolOn := r.opts.ToolOn
+		if tool.Power != 0.0 {
+			toolOn += fmt.Sprintf(" S%v", dec(tool.Power))
+		}
+
+		fmt.Fprintf(w, "(layer %d)\n", layer)
+		if r.opts.Optimize {
+			paths = plotter.Optimize(paths, pos)
+		}
+		for _, path := range paths {
+			start := path.StartPos()
+			fmt.Fprintf(w, "G0 X%v Y%v\n%s\n", dec(start.X), dec(start.Y), toolOn)
+			feed := true
+			for scanner := path.Scanner(); scanner.Scan(); {
+				end := scanner.End()
+				switch scanner.Cmd() {
+				case canvas.LineToCmd, canvas.CloseCmd:
+					if scanner.Cmd() == canvas.CloseCmd && end.Equals(scanner.Start()) {
+						continue
+					}
+					fmt.Fprintf(w, "G1 X%v Y%v", dec(end.X), dec(end.Y))
+				case canvas.ArcToCmd:
+					rx, _, _, large, sweep := scanner.Arc()
+					center := arcCenter(scanner.Start(), end, rx, large, sweep)
+					cmd := "G2" // clockwise
+					if sweep {
+						cmd = "G3"
+					}
+					fmt.Fprintf(w, "%s X%v Y%v I%v J%v", cmd, dec(end.X), dec(end.Y), dec(center.X-scanner.Start().X), dec(center.Y-scanner.Start().Y))
+				default:
+					continue
+				}
+				if feed {
+					fmt.Fprintf(w, " F%v", dec(tool.Feed))
+					feed = false
+				}
+				fmt.Fprintf(w, "\n")
+			}
+			fmt.Fprintf(w, "%s\n", r.opts.ToolOff)
+			pos = path.Pos()
+		}
+	}
+	fmt.Fprintf(w, "G0 X0 Y0\nM2\n")
+	return w.Flush()
+}
+
+// Size returns the size of the canvas in millimeters.
+func (r *GCode) Size() (float64, float64) {
+	return r.width, r.height
+}
+
+// SetLayer sets the z-index of the following paths, which selects the tool settings.
+func (r *GCode) SetLayer(zindex int) {
+	r.layer = zindex
+	for _, layer := range r.layers {
+		if layer == zindex {
+			return
+		}
+	}
+	r.layers = append(r.layers, zindex)
+}
+
+// RenderPath renders a path to the canvas using a style and a transformation matrix.
+func (r *GCode) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	if path.Empty() {
+		return
+	}
+
+	if style.HasFill() && r.opts.PenWidth != 0.0 {
+		r.add(plotter.Hatch(path.Transform(m), style.Fill, r.opts.PenWidth, r.opts.HatchAngle))
+	}
+	if style.HasStroke() {
+		if style.IsDashed() {
+			path = path.Dash(style.DashOffset, style.Dashes...)
+		}
+		r.add(path.Transform(m))
+	}
+}
+
+// RenderText renders a text object to the canvas using a transformation matrix.
+func (r *GCode) RenderText(text *canvas.Text, m canvas.Matrix) {
+	text.RenderAsPath(r, m, canvas.DefaultResolution)
+}
+
+// RenderImage renders an image to the canvas using a transformation matrix.
+func (r *GCode) RenderImage(img image.Image, m canvas.Matrix) {
+	// images cannot be cut
+}
+
+// add adds the subpaths of a path as toolpaths, which consist only of linear segments and circular arcs.
+func (r *GCode) add(path *canvas.Path) {
+	for _, subpath := range path.Split() {
+		if subpath.Empty() {
+			continue
+		}
+		if r.opts.Arcs {
+			subpath = flattenNonCircular(subpath, r.opts.Tolerance)
+		} else {
+			subpath = subpath.Flatten(r.opts.Tolerance)
+		}
+		if 1 < len(subpath.Coords()) {
+			r.paths[r.layer] = append(r.paths[r.layer], subpath)
+		}
+	}
+}
+
+// flattenNonCircular flattens all Bézier curves and elliptical arcs while keeping circular arcs.
+func flattenNonCircular(path *canvas.Path, tolerance float64) *canvas.Path {
+	p := &canvas.Path{}
+	for scanner := path.Scanner(); scanner.Scan(); {
+		start, end := scanner.Start(), scanner.End()
+		switch scanner.Cmd() {
+		case canvas.MoveToCmd:
+			p.MoveTo(end.X, end.Y)
+		case canvas.LineToCmd:
+			p.LineTo(end.X, end.Y)
+		case canvas.CloseCmd:
+			p.Close()
+		case canvas.ArcToCmd:
+			rx, ry, rot, large, sweep := scanner.Arc()
+			if canvas.Equal(rx, ry) {
+				p.ArcTo(rx, rx, 0.0, large, sweep, end.X, end.Y)
+			} else {
+				arc := &canvas.Path{}
+				arc.MoveTo(start.X, start.Y)
+				arc.ArcTo(rx, ry, rot, large, sweep, end.X, end.Y)
+				p = p.Join(arc.Flatten(tolerance))
+			}
+		case canvas.QuadToCmd, canvas.CubeToCmd:
+			curve := &canvas.Path{}
+			curve.MoveTo(start.X, start.Y)
+			if scanner.Cmd() == canvas.QuadToCmd {
+				cp := scanner.CP1()
+				curve.QuadTo(cp.X, cp.Y, end.X, end.Y)
+			} else {
+				cp1, cp2 := scanner.CP1(), scanner.CP2()
+				curve.CubeTo(cp1.X, cp1.Y, cp2.X, cp2.Y, end.X, end.Y)
+			}
+			p = p.Join(curve.Flatten(tolerance))
+		}
+	}
+	return p
+}
+
+// arcCenter returns the center of a circular arc from start to end. The center lies to the left of the chord for small counter clockwise arcs and large clockwise arcs.
+func arcCenter(start, end canvas.Point, r float64, large, sweep bool) canvas.Point {
+	mid := start.Interpolate(end, 0.5)
+	chord := end.Sub(start)
+	d := chord.Length() / 2.0
+	h := math.Sqrt(math.Max(0.0, r*r-d*d))
+	normal := canvas.Point{X: -chord.Y, Y: chord.X}.Norm(h)
+	if large == sweep {
+		normal = normal.Neg()
+	}
+	return mid.Add(normal)
+}
@@ -0,0 +1,58 @@
+package gcode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/test"
+)
+
+func TestGCode(t *testing.T) {
+	c := canvas.New(100.0, 100.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetFill(canvas.Transparent)
+	ctx.SetStrokeColor(canvas.Black)
+	ctx.DrawPath(0.0, 0.0, canvas.MustParseSVGPath("M20 0L10 0"))
+	ctx.SetZIndex(1)
+	ctx.DrawPath(50.0, 50.0, canvas.Circle(10.0))
+
+	buf := &bytes.Buffer{}
+	gcode := New(buf, c.W, c.H, &Options{
+		Tolerance: 0.1,
+		Arcs:      true,
+		Optimize:  true,
+		Feed:      600.0,
+		ToolOn:    "M3",
+		ToolOff:   "M5",
+		Tools:     map[int]Tool{1: {Feed: 300.0, Power: 1000.0}},
+	})
+	c.RenderTo(gcode)
+	test.Error(t, gcode.Close())
+	test.String(t, buf.String(), `G21
+G90
+M5
+(layer 0)
+G0 X10 Y0
+M3
+G1 X20 Y0 F600
+M5
+(layer 1)
+G0 X60 Y50
+M3 S1000
+G3 X40 Y50 I-10 J0 F300
+G3 X60 Y50 I10 J0
+M5
+G0 X0 Y0
+M2
+`)
+
+	// flattened arcs
+	buf.Reset()
+	gcode = New(buf, c.W, c.H, &Options{Tolerance: 0.1, ToolOn: "M3", ToolOff: "M5"})
+	c.RenderTo(gcode)
+	test.Error(t, gcode.Close())
+	test.That(t, !strings.Contains(buf.String(), "G3"), "arcs are not flattened")
+	test.That(t, 10 < strings.Count(buf.String(), "G1"), "arcs are not flattened")
+}
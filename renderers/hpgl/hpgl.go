@@ -0,0 +1,169 @@
+package hpgl
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/internal/plotter"
+)
+
+// unitsPerMm is the number of plotter units per millimeter.
+const unitsPerMm = 40.0
+
+// Pen are the pen settings of a layer.
+type Pen struct {
+	Number   int     // pen number, zero to keep the current pen
+	Velocity float64 // pen velocity in cm/s, zero to use the plotter's default
+}
+
+// Options are the HPGL renderer options.
+type Options struct {
+	Tolerance  float64     // maximum deviation in mm when flattening curves
+	PenWidth   float64     // pen width in mm used to hatch fills, zero disables fills
+	HatchAngle float64     // angle in degrees of the hatch lines of fills
+	Optimize   bool        // reorder and reverse paths per layer to minimize pen-up travel
+	Pens       map[int]Pen // pen settings per z-index
+}
+
+// DefaultOptions are the default HPGL renderer options.
+var DefaultOptions = Options{
+	Tolerance:  0.05,
+	PenWidth:   0.3,
+	HatchAngle: 45.0,
+	Optimize:   true,
+}
+
+// HPGL is a Hewlett-Packard Graphics Language renderer for pen plotters. Paths are flattened and drawn with pen-up (PU) and pen-down (PD) moves, fills are converted to hatch lines, and text is converted to paths. Each z-index can select a different pen. Be aware that stroke widths, colors, and images are not supported.
+type HPGL struct {
+	w             io.Writer
+	width, height float64
+	opts          *Options
+
+	layer  int
+	layers []int
+	paths  map[int][]*canvas.Path
+}
+
+// New returns an HPGL renderer. Units are in millimeters.
+func New(w io.Writer, width, height float64, opts *Options) *HPGL {
+	if opts == nil {
+		defaultOptions := DefaultOptions
+		opts = &defaultOptions
+	}
+	return &HPGL{
+		w:      w,
+		width:  width,
+		height: height,
+		opts:   opts,
+		layers: []int{0},
+		paths:  map[int][]*canvas.Path{},
+	}
+}
+
+// Close writes the toolpaths of all layers and closes the HPGL file.
+func (r *HPGL) Close() error {
+	w := bufio.NewWriter(r.w)
+	fmt.Fprintf(w, "IN;")
+
+	pos := canvas.Point{}
+	sort.Ints(r.layers)
+	for _, layer := range r.layers {
+		paths := r.paths[layer]
+		if len(paths) == 0 {
+			continue
+		}
+
+		pen, ok := r.opts.Pens[layer]
+		if !ok {
+			pen.Number = 1
+		}
+		if pen.Number != 0 {
+			fmt.Fprintf(w, "SP%d;", pen.Number)
+		}
+		if pen.Velocity != 0.0 {
+			fmt.Fprintf(w, "VS%v;", dec(pen.Velocity))
+		}
+
+		if r.opts.Optimize {
+			paths = plotter.Optimize(paths, pos)
+		}
+		for _, path := range paths {
+			coords := path.Coords()
+			fmt.Fprintf(w, "\nPU%d,%d;PD", units(coords[0].X), units(coords[0].Y))
+			for i, coord := range coords[1:] {
+				if i != 0 {
+					fmt.Fprintf(w, ",")
+				}
+				fmt.Fprintf(w, "%d,%d", units(coord.X), units(coord.Y))
+			}
+			fmt.Fprintf(w, ";")
+			pos = coords[len(coords)-1]
+		}
+	}
+	fmt.Fprintf(w, "\nPU;SP0;\n")
+	return w.Flush()
+}
+
+// Size returns the size of the canvas in millimeters.
+func (r *HPGL) Size() (float64, float64) {
+	return r.width, r.height
+}
+
+// SetLayer sets the z-index of the following paths, which selects the pen.
+func (r *HPGL) SetLayer(zindex int) {
+	r.layer = zindex
+	for _, layer := range r.layers {
+		if layer == zindex {
+			return
+		}
+	}
+	r.layers = append(r.layers, zindex)
+}
+
+// RenderPath renders a path to the canvas using a style and a transformation matrix.
+func (r *HPGL) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	if path.Empty() {
+		return
+	}
+
+	if style.HasFill() && r.opts.PenWidth != 0.0 {
+		r.add(plotter.Hatch(path.Transform(m), style.Fill, r.opts.PenWidth, r.opts.HatchAngle))
+	}
+	if style.HasStroke() {
+		if style.IsDashed() {
+			path = path.Dash(style.DashOffset, style.Dashes...)
+		}
+		r.add(path.Transform(m))
+	}
+}
+
+// RenderText renders a text object to the canvas using a transformation matrix.
+func (r *HPGL) RenderText(text *canvas.Text, m canvas.Matrix) {
+	text.RenderAsPath(r, m, canvas.DefaultResolution)
+}
+
+// RenderImage renders an image to the canvas using a transformation matrix.
+func (r *HPGL) RenderImage(img image.Image, m canvas.Matrix) {
+	// images cannot be plotted
+}
+
+func (r *HPGL) add(path *canvas.Path) {
+	for _, subpath := range path.Split() {
+		if subpath.Empty() {
+			continue
+		}
+		subpath = subpath.Flatten(r.opts.Tolerance)
+		if 1 < len(subpath.Coords()) {
+			r.paths[r.layer] = append(r.paths[r.layer], subpath)
+		}
+	}
+}
+
+func units(f float64) int {
+	return int(math.Round(f * unitsPerMm))
+}
@@ -0,0 +1,38 @@
+package hpgl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/test"
+)
+
+func TestHPGL(t *testing.T) {
+	c := canvas.New(100.0, 100.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetFill(canvas.Transparent)
+	ctx.SetStrokeColor(canvas.Black)
+	ctx.DrawPath(0.0, 0.0, canvas.MustParseSVGPath("M50 0L60 0"))
+	ctx.DrawPath(0.0, 0.0, canvas.MustParseSVGPath("M20 0L10 0"))
+	ctx.SetZIndex(1)
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(5.0, 5.0))
+
+	buf := &bytes.Buffer{}
+	hpgl := New(buf, c.W, c.H, &Options{Tolerance: 0.1, Optimize: true, Pens: map[int]Pen{1: {Number: 2, Velocity: 10.0}}})
+	c.RenderTo(hpgl)
+	test.Error(t, hpgl.Close())
+	test.String(t, buf.String(), "IN;SP1;\nPU400,0;PD800,0;\nPU2000,0;PD2400,0;SP2;VS10;\nPU0,0;PD200,0,200,200,0,200,0,0;\nPU;SP0;\n")
+
+	// fills are hatched
+	c = canvas.New(10.0, 10.0)
+	ctx = canvas.NewContext(c)
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(10.0, 10.0))
+
+	buf.Reset()
+	hpgl = New(buf, c.W, c.H, nil)
+	c.RenderTo(hpgl)
+	test.Error(t, hpgl.Close())
+	test.That(t, 10 < strings.Count(buf.String(), "PU"), "fill is not hatched")
+}
@@ -0,0 +1,22 @@
+package hpgl
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+)
+
+type dec float64
+
+func (f dec) String() string {
+	s := strconv.FormatFloat(float64(f), 'f', canvas.Precision, 64)
+	if strings.IndexByte(s, '.') != -1 {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
@@ -0,0 +1,45 @@
+// Package plotter contains functionality shared by the renderers for pen plotters and CNC machines.
+package plotter
+
+import (
+	"math"
+
+	"github.com/tdewolff/canvas"
+)
+
+// Hatch returns the hatch lines that fill a path. Hatch patterns are used as is, while other fills are hatched using lines of the pen's width at twice the pen's width apart, so that drawing their outlines covers the fill.
+func Hatch(path *canvas.Path, fill canvas.Paint, penWidth, angle float64) *canvas.Path {
+	if pattern, ok := fill.Pattern.(*canvas.HatchPattern); ok {
+		return pattern.Tile(path)
+	}
+	return canvas.NewLineHatch(canvas.Black, angle, 2.0*penWidth, penWidth).Tile(path)
+}
+
+// Optimize orders the paths greedily by the nearest start or end point from the current position, reversing open paths when that shortens the travel.
+func Optimize(paths []*canvas.Path, pos canvas.Point) []*canvas.Path {
+	todo := append([]*canvas.Path{}, paths...)
+	ordered := make([]*canvas.Path, 0, len(paths))
+	for 0 < len(todo) {
+		best, reverse := 0, false
+		bestDist := math.Inf(1)
+		for i, path := range todo {
+			if d := path.StartPos().Sub(pos).Length(); d < bestDist {
+				best, reverse, bestDist = i, false, d
+			}
+			if !path.Closed() {
+				if d := path.Pos().Sub(pos).Length(); d < bestDist {
+					best, reverse, bestDist = i, true, d
+				}
+			}
+		}
+
+		path := todo[best]
+		if reverse {
+			path = path.Reverse()
+		}
+		ordered = append(ordered, path)
+		pos = path.Pos()
+		todo = append(todo[:best], todo[best+1:]...)
+	}
+	return ordered
+}
@@ -0,0 +1,303 @@
+package lottie
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"time"
+
+	"github.com/tdewolff/canvas"
+)
+
+type Options struct {
+	canvas.Resolution         // pixels per millimeter of the composition
+	FrameRate         float64 // frames per second
+	Name              string
+}
+
+var DefaultOptions = Options{
+	Resolution: canvas.DPI(96.0),
+	FrameRate:  60.0,
+}
+
+// Lottie is a Lottie (Bodymovin) JSON animation renderer. Each rendered path becomes a shape layer, text is converted to paths, and images are embedded as PNG image assets. Rotated and scaled images are supported, but skew is ignored for images. Be aware that radial gradients with a non-zero start radius are approximated, and that pattern fills other than hatch patterns are not supported.
+type Lottie struct {
+	w             io.Writer
+	width, height float64
+	opts          *Options
+
+	layers []layer
+	frames [][]layer
+	times  []float64 // start of each frame, in frames
+	end    float64
+}
+
+// New returns a Lottie renderer.
+func New(w io.Writer, width, height float64, opts *Options) *Lottie {
+	if opts == nil {
+		defaultOptions := DefaultOptions
+		opts = &defaultOptions
+	}
+	if opts.Resolution == 0.0 {
+		opts.Resolution = DefaultOptions.Resolution
+	}
+	if opts.FrameRate <= 0.0 {
+		opts.FrameRate = DefaultOptions.FrameRate
+	}
+	return &Lottie{
+		w:      w,
+		width:  width,
+		height: height,
+		opts:   opts,
+	}
+}
+
+// Size returns the size of the canvas in millimeters.
+func (r *Lottie) Size() (float64, float64) {
+	return r.width, r.height
+}
+
+// RenderFrames renders a sequence of canvases as an animation, where each frame is shown for its delay. If all frames consist of compatible layers, that is paths with the same number of segments and the same kind of paints, a single set of layers is written with keyframes for the shapes, colors, gradients, and stroke widths, so that each frame morphs into the next. Otherwise, each frame is written as a separate set of layers that are only visible for the duration of the frame.
+func (r *Lottie) RenderFrames(frames []*canvas.Canvas, delays []time.Duration) {
+	t := 0.0
+	for i, frame := range frames {
+		r.layers = nil
+		frame.RenderTo(r)
+		r.frames = append(r.frames, r.layers)
+		r.times = append(r.times, t)
+		t += delays[i].Seconds() * r.opts.FrameRate
+	}
+	r.layers = nil
+	r.end = t
+}
+
+// Close writes the Lottie JSON.
+func (r *Lottie) Close() error {
+	frames, times, end := r.frames, r.times, r.end
+	if len(frames) == 0 {
+		frames, times, end = [][]layer{r.layers}, []float64{0.0}, 1.0
+	}
+	end = math.Max(math.Ceil(end), 1.0)
+
+	anim := animation{
+		Version:   "5.7.4",
+		FrameRate: r.opts.FrameRate,
+		In:        0.0,
+		Out:       end,
+		Width:     int(r.width*r.opts.Resolution.DPMM() + 0.5),
+		Height:    int(r.height*r.opts.Resolution.DPMM() + 0.5),
+		Name:      r.opts.Name,
+		Assets:    []asset{},
+		Layers:    []interface{}{},
+	}
+
+	ind := 1
+	addLayers := func(frameLayers [][]layer, times []float64, in, out float64) {
+		// layers on top come first
+		for i := len(frameLayers[0]) - 1; 0 <= i; i-- {
+			layers := make([]layer, len(frameLayers))
+			for k := range frameLayers {
+				layers[k] = frameLayers[k][i]
+			}
+			if layers[0].image != nil {
+				id := fmt.Sprintf("image_%d", len(anim.Assets))
+				anim.Assets = append(anim.Assets, layers[0].image.asset(id))
+				anim.Layers = append(anim.Layers, layers[0].image.layer(ind, id, in, out))
+			} else {
+				anim.Layers = append(anim.Layers, shapeLayerJSON(ind, layers, times, in, out))
+			}
+			ind++
+		}
+	}
+	if compatibleFrames(frames) {
+		addLayers(frames, times, 0.0, end)
+	} else {
+		for k := range frames {
+			if len(frames[k]) == 0 {
+				continue
+			}
+			out := end
+			if k+1 < len(frames) {
+				out = times[k+1]
+			}
+			addLayers(frames[k:k+1], times[k:k+1], times[k], out)
+		}
+	}
+
+	enc := json.NewEncoder(r.w)
+	return enc.Encode(anim)
+}
+
+// page returns the transformation from canvas coordinates to composition coordinates, which have their origin in the top-left corner.
+func (r *Lottie) page() canvas.Matrix {
+	dpmm := r.opts.Resolution.DPMM()
+	return canvas.Identity.Scale(dpmm, -dpmm).Translate(0.0, -r.height)
+}
+
+// RenderPath renders a path to the canvas using a style and a transformation matrix.
+func (r *Lottie) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	if path.Empty() {
+		return
+	}
+
+	// Lottie doesn't support the arcs joiner, miter joiner (not clipped), or miter joiner (clipped) with non-bevel fallback
+	strokeUnsupported := !m.IsSimilarity()
+	if _, ok := style.StrokeJoiner.(canvas.ArcsJoiner); ok {
+		strokeUnsupported = true
+	} else if miter, ok := style.StrokeJoiner.(canvas.MiterJoiner); ok {
+		if math.IsNaN(miter.Limit) {
+			strokeUnsupported = true
+		} else if _, ok := miter.GapJoiner.(canvas.BevelJoiner); !ok {
+			strokeUnsupported = true
+		}
+	}
+
+	if style.HasFill() && style.Fill.IsPattern() {
+		if hatch, ok := style.Fill.Pattern.(*canvas.HatchPattern); ok {
+			r.RenderPath(hatch.Tile(path.Transform(m)), canvas.Style{Fill: hatch.Fill}, canvas.Identity)
+		}
+		style.Fill = canvas.Paint{}
+	}
+	if style.HasStroke() && strokeUnsupported {
+		if style.HasFill() {
+			fillStyle := style
+			fillStyle.Stroke = canvas.Paint{}
+			r.RenderPath(path, fillStyle, m)
+		}
+
+		// stroke settings unsupported by Lottie, draw stroke explicitly
+		if style.IsDashed() {
+			path = path.Dash(style.DashOffset, style.Dashes...)
+		}
+		path = path.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner, canvas.Tolerance)
+		r.RenderPath(path, canvas.Style{Fill: style.Stroke}, m)
+		return
+	} else if !style.HasFill() && !style.HasStroke() {
+		return
+	}
+
+	m = r.page().Mul(m)
+	l := layer{
+		shapes:    bezierShapes(path.Transform(m)),
+		evenOdd:   style.FillRule == canvas.EvenOdd,
+		hasFill:   style.HasFill(),
+		hasStroke: style.HasStroke(),
+	}
+	if l.hasFill {
+		l.fill = r.paint(style.Fill)
+	}
+	if l.hasStroke {
+		scale := math.Sqrt(math.Abs(m.Det()))
+		l.stroke = r.paint(style.Stroke)
+		l.strokeWidth = style.StrokeWidth * scale
+		l.lineCap, l.lineJoin, l.miterLimit = 2, 2, 0.0
+		if _, ok := style.StrokeCapper.(canvas.ButtCapper); ok {
+			l.lineCap = 1
+		} else if _, ok := style.StrokeCapper.(canvas.SquareCapper); ok {
+			l.lineCap = 3
+		}
+		if _, ok := style.StrokeJoiner.(canvas.BevelJoiner); ok {
+			l.lineJoin = 3
+		} else if miter, ok := style.StrokeJoiner.(canvas.MiterJoiner); ok {
+			l.lineJoin, l.miterLimit = 1, miter.Limit
+		}
+		if style.IsDashed() {
+			l.dashes = make([]float64, len(style.Dashes))
+			for i := range style.Dashes {
+				l.dashes[i] = style.Dashes[i] * scale
+			}
+			if len(l.dashes)%2 == 1 {
+				l.dashes = append(l.dashes, l.dashes...)
+			}
+			l.dashOffset = style.DashOffset * scale
+		}
+	}
+	r.layers = append(r.layers, l)
+}
+
+// paint returns the paint in composition coordinates.
+func (r *Lottie) paint(paint canvas.Paint) lottiePaint {
+	m := r.page()
+	switch g := paint.Gradient.(type) {
+	case *canvas.LinearGradient:
+		start, end := m.Dot(g.Start), m.Dot(g.End)
+		stops, numStops := gradientStops(g.Stops, 0.0)
+		return lottiePaint{
+			gradient: 1,
+			start:    [2]float64{start.X, start.Y},
+			end:      [2]float64{end.X, end.Y},
+			stops:    stops,
+			numStops: numStops,
+		}
+	case *canvas.RadialGradient:
+		// the focal point is given by the highlight length and angle relative to the center, stops are remapped to start at the inner radius
+		c0, c1 := m.Dot(g.C0), m.Dot(g.C1)
+		radius := g.R1 * r.opts.Resolution.DPMM()
+		t0, highlight := 0.0, 0.0
+		if 0.0 < radius {
+			t0 = math.Max(0.0, math.Min(1.0, g.R0/g.R1))
+			highlight = math.Min(99.0, c0.Sub(c1).Length()/radius*100.0)
+		}
+		angle := 0.0
+		if c0 != c1 {
+			angle = c0.Sub(c1).Angle() * 180.0 / math.Pi
+		}
+		stops, numStops := gradientStops(g.Stops, t0)
+		return lottiePaint{
+			gradient:  2,
+			start:     [2]float64{c1.X, c1.Y},
+			end:       [2]float64{c1.X + radius, c1.Y},
+			highlight: highlight,
+			angle:     angle,
+			stops:     stops,
+			numStops:  numStops,
+		}
+	}
+
+	c := paint.Color
+	if paint.IsGradient() {
+		c = paint.Gradient.At(r.width/2.0, r.height/2.0)
+	}
+	return lottiePaint{color: colorComponents(c)}
+}
+
+// RenderText renders a text object to the canvas using a transformation matrix.
+func (r *Lottie) RenderText(text *canvas.Text, m canvas.Matrix) {
+	text.RenderAsPath(r, m, canvas.DefaultResolution)
+}
+
+// RenderImage renders an image to the canvas using a transformation matrix.
+func (r *Lottie) RenderImage(img image.Image, m canvas.Matrix) {
+	size := img.Bounds().Size()
+	if size.X == 0 || size.Y == 0 {
+		return
+	}
+
+	var data []byte
+	mimetype := "image/png"
+	if cimg, ok := img.(canvas.Image); ok && 0 < len(cimg.Bytes) && (cimg.Mimetype == "image/png" || cimg.Mimetype == "image/jpeg") {
+		data, mimetype = cimg.Bytes, cimg.Mimetype
+	} else {
+		buf := &bytes.Buffer{}
+		if err := png.Encode(buf, img); err != nil {
+			return
+		}
+		data = buf.Bytes()
+	}
+
+	// transformation from pixel coordinates with a top-left origin to composition coordinates
+	m = r.page().Mul(m).Translate(0.0, float64(size.Y)).Scale(1.0, -1.0)
+	r.layers = append(r.layers, layer{
+		image: &imageLayer{
+			width:  size.X,
+			height: size.Y,
+			uri:    "data:" + mimetype + ";base64," + base64.StdEncoding.EncodeToString(data),
+			m:      m,
+		},
+	})
+}
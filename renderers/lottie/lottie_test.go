@@ -0,0 +1,126 @@
+package lottie
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/test"
+)
+
+func decode(t *testing.T, b []byte) map[string]interface{} {
+	var v map[string]interface{}
+	test.Error(t, json.Unmarshal(b, &v))
+	return v
+}
+
+func path(v interface{}, keys ...interface{}) interface{} {
+	for _, key := range keys {
+		switch k := key.(type) {
+		case string:
+			v = v.(map[string]interface{})[k]
+		case int:
+			v = v.([]interface{})[k]
+		}
+	}
+	return v
+}
+
+func TestLottie(t *testing.T) {
+	c := canvas.New(10.0, 10.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetFillColor(canvas.Red)
+	ctx.SetStrokeColor(canvas.Blue)
+	ctx.SetStrokeWidth(1.0)
+	ctx.SetDashes(0.5, 1.0, 2.0)
+	ctx.DrawPath(1.0, 1.0, canvas.Rectangle(4.0, 2.0))
+	ctx.SetStrokeColor(canvas.Transparent)
+	gradient := canvas.NewLinearGradient(canvas.Point{X: 0.0, Y: 0.0}, canvas.Point{X: 10.0, Y: 0.0})
+	gradient.Add(0.0, canvas.Black)
+	gradient.Add(1.0, canvas.White)
+	ctx.SetFillGradient(gradient)
+	ctx.DrawPath(0.0, 0.0, canvas.MustParseSVGPath("M0 0Q10 0 10 10z"))
+
+	buf := &bytes.Buffer{}
+	r := New(buf, c.W, c.H, &Options{Resolution: canvas.DPMM(1.0)})
+	c.RenderTo(r)
+	test.Error(t, r.Close())
+
+	v := decode(t, buf.Bytes())
+	test.T(t, v["w"], 10.0)
+	test.T(t, v["h"], 10.0)
+	test.T(t, v["op"], 1.0)
+	test.T(t, len(v["layers"].([]interface{})), 2)
+
+	// top layer first
+	items := path(v, "layers", 0, "shapes", 0, "it")
+	test.T(t, path(items, 0, "ty"), "sh")
+	test.T(t, path(items, 0, "ks", "k", "v"), []interface{}{[]interface{}{0.0, 10.0}, []interface{}{10.0, 0.0}})
+	test.T(t, path(items, 0, "ks", "k", "c"), true)
+	test.T(t, path(items, 0, "ks", "k", "o", 0, 0), 6.6666667)
+	test.T(t, path(items, 0, "ks", "k", "i", 1, 1), 6.6666667)
+	test.T(t, path(items, 1, "ty"), "gf")
+	test.T(t, path(items, 1, "t"), 1.0)
+	test.T(t, path(items, 1, "g", "p"), 2.0)
+	test.T(t, path(items, 1, "g", "k", "k"), []interface{}{0.0, 0.0, 0.0, 0.0, 1.0, 1.0, 1.0, 1.0, 0.0, 1.0, 1.0, 1.0})
+	test.T(t, path(items, 2, "ty"), "tr")
+
+	items = path(v, "layers", 1, "shapes", 0, "it")
+	test.T(t, path(items, 0, "ks", "k", "v"), []interface{}{[]interface{}{1.0, 9.0}, []interface{}{5.0, 9.0}, []interface{}{5.0, 7.0}, []interface{}{1.0, 7.0}})
+	test.T(t, path(items, 1, "ty"), "st")
+	test.T(t, path(items, 1, "c", "k"), []interface{}{0.0, 0.0, 1.0, 1.0})
+	test.T(t, path(items, 1, "w", "k"), 1.0)
+	test.T(t, path(items, 1, "d", 0, "n"), "d")
+	test.T(t, path(items, 1, "d", 1, "v", "k"), 2.0)
+	test.T(t, path(items, 1, "d", 2, "n"), "o")
+	test.T(t, path(items, 1, "d", 2, "v", "k"), 0.5)
+	test.T(t, path(items, 2, "ty"), "fl")
+	test.T(t, path(items, 2, "c", "k"), []interface{}{1.0, 0.0, 0.0, 1.0})
+	test.T(t, path(items, 2, "r"), 1.0)
+}
+
+func TestLottieFrames(t *testing.T) {
+	frame := func(x float64, color canvas.Paint) *canvas.Canvas {
+		c := canvas.New(10.0, 10.0)
+		ctx := canvas.NewContext(c)
+		ctx.SetFill(color)
+		ctx.DrawPath(x, 0.0, canvas.Rectangle(2.0, 2.0))
+		return c
+	}
+
+	// compatible frames
+	buf := &bytes.Buffer{}
+	r := New(buf, 10.0, 10.0, &Options{Resolution: canvas.DPMM(1.0), FrameRate: 10.0})
+	r.RenderFrames([]*canvas.Canvas{frame(0.0, canvas.Paint{Color: canvas.Red}), frame(5.0, canvas.Paint{Color: canvas.Red})}, []time.Duration{time.Second, time.Second})
+	test.Error(t, r.Close())
+
+	v := decode(t, buf.Bytes())
+	test.T(t, v["op"], 20.0)
+	test.T(t, len(v["layers"].([]interface{})), 1)
+	shape := path(v, "layers", 0, "shapes", 0, "it", 0, "ks")
+	test.T(t, path(shape, "a"), 1.0)
+	test.T(t, path(shape, "k", 0, "t"), 0.0)
+	test.T(t, path(shape, "k", 0, "s", 0, "v", 0), []interface{}{0.0, 10.0})
+	test.T(t, path(shape, "k", 1, "t"), 10.0)
+	test.T(t, path(shape, "k", 1, "s", 0, "v", 0), []interface{}{5.0, 10.0})
+	test.T(t, path(v, "layers", 0, "shapes", 0, "it", 1, "c", "a"), 0.0)
+
+	// incompatible frames
+	gradient := canvas.NewLinearGradient(canvas.Point{X: 0.0, Y: 0.0}, canvas.Point{X: 10.0, Y: 0.0})
+	gradient.Add(0.0, canvas.Black)
+	gradient.Add(1.0, canvas.White)
+
+	buf.Reset()
+	r = New(buf, 10.0, 10.0, &Options{Resolution: canvas.DPMM(1.0), FrameRate: 10.0})
+	r.RenderFrames([]*canvas.Canvas{frame(0.0, canvas.Paint{Color: canvas.Red}), frame(5.0, canvas.Paint{Gradient: gradient})}, []time.Duration{time.Second, time.Second})
+	test.Error(t, r.Close())
+
+	v = decode(t, buf.Bytes())
+	test.T(t, len(v["layers"].([]interface{})), 2)
+	test.T(t, path(v, "layers", 0, "ip"), 0.0)
+	test.T(t, path(v, "layers", 0, "op"), 10.0)
+	test.T(t, path(v, "layers", 1, "ip"), 10.0)
+	test.T(t, path(v, "layers", 1, "op"), 20.0)
+}
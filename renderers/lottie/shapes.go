@@ -0,0 +1,499 @@
+package lottie
+
+import (
+	"image/color"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/tdewolff/canvas"
+)
+
+// num is a number that is written with canvas.Precision significant digits.
+type num float64
+
+func (n num) MarshalJSON() ([]byte, error) {
+	f := float64(n)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		f = 0.0
+	} else if f == 0.0 {
+		f = 0.0 // remove negative zero
+	}
+	return strconv.AppendFloat(nil, f, 'g', canvas.Precision, 64), nil
+}
+
+func nums(fs ...float64) []num {
+	ns := make([]num, len(fs))
+	for i, f := range fs {
+		ns[i] = num(f)
+	}
+	return ns
+}
+
+type animation struct {
+	Version   string        `json:"v"`
+	FrameRate float64       `json:"fr"`
+	In        float64       `json:"ip"`
+	Out       float64       `json:"op"`
+	Width     int           `json:"w"`
+	Height    int           `json:"h"`
+	Name      string        `json:"nm"`
+	ThreeD    int           `json:"ddd"`
+	Assets    []asset       `json:"assets"`
+	Layers    []interface{} `json:"layers"`
+}
+
+type asset struct {
+	ID       string `json:"id"`
+	Width    int    `json:"w"`
+	Height   int    `json:"h"`
+	Dir      string `json:"u"`
+	Path     string `json:"p"`
+	Embedded int    `json:"e"`
+}
+
+// property is an optionally animated property, where K is either the static value or a list of keyframes.
+type property struct {
+	Animated int         `json:"a"`
+	K        interface{} `json:"k"`
+}
+
+type keyframe struct {
+	Time  num         `json:"t"`
+	Start interface{} `json:"s"`
+	In    *easing     `json:"i,omitempty"`
+	Out   *easing     `json:"o,omitempty"`
+}
+
+type easing struct {
+	X []num `json:"x"`
+	Y []num `json:"y"`
+}
+
+// animated returns a static property if all values are equal, or a property with linearly interpolated keyframes at the given times otherwise.
+func animated(times []float64, values []interface{}) property {
+	static := true
+	for _, value := range values[1:] {
+		if !reflect.DeepEqual(value, values[0]) {
+			static = false
+			break
+		}
+	}
+	if static {
+		return property{0, values[0]}
+	}
+
+	keyframes := make([]keyframe, len(values))
+	for k, value := range values {
+		switch v := value.(type) {
+		case num:
+			value = []num{v}
+		case bezier:
+			value = []bezier{v}
+		}
+		keyframes[k] = keyframe{Time: num(times[k]), Start: value}
+		if k+1 < len(values) {
+			keyframes[k].In = &easing{nums(1.0), nums(1.0)}
+			keyframes[k].Out = &easing{nums(0.0), nums(0.0)}
+		}
+	}
+	return property{1, keyframes}
+}
+
+// animatedFunc returns a property from the value of each layer.
+func animatedFunc(layers []layer, times []float64, f func(layer) interface{}) property {
+	values := make([]interface{}, len(layers))
+	for k, l := range layers {
+		values[k] = f(l)
+	}
+	return animated(times, values)
+}
+
+func static(value interface{}) property {
+	return property{0, value}
+}
+
+type transform struct {
+	Type     string    `json:"ty,omitempty"`
+	Opacity  property  `json:"o"`
+	Rotation property  `json:"r"`
+	Position property  `json:"p"`
+	Anchor   property  `json:"a"`
+	Scale    property  `json:"s"`
+	Skew     *property `json:"sk,omitempty"`
+	SkewAxis *property `json:"sa,omitempty"`
+}
+
+func identityTransform(typ string) transform {
+	t := transform{
+		Type:     typ,
+		Opacity:  static(num(100.0)),
+		Rotation: static(num(0.0)),
+		Position: static(nums(0.0, 0.0, 0.0)),
+		Anchor:   static(nums(0.0, 0.0, 0.0)),
+		Scale:    static(nums(100.0, 100.0, 100.0)),
+	}
+	if typ == "tr" {
+		skew, skewAxis := static(num(0.0)), static(num(0.0))
+		t.Skew, t.SkewAxis = &skew, &skewAxis
+	}
+	return t
+}
+
+type shapeLayer struct {
+	ThreeD      int         `json:"ddd"`
+	Index       int         `json:"ind"`
+	Type        int         `json:"ty"`
+	Name        string      `json:"nm"`
+	Stretch     int         `json:"sr"`
+	Transform   transform   `json:"ks"`
+	AutoOrient  int         `json:"ao"`
+	Shapes      []shapeItem `json:"shapes,omitempty"`
+	In          num         `json:"ip"`
+	Out         num         `json:"op"`
+	StartTime   int         `json:"st"`
+	BlendMode   int         `json:"bm"`
+	ReferenceID string      `json:"refId,omitempty"`
+}
+
+// shapeItem is a shape, group, paint, or transform item of a shape layer.
+type shapeItem struct {
+	Type      string        `json:"ty"`
+	Name      string        `json:"nm,omitempty"`
+	Items     []interface{} `json:"it,omitempty"`
+	Path      *property     `json:"ks,omitempty"`
+	Color     *property     `json:"c,omitempty"`
+	Opacity   *property     `json:"o,omitempty"`
+	FillRule  int           `json:"r,omitempty"`
+	Width     *property     `json:"w,omitempty"`
+	LineCap   int           `json:"lc,omitempty"`
+	LineJoin  int           `json:"lj,omitempty"`
+	Miter     num           `json:"ml,omitempty"`
+	Dashes    []dash        `json:"d,omitempty"`
+	Gradient  int           `json:"t,omitempty"`
+	Start     *property     `json:"s,omitempty"`
+	End       *property     `json:"e,omitempty"`
+	Highlight *property     `json:"h,omitempty"`
+	Angle     *property     `json:"a,omitempty"`
+	Colors    *colors       `json:"g,omitempty"`
+}
+
+type colors struct {
+	NumStops int      `json:"p"`
+	K        property `json:"k"`
+}
+
+type dash struct {
+	Type  string   `json:"n"`
+	Name  string   `json:"nm"`
+	Value property `json:"v"`
+}
+
+// bezier is a Lottie path with vertices and in and out tangents relative to the vertices.
+type bezier struct {
+	Closed bool     `json:"c"`
+	V      [][2]num `json:"v"`
+	I      [][2]num `json:"i"`
+	O      [][2]num `json:"o"`
+}
+
+// bezierShapes converts a path in composition coordinates to a Lottie path per subpath. Arcs are replaced by cubic Béziers and quadratic Béziers are elevated to cubic Béziers.
+func bezierShapes(p *canvas.Path) []bezier {
+	shapes := []bezier{}
+	for _, ps := range p.ReplaceArcs().Split() {
+		var vs, is, os []canvas.Point
+		closed := false
+		scanner := ps.Scanner()
+		for scanner.Scan() {
+			start, end := scanner.Start(), scanner.End()
+			switch scanner.Cmd() {
+			case canvas.MoveToCmd:
+				vs, is, os = append(vs, end), append(is, canvas.Point{}), append(os, canvas.Point{})
+			case canvas.LineToCmd:
+				vs, is, os = append(vs, end), append(is, canvas.Point{}), append(os, canvas.Point{})
+			case canvas.QuadToCmd:
+				cp := scanner.CP1()
+				cp1 := start.Interpolate(cp, 2.0/3.0)
+				cp2 := end.Interpolate(cp, 2.0/3.0)
+				os[len(os)-1] = cp1.Sub(start)
+				vs, is, os = append(vs, end), append(is, cp2.Sub(end)), append(os, canvas.Point{})
+			case canvas.CubeToCmd:
+				os[len(os)-1] = scanner.CP1().Sub(start)
+				vs, is, os = append(vs, end), append(is, scanner.CP2().Sub(end)), append(os, canvas.Point{})
+			case canvas.CloseCmd:
+				closed = true
+			}
+		}
+		if closed && 1 < len(vs) && vs[len(vs)-1].Equals(vs[0]) {
+			// the last vertex coincides with the first, move its in tangent to the first vertex
+			is[0] = is[len(is)-1]
+			vs, is, os = vs[:len(vs)-1], is[:len(is)-1], os[:len(os)-1]
+		}
+		if len(vs) < 2 {
+			continue
+		}
+
+		shape := bezier{Closed: closed}
+		for i := range vs {
+			shape.V = append(shape.V, [2]num{num(vs[i].X), num(vs[i].Y)})
+			shape.I = append(shape.I, [2]num{num(is[i].X), num(is[i].Y)})
+			shape.O = append(shape.O, [2]num{num(os[i].X), num(os[i].Y)})
+		}
+		shapes = append(shapes, shape)
+	}
+	return shapes
+}
+
+// lottiePaint is a solid color or a linear (1) or radial (2) gradient in composition coordinates.
+type lottiePaint struct {
+	color     [4]float64 // un-premultiplied RGBA in [0,1]
+	gradient  int
+	start     [2]float64
+	end       [2]float64
+	highlight float64 // percentage of the radius
+	angle     float64 // in degrees
+	stops     []float64
+	numStops  int
+}
+
+// colorComponents returns the un-premultiplied color components in [0,1].
+func colorComponents(c color.RGBA) [4]float64 {
+	if c.A == 0 {
+		return [4]float64{0.0, 0.0, 0.0, 0.0}
+	}
+	a := float64(c.A)
+	return [4]float64{float64(c.R) / a, float64(c.G) / a, float64(c.B) / a, a / 255.0}
+}
+
+// gradientStops returns the Lottie gradient colors, which are the offsets and RGB components of the stops followed by the offsets and alpha of the stops. Offsets are remapped to start at t0, where the first color is extended to zero.
+func gradientStops(stops canvas.Stops, t0 float64) ([]float64, int) {
+	if len(stops) == 0 {
+		return []float64{0.0, 0.0, 0.0, 0.0, 0.0, 0.0}, 1
+	}
+	if t0 != 0.0 {
+		mapped := canvas.Stops{{Offset: 0.0, Color: stops[0].Color}}
+		for _, stop := range stops {
+			mapped = append(mapped, canvas.Stop{Offset: t0 + stop.Offset*(1.0-t0), Color: stop.Color})
+		}
+		stops = mapped
+	}
+
+	rgb := make([]float64, 0, 4*len(stops))
+	alpha := make([]float64, 0, 2*len(stops))
+	for _, stop := range stops {
+		c := colorComponents(stop.Color)
+		rgb = append(rgb, stop.Offset, c[0], c[1], c[2])
+		alpha = append(alpha, stop.Offset, c[3])
+	}
+	return append(rgb, alpha...), len(stops)
+}
+
+type layer struct {
+	shapes    []bezier
+	evenOdd   bool
+	hasFill   bool
+	hasStroke bool
+	fill      lottiePaint
+	stroke    lottiePaint
+
+	strokeWidth float64
+	lineCap     int
+	lineJoin    int
+	miterLimit  float64
+	dashes      []float64
+	dashOffset  float64
+
+	image *imageLayer
+}
+
+// compatibleFrames returns true if the frames can be written as a single set of layers with keyframes, which requires the same structure of layers, paths, and paints.
+func compatibleFrames(frames [][]layer) bool {
+	for _, layers := range frames[1:] {
+		if len(layers) != len(frames[0]) {
+			return false
+		}
+		for i, l := range layers {
+			l0 := frames[0][i]
+			if l.image != nil || l0.image != nil {
+				if !reflect.DeepEqual(l.image, l0.image) {
+					return false
+				}
+				continue
+			}
+			if len(l.shapes) != len(l0.shapes) || l.evenOdd != l0.evenOdd || l.hasFill != l0.hasFill || l.hasStroke != l0.hasStroke {
+				return false
+			}
+			for j := range l.shapes {
+				if len(l.shapes[j].V) != len(l0.shapes[j].V) || l.shapes[j].Closed != l0.shapes[j].Closed {
+					return false
+				}
+			}
+			if l.hasFill && (l.fill.gradient != l0.fill.gradient || l.fill.numStops != l0.fill.numStops) {
+				return false
+			} else if l.hasStroke && (l.stroke.gradient != l0.stroke.gradient || l.stroke.numStops != l0.stroke.numStops || l.lineCap != l0.lineCap || l.lineJoin != l0.lineJoin || l.miterLimit != l0.miterLimit || len(l.dashes) != len(l0.dashes)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// paintItem returns the fill or stroke item for the paint of each layer.
+func paintItem(layers []layer, times []float64, stroke bool) shapeItem {
+	paint := func(l layer) lottiePaint {
+		if stroke {
+			return l.stroke
+		}
+		return l.fill
+	}
+
+	item := shapeItem{}
+	if p := paint(layers[0]); p.gradient == 0 {
+		item.Type, item.Name = "fl", "Fill"
+		if stroke {
+			item.Type, item.Name = "st", "Stroke"
+		}
+		color := animatedFunc(layers, times, func(l layer) interface{} {
+			c := paint(l).color
+			return nums(c[0], c[1], c[2], 1.0)
+		})
+		opacity := animatedFunc(layers, times, func(l layer) interface{} {
+			return num(paint(l).color[3] * 100.0)
+		})
+		item.Color, item.Opacity = &color, &opacity
+	} else {
+		item.Type, item.Name = "gf", "Gradient Fill"
+		if stroke {
+			item.Type, item.Name = "gs", "Gradient Stroke"
+		}
+		item.Gradient = p.gradient
+		start := animatedFunc(layers, times, func(l layer) interface{} {
+			return nums(paint(l).start[0], paint(l).start[1])
+		})
+		end := animatedFunc(layers, times, func(l layer) interface{} {
+			return nums(paint(l).end[0], paint(l).end[1])
+		})
+		opacity := static(num(100.0))
+		item.Start, item.End, item.Opacity = &start, &end, &opacity
+		if p.gradient == 2 {
+			highlight := animatedFunc(layers, times, func(l layer) interface{} {
+				return num(paint(l).highlight)
+			})
+			angle := animatedFunc(layers, times, func(l layer) interface{} {
+				return num(paint(l).angle)
+			})
+			item.Highlight, item.Angle = &highlight, &angle
+		}
+		item.Colors = &colors{
+			NumStops: p.numStops,
+			K: animatedFunc(layers, times, func(l layer) interface{} {
+				return nums(paint(l).stops...)
+			}),
+		}
+	}
+
+	if stroke {
+		width := animatedFunc(layers, times, func(l layer) interface{} {
+			return num(l.strokeWidth)
+		})
+		item.Width = &width
+		item.LineCap, item.LineJoin, item.Miter = layers[0].lineCap, layers[0].lineJoin, num(layers[0].miterLimit)
+		if layers[0].lineJoin != 1 {
+			item.Miter = 0.0
+		}
+		if 0 < len(layers[0].dashes) {
+			for i := range layers[0].dashes {
+				typ, name := "d", "dash"
+				if i%2 == 1 {
+					typ, name = "g", "gap"
+				}
+				i := i
+				item.Dashes = append(item.Dashes, dash{typ, name, animatedFunc(layers, times, func(l layer) interface{} {
+					return num(l.dashes[i])
+				})})
+			}
+			item.Dashes = append(item.Dashes, dash{"o", "offset", animatedFunc(layers, times, func(l layer) interface{} {
+				return num(l.dashOffset)
+			})})
+		}
+	} else {
+		item.FillRule = 1
+		if layers[0].evenOdd {
+			item.FillRule = 2
+		}
+	}
+	return item
+}
+
+// shapeLayerJSON returns a shape layer for the layer in each frame, which is a group of the paths followed by the stroke, fill, and transform.
+func shapeLayerJSON(ind int, layers []layer, times []float64, in, out float64) shapeLayer {
+	items := []interface{}{}
+	for j := range layers[0].shapes {
+		j := j
+		path := animatedFunc(layers, times, func(l layer) interface{} {
+			return l.shapes[j]
+		})
+		items = append(items, shapeItem{Type: "sh", Name: "Path " + strconv.Itoa(j+1), Path: &path})
+	}
+	if layers[0].hasStroke {
+		items = append(items, paintItem(layers, times, true))
+	}
+	if layers[0].hasFill {
+		items = append(items, paintItem(layers, times, false))
+	}
+	items = append(items, identityTransform("tr"))
+
+	return shapeLayer{
+		Index:     ind,
+		Type:      4,
+		Name:      "Layer " + strconv.Itoa(ind),
+		Stretch:   1,
+		Transform: identityTransform(""),
+		Shapes:    []shapeItem{{Type: "gr", Name: "Group", Items: items}},
+		In:        num(in),
+		Out:       num(out),
+	}
+}
+
+// imageLayer is an image with the transformation from pixel coordinates to composition coordinates.
+type imageLayer struct {
+	width, height int
+	uri           string
+	m             canvas.Matrix
+}
+
+func (img *imageLayer) asset(id string) asset {
+	return asset{
+		ID:       id,
+		Width:    img.width,
+		Height:   img.height,
+		Path:     img.uri,
+		Embedded: 1,
+	}
+}
+
+// layer returns an image layer, where the transformation is decomposed into a translation, rotation, and (possibly mirrored) scale. Skew is ignored.
+func (img *imageLayer) layer(ind int, id string, in, out float64) shapeLayer {
+	m := img.m
+	sx := math.Hypot(m[0][0], m[1][0])
+	sy := 0.0
+	if sx != 0.0 {
+		sy = m.Det() / sx
+	}
+	rot := math.Atan2(m[1][0], m[0][0]) * 180.0 / math.Pi
+
+	t := identityTransform("")
+	t.Position = static(nums(m[0][2], m[1][2], 0.0))
+	t.Rotation = static(num(rot))
+	t.Scale = static(nums(sx*100.0, sy*100.0, 100.0))
+	return shapeLayer{
+		Index:       ind,
+		Type:        2,
+		Name:        "Image " + strconv.Itoa(ind),
+		Stretch:     1,
+		Transform:   t,
+		In:          num(in),
+		Out:         num(out),
+		ReferenceID: id,
+	}
+}
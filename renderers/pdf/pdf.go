@@ -7,18 +7,21 @@ import (
 	"math"
 
 	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/rasterizer"
 )
 
 type Options struct {
-	Compress    bool
-	SubsetFonts bool
+	Compress         bool
+	SubsetFonts      bool
+	FilterResolution canvas.Resolution // resolution at which groups with filter effects are rasterized
 	canvas.ImageEncoding
 }
 
 var DefaultOptions = Options{
-	Compress:      true,
-	SubsetFonts:   true,
-	ImageEncoding: canvas.Lossless,
+	Compress:         true,
+	SubsetFonts:      true,
+	FilterResolution: canvas.DPI(300.0),
+	ImageEncoding:    canvas.Lossless,
 }
 
 // PDF is a portable document format renderer.
@@ -246,6 +249,30 @@ func (r *PDF) RenderText(text *canvas.Text, m canvas.Matrix) {
 	})
 }
 
+// RenderFilter renders a group with a filter effect to the canvas using a transformation matrix. PDFs don't support filter effects, so the region of the page affected by the filter is rasterized into an image at the filter resolution.
+func (r *PDF) RenderFilter(group *canvas.Canvas, filter *canvas.Filter, m canvas.Matrix) {
+	resolution := r.opts.FilterResolution
+	if resolution <= 0.0 {
+		resolution = DefaultOptions.FilterResolution
+	}
+	dpmm := resolution.DPMM()
+
+	// align the region to whole pixels within the page
+	bounds := filter.Bounds(group.Bounds()).Transform(m)
+	x0 := math.Floor(math.Max(bounds.X, 0.0)*dpmm) / dpmm
+	y0 := math.Floor(math.Max(bounds.Y, 0.0)*dpmm) / dpmm
+	x1 := math.Ceil(math.Min(bounds.X+bounds.W, r.width)*dpmm) / dpmm
+	y1 := math.Ceil(math.Min(bounds.Y+bounds.H, r.height)*dpmm) / dpmm
+	if x1-x0 < 1.0/dpmm || y1-y0 < 1.0/dpmm {
+		return
+	}
+
+	c := canvas.New(x1-x0, y1-y0)
+	c.RenderFilter(group, filter, canvas.Identity.Translate(-x0, -y0).Mul(m))
+	img := rasterizer.Draw(c, resolution, canvas.DefaultColorSpace)
+	r.RenderImage(img, canvas.Identity.Translate(x0, y0).Scale(1.0/dpmm, 1.0/dpmm))
+}
+
 // RenderImage renders an image to the canvas using a transformation matrix.
 func (r *PDF) RenderImage(img image.Image, m canvas.Matrix) {
 	r.w.DrawImage(img, r.opts.ImageEncoding, m)
@@ -116,6 +116,31 @@ func TestPDFImage(t *testing.T) {
 	test.String(t, pdf.String(), " 2.8346457 0 0 2.8346457 0 0 cm q 0 0 2 2 re W n 0 0 m 0 2 l 2 2 l 2 0 l h W n 2 0 0 2 0 0 cm /Im0 Do Q")
 }
 
+func TestPDFImageInterpolation(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210, 297, &Options{Compress: false})
+	pdf.RenderImage(img, canvas.Identity)
+	pdf.RenderImage(canvas.WithInterpolation(img, canvas.NearestInterpolation), canvas.Identity)
+	test.Error(t, pdf.Close())
+	test.T(t, strings.Count(buf.String(), "/Interpolate true"), 2) // image and its mask
+	test.T(t, strings.Count(buf.String(), "/Interpolate false"), 2)
+}
+
+func TestPDFFilter(t *testing.T) {
+	group := canvas.New(10.0, 10.0)
+	canvas.NewContext(group).DrawPath(2.0, 2.0, canvas.Rectangle(6.0, 6.0))
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 10.0, 10.0, &Options{Compress: false, FilterResolution: canvas.DPMM(2.0)})
+	pdf.RenderFilter(group, canvas.DropShadow(1.0, -1.0, 0.5, canvas.Black), canvas.Identity)
+	test.Error(t, pdf.Close())
+	test.T(t, strings.Count(buf.String(), "/Subtype /Image"), 2) // image and its mask
+	test.T(t, strings.Count(buf.String(), "/Width 19"), 2)       // region within the page at the filter resolution
+	test.T(t, strings.Count(buf.String(), "/Height 19"), 2)
+}
+
 func TestPDFMultipage(t *testing.T) {
 	buf := &bytes.Buffer{}
 	pdf := New(buf, 210, 297, nil)
@@ -256,7 +256,6 @@ func (w *pdfWriter) writeFont(ref pdfRef, font *canvas.Font, vertical bool) {
 	glyphIDs := w.fontSubset[font].List()
 	if w.subset {
 		// TODO: CFF font subsetting doesn't work
-		// TODO: remove all optional tables such as kern, GPOS, GSUB, ...
 		fontProgram, glyphIDs = font.SFNT.Subset(glyphIDs, canvasFont.WritePDFTables)
 	}
 
@@ -965,13 +964,15 @@ func (w *pdfPageWriter) DrawImage(img image.Image, enc canvas.ImageEncoding, m c
 	fmt.Fprintf(w, " q %v %v %v %v re W n", dec(outerRect.X), dec(outerRect.Y), dec(outerRect.W), dec(outerRect.H))
 	fmt.Fprintf(w, " %v %v m %v %v l %v %v l %v %v l h W n", dec(bl.X), dec(bl.Y), dec(tl.X), dec(tl.Y), dec(tr.X), dec(tr.Y), dec(br.X), dec(br.Y))
 
-	name := w.embedImage(img, enc)
+	// only nearest neighbor disables interpolation, PDF viewers choose the interpolation method themselves
+	interpolate := canvas.ImageInterpolation(img) != canvas.NearestInterpolation
+	name := w.embedImage(img, enc, interpolate)
 	m = m.Scale(float64(size.X), float64(size.Y))
 	w.SetAlpha(1.0)
 	fmt.Fprintf(w, " %v %v %v %v %v %v cm /%v Do Q", dec(m[0][0]), dec(m[1][0]), dec(m[0][1]), dec(m[1][1]), dec(m[0][2]), dec(m[1][2]), name)
 }
 
-func (w *pdfPageWriter) embedImage(img image.Image, enc canvas.ImageEncoding) pdfName {
+func (w *pdfPageWriter) embedImage(img image.Image, enc canvas.ImageEncoding, interpolate bool) pdfName {
 	size := img.Bounds().Size()
 	sp := img.Bounds().Min // starting point
 	b := make([]byte, size.X*size.Y*3)
@@ -1000,7 +1001,7 @@ func (w *pdfPageWriter) embedImage(img image.Image, enc canvas.ImageEncoding) pd
 		"Height":           size.Y,
 		"ColorSpace":       pdfName("DeviceRGB"),
 		"BitsPerComponent": 8,
-		"Interpolate":      true,
+		"Interpolate":      interpolate,
 		"Filter":           pdfFilterFlate,
 	}
 
@@ -1013,7 +1014,7 @@ func (w *pdfPageWriter) embedImage(img image.Image, enc canvas.ImageEncoding) pd
 				"Height":           size.Y,
 				"ColorSpace":       pdfName("DeviceGray"),
 				"BitsPerComponent": 8,
-				"Interpolate":      true,
+				"Interpolate":      interpolate,
 				"Filter":           pdfFilterFlate,
 			},
 			stream: bMask,
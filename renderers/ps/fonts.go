@@ -0,0 +1,224 @@
+package ps
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+	canvasFont "github.com/tdewolff/canvas/font"
+)
+
+// maxSfntsString is the maximum length of each string in the sfnts array of a Type 42 font, strings must have an even length.
+const maxSfntsString = 65534
+
+type psFont struct {
+	name      string
+	cff       bool
+	subsetter *canvas.FontSubsetter
+	names     map[uint16]string // glyph names by original glyph ID
+	used      map[string]bool
+}
+
+// fontEmbeddable returns true if the font can be embedded as a Type 42 font or as a name-keyed CFF FontSet.
+func fontEmbeddable(sfnt *canvasFont.SFNT) bool {
+	if sfnt.IsTrueType {
+		return sfnt.Glyf != nil && sfnt.Loca != nil
+	} else if _, ok := sfnt.Tables["CFF "]; ok && sfnt.CFF != nil {
+		return sfnt.CFF.FontName() != "" && sfnt.CFF.GlyphName(0) != ""
+	}
+	return false
+}
+
+func (r *PS) getFont(font *canvas.Font) *psFont {
+	if f, ok := r.fonts[font]; ok {
+		return f
+	}
+
+	f := &psFont{
+		name:      fmt.Sprintf("CanvasFont%d", len(r.fontList)),
+		cff:       !font.SFNT.IsTrueType,
+		subsetter: canvas.NewFontSubsetter(),
+		names:     map[uint16]string{0: ".notdef"},
+		used:      map[string]bool{".notdef": true},
+	}
+	if f.cff {
+		// the FontSet defines the font by the name in the CFF table
+		f.name = font.SFNT.CFF.FontName()
+	}
+	r.fonts[font] = f
+	r.fontList = append(r.fontList, font)
+	return f
+}
+
+// glyphName returns the name by which the glyph is shown. CFF fonts use the names from their charset, while for TrueType fonts the glyph names are taken from the post table or derived from the Unicode code point, so that text extraction maps glyphs back to text.
+func (f *psFont) glyphName(sfnt *canvasFont.SFNT, glyphID uint16) string {
+	if name, ok := f.names[glyphID]; ok {
+		return name
+	}
+
+	var name string
+	if f.cff {
+		name = sfnt.CFF.GlyphName(glyphID)
+	} else {
+		f.subsetter.Get(glyphID)
+		name = sfnt.GlyphName(glyphID)
+		if !validName(name) || f.used[name] {
+			name = ""
+			if r := sfnt.Cmap.ToUnicode(glyphID); r != 0 && r <= 0xFFFF {
+				name = fmt.Sprintf("uni%04X", r)
+			} else if r != 0 {
+				name = fmt.Sprintf("u%X", r)
+			}
+		}
+		if name == "" || f.used[name] {
+			name = fmt.Sprintf("glyph%d", glyphID)
+		}
+	}
+	f.names[glyphID] = name
+	f.used[name] = true
+	return name
+}
+
+// validName returns true if the name can be written as a PostScript literal name.
+func validName(name string) bool {
+	if name == "" || 127 < len(name) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c <= ' ' || 127 <= c || strings.IndexByte("()<>[]{}/%", c) != -1 {
+			return false
+		}
+	}
+	return true
+}
+
+// write writes the font resource, it returns true if the font was written as binary data.
+func (f *psFont) write(w io.Writer, font *canvas.Font) (bool, error) {
+	if f.cff {
+		// name-keyed CFF FontSet, the whole font is embedded as CFF subsetting is not supported
+		cff := font.SFNT.Tables["CFF "]
+		startData := fmt.Sprintf("/%v %d StartData ", f.name, len(cff))
+		fmt.Fprintf(w, "%%%%BeginResource: FontSet (%v)\n", f.name)
+		fmt.Fprintf(w, "/FontSetInit /ProcSet findresource begin\n")
+		fmt.Fprintf(w, "%%%%BeginData: %d Binary Bytes\n", len(startData)+len(cff)+1)
+		fmt.Fprintf(w, "%v", startData)
+		w.Write(cff)
+		fmt.Fprintf(w, "\n%%%%EndData\n%%%%EndResource\n")
+		return true, nil
+	}
+
+	sfnt := font.SFNT
+	fontProgram, glyphIDs := sfnt.Subset(f.subsetter.List(), canvasFont.WritePDFTables)
+	strs, err := sfntsStrings(fontProgram)
+	if err != nil {
+		return false, fmt.Errorf("PS: %v: %w", font.Name(), err)
+	}
+
+	charStrings := 0
+	for _, glyphID := range glyphIDs {
+		if _, ok := f.names[glyphID]; ok {
+			charStrings++
+		}
+	}
+
+	unitsPerEm := float64(sfnt.Head.UnitsPerEm)
+	fmt.Fprintf(w, "%%%%BeginResource: font %v\n", f.name)
+	fmt.Fprintf(w, "11 dict begin\n/FontName /%v def\n/FontType 42 def\n/PaintType 0 def\n/FontMatrix [1 0 0 1 0 0] def\n", f.name)
+	fmt.Fprintf(w, "/FontBBox [%v %v %v %v] def\n", dec(float64(sfnt.Head.XMin)/unitsPerEm), dec(float64(sfnt.Head.YMin)/unitsPerEm), dec(float64(sfnt.Head.XMax)/unitsPerEm), dec(float64(sfnt.Head.YMax)/unitsPerEm))
+	fmt.Fprintf(w, "/Encoding 256 array 0 1 255 {1 index exch /.notdef put} for def\n")
+	fmt.Fprintf(w, "/CharStrings %d dict dup begin\n", charStrings)
+	for subsetGlyphID, glyphID := range glyphIDs {
+		if name, ok := f.names[glyphID]; ok {
+			fmt.Fprintf(w, "/%v %d def\n", name, subsetGlyphID)
+		}
+	}
+	fmt.Fprintf(w, "end def\n/sfnts [\n")
+	for _, str := range strs {
+		// each string has an extra padding byte that is ignored
+		fmt.Fprintf(w, "<")
+		for i := 0; i < len(str); i += 32 {
+			if 0 < i {
+				fmt.Fprintf(w, "\n")
+			}
+			j := i + 32
+			if len(str) < j {
+				j = len(str)
+			}
+			fmt.Fprintf(w, "%v", strings.ToUpper(hex.EncodeToString(str[i:j])))
+		}
+		fmt.Fprintf(w, "00>\n")
+	}
+	fmt.Fprintf(w, "] def\nFontName currentdict end definefont pop\n%%%%EndResource\n")
+	return false, nil
+}
+
+// sfntsStrings splits the font program into strings for the sfnts array of a Type 42 font. Strings are split at table boundaries, and within the glyf table at glyph boundaries.
+func sfntsStrings(b []byte) ([][]byte, error) {
+	if len(b) < 12 {
+		return nil, fmt.Errorf("bad font program")
+	}
+	numTables := int(binary.BigEndian.Uint16(b[4:]))
+	if len(b) < 12+16*numTables {
+		return nil, fmt.Errorf("bad font program")
+	}
+
+	var head, loca []byte
+	var glyfOffset uint32
+	breaks := []uint32{uint32(12 + 16*numTables)}
+	for i := 0; i < numTables; i++ {
+		record := b[12+16*i:]
+		tag := string(record[:4])
+		offset := binary.BigEndian.Uint32(record[8:])
+		length := binary.BigEndian.Uint32(record[12:])
+		if uint32(len(b)) < offset || uint32(len(b))-offset < length {
+			return nil, fmt.Errorf("bad %v table", tag)
+		}
+		breaks = append(breaks, offset, offset+length)
+		switch tag {
+		case "head":
+			head = b[offset : offset+length]
+		case "loca":
+			loca = b[offset : offset+length]
+		case "glyf":
+			glyfOffset = offset
+		}
+	}
+	if head != nil && loca != nil && glyfOffset != 0 && 54 <= len(head) {
+		if binary.BigEndian.Uint16(head[50:]) == 0 {
+			for i := 0; i+2 <= len(loca); i += 2 {
+				breaks = append(breaks, glyfOffset+2*uint32(binary.BigEndian.Uint16(loca[i:])))
+			}
+		} else {
+			for i := 0; i+4 <= len(loca); i += 4 {
+				breaks = append(breaks, glyfOffset+binary.BigEndian.Uint32(loca[i:]))
+			}
+		}
+	}
+	breaks = append(breaks, uint32(len(b)))
+
+	// greedily fill strings up to the maximum length, only breaking at even offsets
+	strs := [][]byte{}
+	start, last := uint32(0), uint32(0)
+	sort.Slice(breaks, func(i, j int) bool { return breaks[i] < breaks[j] })
+	for _, pos := range breaks {
+		if pos%2 != 0 && pos != uint32(len(b)) {
+			continue
+		}
+		for maxSfntsString < pos-start {
+			if last == start {
+				last = start + maxSfntsString // no suitable boundary, break anyway
+			}
+			strs = append(strs, b[start:last])
+			start = last
+		}
+		last = pos
+	}
+	if start < uint32(len(b)) {
+		strs = append(strs, b[start:])
+	}
+	return strs, nil
+}
@@ -1,19 +1,26 @@
 package ps
 
 import (
+	"bytes"
 	"compress/zlib"
 	"encoding/ascii85"
+	"encoding/binary"
 	"fmt"
 	"image"
+	"image/draw"
 	"io"
 	"math"
 	"strings"
 	"time"
 
 	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/rasterizer"
 	"github.com/tdewolff/minify/v2"
+	"golang.org/x/image/tiff"
 )
 
+const ptPerMm = 72.0 / 25.4
+
 var psEllipseDef = `/ellipse{/rot exch def /a1 exch def /a0 exch def /ry exch def /rx exch def /y exch def /x exch def /m matrix currentmatrix def x y translate rot rotate rx ry scale 0 0 1 a0 a1 arc m setmatrix}def
 /ellipsen{/rot exch def /a1 exch def /a0 exch def /ry exch def /rx exch def /y exch def /x exch def /m matrix currentmatrix def x y translate rot rotate rx ry scale 0 0 1 a0 a1 arcn m setmatrix}def`
 
@@ -27,18 +34,26 @@ const (
 type Options struct {
 	Format
 	canvas.ImageEncoding
+	TextAsPath bool // draw text as paths instead of embedding the fonts
+	Preview    bool // add a TIFF preview to EPS files
 }
 
 var DefaultOptions = Options{
 	ImageEncoding: canvas.Lossless,
 }
 
-// PS is an PostScript renderer. Be aware that PostScript does not support transparency of colors.
+// PS is an PostScript renderer. Gradients are drawn using shading dictionaries and hatch patterns using tiling patterns, both requiring PostScript LanguageLevel 3. TrueType fonts are embedded as Type 42 fonts and CFF fonts as FontSets, glyphs are shown by name to keep the text searchable. CID-keyed CFF fonts, CFF2 fonts, faux bold, vertical text, and text filled with gradients or patterns are drawn as paths. Be aware that PostScript does not support transparency of colors.
 type PS struct {
-	w             io.Writer
+	w             *bytes.Buffer // page content, the header and resources are written when closing
+	out           io.Writer
 	width, height float64
 	opts          *Options
 
+	fonts    map[*canvas.Font]*psFont
+	fontList []*canvas.Font
+	patterns map[*canvas.HatchPattern]string
+	preview  *rasterizer.Rasterizer
+
 	paint      canvas.Paint
 	lineWidth  float64
 	miterLimit float64
@@ -55,34 +70,98 @@ func New(w io.Writer, width, height float64, opts *Options) *PS {
 		opts = &defaultOptions
 	}
 
-	if opts.Format == PostScript {
-		fmt.Fprintf(w, "%%!PS-Adobe-3.0\n")
-	} else if opts.Format == EncapsulatedPostScript {
-		fmt.Fprintf(w, "%%!PS-Adobe-3.0 EPSF-3.0\n")
-	}
-	fmt.Fprintf(w, "%%%%Creator: tdewolff/canvas\n")
-	fmt.Fprintf(w, "%%%%CreationDate: %v\n", time.Now().Format(time.ANSIC))
-	fmt.Fprintf(w, "%%%%BoundingBox: 0 0 %v %v\n", dec(width), dec(height))
-
-	if opts.Format == EncapsulatedPostScript {
-		fmt.Fprintf(w, "%%%%EndComments\n")
-		// TODO: (EPS) generate and add preview
+	var preview *rasterizer.Rasterizer
+	if opts.Format == EncapsulatedPostScript && opts.Preview {
+		resolution := canvas.DPI(72.0)
+		img := image.NewRGBA(image.Rect(0, 0, int(math.Ceil(width*resolution.DPMM())), int(math.Ceil(height*resolution.DPMM()))))
+		if !img.Rect.Empty() {
+			draw.Draw(img, img.Rect, image.White, image.Point{}, draw.Src)
+			preview = rasterizer.FromImage(img, resolution, canvas.DefaultColorSpace)
+		}
 	}
 
-	fmt.Fprint(w, psEllipseDef)
-
 	return &PS{
-		w:          w,
+		w:          &bytes.Buffer{},
+		out:        w,
 		width:      width,
 		height:     height,
 		opts:       opts,
+		fonts:      map[*canvas.Font]*psFont{},
+		patterns:   map[*canvas.HatchPattern]string{},
+		preview:    preview,
 		miterLimit: 10.0,
 	}
 }
 
+// Close writes the header, the prolog with the embedded fonts, and the page content. For EPS files with a preview, the PostScript is wrapped in a DOS EPS binary file together with a TIFF preview.
 func (r *PS) Close() error {
-	if r.opts.Format == EncapsulatedPostScript {
-		fmt.Fprintf(r.w, "%%%%EOF")
+	resources := &bytes.Buffer{}
+	binaryData := false
+	for _, font := range r.fontList {
+		isBinary, err := r.fonts[font].write(resources, font)
+		if err != nil {
+			return err
+		}
+		binaryData = binaryData || isBinary
+	}
+
+	w := &bytes.Buffer{}
+	if r.opts.Format == PostScript {
+		fmt.Fprintf(w, "%%!PS-Adobe-3.0\n")
+	} else if r.opts.Format == EncapsulatedPostScript {
+		fmt.Fprintf(w, "%%!PS-Adobe-3.0 EPSF-3.0\n")
+	}
+	fmt.Fprintf(w, "%%%%Creator: tdewolff/canvas\n")
+	fmt.Fprintf(w, "%%%%CreationDate: %v\n", time.Now().Format(time.ANSIC))
+	fmt.Fprintf(w, "%%%%BoundingBox: 0 0 %d %d\n", int(math.Ceil(r.width*ptPerMm)), int(math.Ceil(r.height*ptPerMm)))
+	fmt.Fprintf(w, "%%%%HiResBoundingBox: 0 0 %v %v\n", dec(r.width*ptPerMm), dec(r.height*ptPerMm))
+	fmt.Fprintf(w, "%%%%LanguageLevel: 3\n")
+	if binaryData {
+		fmt.Fprintf(w, "%%%%DocumentData: Binary\n")
+	}
+	if r.opts.Format == PostScript {
+		fmt.Fprintf(w, "%%%%Pages: 1\n")
+	}
+	fmt.Fprintf(w, "%%%%EndComments\n")
+	fmt.Fprintf(w, "%%%%BeginProlog\n%v\n%%%%EndProlog\n", psEllipseDef)
+	if 0 < resources.Len() {
+		fmt.Fprintf(w, "%%%%BeginSetup\n")
+		w.Write(resources.Bytes())
+		fmt.Fprintf(w, "%%%%EndSetup\n")
+	}
+	if r.opts.Format == PostScript {
+		fmt.Fprintf(w, "%%%%Page: 1 1\n")
+		fmt.Fprintf(w, "%%%%BeginPageSetup\n<</PageSize [%v %v]>> setpagedevice\n%%%%EndPageSetup\n", dec(r.width*ptPerMm), dec(r.height*ptPerMm))
+	}
+
+	// the page content is in millimeters
+	fmt.Fprintf(w, "gsave %v %v scale", dec(ptPerMm), dec(ptPerMm))
+	w.Write(r.w.Bytes())
+	fmt.Fprintf(w, "\ngrestore\nshowpage\n%%%%Trailer\n%%%%EOF\n")
+
+	if r.preview == nil {
+		_, err := r.out.Write(w.Bytes())
+		return err
+	}
+
+	r.preview.Close()
+	tiffPreview := &bytes.Buffer{}
+	if err := tiff.Encode(tiffPreview, r.preview.Image, &tiff.Options{Compression: tiff.Deflate}); err != nil {
+		return err
+	}
+
+	// DOS EPS binary file header
+	header := make([]byte, 30)
+	binary.LittleEndian.PutUint32(header[0:], 0xC6D3D0C5)
+	binary.LittleEndian.PutUint32(header[4:], 30)
+	binary.LittleEndian.PutUint32(header[8:], uint32(w.Len()))
+	binary.LittleEndian.PutUint32(header[20:], uint32(30+w.Len()))
+	binary.LittleEndian.PutUint32(header[24:], uint32(tiffPreview.Len()))
+	binary.LittleEndian.PutUint16(header[28:], 0xFFFF)
+	for _, b := range [][]byte{header, w.Bytes(), tiffPreview.Bytes()} {
+		if _, err := r.out.Write(b); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -170,9 +249,16 @@ func (r *PS) Size() (float64, float64) {
 
 // RenderPath renders a path to the canvas using a style and a transformation matrix.
 func (r *PS) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	if r.preview != nil {
+		r.preview.RenderPath(path, style, m)
+	}
+	r.renderPath(path, style, m)
+}
+
+func (r *PS) renderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
 	// TODO: (EPS) use dither to fake transparency
 
-	strokeUnsupported := false
+	strokeUnsupported := !style.Stroke.IsColor()
 	if _, ok := style.StrokeJoiner.(canvas.ArcsJoiner); ok {
 		strokeUnsupported = true
 	} else if miter, ok := style.StrokeJoiner.(canvas.MiterJoiner); ok {
@@ -197,6 +283,11 @@ func (r *PS) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 		}
 	}
 
+	if style.HasFill() && !style.Fill.IsColor() {
+		r.fill(path.Transform(m), style.Fill, style.FillRule)
+		style.Fill = canvas.Paint{}
+	}
+
 	if style.HasFill() || style.HasStroke() && !strokeUnsupported {
 		r.w.Write([]byte("\n"))
 		r.w.Write([]byte(path.Transform(m).ToPS()))
@@ -225,28 +316,161 @@ func (r *PS) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 			r.setDashes(style.DashOffset, style.Dashes)
 			r.w.Write([]byte(" stroke"))
 		} else {
-			// stroke settings unsupported by PDF, draw stroke explicitly
+			// stroke settings or paint unsupported by PS, draw stroke explicitly
 			if style.IsDashed() {
 				path = path.Dash(style.DashOffset, style.Dashes...)
 			}
 			path = path.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner, canvas.Tolerance)
+			path = path.Transform(m)
+			if style.Stroke.IsColor() {
+				r.w.Write([]byte("\n"))
+				r.w.Write([]byte(path.ToPS()))
+				r.setPaint(style.Stroke)
+				r.w.Write([]byte(" fill"))
+			} else {
+				r.fill(path, style.Stroke, canvas.NonZero)
+			}
+		}
+	}
+}
 
-			r.w.Write([]byte("\n"))
-			r.w.Write([]byte(path.Transform(m).ToPS()))
-			r.setPaint(style.Stroke)
-			r.w.Write([]byte(" fill"))
+// fill fills a path in page coordinates with a gradient or pattern.
+func (r *PS) fill(path *canvas.Path, paint canvas.Paint, fillRule canvas.FillRule) {
+	if path.Empty() {
+		return
+	}
+
+	fillOp, clipOp := "fill", "clip"
+	if fillRule == canvas.EvenOdd {
+		fillOp, clipOp = "eofill", "eoclip"
+	}
+	if paint.IsPattern() {
+		hatch, ok := paint.Pattern.(*canvas.HatchPattern)
+		if !ok {
+			// other patterns render themselves clipped to the path, the preview already has the original path
+			preview := r.preview
+			r.preview = nil
+			paint.Pattern.ClipTo(r, path)
+			r.preview = preview
+			return
+		} else if !hatch.Fill.IsColor() || hatch.Cell().Det() == 0.0 {
+			r.fill(hatch.Tile(path), hatch.Fill, canvas.NonZero)
+			return
+		}
+
+		name := r.getPattern(hatch)
+		fmt.Fprintf(r.w, "\ngsave %v setpattern %v %v grestore", name, path.ToPS(), fillOp)
+	} else if paint.IsGradient() {
+		var stops canvas.Stops
+		var shading string
+		switch g := paint.Gradient.(type) {
+		case *canvas.LinearGradient:
+			stops = g.Stops
+			shading = fmt.Sprintf("/ShadingType 2 /Coords [%v %v %v %v]", dec(g.Start.X), dec(g.Start.Y), dec(g.End.X), dec(g.End.Y))
+		case *canvas.RadialGradient:
+			stops = g.Stops
+			shading = fmt.Sprintf("/ShadingType 3 /Coords [%v %v %v %v %v %v]", dec(g.C0.X), dec(g.C0.Y), dec(g.R0), dec(g.C1.X), dec(g.C1.Y), dec(g.R1))
+		default:
+			return
+		}
+		if len(stops) == 0 {
+			return
 		}
+		fmt.Fprintf(r.w, "\ngsave %v %v newpath <</ColorSpace /DeviceRGB %v /Extend [true true] /Function %v>> shfill grestore", path.ToPS(), clipOp, shading, stopsFunction(stops))
+	}
+}
+
+// getPattern returns the name of a tiling pattern for the hatch, which is defined on first use. The pattern space is the hatch's cell and the paint procedure draws the hatch over the cell and its neighbours, the pattern's bounding box clips it to the cell.
+func (r *PS) getPattern(hatch *canvas.HatchPattern) string {
+	if name, ok := r.patterns[hatch]; ok {
+		return name
+	}
+
+	cell := hatch.Cell()
+	invCell := cell.Inv()
+	color := toNRGBA(hatch.Fill.Color)
+	paintOp := "fill"
+	if hatch.Thickness != 0.0 {
+		paintOp = fmt.Sprintf("%v setlinewidth 0 setlinecap 0 setlinejoin 10 setmiterlimit [] 0 setdash stroke", dec(hatch.Thickness))
 	}
+
+	name := fmt.Sprintf("CanvasPattern%d", len(r.patterns))
+	fmt.Fprintf(r.w, "\n/%v <</PatternType 1 /PaintType 1 /TilingType 1 /BBox [0 0 1 1] /XStep 1 /YStep 1", name)
+	fmt.Fprintf(r.w, " /PaintProc {pop [%v %v %v %v %v %v] concat", dec(invCell[0][0]), dec(invCell[1][0]), dec(invCell[0][1]), dec(invCell[1][1]), dec(invCell[0][2]), dec(invCell[1][2]))
+	fmt.Fprintf(r.w, " %v %v %v setrgbcolor %v %v}>>", dec(float64(color.R)/255.0), dec(float64(color.G)/255.0), dec(float64(color.B)/255.0), hatch.Hatch(-1.0, -1.0, 2.0, 2.0).ToPS(), paintOp)
+	fmt.Fprintf(r.w, " [%v %v %v %v %v %v] makepattern def", dec(cell[0][0]), dec(cell[1][0]), dec(cell[0][1]), dec(cell[1][1]), dec(cell[0][2]), dec(cell[1][2]))
+	r.patterns[hatch] = name
+	return name
 }
 
 // RenderText renders a text object to the canvas using a transformation matrix.
 func (r *PS) RenderText(text *canvas.Text, m canvas.Matrix) {
-	// TODO: (EPS) write text natively
-	text.RenderAsPath(r, m, 0.0)
+	if r.opts.TextAsPath || !r.embeddable(text) {
+		text.RenderAsPath(r, m, 0.0)
+		return
+	}
+
+	if r.preview != nil {
+		// decorations and span objects are drawn to the preview as part of the text
+		r.preview.RenderText(text, m)
+		preview := r.preview
+		r.preview = nil
+		defer func() {
+			r.preview = preview
+		}()
+	}
+
+	text.WalkDecorations(func(fill canvas.Paint, p *canvas.Path) {
+		style := canvas.DefaultStyle
+		style.Fill = fill
+		r.RenderPath(p, style, m)
+	})
+
+	text.WalkSpans(func(x, y float64, span canvas.TextSpan) {
+		if span.IsText() {
+			font := r.getFont(span.Face.Font)
+			face := span.Face
+			view := m.Translate(x, y).Shear(face.FauxItalic, 0.0)
+
+			r.setPaint(face.Fill)
+			fmt.Fprintf(r.w, "\ngsave [%v %v %v %v %v %v] concat", dec(view[0][0]), dec(view[1][0]), dec(view[0][1]), dec(view[1][1]), dec(view[0][2]), dec(view[1][2]))
+			fmt.Fprintf(r.w, " /%v findfont %v scalefont setfont", font.name, dec(face.Size))
+			f := face.MmPerEm
+			x, y := face.XOffset, face.YOffset
+			for _, glyph := range span.Glyphs {
+				fmt.Fprintf(r.w, " %v %v moveto /%v glyphshow", dec(f*float64(x+glyph.XOffset)), dec(f*float64(y+glyph.YOffset)), font.glyphName(face.Font.SFNT, glyph.ID))
+				x += glyph.XAdvance
+				y += glyph.YAdvance
+			}
+			fmt.Fprintf(r.w, " grestore")
+		} else {
+			for _, obj := range span.Objects {
+				obj.Canvas.RenderViewTo(r, m.Mul(obj.View(x, y, span.Face)))
+			}
+		}
+	})
+}
+
+// embeddable returns true if all text spans can be drawn using embedded fonts.
+func (r *PS) embeddable(text *canvas.Text) bool {
+	if text.WritingMode != canvas.HorizontalTB {
+		return false
+	}
+	embeddable := true
+	text.WalkSpans(func(x, y float64, span canvas.TextSpan) {
+		if span.IsText() && (!span.Face.Fill.IsColor() || span.Face.FauxBold != 0.0 || !fontEmbeddable(span.Face.Font.SFNT)) {
+			embeddable = false
+		}
+	})
+	return embeddable
 }
 
 // RenderImage renders an image to the canvas using a transformation matrix.
 func (r *PS) RenderImage(img image.Image, m canvas.Matrix) {
+	if r.preview != nil {
+		r.preview.RenderImage(img, m)
+	}
+
 	size := img.Bounds().Size()
 	sp := img.Bounds().Min // starting point
 	b := make([]byte, size.X*size.Y*3)
@@ -2,14 +2,163 @@ package ps
 
 import (
 	"bytes"
+	"encoding/binary"
+	"image"
+	"strings"
 	"testing"
 
 	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/test"
+	"golang.org/x/image/tiff"
 )
 
 func TestPS(t *testing.T) {
 	w := &bytes.Buffer{}
 	ps := New(w, 100, 80, nil)
 	ps.setPaint(canvas.Paint{Color: canvas.Red})
-	//test.String(t, string(w.Bytes()), "")
+	test.Error(t, ps.Close())
+
+	s := w.String()
+	test.That(t, strings.HasPrefix(s, "%!PS-Adobe-3.0\n"), s)
+	test.That(t, strings.Contains(s, "%%BoundingBox: 0 0 284 227\n%%HiResBoundingBox: 0 0 283.46457 226.77165\n"), s)
+	test.That(t, strings.Contains(s, "gsave 2.8346457 2.8346457 scale 1 0 0 setrgbcolor\ngrestore\nshowpage\n"), s)
+	test.That(t, strings.HasSuffix(s, "%%EOF\n"), s)
+}
+
+func TestPSGradient(t *testing.T) {
+	w := &bytes.Buffer{}
+	ps := New(w, 10, 10, nil)
+
+	gradient := canvas.NewLinearGradient(canvas.Point{X: 0.0, Y: 0.0}, canvas.Point{X: 10.0, Y: 0.0})
+	gradient.Add(0.0, canvas.Red)
+	gradient.Add(1.0, canvas.Blue)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Gradient: gradient}
+	ps.RenderPath(canvas.Rectangle(10.0, 5.0), style, canvas.Identity)
+
+	radial := canvas.NewRadialGradient(canvas.Point{X: 5.0, Y: 5.0}, 0.0, canvas.Point{X: 5.0, Y: 5.0}, 5.0)
+	radial.Add(0.2, canvas.Red)
+	radial.Add(0.6, canvas.Lime)
+	style.Fill = canvas.Paint{Gradient: radial}
+	style.FillRule = canvas.EvenOdd
+	ps.RenderPath(canvas.Rectangle(10.0, 5.0), style, canvas.Identity)
+	test.Error(t, ps.Close())
+
+	s := w.String()
+	test.That(t, strings.Contains(s, "\ngsave 0 0 moveto 10 0 lineto 10 5 lineto 0 5 lineto closepath clip newpath <</ColorSpace /DeviceRGB /ShadingType 2 /Coords [0 0 10 0] /Extend [true true] /Function <</FunctionType 2 /Domain [0 1] /C0 [1 0 0] /C1 [0 0 1] /N 1>>>> shfill grestore"), s)
+	test.That(t, strings.Contains(s, "eoclip newpath <</ColorSpace /DeviceRGB /ShadingType 3 /Coords [5 5 0 5 5 5] /Extend [true true] /Function <</FunctionType 3 /Domain [0 1] /Functions [<</FunctionType 2 /Domain [0 1] /C0 [1 0 0] /C1 [1 0 0] /N 1>> <</FunctionType 2 /Domain [0 1] /C0 [1 0 0] /C1 [0 1 0] /N 1>> <</FunctionType 2 /Domain [0 1] /C0 [0 1 0] /C1 [0 1 0] /N 1>>] /Bounds [.2 .6] /Encode [0 1 0 1 0 1]>>>> shfill grestore"), s)
+}
+
+func TestPSHatch(t *testing.T) {
+	w := &bytes.Buffer{}
+	ps := New(w, 10, 10, nil)
+
+	hatch := canvas.NewLineHatch(canvas.Black, 0.0, 2.0, 0.5)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Pattern: hatch}
+	ps.RenderPath(canvas.Rectangle(10.0, 5.0), style, canvas.Identity)
+	ps.RenderPath(canvas.Rectangle(5.0, 10.0), style, canvas.Identity)
+	test.Error(t, ps.Close())
+
+	s := w.String()
+	test.That(t, strings.Contains(s, "\n/CanvasPattern0 <</PatternType 1 /PaintType 1 /TilingType 1 /BBox [0 0 1 1] /XStep 1 /YStep 1 /PaintProc {pop [.5 0 0 .5 0 0] concat 0 0 0 setrgbcolor "), s)
+	test.That(t, strings.Contains(s, " .5 setlinewidth 0 setlinecap 0 setlinejoin 10 setmiterlimit [] 0 setdash stroke}>> [2 0 0 2 0 0] makepattern def\ngsave CanvasPattern0 setpattern 0 0 moveto"), s)
+	test.That(t, strings.Count(s, "makepattern") == 1, s)
+	test.That(t, strings.Count(s, "CanvasPattern0 setpattern") == 2, s)
+}
+
+// fillPattern is a pattern that fills the clipping path with a color.
+type fillPattern struct {
+	col canvas.Paint
+}
+
+func (p fillPattern) SetView(canvas.Matrix) canvas.Pattern           { return p }
+func (p fillPattern) SetColorSpace(canvas.ColorSpace) canvas.Pattern { return p }
+func (p fillPattern) ClipTo(r canvas.Renderer, clip *canvas.Path) {
+	r.RenderPath(clip, canvas.Style{Fill: p.col}, canvas.Identity)
+}
+
+func TestPSPattern(t *testing.T) {
+	w := &bytes.Buffer{}
+	ps := New(w, 10, 10, nil)
+
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Pattern: fillPattern{canvas.Paint{Color: canvas.Red}}}
+	ps.RenderPath(canvas.Rectangle(10.0, 5.0), style, canvas.Identity)
+	test.Error(t, ps.Close())
+
+	s := w.String()
+	test.That(t, strings.Contains(s, "\n0 0 moveto 10 0 lineto 10 5 lineto 0 5 lineto closepath 1 0 0 setrgbcolor fill\n"), s)
+}
+
+func TestPSText(t *testing.T) {
+	dejaVu := canvas.NewFontFamily("dejavu")
+	if err := dejaVu.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	garamond := canvas.NewFontFamily("garamond")
+	if err := garamond.LoadFontFile("../../resources/EBGaramond12-Regular.otf", canvas.FontRegular); err != nil {
+		test.Error(t, err)
+	}
+
+	w := &bytes.Buffer{}
+	ps := New(w, 20, 10, nil)
+	ps.RenderText(canvas.NewTextLine(dejaVu.Face(12.0, canvas.Red), "Text", canvas.Left), canvas.Identity.Translate(1.0, 2.0))
+	ps.RenderText(canvas.NewTextLine(garamond.Face(12.0, canvas.Black), "ab", canvas.Left), canvas.Identity)
+	test.Error(t, ps.Close())
+
+	s := w.String()
+	test.That(t, strings.Contains(s, "%%DocumentData: Binary\n"), s)
+	test.That(t, strings.Contains(s, "%%BeginResource: font CanvasFont0\n11 dict begin\n/FontName /CanvasFont0 def\n/FontType 42 def\n"), s)
+	test.That(t, strings.Contains(s, "/CharStrings 5 dict dup begin\n/.notdef 0 def\n/T 1 def\n/e 2 def\n/x 3 def\n/t 4 def\nend def\n/sfnts [\n<"), s)
+	test.That(t, strings.Contains(s, "%%BeginResource: FontSet (EBGaramond12-Regular)\n/FontSetInit /ProcSet findresource begin\n"), s)
+	test.That(t, strings.Contains(s, "\n/EBGaramond12-Regular "), s)
+	test.That(t, strings.Contains(s, " 1 0 0 setrgbcolor\ngsave [1 0 0 1 1 2] concat /CanvasFont0 findfont 4.2333333 scalefont setfont 0 0 moveto /T glyphshow "), s)
+	test.That(t, strings.Contains(s, "/EBGaramond12-Regular findfont 4.2333333 scalefont setfont 0 0 moveto /a glyphshow "), s)
+
+	// text as path
+	w.Reset()
+	ps = New(w, 20, 10, &Options{TextAsPath: true})
+	ps.RenderText(canvas.NewTextLine(dejaVu.Face(12.0, canvas.Red), "Text", canvas.Left), canvas.Identity)
+	test.Error(t, ps.Close())
+	test.That(t, !strings.Contains(w.String(), "glyphshow"))
+}
+
+func TestSfntsStrings(t *testing.T) {
+	b := make([]byte, 12+16*2+maxSfntsString+8)
+	binary.BigEndian.PutUint16(b[4:], 2)
+	binary.BigEndian.PutUint32(b[12+8:], 44)
+	binary.BigEndian.PutUint32(b[12+12:], 100)
+	binary.BigEndian.PutUint32(b[28+8:], 144)
+	binary.BigEndian.PutUint32(b[28+12:], uint32(len(b)-144))
+
+	strs, err := sfntsStrings(b)
+	test.Error(t, err)
+	test.T(t, len(strs), 2)
+	test.T(t, len(strs[0]), 144)
+	test.T(t, len(strs[1]), len(b)-144)
+}
+
+func TestEPSPreview(t *testing.T) {
+	w := &bytes.Buffer{}
+	ps := New(w, 10, 5, &Options{Format: EncapsulatedPostScript, Preview: true})
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Color: canvas.Red}
+	ps.RenderPath(canvas.Rectangle(10.0, 5.0), style, canvas.Identity)
+	test.Error(t, ps.Close())
+
+	b := w.Bytes()
+	test.T(t, b[:4], []byte{0xC5, 0xD0, 0xD3, 0xC6})
+	psOffset, psLength := binary.LittleEndian.Uint32(b[4:]), binary.LittleEndian.Uint32(b[8:])
+	tiffOffset, tiffLength := binary.LittleEndian.Uint32(b[20:]), binary.LittleEndian.Uint32(b[24:])
+	test.T(t, psOffset, uint32(30))
+	test.T(t, tiffOffset, psOffset+psLength)
+	test.T(t, int(tiffOffset+tiffLength), len(b))
+	test.That(t, bytes.HasPrefix(b[psOffset:], []byte("%!PS-Adobe-3.0 EPSF-3.0\n")))
+
+	img, err := tiff.Decode(bytes.NewReader(b[tiffOffset:]))
+	test.Error(t, err)
+	test.T(t, img.Bounds(), image.Rect(0, 0, 29, 15))
+	R, G, B, _ := img.At(14, 7).RGBA()
+	test.T(t, [3]uint32{R >> 8, G >> 8, B >> 8}, [3]uint32{255, 0, 0})
 }
@@ -1,6 +1,12 @@
 package ps
 
-import "image/color"
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+)
 
 func float64sEqual(a, b []float64) bool {
 	if len(a) != len(b) {
@@ -24,3 +30,46 @@ func toNRGBA(col color.Color) color.NRGBA {
 	b = (b * 0xffff) / a
 	return color.NRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(a >> 8)}
 }
+
+// stopsFunction returns a PostScript function for the gradient stops, which stitches together the exponential interpolation functions between stops. The function's domain is [0,1] and the first and last colors are extended to the ends of the domain.
+func stopsFunction(stops canvas.Stops) string {
+	if stops[0].Offset != 0.0 {
+		stops = append(canvas.Stops{{Offset: 0.0, Color: stops[0].Color}}, stops...)
+	}
+	if stops[len(stops)-1].Offset != 1.0 {
+		stops = append(stops, canvas.Stop{Offset: 1.0, Color: stops[len(stops)-1].Color})
+	}
+
+	rgb := func(col color.RGBA) string {
+		c := toNRGBA(col)
+		return fmt.Sprintf("[%v %v %v]", dec(float64(c.R)/255.0), dec(float64(c.G)/255.0), dec(float64(c.B)/255.0))
+	}
+	if len(stops) == 2 {
+		return fmt.Sprintf("<</FunctionType 2 /Domain [0 1] /C0 %v /C1 %v /N 1>>", rgb(stops[0].Color), rgb(stops[1].Color))
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("<</FunctionType 3 /Domain [0 1] /Functions [")
+	for i := 0; i+1 < len(stops); i++ {
+		if i != 0 {
+			sb.WriteString(" ")
+		}
+		fmt.Fprintf(&sb, "<</FunctionType 2 /Domain [0 1] /C0 %v /C1 %v /N 1>>", rgb(stops[i].Color), rgb(stops[i+1].Color))
+	}
+	sb.WriteString("] /Bounds [")
+	for i, stop := range stops[1 : len(stops)-1] {
+		if i != 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(dec(stop.Offset).String())
+	}
+	sb.WriteString("] /Encode [")
+	for i := 0; i+1 < len(stops); i++ {
+		if i != 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString("0 1")
+	}
+	sb.WriteString("]>>")
+	return sb.String()
+}
@@ -0,0 +1,84 @@
+package rasterizer
+
+import (
+	"image"
+	"math"
+)
+
+// bayer4 is the 4x4 Bayer threshold matrix.
+var bayer4 = [4][4]float64{
+	{0.0, 8.0, 2.0, 10.0},
+	{12.0, 4.0, 14.0, 6.0},
+	{3.0, 11.0, 1.0, 9.0},
+	{15.0, 7.0, 13.0, 5.0},
+}
+
+// Dither reduces an image with 16 bits per channel to 8 bits per channel using the given dithering method. Channels are dithered on the premultiplied values and the color channels never exceed the alpha channel.
+func Dither(src *image.RGBA64, dithering Dithering) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(bounds)
+	w, h := bounds.Dx(), bounds.Dy()
+	switch dithering {
+	case OrderedDithering:
+		for j := 0; j < h; j++ {
+			for i := 0; i < w; i++ {
+				t := (bayer4[j%4][i%4] + 0.5) / 16.0
+				k := src.PixOffset(bounds.Min.X+i, bounds.Min.Y+j)
+				l := dst.PixOffset(bounds.Min.X+i, bounds.Min.Y+j)
+				for c := 0; c < 4; c++ {
+					v := float64(uint16(src.Pix[k+2*c])<<8|uint16(src.Pix[k+2*c+1])) / 257.0
+					dst.Pix[l+c] = uint8(math.Min(math.Floor(v+t), 255.0))
+				}
+				clampPremultiplied(dst.Pix[l : l+4])
+			}
+		}
+	case FloydSteinbergDithering:
+		// quantization errors of the current and next row for each channel
+		cur := make([]float64, 4*(w+2))
+		next := make([]float64, 4*(w+2))
+		for j := 0; j < h; j++ {
+			for i := 0; i < w; i++ {
+				k := src.PixOffset(bounds.Min.X+i, bounds.Min.Y+j)
+				l := dst.PixOffset(bounds.Min.X+i, bounds.Min.Y+j)
+				for c := 0; c < 4; c++ {
+					e := 4*(i+1) + c
+					v := float64(uint16(src.Pix[k+2*c])<<8|uint16(src.Pix[k+2*c+1]))/257.0 + cur[e]
+					q := math.Min(math.Max(math.Floor(v+0.5), 0.0), 255.0)
+					dst.Pix[l+c] = uint8(q)
+
+					err := v - q
+					cur[e+4] += err * 7.0 / 16.0
+					next[e-4] += err * 3.0 / 16.0
+					next[e] += err * 5.0 / 16.0
+					next[e+4] += err * 1.0 / 16.0
+				}
+				clampPremultiplied(dst.Pix[l : l+4])
+			}
+			cur, next = next, cur
+			for i := range next {
+				next[i] = 0.0
+			}
+		}
+	default:
+		for j := 0; j < h; j++ {
+			for i := 0; i < w; i++ {
+				k := src.PixOffset(bounds.Min.X+i, bounds.Min.Y+j)
+				l := dst.PixOffset(bounds.Min.X+i, bounds.Min.Y+j)
+				for c := 0; c < 4; c++ {
+					v := uint32(src.Pix[k+2*c])<<8 | uint32(src.Pix[k+2*c+1])
+					dst.Pix[l+c] = uint8((v*255 + 0x7fff) / 0xffff)
+				}
+			}
+		}
+	}
+	return dst
+}
+
+// clampPremultiplied ensures that the color channels do not exceed the alpha channel.
+func clampPremultiplied(pix []uint8) {
+	for c := 0; c < 3; c++ {
+		if pix[3] < pix[c] {
+			pix[c] = pix[3]
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package rasterizer
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/tdewolff/canvas"
+	"golang.org/x/image/draw"
+)
+
+// RenderFilter renders a group with a filter effect to the canvas using a transformation matrix. The group is rasterized separately within the region affected by the filter, after which the filter is applied in the linear color space and the result is drawn onto the image.
+func (r *Rasterizer) RenderFilter(group *canvas.Canvas, filter *canvas.Filter, m canvas.Matrix) {
+	if group.Empty() {
+		return
+	}
+
+	// region of the filter in pixels, content outside the image is included as far as the filter reaches
+	dpmm := r.resolution.DPMM()
+	size := r.Bounds().Size()
+	bounds := filter.Bounds(group.Bounds()).Transform(m)
+	reach := filter.Transform(m).Bounds(canvas.Rect{})
+	margin := int(math.Ceil(math.Max(reach.W, reach.H) * dpmm))
+	rect := image.Rect(
+		int(math.Floor(bounds.X*dpmm)),
+		size.Y-int(math.Ceil((bounds.Y+bounds.H)*dpmm)),
+		int(math.Ceil((bounds.X+bounds.W)*dpmm)),
+		size.Y-int(math.Floor(bounds.Y*dpmm)),
+	).Intersect(image.Rect(-margin, -margin, size.X+margin, size.Y+margin))
+	if rect.Empty() {
+		return
+	}
+
+	var img draw.Image
+	if r.precise {
+		img = image.NewRGBA64(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	} else {
+		img = image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	}
+	sub := &Rasterizer{
+		Image:        img,
+		resolution:   r.resolution,
+		colorSpace:   r.colorSpace,
+		antialiasing: r.antialiasing,
+		precise:      r.precise,
+		samples:      1,
+	}
+	view := canvas.Identity.Translate(-float64(rect.Min.X)/dpmm, -float64(size.Y-rect.Max.Y)/dpmm)
+	group.RenderViewTo(sub, view.Mul(m))
+
+	// filter lengths in pixels with the y-axis pointing downwards
+	filter = filter.Transform(canvas.Identity.Scale(dpmm, -dpmm).Mul(m))
+	flood := func(col color.RGBA) [4]float64 {
+		c := r.toLinear64(col)
+		return [4]float64{float64(c.R) / 0xffff, float64(c.G) / 0xffff, float64(c.B) / 0xffff, float64(c.A) / 0xffff}
+	}
+	applyFilter(newFilterImage(img), filter, flood).draw(img)
+	r.drawImage(func(dst draw.Image) {
+		draw.Draw(dst, rect, img, image.Point{}, draw.Over)
+	})
+}
+
+// filterImage is an image with premultiplied RGBA components in [0,1] to which filter primitives are applied.
+type filterImage struct {
+	w, h int
+	pix  []float64
+}
+
+func newFilterImage(img image.Image) *filterImage {
+	bounds := img.Bounds()
+	f := &filterImage{bounds.Dx(), bounds.Dy(), make([]float64, 4*bounds.Dx()*bounds.Dy())}
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			f.pix[i+0] = float64(r) / 0xffff
+			f.pix[i+1] = float64(g) / 0xffff
+			f.pix[i+2] = float64(b) / 0xffff
+			f.pix[i+3] = float64(a) / 0xffff
+			i += 4
+		}
+	}
+	return f
+}
+
+func (f *filterImage) empty() *filterImage {
+	return &filterImage{f.w, f.h, make([]float64, len(f.pix))}
+}
+
+// draw writes the filter image to an image of the same size.
+func (f *filterImage) draw(img draw.Image) {
+	bounds := img.Bounds()
+	col := color.RGBA64{}
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			col.R = uint16(f.pix[i+0]*0xffff + 0.5)
+			col.G = uint16(f.pix[i+1]*0xffff + 0.5)
+			col.B = uint16(f.pix[i+2]*0xffff + 0.5)
+			col.A = uint16(f.pix[i+3]*0xffff + 0.5)
+			img.Set(x, y, col)
+			i += 4
+		}
+	}
+}
+
+// applyFilter applies the filter primitives in order and returns the result of the last primitive. Filter lengths must be in pixels.
+func applyFilter(src *filterImage, filter *canvas.Filter, flood func(color.RGBA) [4]float64) *filterImage {
+	prev := src
+	results := map[string]*filterImage{}
+	input := func(name string) *filterImage {
+		switch name {
+		case canvas.SourceGraphic:
+			return src
+		case canvas.SourceAlpha:
+			return src.alpha()
+		}
+		if res, ok := results[name]; ok {
+			return res
+		}
+		return prev // empty or unknown references refer to the previous result
+	}
+
+	for _, primitive := range filter.Primitives {
+		var res *filterImage
+		switch effect := primitive.Effect.(type) {
+		case canvas.GaussianBlurEffect:
+			res = input(primitive.In).blur(effect.StdDevX, effect.StdDevY)
+		case canvas.OffsetEffect:
+			res = input(primitive.In).offset(int(math.Round(effect.DX)), int(math.Round(effect.DY)))
+		case canvas.FloodEffect:
+			res = src.empty()
+			col := flood(effect.Color)
+			for i := 0; i < len(res.pix); i += 4 {
+				copy(res.pix[i:i+4], col[:])
+			}
+		case canvas.CompositeEffect:
+			res = composite(input(primitive.In), input(primitive.In2), effect)
+		case canvas.MergeEffect:
+			res = src.empty()
+			for _, name := range effect.In {
+				res = composite(input(name), res, canvas.CompositeEffect{Operator: canvas.CompositeOver})
+			}
+		case canvas.ColorMatrixEffect:
+			res = input(primitive.In).colorMatrix(effect.Matrix)
+		default:
+			res = input(primitive.In)
+		}
+		if primitive.Result != "" {
+			results[primitive.Result] = res
+		}
+		prev = res
+	}
+	return prev
+}
+
+// alpha returns the alpha channel with black color.
+func (f *filterImage) alpha() *filterImage {
+	res := f.empty()
+	for i := 3; i < len(f.pix); i += 4 {
+		res.pix[i] = f.pix[i]
+	}
+	return res
+}
+
+// blur applies a Gaussian blur with the standard deviations in pixels as two separable passes.
+func (f *filterImage) blur(stdDevX, stdDevY float64) *filterImage {
+	if stdDevX <= 0.0 && stdDevY <= 0.0 {
+		return f
+	}
+	res := f
+	if 0.0 < stdDevX {
+		res = res.convolve(gaussianKernel(stdDevX), 4, 4*res.w, res.w, res.h)
+	}
+	if 0.0 < stdDevY {
+		res = res.convolve(gaussianKernel(stdDevY), 4*res.w, 4, res.h, res.w)
+	}
+	return res
+}
+
+// convolve convolves n lines of length l with a symmetric kernel, where step is the distance between pixels within a line and stride the distance between lines. Pixels outside the image are transparent.
+func (f *filterImage) convolve(kernel []float64, step, stride, l, n int) *filterImage {
+	res := f.empty()
+	radius := len(kernel) - 1
+	for j := 0; j < n; j++ {
+		line := j * stride
+		for i := 0; i < l; i++ {
+			var sum [4]float64
+			for k := -radius; k <= radius; k++ {
+				if i+k < 0 || l <= i+k {
+					continue
+				}
+				w := kernel[abs(k)]
+				o := line + (i+k)*step
+				sum[0] += w * f.pix[o+0]
+				sum[1] += w * f.pix[o+1]
+				sum[2] += w * f.pix[o+2]
+				sum[3] += w * f.pix[o+3]
+			}
+			copy(res.pix[line+i*step:], sum[:])
+		}
+	}
+	return res
+}
+
+// gaussianKernel returns the normalized weights of one half of a Gaussian kernel that reaches three standard deviations.
+func gaussianKernel(stdDev float64) []float64 {
+	radius := int(math.Ceil(3.0 * stdDev))
+	kernel := make([]float64, radius+1)
+	sum := 0.0
+	for i := range kernel {
+		kernel[i] = math.Exp(-float64(i*i) / (2.0 * stdDev * stdDev))
+		if i == 0 {
+			sum += kernel[i]
+		} else {
+			sum += 2.0 * kernel[i]
+		}
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// offset translates the image by a number of pixels.
+func (f *filterImage) offset(dx, dy int) *filterImage {
+	res := f.empty()
+	for y := 0; y < f.h; y++ {
+		if y-dy < 0 || f.h <= y-dy {
+			continue
+		}
+		for x := 0; x < f.w; x++ {
+			if x-dx < 0 || f.w <= x-dx {
+				continue
+			}
+			copy(res.pix[4*(y*f.w+x):4*(y*f.w+x)+4], f.pix[4*((y-dy)*f.w+x-dx):])
+		}
+	}
+	return res
+}
+
+// composite composites a on top of b using a Porter-Duff or arithmetic operator.
+func composite(a, b *filterImage, effect canvas.CompositeEffect) *filterImage {
+	res := a.empty()
+	for i := 0; i < len(res.pix); i += 4 {
+		aa, ba := a.pix[i+3], b.pix[i+3]
+		for c := 0; c < 4; c++ {
+			ac, bc := a.pix[i+c], b.pix[i+c]
+			var v float64
+			switch effect.Operator {
+			case canvas.CompositeOver:
+				v = ac + bc*(1.0-aa)
+			case canvas.CompositeIn:
+				v = ac * ba
+			case canvas.CompositeOut:
+				v = ac * (1.0 - ba)
+			case canvas.CompositeAtop:
+				v = ac*ba + bc*(1.0-aa)
+			case canvas.CompositeXor:
+				v = ac*(1.0-ba) + bc*(1.0-aa)
+			case canvas.CompositeArithmetic:
+				v = effect.K1*ac*bc + effect.K2*ac + effect.K3*bc + effect.K4
+			}
+			res.pix[i+c] = math.Max(0.0, math.Min(1.0, v))
+		}
+		for c := 0; c < 3; c++ {
+			res.pix[i+c] = math.Min(res.pix[i+c], res.pix[i+3])
+		}
+	}
+	return res
+}
+
+// colorMatrix transforms the unpremultiplied colors by a 4x5 matrix.
+func (f *filterImage) colorMatrix(m [20]float64) *filterImage {
+	res := f.empty()
+	for i := 0; i < len(f.pix); i += 4 {
+		a := f.pix[i+3]
+		var c [4]float64
+		if 0.0 < a {
+			c = [4]float64{f.pix[i+0] / a, f.pix[i+1] / a, f.pix[i+2] / a, a}
+		}
+		var out [4]float64
+		for j := 0; j < 4; j++ {
+			v := m[5*j+0]*c[0] + m[5*j+1]*c[1] + m[5*j+2]*c[2] + m[5*j+3]*c[3] + m[5*j+4]
+			out[j] = math.Max(0.0, math.Min(1.0, v))
+		}
+		res.pix[i+0] = out[0] * out[3]
+		res.pix[i+1] = out[1] * out[3]
+		res.pix[i+2] = out[2] * out[3]
+		res.pix[i+3] = out[3]
+	}
+	return res
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -2,7 +2,9 @@ package rasterizer
 
 import (
 	"image"
+	"image/color"
 	"math"
+	"strconv"
 
 	"github.com/tdewolff/canvas"
 	"golang.org/x/image/draw"
@@ -10,52 +12,227 @@ import (
 	"golang.org/x/image/vector"
 )
 
+// Antialiasing is the anti-aliasing mode of the rasterizer.
+type Antialiasing int
+
+// see Antialiasing
+const (
+	AnalyticAntialiasing Antialiasing = iota // coverage is the exact area of the pixel that is covered
+	Supersampling                            // coverage is sampled Samples×Samples times per pixel, which avoids seams between adjacent shapes
+	NoAntialiasing                           // pixels are either covered or not, for pixel art and masks
+)
+
+func (aa Antialiasing) String() string {
+	switch aa {
+	case AnalyticAntialiasing:
+		return "Analytic"
+	case Supersampling:
+		return "Supersampling"
+	case NoAntialiasing:
+		return "None"
+	}
+	return "Invalid(" + strconv.Itoa(int(aa)) + ")"
+}
+
+// Dithering is the dithering method used when reducing colors from 16 to 8 bits per channel.
+type Dithering int
+
+// see Dithering
+const (
+	NoDithering             Dithering = iota // round to the nearest color
+	OrderedDithering                         // 4x4 Bayer matrix
+	FloydSteinbergDithering                  // error diffusion
+)
+
+func (d Dithering) String() string {
+	switch d {
+	case NoDithering:
+		return "None"
+	case OrderedDithering:
+		return "Ordered"
+	case FloydSteinbergDithering:
+		return "FloydSteinberg"
+	}
+	return "Invalid(" + strconv.Itoa(int(d)) + ")"
+}
+
+// Options are the rasterizer options.
+type Options struct {
+	TileSize     int // if non-zero, split the image in square tiles of TileSize pixels that are rasterized concurrently
+	Antialiasing Antialiasing
+	Samples      int       // number of samples per pixel along each axis for Supersampling
+	BitDepth     int       // bits per channel of the output image, either 8 or 16, used by image writers
+	Dithering    Dithering // when non-zero, rasterize with 16 bits per channel and dither to 8 bits per channel
+}
+
+// DefaultOptions are the default rasterizer options.
+var DefaultOptions = Options{
+	TileSize:     0,
+	Antialiasing: AnalyticAntialiasing,
+	Samples:      4,
+	BitDepth:     8,
+	Dithering:    NoDithering,
+}
+
 // Draw draws the canvas on a new image with given resolution (in dots-per-millimeter). Higher resolution will result in larger images.
 func Draw(c *canvas.Canvas, resolution canvas.Resolution, colorSpace canvas.ColorSpace) *image.RGBA {
+	return DrawWithOptions(c, resolution, colorSpace, nil)
+}
+
+// DrawWithOptions draws the canvas on a new image with given resolution (in dots-per-millimeter) and options. With a non-zero tile size, the layers are rasterized concurrently over GOMAXPROCS workers and composited per tile, which gives the same image as rasterizing serially.
+func DrawWithOptions(c *canvas.Canvas, resolution canvas.Resolution, colorSpace canvas.ColorSpace, opts *Options) *image.RGBA {
+	if opts == nil {
+		defaultOptions := DefaultOptions
+		opts = &defaultOptions
+	}
+
+	if opts.Dithering != NoDithering {
+		return Dither(DrawRGBA64(c, resolution, colorSpace, opts), opts.Dithering)
+	}
+
 	img := image.NewRGBA(image.Rect(0, 0, int(c.W*resolution.DPMM()+0.5), int(c.H*resolution.DPMM()+0.5)))
-	ras := FromImage(img, resolution, colorSpace)
-	c.RenderTo(ras)
-	ras.Close()
+	drawTo(img, c, resolution, colorSpace, opts)
+	return img
+}
+
+// DrawRGBA64 draws the canvas on a new image with 16 bits per channel with given resolution (in dots-per-millimeter) and options. Colors are converted to the linear color space and composited with 16 bits per channel, which avoids banding in dark gradients.
+func DrawRGBA64(c *canvas.Canvas, resolution canvas.Resolution, colorSpace canvas.ColorSpace, opts *Options) *image.RGBA64 {
+	if opts == nil {
+		defaultOptions := DefaultOptions
+		opts = &defaultOptions
+	}
+
+	img := image.NewRGBA64(image.Rect(0, 0, int(c.W*resolution.DPMM()+0.5), int(c.H*resolution.DPMM()+0.5)))
+	drawTo(img, c, resolution, colorSpace, opts)
 	return img
 }
 
+func drawTo(img draw.Image, c *canvas.Canvas, resolution canvas.Resolution, colorSpace canvas.ColorSpace, opts *Options) {
+	ras := FromImageWithOptions(img, resolution, colorSpace, opts)
+	if 0 < opts.TileSize {
+		drawTiled(ras, c, opts.TileSize)
+	} else {
+		c.RenderTo(ras)
+	}
+	ras.Close()
+}
+
 // Rasterizer is a rasterizing renderer.
 type Rasterizer struct {
 	draw.Image
-	resolution canvas.Resolution
-	colorSpace canvas.ColorSpace
+	resolution   canvas.Resolution
+	colorSpace   canvas.ColorSpace
+	antialiasing Antialiasing
+	precise      bool // composite with 16 bits per channel
+
+	dst     draw.Image // destination image when supersampling, Image is the supersampled image
+	samples int
+
+	ops *[]tileOp // records draw operations instead when rendering in tiles
 }
 
 // New returns a renderer that draws to a rasterized image. By default the linear color space is used, which assumes input and output colors are in linearRGB. If the sRGB color space is used for drawing with an average of gamma=2.2, the input and output colors are assumed to be in sRGB (a common assumption) and blending happens in linearRGB. Be aware that for text this results in thin stems for black-on-white (but wide stems for white-on-black).
 func New(width, height float64, resolution canvas.Resolution, colorSpace canvas.ColorSpace) *Rasterizer {
+	return NewWithOptions(width, height, resolution, colorSpace, nil)
+}
+
+// NewWithOptions returns a renderer that draws to a rasterized image using the given options, such as the anti-aliasing mode. See New.
+func NewWithOptions(width, height float64, resolution canvas.Resolution, colorSpace canvas.ColorSpace, opts *Options) *Rasterizer {
 	img := image.NewRGBA(image.Rect(0, 0, int(width*resolution.DPMM()+0.5), int(height*resolution.DPMM()+0.5)))
-	return FromImage(img, resolution, colorSpace)
+	return FromImageWithOptions(img, resolution, colorSpace, opts)
 }
 
-// FromImage returns a renderer that draws to an existing image.
+// FromImage returns a renderer that draws to an existing image. If the image is an *image.RGBA64, colors are converted and composited with 16 bits per channel.
 func FromImage(img draw.Image, resolution canvas.Resolution, colorSpace canvas.ColorSpace) *Rasterizer {
+	return FromImageWithOptions(img, resolution, colorSpace, nil)
+}
+
+// FromImageWithOptions returns a renderer that draws to an existing image using the given options, such as the anti-aliasing mode. The tile size option is ignored.
+func FromImageWithOptions(img draw.Image, resolution canvas.Resolution, colorSpace canvas.ColorSpace, opts *Options) *Rasterizer {
+	if opts == nil {
+		defaultOptions := DefaultOptions
+		opts = &defaultOptions
+	}
+
 	bounds := img.Bounds()
+	samples := 1
+	if opts.Antialiasing == Supersampling {
+		samples = opts.Samples
+		if samples < 1 {
+			samples = DefaultOptions.Samples
+		}
+	}
 	if bounds.Dx() == 0 || bounds.Dy() == 0 {
 		panic("rasterizer size 0x0, increase resolution")
-	} else if float64(math.MaxInt32) < float64(bounds.Dx())*float64(bounds.Dy()) {
+	} else if float64(math.MaxInt32) < float64(samples*bounds.Dx())*float64(samples*bounds.Dy()) {
 		panic("rasterizer overflow, decrease resolution")
 	}
 
 	if colorSpace == nil {
 		colorSpace = canvas.DefaultColorSpace
 	}
-	return &Rasterizer{
-		Image:      img,
-		resolution: resolution,
-		colorSpace: colorSpace,
+	r := &Rasterizer{
+		Image:        img,
+		resolution:   resolution,
+		colorSpace:   colorSpace,
+		antialiasing: opts.Antialiasing,
+		samples:      1,
+	}
+	if _, ok := img.(*image.RGBA64); ok {
+		r.precise = true
+	}
+	if opts.Antialiasing == Supersampling {
+		// draw without anti-aliasing on an image that is larger by the number of samples, and downsample when closing
+		r.Image = upsample(img, samples)
+		r.resolution = canvas.DPMM(resolution.DPMM() * float64(samples))
+		r.dst = img
+		r.samples = samples
 	}
+	return r
 }
 
+// Close finishes drawing by downsampling the image when supersampling, and by converting colors from the linear color space to the output color space.
 func (r *Rasterizer) Close() {
+	if r.dst != nil {
+		downsample(r.dst, r.Image, r.samples)
+		r.Image = r.dst
+		r.resolution = canvas.DPMM(r.resolution.DPMM() / float64(r.samples))
+		r.dst = nil
+		r.samples = 1
+	}
 	if _, ok := r.colorSpace.(canvas.LinearColorSpace); !ok {
 		// gamma compress
-		changeColorSpace(r.Image, r.Image, r.colorSpace.FromLinear)
+		if r.precise {
+			changeColorSpace64(r.Image, r.Image, r.fromLinear64)
+		} else {
+			changeColorSpace(r.Image, r.Image, r.colorSpace.FromLinear)
+		}
+	}
+}
+
+func (r *Rasterizer) toLinear64(col color.Color) color.RGBA64 {
+	return canvas.ToLinear64(r.colorSpace, col)
+}
+
+func (r *Rasterizer) fromLinear64(col color.Color) color.RGBA64 {
+	return canvas.FromLinear64(r.colorSpace, col)
+}
+
+// paint returns the source image for a color or gradient paint in the linear color space.
+func (r *Rasterizer) paint(paint canvas.Paint, zp, size image.Point) image.Image {
+	if paint.IsColor() {
+		if r.precise {
+			return image.NewUniform(r.toLinear64(paint.Color))
+		}
+		return image.NewUniform(r.colorSpace.ToLinear(paint.Color))
+	} else if paint.IsGradient() {
+		if gradient, ok := paint.Gradient.(canvas.Gradient64); ok && r.precise {
+			return newGradientImage64(gradient, r.colorSpace, zp, size, r.resolution)
+		}
+		gradient := paint.Gradient.SetColorSpace(r.colorSpace)
+		return NewGradientImage(gradient, zp, size, r.resolution)
 	}
+	return nil
 }
 
 // Size returns the size of the canvas in millimeters.
@@ -117,85 +294,199 @@ func (r *Rasterizer) RenderPath(path *canvas.Path, style canvas.Style, m canvas.
 		return // has no size
 	}
 
+	offset := canvas.Identity.Translate(-float64(x)/dpmm, -float64(size.Y-y-h)/dpmm)
 	if style.HasFill() {
+		var hatch *canvas.HatchPattern
 		if style.Fill.IsPattern() {
-			if hatch, ok := style.Fill.Pattern.(*canvas.HatchPattern); ok {
+			if hatch, _ = style.Fill.Pattern.(*canvas.HatchPattern); hatch != nil {
 				style.Fill = hatch.Fill
-				fill = hatch.Tile(fill)
 			}
 		}
 
 		ras := vector.NewRasterizer(w, h)
-		fill = fill.Translate(-float64(x)/dpmm, -float64(size.Y-y-h)/dpmm)
-		fill.ToRasterizer(ras, r.resolution)
-		var src image.Image
-		if style.Fill.IsColor() {
-			src = image.NewUniform(r.colorSpace.ToLinear(style.Fill.Color))
-		} else if style.Fill.IsGradient() {
-			gradient := style.Fill.Gradient.SetColorSpace(r.colorSpace)
-			src = NewGradientImage(gradient, zp, size, r.resolution)
-		} else if style.Fill.IsPattern() {
+		fill.Transform(offset).ToRasterizer(ras, r.resolution)
+		src := r.paint(style.Fill, zp, size)
+		if style.Fill.IsPattern() {
 			pattern := style.Fill.Pattern.SetColorSpace(r.colorSpace)
 			pattern.ClipTo(r, fill)
 		}
 		if src != nil {
-			ras.Draw(r.Image, image.Rect(x, y, x+w, y+h), src, image.Point{dx, dy})
+			if hatch != nil {
+				r.drawHatch(ras, hatch, fill.FastBounds(), offset, image.Rect(x, y, x+w, y+h), src, image.Point{dx, dy})
+			} else {
+				r.draw(ras, image.Rect(x, y, x+w, y+h), src, image.Point{dx, dy})
+			}
 		}
 	}
 	if style.HasStroke() {
+		var hatch *canvas.HatchPattern
 		if style.Stroke.IsPattern() {
-			if hatch, ok := style.Stroke.Pattern.(*canvas.HatchPattern); ok {
+			if hatch, _ = style.Stroke.Pattern.(*canvas.HatchPattern); hatch != nil {
 				style.Stroke = hatch.Fill
-				stroke = hatch.Tile(stroke)
 			}
 		}
 
 		ras := vector.NewRasterizer(w, h)
-		stroke = stroke.Translate(-float64(x)/dpmm, -float64(size.Y-y-h)/dpmm)
-		stroke.ToRasterizer(ras, r.resolution)
-		var src image.Image
-		if style.Stroke.IsColor() {
-			src = image.NewUniform(r.colorSpace.ToLinear(style.Stroke.Color))
-		} else if style.Stroke.IsGradient() {
-			gradient := style.Stroke.Gradient.SetColorSpace(r.colorSpace)
-			src = NewGradientImage(gradient, zp, size, r.resolution)
-		} else if style.Fill.IsPattern() {
+		stroke.Transform(offset).ToRasterizer(ras, r.resolution)
+		src := r.paint(style.Stroke, zp, size)
+		if style.Stroke.IsPattern() {
 			pattern := style.Stroke.Pattern.SetColorSpace(r.colorSpace)
-			pattern.ClipTo(r, fill)
+			pattern.ClipTo(r, stroke)
 		}
 		if src != nil {
-			ras.Draw(r.Image, image.Rect(x, y, x+w, y+h), src, image.Point{dx, dy})
+			if hatch != nil {
+				r.drawHatch(ras, hatch, stroke.FastBounds(), offset, image.Rect(x, y, x+w, y+h), src, image.Point{dx, dy})
+			} else {
+				r.draw(ras, image.Rect(x, y, x+w, y+h), src, image.Point{dx, dy})
+			}
 		}
 	}
 }
 
+// drawHatch draws a hatch pattern within the area covered by the rasterizer. The hatch is rasterized separately and both coverages are multiplied, which avoids clipping the hatch with path boolean operations.
+func (r *Rasterizer) drawHatch(ras *vector.Rasterizer, hatch *canvas.HatchPattern, bounds canvas.Rect, offset canvas.Matrix, rect image.Rectangle, src image.Image, sp image.Point) {
+	// find extremes along cell axes
+	invCell := hatch.Cell().Inv()
+	d := hatch.Thickness
+	points := []canvas.Point{
+		invCell.Dot(canvas.Point{X: bounds.X - d, Y: bounds.Y - d}),
+		invCell.Dot(canvas.Point{X: bounds.X + bounds.W + d, Y: bounds.Y - d}),
+		invCell.Dot(canvas.Point{X: bounds.X + bounds.W + d, Y: bounds.Y + bounds.H + d}),
+		invCell.Dot(canvas.Point{X: bounds.X - d, Y: bounds.Y + bounds.H + d}),
+	}
+	x0, x1 := points[0].X, points[0].X
+	y0, y1 := points[0].Y, points[0].Y
+	for _, point := range points[1:] {
+		x0, x1 = math.Min(x0, point.X), math.Max(x1, point.X)
+		y0, y1 = math.Min(y0, point.Y), math.Max(y1, point.Y)
+	}
+
+	p := hatch.Hatch(x0, y0, x1, y1)
+	if hatch.Thickness != 0.0 {
+		p = p.Stroke(hatch.Thickness, canvas.ButtCap, canvas.MiterJoin, canvas.PixelTolerance/r.resolution.DPMM())
+	}
+	hatchRas := vector.NewRasterizer(ras.Size().X, ras.Size().Y)
+	p.Transform(offset).ToRasterizer(hatchRas, r.resolution)
+
+	mask := image.NewAlpha16(rect)
+	ras.Draw(mask, rect, image.Opaque, image.Point{})
+	hatchMask := image.NewAlpha16(rect)
+	hatchRas.Draw(hatchMask, rect, image.Opaque, image.Point{})
+	for i := 0; i < len(mask.Pix); i += 2 {
+		a := uint32(mask.Pix[i])<<8 | uint32(mask.Pix[i+1])
+		b := uint32(hatchMask.Pix[i])<<8 | uint32(hatchMask.Pix[i+1])
+		a = a * b / 0xffff
+		mask.Pix[i], mask.Pix[i+1] = uint8(a>>8), uint8(a)
+	}
+	r.drawMask(mask, rect, src, sp)
+}
+
 // RenderText renders a text object to the canvas using a transformation matrix.
 func (r *Rasterizer) RenderText(text *canvas.Text, m canvas.Matrix) {
 	text.RenderAsPath(r, m, r.resolution)
 }
 
-// RenderImage renders an image to the canvas using a transformation matrix.
+// RenderImage renders an image to the canvas using a transformation matrix. The resampling kernel is taken from the image's interpolation hint, see canvas.Image. Integer translations and axis-aligned scales that end on pixel boundaries are drawn without a general affine transformation.
 func (r *Rasterizer) RenderImage(img image.Image, m canvas.Matrix) {
-	// add transparent margin to image for smooth borders when rotating
-	// TODO: optimize when transformation is only translation or stretch (if optimizing, dont overwrite original img when gamma correcting)
-	margin := 4
+	interpolator := imageInterpolator(canvas.ImageInterpolation(img))
 	size := img.Bounds().Size()
-	sp := img.Bounds().Min // starting point
-	img2 := image.NewRGBA(image.Rect(0, 0, size.X+margin*2, size.Y+margin*2))
-	draw.Draw(img2, image.Rect(margin, margin, size.X+margin, size.Y+margin), img, sp, draw.Over)
+	dpmm := r.resolution.DPMM()
+	h := float64(r.Bounds().Size().Y)
+
+	if canvas.Equal(m[0][1], 0.0) && canvas.Equal(m[1][0], 0.0) && 0.0 < m[0][0] && 0.0 < m[1][1] {
+		// axis-aligned without flips, check if the image ends on pixel boundaries
+		topLeft := m.Dot(canvas.Point{X: 0.0, Y: float64(size.Y)}).Mul(dpmm)
+		x0, y0 := topLeft.X, h-topLeft.Y
+		x1, y1 := x0+m[0][0]*dpmm*float64(size.X), y0+m[1][1]*dpmm*float64(size.Y)
+		if isInteger(x0) && isInteger(y0) && isInteger(x1) && isInteger(y1) {
+			src := r.linearImage(img, 0)
+			rect := image.Rect(int(math.Round(x0)), int(math.Round(y0)), int(math.Round(x1)), int(math.Round(y1)))
+			if rect.Dx() == size.X && rect.Dy() == size.Y {
+				r.drawImage(func(dst draw.Image) {
+					draw.Draw(dst, rect, src, image.Point{}, draw.Over)
+				})
+			} else {
+				r.drawImage(func(dst draw.Image) {
+					interpolator.Scale(dst, rect, src, src.Bounds(), draw.Over, nil)
+				})
+			}
+			return
+		}
+	}
 
-	// draw to destination image
+	// add transparent margin to image for smooth borders when rotating
 	// note that we need to correct for the added margin in origin and m
-	dpmm := r.resolution.DPMM()
-	origin := m.Dot(canvas.Point{-float64(margin), float64(img2.Bounds().Size().Y - margin)}).Mul(dpmm)
+	margin := 4
+	src := r.linearImage(img, margin)
+	origin := m.Dot(canvas.Point{X: -float64(margin), Y: float64(size.Y + margin)}).Mul(dpmm)
 	m = m.Scale(dpmm, dpmm)
+	aff3 := f64.Aff3{m[0][0], -m[0][1], origin.X, -m[1][0], m[1][1], h - origin.Y}
+	r.drawImage(func(dst draw.Image) {
+		interpolator.Transform(dst, aff3, src, src.Bounds(), draw.Over, nil)
+	})
+}
+
+// linearImage returns a copy of the image in the linear color space with a transparent margin.
+func (r *Rasterizer) linearImage(img image.Image, margin int) draw.Image {
+	size := img.Bounds().Size()
+	rect := image.Rect(0, 0, size.X+margin*2, size.Y+margin*2)
+	var dst draw.Image
+	if r.precise {
+		dst = image.NewRGBA64(rect)
+	} else {
+		dst = image.NewRGBA(rect)
+	}
+	draw.Draw(dst, image.Rect(margin, margin, size.X+margin, size.Y+margin), img, img.Bounds().Min, draw.Over)
 
 	if _, ok := r.colorSpace.(canvas.LinearColorSpace); !ok {
 		// gamma decompress
-		changeColorSpace(img2, img2, r.colorSpace.ToLinear)
+		if r.precise {
+			changeColorSpace64(dst, dst, r.toLinear64)
+		} else {
+			changeColorSpace(dst, dst, r.colorSpace.ToLinear)
+		}
 	}
+	return dst
+}
 
-	h := float64(r.Bounds().Size().Y)
-	aff3 := f64.Aff3{m[0][0], -m[0][1], origin.X, -m[1][0], m[1][1], h - origin.Y}
-	draw.CatmullRom.Transform(r, aff3, img2, img2.Bounds(), draw.Over, nil)
+// draw composites the coverage of the rasterized path onto the image, or records it when rendering in tiles.
+func (r *Rasterizer) draw(ras *vector.Rasterizer, rect image.Rectangle, src image.Image, sp image.Point) {
+	if r.ops == nil && r.antialiasing == AnalyticAntialiasing {
+		ras.Draw(r.Image, rect, src, sp)
+		return
+	}
+
+	mask := image.NewAlpha16(rect)
+	ras.Draw(mask, rect, image.Opaque, image.Point{})
+	r.drawMask(mask, rect, src, sp)
+}
+
+// drawMask draws the source through the coverage mask, or records it when rendering in tiles.
+func (r *Rasterizer) drawMask(mask *image.Alpha16, rect image.Rectangle, src image.Image, sp image.Point) {
+	if r.antialiasing != AnalyticAntialiasing {
+		// either supersampling or no anti-aliasing, each (sub)pixel is covered when its coverage is at least half
+		for i := 0; i < len(mask.Pix); i += 2 {
+			if mask.Pix[i] < 0x80 {
+				mask.Pix[i], mask.Pix[i+1] = 0x00, 0x00
+			} else {
+				mask.Pix[i], mask.Pix[i+1] = 0xff, 0xff
+			}
+		}
+	}
+
+	op := tileOp{rect: rect, mask: mask, src: src, sp: sp}
+	if r.ops != nil {
+		*r.ops = append(*r.ops, op)
+		return
+	}
+	op.composite(r.Image, rect)
+}
+
+// drawImage draws an image onto the destination, or records it when rendering in tiles.
+func (r *Rasterizer) drawImage(f func(draw.Image)) {
+	if r.ops != nil {
+		*r.ops = append(*r.ops, tileOp{image: f})
+		return
+	}
+	f(r.Image)
 }
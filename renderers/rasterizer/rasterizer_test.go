@@ -0,0 +1,211 @@
+package rasterizer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/test"
+)
+
+func newTestCanvas(t *testing.T) *canvas.Canvas {
+	family := canvas.NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular); err != nil {
+		test.Error(t, err)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < 16; i++ {
+		img.Set(i%4, i/4, canvas.RGBA(uint8(16*i), 0, 255-uint8(16*i), 0.8))
+	}
+
+	gradient := canvas.NewLinearGradient(canvas.Point{X: 0.0, Y: 0.0}, canvas.Point{X: 40.0, Y: 30.0})
+	gradient.Add(0.0, canvas.Red)
+	gradient.Add(1.0, canvas.RGBA(0, 0, 255, 0.5))
+
+	c := canvas.New(80.0, 60.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetFillColor(canvas.White)
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(80.0, 60.0))
+	ctx.SetFillGradient(gradient)
+	ctx.SetStrokeColor(canvas.RGBA(0, 128, 0, 0.5))
+	ctx.SetStrokeWidth(2.0)
+	ctx.DrawPath(5.0, 5.0, canvas.Circle(20.0))
+	ctx.SetFill(canvas.NewLineHatch(canvas.Black, 30.0, 1.5, 0.3))
+	ctx.SetStroke(canvas.Transparent)
+	ctx.DrawPath(40.0, 10.0, canvas.RegularPolygon(6, 15.0, true))
+	ctx.DrawImage(30.0, 30.0, img, canvas.DPMM(0.2))
+	ctx.SetFillColor(canvas.RGBA(255, 0, 0, 0.3))
+	ctx.DrawPath(35.0, 25.0, canvas.Rectangle(30.0, 20.0))
+	ctx.DrawText(10.0, 50.0, canvas.NewTextLine(family.Face(24.0, canvas.Black, canvas.FontRegular, canvas.FontNormal, canvas.FontUnderline), "Tiles", canvas.Left))
+	return c
+}
+
+func TestDrawTiled(t *testing.T) {
+	c := newTestCanvas(t)
+	for _, colorSpace := range []canvas.ColorSpace{canvas.LinearColorSpace{}, canvas.SRGBColorSpace{}} {
+		img := Draw(c, canvas.DPMM(5.0), colorSpace)
+		for _, tileSize := range []int{1, 17, 64, 1000} {
+			imgTiled := DrawWithOptions(c, canvas.DPMM(5.0), colorSpace, &Options{TileSize: tileSize})
+			test.T(t, imgTiled.Bounds(), img.Bounds())
+			test.That(t, bytes.Equal(imgTiled.Pix, img.Pix), "tile size", tileSize, "differs from serial rasterization")
+		}
+	}
+}
+
+func TestAntialiasing(t *testing.T) {
+	// two adjacent triangles that share a diagonal edge
+	c := canvas.New(10.0, 10.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetFillColor(canvas.Black)
+	ctx.DrawPath(0.0, 0.0, canvas.MustParseSVGPath("M0 0L10 0L10 10z"))
+	ctx.DrawPath(0.0, 0.0, canvas.MustParseSVGPath("M0 0L10 10L0 10z"))
+
+	img := Draw(c, canvas.DPMM(1.0), canvas.LinearColorSpace{})
+	test.That(t, img.RGBAAt(3, 6).A < 0xff, "analytic anti-aliasing shows a seam")
+
+	for _, aa := range []Antialiasing{Supersampling, NoAntialiasing} {
+		for _, tileSize := range []int{0, 3} {
+			img := DrawWithOptions(c, canvas.DPMM(1.0), canvas.LinearColorSpace{}, &Options{TileSize: tileSize, Antialiasing: aa})
+			for i := 0; i < len(img.Pix); i += 4 {
+				test.T(t, img.Pix[i+3], uint8(0xff), aa, "has a seam")
+			}
+		}
+	}
+
+	// a half-covered pixel column
+	c = canvas.New(2.0, 1.0)
+	ctx = canvas.NewContext(c)
+	ctx.SetFillColor(canvas.Black)
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(0.75, 1.0))
+
+	img = DrawWithOptions(c, canvas.DPMM(1.0), canvas.LinearColorSpace{}, &Options{Antialiasing: NoAntialiasing})
+	test.T(t, img.RGBAAt(0, 0).A, uint8(0xff))
+	test.T(t, img.RGBAAt(1, 0).A, uint8(0x00))
+
+	img = DrawWithOptions(c, canvas.DPMM(1.0), canvas.LinearColorSpace{}, &Options{Antialiasing: Supersampling, Samples: 4})
+	test.T(t, img.RGBAAt(0, 0).A, uint8(0xbf)) // 12 out of 16 samples
+	test.T(t, img.RGBAAt(1, 0).A, uint8(0x00))
+
+	ras := NewWithOptions(2.0, 1.0, canvas.DPMM(1.0), canvas.LinearColorSpace{}, &Options{Antialiasing: Supersampling, Samples: 2})
+	ras.RenderPath(canvas.Rectangle(1.5, 1.0), canvas.DefaultStyle, canvas.Identity)
+	ras.Close()
+	test.T(t, ras.Bounds(), image.Rect(0, 0, 2, 1))
+	test.T(t, ras.Image.(*image.RGBA).RGBAAt(1, 0).A, uint8(0x80))
+}
+
+func TestDrawRGBA64(t *testing.T) {
+	c := newTestCanvas(t)
+	img := DrawRGBA64(c, canvas.DPMM(5.0), canvas.SRGBColorSpace{}, nil)
+	imgTiled := DrawRGBA64(c, canvas.DPMM(5.0), canvas.SRGBColorSpace{}, &Options{TileSize: 17})
+	test.That(t, bytes.Equal(imgTiled.Pix, img.Pix), "tiled differs from serial rasterization")
+
+	// dark gradient keeps more levels than 8 bits per channel
+	gradient := canvas.NewLinearGradient(canvas.Point{X: 0.0, Y: 0.0}, canvas.Point{X: 256.0, Y: 0.0})
+	gradient.Add(0.0, canvas.Black)
+	gradient.Add(1.0, canvas.RGB(8, 8, 8))
+
+	c = canvas.New(256.0, 1.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetFillGradient(gradient)
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(256.0, 1.0))
+
+	levels := map[uint16]bool{}
+	img = DrawRGBA64(c, canvas.DPMM(1.0), canvas.SRGBColorSpace{}, nil)
+	for i := 0; i < 256; i++ {
+		levels[img.RGBA64At(i, 0).R] = true
+	}
+	test.That(t, 8 < len(levels), "only", len(levels), "levels")
+
+	// dithering of a value in between two 8-bit levels
+	src := image.NewRGBA64(image.Rect(0, 0, 16, 16))
+	for i := 0; i < 16*16; i++ {
+		src.SetRGBA64(i%16, i/16, color.RGBA64{0x0180, 0x0180, 0x0180, 0xffff})
+	}
+	for _, dithering := range []Dithering{OrderedDithering, FloydSteinbergDithering} {
+		dst := Dither(src, dithering)
+		sum := 0
+		for i := 0; i < len(dst.Pix); i += 4 {
+			test.That(t, dst.Pix[i] == 1 || dst.Pix[i] == 2, dithering, "gives", dst.Pix[i])
+			test.T(t, dst.Pix[i+3], uint8(0xff))
+			sum += int(dst.Pix[i])
+		}
+		test.Float(t, math.Round(float64(sum)/256.0*2.0)/2.0, 1.5, dithering) // 0x0180/257 ≈ 1.49
+	}
+	test.T(t, Dither(src, NoDithering).RGBAAt(0, 0), color.RGBA{1, 1, 1, 0xff})
+}
+
+func TestRenderImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, canvas.Red)
+	img.Set(1, 0, canvas.Green)
+	img.Set(0, 1, canvas.Blue)
+	img.Set(1, 1, canvas.White)
+
+	// integer translation
+	ras := New(4.0, 4.0, canvas.DPMM(1.0), nil)
+	ras.RenderImage(img, canvas.Identity.Translate(1.0, 1.0))
+	test.T(t, ras.At(1, 1), color.Color(canvas.Red))
+	test.T(t, ras.At(2, 2), color.Color(canvas.White))
+	test.T(t, ras.At(0, 0), color.Color(color.RGBA{}))
+
+	// axis-aligned scale with nearest neighbor
+	ras = New(4.0, 4.0, canvas.DPMM(1.0), nil)
+	ras.RenderImage(canvas.WithInterpolation(img, canvas.NearestInterpolation), canvas.Identity.Scale(2.0, 2.0))
+	test.T(t, ras.At(0, 0), color.Color(canvas.Red))
+	test.T(t, ras.At(1, 1), color.Color(canvas.Red))
+	test.T(t, ras.At(2, 1), color.Color(canvas.Green))
+	test.T(t, ras.At(3, 3), color.Color(canvas.White))
+
+	// general transformation off pixel boundaries
+	c := canvas.New(4.0, 4.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetImageInterpolation(canvas.NearestInterpolation)
+	ctx.DrawImage(0.25, 0.25, img, canvas.DPMM(1.0))
+	imgNearest := Draw(c, canvas.DPMM(2.0), nil)
+	test.T(t, imgNearest.At(1, 4), color.Color(canvas.Red))
+	test.T(t, imgNearest.At(3, 6), color.Color(canvas.White))
+
+	for _, interpolation := range []canvas.Interpolation{canvas.BilinearInterpolation, canvas.BicubicInterpolation, canvas.LanczosInterpolation, canvas.AreaInterpolation} {
+		ras = New(4.0, 4.0, canvas.DPMM(1.0), nil)
+		ras.RenderImage(canvas.WithInterpolation(img, interpolation), canvas.Identity.Translate(0.5, 0.5))
+		_, _, _, a := ras.At(2, 2).RGBA()
+		test.That(t, 0 < a, interpolation, "draws nothing")
+	}
+}
+
+func TestRenderFilter(t *testing.T) {
+	group := canvas.New(20.0, 20.0)
+	ctx := canvas.NewContext(group)
+	ctx.DrawPath(4.0, 10.0, canvas.Rectangle(6.0, 6.0))
+
+	c := canvas.New(20.0, 20.0)
+	c.RenderFilter(group, canvas.DropShadow(4.0, -4.0, 0.0, canvas.Red), canvas.Identity)
+	img := Draw(c, canvas.DPMM(1.0), nil)
+	test.T(t, img.At(5, 5), color.Color(canvas.Black))
+	test.T(t, img.At(12, 12), color.Color(canvas.Red))
+	test.T(t, img.At(1, 1), color.Color(color.RGBA{}))
+
+	// blurred shadow equals for tiled rasterization
+	c = canvas.New(20.0, 20.0)
+	c.RenderFilter(group, canvas.DropShadow(4.0, -4.0, 1.0, canvas.Red), canvas.Identity)
+	img = Draw(c, canvas.DPMM(1.0), nil)
+	test.T(t, img.At(5, 5), color.Color(canvas.Black))
+	test.That(t, 0 < img.RGBAAt(11, 11).A && img.RGBAAt(11, 11).A < 255, "shadow is not blurred")
+	test.That(t, 0 < img.RGBAAt(14, 12).A, "shadow is not blurred")
+	imgTiled := DrawWithOptions(c, canvas.DPMM(1.0), nil, &Options{TileSize: 7})
+	test.That(t, bytes.Equal(imgTiled.Pix, img.Pix), "differs from serial rasterization")
+
+	// color matrix
+	ctx.SetFillColor(canvas.Red)
+	ctx.DrawPath(10.0, 0.0, canvas.Rectangle(4.0, 4.0))
+	c = canvas.New(20.0, 20.0)
+	c.RenderFilter(group, &canvas.Filter{Primitives: []canvas.FilterPrimitive{{Effect: canvas.SaturateColorMatrix(0.0)}}}, canvas.Identity)
+	img = Draw(c, canvas.DPMM(1.0), nil)
+	col := img.RGBAAt(12, 18)
+	test.T(t, col.A, uint8(255))
+	test.That(t, col.R == col.G && col.G == col.B && 0 < col.R, "color is not gray:", col)
+}
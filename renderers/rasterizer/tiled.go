@@ -0,0 +1,194 @@
+package rasterizer
+
+import (
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tdewolff/canvas"
+	"golang.org/x/image/draw"
+)
+
+// tileOp is a recorded draw operation, which is either a coverage mask of a path that is composited with a source image, or an image that is drawn onto the destination.
+type tileOp struct {
+	// path
+	rect image.Rectangle
+	mask *image.Alpha16
+	src  image.Image
+	sp   image.Point
+
+	// image
+	image func(draw.Image)
+}
+
+// composite composites the path's coverage mask within the tile. It uses the same arithmetic as golang.org/x/image/vector so that the result is identical to rasterizing serially.
+func (op tileOp) composite(dst draw.Image, tile image.Rectangle) {
+	r := op.rect.Intersect(tile)
+	if r.Empty() {
+		return
+	}
+
+	if dst, ok := dst.(*image.RGBA); ok {
+		if src, ok := op.src.(*image.Uniform); ok {
+			op.compositeUniform(dst, r, src)
+			return
+		}
+	}
+
+	out := color.RGBA64{}
+	outc := color.Color(&out)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sr, sg, sb, sa := op.src.At(op.sp.X+x-op.rect.Min.X, op.sp.Y+y-op.rect.Min.Y).RGBA()
+			ma := uint32(op.mask.Alpha16At(x, y).A)
+
+			dr, dg, db, da := dst.At(x, y).RGBA()
+			a := 0xffff - (sa * ma / 0xffff)
+			out.R = uint16((dr*a + sr*ma) / 0xffff)
+			out.G = uint16((dg*a + sg*ma) / 0xffff)
+			out.B = uint16((db*a + sb*ma) / 0xffff)
+			out.A = uint16((da*a + sa*ma) / 0xffff)
+			dst.Set(x, y, outc)
+		}
+	}
+}
+
+func (op tileOp) compositeUniform(dst *image.RGBA, r image.Rectangle, src *image.Uniform) {
+	sr, sg, sb, sa := src.RGBA()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			ma := uint32(op.mask.Alpha16At(x, y).A)
+			a := 0xffff - (sa * ma / 0xffff)
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(((uint32(dst.Pix[i+0])*0x101*a + sr*ma) / 0xffff) >> 8)
+			dst.Pix[i+1] = uint8(((uint32(dst.Pix[i+1])*0x101*a + sg*ma) / 0xffff) >> 8)
+			dst.Pix[i+2] = uint8(((uint32(dst.Pix[i+2])*0x101*a + sb*ma) / 0xffff) >> 8)
+			dst.Pix[i+3] = uint8(((uint32(dst.Pix[i+3])*0x101*a + sa*ma) / 0xffff) >> 8)
+		}
+	}
+}
+
+// tileLayer is a layer of the canvas that is yet to be rasterized.
+type tileLayer struct {
+	path   *canvas.Path
+	style  canvas.Style
+	text   *canvas.Text
+	img    image.Image
+	group  *canvas.Canvas
+	filter *canvas.Filter
+	m      canvas.Matrix
+}
+
+// tileRecorder is a renderer that records the layers of a canvas in order.
+type tileRecorder struct {
+	w, h   float64
+	layers []tileLayer
+}
+
+func (r *tileRecorder) Size() (float64, float64) {
+	return r.w, r.h
+}
+
+func (r *tileRecorder) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	r.layers = append(r.layers, tileLayer{path: path, style: style, m: m})
+}
+
+func (r *tileRecorder) RenderText(text *canvas.Text, m canvas.Matrix) {
+	r.layers = append(r.layers, tileLayer{text: text, m: m})
+}
+
+func (r *tileRecorder) RenderImage(img image.Image, m canvas.Matrix) {
+	r.layers = append(r.layers, tileLayer{img: img, m: m})
+}
+
+func (r *tileRecorder) RenderFilter(group *canvas.Canvas, filter *canvas.Filter, m canvas.Matrix) {
+	r.layers = append(r.layers, tileLayer{group: group, filter: filter, m: m})
+}
+
+// drawTiled rasterizes the canvas using GOMAXPROCS workers. Layers are rasterized concurrently into coverage masks, which are then composited in order for each tile concurrently. Paths are only read from and never modified, so that layers may share path data. Images are drawn serially in between, since their resampling depends on the destination bounds. The rasterizer still needs to be closed.
+func drawTiled(ras *Rasterizer, c *canvas.Canvas, tileSize int) {
+	rec := &tileRecorder{w: c.W, h: c.H}
+	c.RenderTo(rec)
+
+	img := ras.Image
+	bounds := img.Bounds()
+	tiles := []image.Rectangle{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += tileSize {
+		for x := bounds.Min.X; x < bounds.Max.X; x += tileSize {
+			tiles = append(tiles, image.Rect(x, y, x+tileSize, y+tileSize).Intersect(bounds))
+		}
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	composite := func(ops []tileOp) {
+		if len(ops) == 0 {
+			return
+		}
+		parallel(len(tiles), workers, func(i int) {
+			for _, op := range ops {
+				op.composite(img, tiles[i])
+			}
+		})
+	}
+
+	// limit the number of coverage masks held in memory
+	batchSize := 4 * workers
+	for i := 0; i < len(rec.layers); i += batchSize {
+		layers := rec.layers[i:]
+		if batchSize < len(layers) {
+			layers = layers[:batchSize]
+		}
+
+		layerOps := make([][]tileOp, len(layers))
+		parallel(len(layers), workers, func(j int) {
+			r := *ras
+			r.ops = &layerOps[j]
+			l := layers[j]
+			if l.path != nil {
+				r.RenderPath(l.path, l.style, l.m)
+			} else if l.text != nil {
+				r.RenderText(l.text, l.m)
+			} else if l.img != nil {
+				r.RenderImage(l.img, l.m)
+			} else if l.group != nil {
+				r.RenderFilter(l.group, l.filter, l.m)
+			}
+		})
+
+		ops := []tileOp{}
+		for _, jobOps := range layerOps {
+			for _, op := range jobOps {
+				if op.image != nil {
+					composite(ops)
+					ops = ops[:0]
+					op.image(img)
+				} else {
+					ops = append(ops, op)
+				}
+			}
+		}
+		composite(ops)
+	}
+}
+
+// parallel calls f for 0 <= i < n using a number of concurrent workers.
+func parallel(n, workers int, f func(int)) {
+	next := int64(-1)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if n <= i {
+					return
+				}
+				f(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -3,6 +3,7 @@ package rasterizer
 import (
 	"image"
 	"image/color"
+	"math"
 
 	"github.com/tdewolff/canvas"
 	"golang.org/x/image/draw"
@@ -11,16 +12,17 @@ import (
 type colorFunc func(color.Color) color.RGBA
 
 func changeColorSpace(dst draw.Image, src image.Image, f colorFunc) {
+	bounds := dst.Bounds()
 	if dstRGBA, ok := dst.(*image.RGBA); ok {
-		for j := 0; j < dst.Bounds().Max.Y; j++ {
-			for i := 0; i < dst.Bounds().Max.X; i++ {
+		for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+			for i := bounds.Min.X; i < bounds.Max.X; i++ {
 				// TODO: parallelize
 				dstRGBA.SetRGBA(i, j, f(src.At(i, j)))
 			}
 		}
 	} else {
-		for j := 0; j < dst.Bounds().Max.Y; j++ {
-			for i := 0; i < dst.Bounds().Max.X; i++ {
+		for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+			for i := bounds.Min.X; i < bounds.Max.X; i++ {
 				// TODO: parallelize
 				dst.Set(i, j, f(src.At(i, j)))
 			}
@@ -28,6 +30,127 @@ func changeColorSpace(dst draw.Image, src image.Image, f colorFunc) {
 	}
 }
 
+func changeColorSpace64(dst draw.Image, src image.Image, f func(color.Color) color.RGBA64) {
+	bounds := dst.Bounds()
+	if dstRGBA64, ok := dst.(*image.RGBA64); ok {
+		for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+			for i := bounds.Min.X; i < bounds.Max.X; i++ {
+				dstRGBA64.SetRGBA64(i, j, f(src.At(i, j)))
+			}
+		}
+	} else {
+		for j := bounds.Min.Y; j < bounds.Max.Y; j++ {
+			for i := bounds.Min.X; i < bounds.Max.X; i++ {
+				dst.Set(i, j, f(src.At(i, j)))
+			}
+		}
+	}
+}
+
+// imageInterpolator returns the resampling kernel for an interpolation hint.
+func imageInterpolator(interpolation canvas.Interpolation) draw.Interpolator {
+	switch interpolation {
+	case canvas.NearestInterpolation:
+		return draw.NearestNeighbor
+	case canvas.BilinearInterpolation:
+		return draw.BiLinear
+	case canvas.LanczosInterpolation:
+		return lanczos
+	case canvas.AreaInterpolation:
+		return area
+	}
+	return draw.CatmullRom
+}
+
+// lanczos is the Lanczos-3 kernel.
+var lanczos = &draw.Kernel{Support: 3.0, At: func(t float64) float64 {
+	if t == 0.0 {
+		return 1.0
+	} else if 3.0 <= math.Abs(t) {
+		return 0.0
+	}
+	t *= math.Pi
+	return 3.0 * math.Sin(t) * math.Sin(t/3.0) / (t * t)
+}}
+
+// area is the box kernel, which averages the covered source pixels when downscaling since kernels are stretched by the scale factor. The support is slightly larger than the box so that source pixels exactly halfway are included.
+var area = &draw.Kernel{Support: 0.5 + 1e-6, At: func(t float64) float64 {
+	if math.Abs(t) <= 0.5 {
+		return 1.0
+	}
+	return 0.0
+}}
+
+func isInteger(f float64) bool {
+	return math.Abs(f-math.Round(f)) < 1e-6
+}
+
+// upsample returns an image that is n times larger than src along each axis, where each pixel of src is repeated over n×n pixels. The image has 16 bits per channel if src has.
+func upsample(src image.Image, n int) draw.Image {
+	bounds := src.Bounds()
+	rect := image.Rect(0, 0, n*bounds.Dx(), n*bounds.Dy())
+	var dst draw.Image
+	if _, ok := src.(*image.RGBA64); ok {
+		dst = image.NewRGBA64(rect)
+	} else {
+		dst = image.NewRGBA(rect)
+	}
+	for j := 0; j < bounds.Dy(); j++ {
+		for i := 0; i < bounds.Dx(); i++ {
+			c := src.At(bounds.Min.X+i, bounds.Min.Y+j)
+			if _, _, _, a := c.RGBA(); a == 0 {
+				continue
+			}
+			for y := n * j; y < n*(j+1); y++ {
+				for x := n * i; x < n*(i+1); x++ {
+					dst.Set(x, y, c)
+				}
+			}
+		}
+	}
+	return dst
+}
+
+// downsample averages each block of n×n pixels of src into a pixel of dst, which is a box filter.
+func downsample(dst draw.Image, src image.Image, n int) {
+	bounds := dst.Bounds()
+	nn := uint32(n * n)
+	if srcRGBA, ok := src.(*image.RGBA); ok {
+		for j := 0; j < bounds.Dy(); j++ {
+			for i := 0; i < bounds.Dx(); i++ {
+				var r, g, b, a uint32
+				for y := n * j; y < n*(j+1); y++ {
+					for x := n * i; x < n*(i+1); x++ {
+						k := srcRGBA.PixOffset(x, y)
+						r += uint32(srcRGBA.Pix[k+0])
+						g += uint32(srcRGBA.Pix[k+1])
+						b += uint32(srcRGBA.Pix[k+2])
+						a += uint32(srcRGBA.Pix[k+3])
+					}
+				}
+				dst.Set(bounds.Min.X+i, bounds.Min.Y+j, color.RGBA{uint8((r + nn/2) / nn), uint8((g + nn/2) / nn), uint8((b + nn/2) / nn), uint8((a + nn/2) / nn)})
+			}
+		}
+		return
+	}
+
+	for j := 0; j < bounds.Dy(); j++ {
+		for i := 0; i < bounds.Dx(); i++ {
+			var r, g, b, a uint32
+			for y := n * j; y < n*(j+1); y++ {
+				for x := n * i; x < n*(i+1); x++ {
+					sr, sg, sb, sa := src.At(x, y).RGBA()
+					r += sr
+					g += sg
+					b += sb
+					a += sa
+				}
+			}
+			dst.Set(bounds.Min.X+i, bounds.Min.Y+j, color.RGBA64{uint16((r + nn/2) / nn), uint16((g + nn/2) / nn), uint16((b + nn/2) / nn), uint16((a + nn/2) / nn)})
+		}
+	}
+}
+
 type GradientImage struct {
 	g        canvas.Gradient
 	zp, size image.Point
@@ -55,6 +178,36 @@ func (img *GradientImage) At(x, y int) color.Color {
 	return img.g.At(float64(img.zp.X+x)/img.dpmm, float64(img.size.Y-img.zp.Y-y)/img.dpmm)
 }
 
+// gradientImage64 is a gradient image with 16 bits per channel, which converts the colors to the linear color space itself.
+type gradientImage64 struct {
+	g          canvas.Gradient64
+	colorSpace canvas.ColorSpace
+	zp, size   image.Point
+	dpmm       float64
+}
+
+func newGradientImage64(g canvas.Gradient64, colorSpace canvas.ColorSpace, zp, size image.Point, res canvas.Resolution) *gradientImage64 {
+	return &gradientImage64{
+		g:          g,
+		colorSpace: colorSpace,
+		zp:         zp,
+		size:       size,
+		dpmm:       res.DPMM(),
+	}
+}
+
+func (img *gradientImage64) ColorModel() color.Model {
+	return color.RGBA64Model
+}
+
+func (img *gradientImage64) Bounds() image.Rectangle {
+	return image.Rectangle{image.Point{-1e9, -1e9}, image.Point{1e9, 1e9}}
+}
+
+func (img *gradientImage64) At(x, y int) color.Color {
+	return img.g.At64(float64(img.zp.X+x)/img.dpmm, float64(img.size.Y-img.zp.Y-y)/img.dpmm, img.colorSpace)
+}
+
 //func NewPatternImage(p canvas.Pattern, zp, size image.Point, res canvas.Resolution, colorSpace canvas.ColorSpace) *image.RGBA {
 //	img := image.NewRGBA(image.Rect(0, 0, int(float64(size.X)*res.DPMM()+0.5), int(float64(size.Y)*res.DPMM()+0.5)))
 //	ras := FromImage(img, res, colorSpace)
@@ -9,13 +9,20 @@ import (
 	"path/filepath"
 	"strings"
 
-	//webp "github.com/kolesa-team/go-webp/encoder"
 	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/dxf"
+	"github.com/tdewolff/canvas/renderers/emf"
+	"github.com/tdewolff/canvas/renderers/gcode"
+	"github.com/tdewolff/canvas/renderers/hpgl"
+	"github.com/tdewolff/canvas/renderers/lottie"
 	"github.com/tdewolff/canvas/renderers/pdf"
 	"github.com/tdewolff/canvas/renderers/ps"
 	"github.com/tdewolff/canvas/renderers/rasterizer"
 	"github.com/tdewolff/canvas/renderers/svg"
+	"github.com/tdewolff/canvas/renderers/terminal"
 	"github.com/tdewolff/canvas/renderers/tex"
+	"github.com/tdewolff/canvas/renderers/webp"
+	"github.com/tdewolff/canvas/renderers/xps"
 	"golang.org/x/image/bmp"
 	"golang.org/x/image/tiff"
 )
@@ -36,8 +43,8 @@ func Write(filename string, c *canvas.Canvas, opts ...interface{}) error {
 		return c.WriteFile(filename, TIFF(opts...))
 	case ".bmp":
 		return c.WriteFile(filename, BMP(opts...))
-	//case ".webp":
-	//	return c.WriteFile(filename, WEBP(opts...))
+	case ".webp":
+		return c.WriteFile(filename, WEBP(opts...))
 	case ".svgz":
 		return c.WriteFile(filename, SVGZ(opts...))
 	case ".svg":
@@ -50,6 +57,16 @@ func Write(filename string, c *canvas.Canvas, opts ...interface{}) error {
 		return c.WriteFile(filename, PS(opts...))
 	case ".eps":
 		return c.WriteFile(filename, EPS(opts...))
+	case ".emf":
+		return c.WriteFile(filename, EMF(opts...))
+	case ".xps", ".oxps":
+		return c.WriteFile(filename, XPS(opts...))
+	case ".dxf":
+		return c.WriteFile(filename, DXF(opts...))
+	case ".hpgl", ".plt":
+		return c.WriteFile(filename, HPGL(opts...))
+	case ".gcode", ".nc":
+		return c.WriteFile(filename, GCode(opts...))
 	default:
 		return fmt.Errorf("unknown file extension: %v", ext)
 	}
@@ -65,18 +82,24 @@ func errorWriter(err error) canvas.Writer {
 func PNG(opts ...interface{}) canvas.Writer {
 	resolution := canvas.DPMM(1.0)
 	colorSpace := canvas.DefaultColorSpace
+	var rasterOptions *rasterizer.Options
 	for _, opt := range opts {
 		switch o := opt.(type) {
 		case canvas.Resolution:
 			resolution = o
 		case canvas.ColorSpace:
 			colorSpace = o
+		case *rasterizer.Options:
+			rasterOptions = o
 		default:
 			return errorWriter(fmt.Errorf("unknown option: %v", opt))
 		}
 	}
 	return func(w io.Writer, c *canvas.Canvas) error {
-		img := rasterizer.Draw(c, resolution, colorSpace)
+		if rasterOptions != nil && rasterOptions.BitDepth == 16 {
+			return png.Encode(w, rasterizer.DrawRGBA64(c, resolution, colorSpace, rasterOptions))
+		}
+		img := rasterizer.DrawWithOptions(c, resolution, colorSpace, rasterOptions)
 		return png.Encode(w, img)
 	}
 }
@@ -84,6 +107,7 @@ func PNG(opts ...interface{}) canvas.Writer {
 func JPEG(opts ...interface{}) canvas.Writer {
 	resolution := canvas.DPMM(1.0)
 	colorSpace := canvas.DefaultColorSpace
+	var rasterOptions *rasterizer.Options
 	var options *jpeg.Options
 	for _, opt := range opts {
 		switch o := opt.(type) {
@@ -91,6 +115,8 @@ func JPEG(opts ...interface{}) canvas.Writer {
 			resolution = o
 		case canvas.ColorSpace:
 			colorSpace = o
+		case *rasterizer.Options:
+			rasterOptions = o
 		case *jpeg.Options:
 			options = o
 		default:
@@ -98,7 +124,7 @@ func JPEG(opts ...interface{}) canvas.Writer {
 		}
 	}
 	return func(w io.Writer, c *canvas.Canvas) error {
-		img := rasterizer.Draw(c, resolution, colorSpace)
+		img := rasterizer.DrawWithOptions(c, resolution, colorSpace, rasterOptions)
 		return jpeg.Encode(w, img, options)
 	}
 }
@@ -106,6 +132,7 @@ func JPEG(opts ...interface{}) canvas.Writer {
 func GIF(opts ...interface{}) canvas.Writer {
 	resolution := canvas.DPMM(1.0)
 	colorSpace := canvas.DefaultColorSpace
+	var rasterOptions *rasterizer.Options
 	var options *gif.Options
 	for _, opt := range opts {
 		switch o := opt.(type) {
@@ -113,6 +140,8 @@ func GIF(opts ...interface{}) canvas.Writer {
 			resolution = o
 		case canvas.ColorSpace:
 			colorSpace = o
+		case *rasterizer.Options:
+			rasterOptions = o
 		case *gif.Options:
 			options = o
 		default:
@@ -120,7 +149,7 @@ func GIF(opts ...interface{}) canvas.Writer {
 		}
 	}
 	return func(w io.Writer, c *canvas.Canvas) error {
-		img := rasterizer.Draw(c, resolution, colorSpace)
+		img := rasterizer.DrawWithOptions(c, resolution, colorSpace, rasterOptions)
 		return gif.Encode(w, img, options)
 	}
 }
@@ -128,6 +157,7 @@ func GIF(opts ...interface{}) canvas.Writer {
 func TIFF(opts ...interface{}) canvas.Writer {
 	resolution := canvas.DPMM(1.0)
 	colorSpace := canvas.DefaultColorSpace
+	var rasterOptions *rasterizer.Options
 	var options *tiff.Options
 	for _, opt := range opts {
 		switch o := opt.(type) {
@@ -135,6 +165,8 @@ func TIFF(opts ...interface{}) canvas.Writer {
 			resolution = o
 		case canvas.ColorSpace:
 			colorSpace = o
+		case *rasterizer.Options:
+			rasterOptions = o
 		case *tiff.Options:
 			options = o
 		default:
@@ -142,7 +174,10 @@ func TIFF(opts ...interface{}) canvas.Writer {
 		}
 	}
 	return func(w io.Writer, c *canvas.Canvas) error {
-		img := rasterizer.Draw(c, resolution, colorSpace)
+		if rasterOptions != nil && rasterOptions.BitDepth == 16 {
+			return tiff.Encode(w, rasterizer.DrawRGBA64(c, resolution, colorSpace, rasterOptions), options)
+		}
+		img := rasterizer.DrawWithOptions(c, resolution, colorSpace, rasterOptions)
 		return tiff.Encode(w, img, options)
 	}
 }
@@ -150,47 +185,46 @@ func TIFF(opts ...interface{}) canvas.Writer {
 func BMP(opts ...interface{}) canvas.Writer {
 	resolution := canvas.DPMM(1.0)
 	colorSpace := canvas.DefaultColorSpace
+	var rasterOptions *rasterizer.Options
 	for _, opt := range opts {
 		switch o := opt.(type) {
 		case canvas.Resolution:
 			resolution = o
 		case canvas.ColorSpace:
 			colorSpace = o
+		case *rasterizer.Options:
+			rasterOptions = o
 		default:
 			return errorWriter(fmt.Errorf("unknown option: %v", opt))
 		}
 	}
 	return func(w io.Writer, c *canvas.Canvas) error {
-		img := rasterizer.Draw(c, resolution, colorSpace)
+		img := rasterizer.DrawWithOptions(c, resolution, colorSpace, rasterOptions)
 		return bmp.Encode(w, img)
 	}
 }
 
-//func WEBP(opts ...interface{}) canvas.Writer {
-//	options := &webp.Options{}
-//	resolution := canvas.DPMM(1.0)
-//	colorSpace := canvas.DefaultColorSpace
-//	for _, opt := range opts {
-//		switch o := opt.(type) {
-//		case *webp.Options:
-//			options = o
-//		case canvas.Resolution:
-//			resolution = o
-//		case canvas.ColorSpace:
-//			colorSpace = o
-//		default:
-//			return errorWriter(fmt.Errorf("unknown option: %v", opt))
-//		}
-//	}
-//	return func(w io.Writer, c *canvas.Canvas) error {
-//		img := rasterizer.Draw(c, resolution, colorSpace)
-//		enc, err := webp.NewEncoder(img, options)
-//		if err != nil {
-//			return err
-//		}
-//		return enc.Encode(w)
-//	}
-//}
+func WEBP(opts ...interface{}) canvas.Writer {
+	resolution := canvas.DPMM(1.0)
+	colorSpace := canvas.DefaultColorSpace
+	var rasterOptions *rasterizer.Options
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case canvas.Resolution:
+			resolution = o
+		case canvas.ColorSpace:
+			colorSpace = o
+		case *rasterizer.Options:
+			rasterOptions = o
+		default:
+			return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, c *canvas.Canvas) error {
+		img := rasterizer.DrawWithOptions(c, resolution, colorSpace, rasterOptions)
+		return webp.Encode(w, img)
+	}
+}
 
 func SVGZ(opts ...interface{}) canvas.Writer {
 	var options *svg.Options
@@ -250,12 +284,138 @@ func PDF(opts ...interface{}) canvas.Writer {
 	}
 }
 
+func EMF(opts ...interface{}) canvas.Writer {
+	var options *emf.Options
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *emf.Options:
+			options = o
+		default:
+			return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, c *canvas.Canvas) error {
+		emf := emf.New(w, c.W, c.H, options)
+		c.RenderTo(emf)
+		return emf.Close()
+	}
+}
+
+func XPS(opts ...interface{}) canvas.Writer {
+	var options *xps.Options
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *xps.Options:
+			options = o
+		default:
+			return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, c *canvas.Canvas) error {
+		xps := xps.New(w, c.W, c.H, options)
+		c.RenderTo(xps)
+		return xps.Close()
+	}
+}
+
+func Lottie(opts ...interface{}) canvas.Writer {
+	var options *lottie.Options
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *lottie.Options:
+			options = o
+		default:
+			return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, c *canvas.Canvas) error {
+		lottie := lottie.New(w, c.W, c.H, options)
+		c.RenderTo(lottie)
+		return lottie.Close()
+	}
+}
+
+func DXF(opts ...interface{}) canvas.Writer {
+	var options *dxf.Options
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *dxf.Options:
+			options = o
+		default:
+			return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, c *canvas.Canvas) error {
+		dxf := dxf.New(w, c.W, c.H, options)
+		c.RenderTo(dxf)
+		return dxf.Close()
+	}
+}
+
+func HPGL(opts ...interface{}) canvas.Writer {
+	var options *hpgl.Options
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *hpgl.Options:
+			options = o
+		default:
+			return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, c *canvas.Canvas) error {
+		hpgl := hpgl.New(w, c.W, c.H, options)
+		c.RenderTo(hpgl)
+		return hpgl.Close()
+	}
+}
+
+func GCode(opts ...interface{}) canvas.Writer {
+	var options *gcode.Options
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *gcode.Options:
+			options = o
+		default:
+			return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, c *canvas.Canvas) error {
+		gcode := gcode.New(w, c.W, c.H, options)
+		c.RenderTo(gcode)
+		return gcode.Close()
+	}
+}
+
+// Terminal returns a writer that displays the canvas in the terminal, such as os.Stdout, see terminal.Terminal.
+func Terminal(opts ...interface{}) canvas.Writer {
+	var options *terminal.Options
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case *terminal.Options:
+			options = o
+		default:
+			return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
+	}
+	return func(w io.Writer, c *canvas.Canvas) error {
+		terminal := terminal.New(w, c.W, c.H, options)
+		c.RenderTo(terminal)
+		return terminal.Close()
+	}
+}
+
 func TeX(opts ...interface{}) canvas.Writer {
+	var options *tex.Options
 	for _, opt := range opts {
-		return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		switch o := opt.(type) {
+		case *tex.Options:
+			options = o
+		default:
+			return errorWriter(fmt.Errorf("unknown option: %v", opt))
+		}
 	}
 	return func(w io.Writer, c *canvas.Canvas) error {
-		tex := tex.New(w, c.W, c.H)
+		tex := tex.NewWithOptions(w, c.W, c.H, options)
 		c.RenderTo(tex)
 		return tex.Close()
 	}
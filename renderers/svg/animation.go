@@ -0,0 +1,87 @@
+package svg
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tdewolff/canvas"
+)
+
+// RenderFrames renders a sequence of canvases as an animation, where each frame is shown for its delay. Each frame is wrapped in a group of which the visibility is switched using SMIL animations, or using CSS keyframes if keyframes is set. The animation is repeated loopCount times, or indefinitely if loopCount is zero, after which the last frame remains visible. Viewers that do not support animations show the first frame.
+func (r *SVG) RenderFrames(frames []*canvas.Canvas, delays []time.Duration, loopCount int, keyframes bool) {
+	if len(frames) == 0 {
+		return
+	} else if len(frames) == 1 {
+		frames[0].RenderTo(r)
+		return
+	}
+
+	total := time.Duration(0)
+	for _, delay := range delays {
+		total += delay
+	}
+	if total <= 0 {
+		frames[len(frames)-1].RenderTo(r)
+		return
+	}
+	dur := dec(total.Seconds())
+	repeat := "indefinite"
+	iterations := "infinite"
+	if 0 < loopCount {
+		repeat = fmt.Sprintf("%d", loopCount)
+		iterations = repeat
+	}
+
+	if keyframes {
+		fmt.Fprintf(r.w, `<style>`)
+	}
+	start := time.Duration(0)
+	for i := range frames {
+		end := start + delays[i]
+		t0, t1 := dec(100.0*start.Seconds()/total.Seconds()), dec(100.0*end.Seconds()/total.Seconds())
+		if keyframes {
+			fmt.Fprintf(r.w, `@keyframes frame%d{`, i)
+			if i == 0 {
+				fmt.Fprintf(r.w, `0%%{visibility:visible}`)
+			} else {
+				fmt.Fprintf(r.w, `0%%{visibility:hidden}%v%%{visibility:visible}`, t0)
+			}
+			if i == len(frames)-1 {
+				fmt.Fprintf(r.w, `100%%{visibility:visible}}`)
+			} else {
+				fmt.Fprintf(r.w, `%v%%,100%%{visibility:hidden}}`, t1)
+			}
+			fmt.Fprintf(r.w, `.frame%d{animation:frame%d %vs step-end %s forwards}`, i, i, dur, iterations)
+		}
+		start = end
+	}
+	if keyframes {
+		fmt.Fprintf(r.w, `</style>`)
+	}
+
+	start = 0
+	for i, frame := range frames {
+		end := start + delays[i]
+		visibility := "hidden"
+		if i == 0 {
+			visibility = "visible"
+		}
+		if keyframes {
+			fmt.Fprintf(r.w, `<g class="frame%d" visibility="%s">`, i, visibility)
+		} else {
+			k0, k1 := dec(start.Seconds()/total.Seconds()), dec(end.Seconds()/total.Seconds())
+			fmt.Fprintf(r.w, `<g visibility="%s"><animate attributeName="visibility" calcMode="discrete" dur="%vs" repeatCount="%s" fill="freeze"`, visibility, dur, repeat)
+			if i == 0 {
+				fmt.Fprintf(r.w, ` values="visible;hidden" keyTimes="0;%v"/>`, k1)
+			} else if i == len(frames)-1 {
+				fmt.Fprintf(r.w, ` values="hidden;visible" keyTimes="0;%v"/>`, k0)
+			} else {
+				fmt.Fprintf(r.w, ` values="hidden;visible;hidden" keyTimes="0;%v;%v"/>`, k0, k1)
+			}
+		}
+		frame.RenderTo(r)
+		r.flushPath()
+		fmt.Fprintf(r.w, `</g>`)
+		start = end
+	}
+}
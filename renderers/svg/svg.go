@@ -12,23 +12,32 @@ import (
 	"image/png"
 	"io"
 	"math"
+	"sort"
 	"strings"
 
 	"github.com/tdewolff/canvas"
 	canvasFont "github.com/tdewolff/canvas/font"
 	canvasText "github.com/tdewolff/canvas/text"
+	"github.com/tdewolff/minify/v2"
+	minifyCSS "github.com/tdewolff/minify/v2/css"
+	minifySVG "github.com/tdewolff/minify/v2/svg"
 )
 
 type Options struct {
-	Compression int
-	EmbedFonts  bool
-	SubsetFonts bool
+	Compression    int
+	EmbedFonts     bool
+	SubsetFonts    bool
+	Precision      int  // number of decimals of path coordinates, or zero to use canvas.Precision significant digits
+	ReusePaths     bool // write repeated path data once and reference it with use elements
+	MergePaths     bool // merge consecutive paths with the same opaque style that don't overlap into one path element
+	Minify         bool // minify the output
+	GlyphPositions bool // write the position of each character from text shaping so that text looks the same in all viewers
 	canvas.ImageEncoding
 }
 
 var DefaultOptions = Options{
 	EmbedFonts:    true,
-	SubsetFonts:   false, // TODO: enable when properly handling GPOS and GSUB tables
+	SubsetFonts:   true,
 	ImageEncoding: canvas.Lossless,
 }
 
@@ -39,11 +48,35 @@ type SVG struct {
 	fonts         map[*canvas.Font]bool
 	fontSubset    map[*canvas.Font]*canvas.FontSubsetter
 	maskID        int
-	patterns      map[canvas.Gradient]string
+	filterID      int
+	patterns      map[interface{}]string // gradients and hatch patterns
 	classes       []string
+	paths         map[string]string // path data relative to its start and the ID of its definition
+	pathID        int
+	merge         *svgPath // pending path of merged paths
+	closers       []io.Closer
+	groups        []svgGroup
+	attrs         canvas.Attributes // of the elements that follow
+	elem          canvas.Attributes // of the element being written
+	elemGroup     bool              // element is wrapped in a group with its attributes
+	ids           map[string]bool   // identifiers that were written
+	inText        bool
 	opts          *Options
 }
 
+// svgPath is a path with its attributes.
+type svgPath struct {
+	path   *canvas.Path
+	attrs  string
+	bounds canvas.Rect
+}
+
+// svgGroup is a group started by PushGroup, which is written when its first element is drawn.
+type svgGroup struct {
+	attrs   canvas.Attributes
+	written bool
+}
+
 // New returns a scalable vector graphics (SVG) renderer.
 func New(w io.Writer, width, height float64, opts *Options) *SVG {
 	if opts == nil {
@@ -51,11 +84,22 @@ func New(w io.Writer, width, height float64, opts *Options) *SVG {
 		opts = &defaultOptions
 	}
 
+	closers := []io.Closer{}
 	if opts.Compression != 0 {
 		if opts.Compression < gzip.HuffmanOnly || gzip.BestCompression < opts.Compression {
 			opts.Compression = -1
 		}
-		w, _ = gzip.NewWriterLevel(w, opts.Compression)
+		zw, _ := gzip.NewWriterLevel(w, opts.Compression)
+		closers = append(closers, zw)
+		w = zw
+	}
+	if opts.Minify {
+		m := minify.New()
+		m.AddFunc("text/css", minifyCSS.Minify)
+		m.AddFunc("image/svg+xml", minifySVG.Minify)
+		mw := m.Writer("image/svg+xml", w)
+		closers = append([]io.Closer{mw}, closers...)
+		w = mw
 	}
 
 	fmt.Fprintf(w, `<svg version="1.1" width="%vmm" height="%vmm" viewBox="0 0 %v %v" xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">`, dec(width), dec(height), dec(width), dec(height))
@@ -65,19 +109,26 @@ func New(w io.Writer, width, height float64, opts *Options) *SVG {
 		height:     height,
 		fonts:      map[*canvas.Font]bool{},
 		fontSubset: map[*canvas.Font]*canvas.FontSubsetter{},
-		patterns:   map[canvas.Gradient]string{},
+		patterns:   map[interface{}]string{},
+		paths:      map[string]string{},
+		ids:        map[string]bool{},
+		closers:    closers,
 		opts:       opts,
 	}
 }
 
 // Close finished and closes the SVG.
 func (r *SVG) Close() error {
+	r.flushPath()
 	if r.opts.EmbedFonts {
 		r.writeFonts()
 	}
 	_, err := fmt.Fprintf(r.w, "</svg>")
-	if r.opts.Compression != 0 {
-		r.w.(*gzip.Writer).Close() // does not close underlying writer
+	for _, closer := range r.closers {
+		// does not close underlying writer
+		if errClose := closer.Close(); err == nil {
+			err = errClose
+		}
 	}
 	return err
 }
@@ -142,6 +193,158 @@ func (r *SVG) RemoveClass(class string) {
 	}
 }
 
+// PushGroup starts a group with the given attributes. Groups are written when their first element is drawn, so that empty groups are omitted.
+func (r *SVG) PushGroup(attrs canvas.Attributes) {
+	r.flushPath()
+	r.groups = append(r.groups, svgGroup{attrs: attrs})
+	r.attrs = canvas.Attributes{}
+}
+
+// PopGroup ends the last started group.
+func (r *SVG) PopGroup() {
+	if len(r.groups) == 0 {
+		return
+	}
+	r.flushPath()
+	group := r.groups[len(r.groups)-1]
+	r.groups = r.groups[:len(r.groups)-1]
+	if group.written {
+		fmt.Fprintf(r.w, `</g>`)
+		if group.attrs.Href != "" {
+			fmt.Fprintf(r.w, `</a>`)
+		}
+	}
+	r.attrs = canvas.Attributes{}
+}
+
+// SetAttributes sets the attributes of the elements that follow. The identifier and custom data are written as the id and data-* attributes, the title and description as child elements, and links wrap the element in an a element.
+func (r *SVG) SetAttributes(attrs canvas.Attributes) {
+	r.attrs = attrs
+}
+
+// beginElement writes the groups that are yet to be written and the link of the element that follows. The attributes of an element that is written as multiple SVG elements are written to a group around them, otherwise they are written by writeAttributes and closeTag.
+func (r *SVG) beginElement(multiple bool) {
+	if r.inText {
+		return
+	}
+	r.flushPath()
+	for i, group := range r.groups {
+		if !group.written {
+			if group.attrs.Href != "" {
+				fmt.Fprintf(r.w, `<a xlink:href="%s">`, escapeAttr(group.attrs.Href))
+			}
+			fmt.Fprintf(r.w, `<g`)
+			for _, attr := range attributeList(r.uniqueID(group.attrs)) {
+				fmt.Fprintf(r.w, ` %s="%s"`, attr[0], attr[1])
+			}
+			fmt.Fprintf(r.w, `>`)
+			writeTitle(r.w, group.attrs)
+			r.groups[i].written = true
+		}
+	}
+
+	r.elem = r.uniqueID(r.attrs)
+	if r.elem.Href != "" {
+		fmt.Fprintf(r.w, `<a xlink:href="%s">`, escapeAttr(r.elem.Href))
+	}
+	r.elemGroup = false
+	if multiple && (r.elem.ID != "" || r.elem.Title != "" || r.elem.Desc != "" || len(r.elem.Data) != 0) {
+		fmt.Fprintf(r.w, `<g`)
+		for _, attr := range attributeList(r.elem) {
+			fmt.Fprintf(r.w, ` %s="%s"`, attr[0], attr[1])
+		}
+		fmt.Fprintf(r.w, `>`)
+		writeTitle(r.w, r.elem)
+		r.elem = canvas.Attributes{Href: r.elem.Href}
+		r.elemGroup = true
+	}
+}
+
+// endElement ends the element started by beginElement.
+func (r *SVG) endElement() {
+	if r.inText {
+		return
+	}
+	if r.elemGroup {
+		fmt.Fprintf(r.w, `</g>`)
+	}
+	if r.elem.Href != "" {
+		fmt.Fprintf(r.w, `</a>`)
+	}
+	r.elem = canvas.Attributes{}
+}
+
+// writeAttributes writes the identifier and custom data of the element, the start tag must be open within an attribute value.
+func (r *SVG) writeAttributes() {
+	for _, attr := range attributeList(r.elem) {
+		fmt.Fprintf(r.w, `" %s="%s`, attr[0], attr[1])
+	}
+}
+
+// closeTag closes the start tag of an element that is open within an attribute value. The title and description are written as children, and elements without children are self-closed.
+func (r *SVG) closeTag(name string, empty bool) {
+	if r.elem.Title != "" || r.elem.Desc != "" {
+		fmt.Fprintf(r.w, `">`)
+		writeTitle(r.w, r.elem)
+		if empty {
+			fmt.Fprintf(r.w, `</%s>`, name)
+		}
+	} else if empty {
+		fmt.Fprintf(r.w, `"/>`)
+	} else {
+		fmt.Fprintf(r.w, `">`)
+	}
+	r.elem = canvas.Attributes{Href: r.elem.Href} // attributes apply to the first SVG element only
+}
+
+// uniqueID removes the identifier from the attributes if it was written before, so that elements drawn with the same attributes or groups that are split over z-indices don't repeat it.
+func (r *SVG) uniqueID(attrs canvas.Attributes) canvas.Attributes {
+	if attrs.ID != "" {
+		if r.ids[attrs.ID] {
+			attrs.ID = ""
+		} else {
+			r.ids[attrs.ID] = true
+		}
+	}
+	return attrs
+}
+
+// attributeList returns the identifier and custom data as escaped attributes, where custom data is sorted by key.
+func attributeList(attrs canvas.Attributes) [][2]string {
+	list := [][2]string{}
+	if attrs.ID != "" {
+		list = append(list, [2]string{"id", escapeAttr(attrs.ID)})
+	}
+	keys := make([]string, 0, len(attrs.Data))
+	for key := range attrs.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		list = append(list, [2]string{"data-" + key, escapeAttr(attrs.Data[key])})
+	}
+	return list
+}
+
+func writeTitle(w io.Writer, attrs canvas.Attributes) {
+	if attrs.Title != "" {
+		fmt.Fprintf(w, `<title>`)
+		xml.EscapeText(w, []byte(attrs.Title))
+		fmt.Fprintf(w, `</title>`)
+	}
+	if attrs.Desc != "" {
+		fmt.Fprintf(w, `<desc>`)
+		xml.EscapeText(w, []byte(attrs.Desc))
+		fmt.Fprintf(w, `</desc>`)
+	}
+}
+
+func escapeAttr(s string) string {
+	sb := &strings.Builder{}
+	xml.EscapeText(sb, []byte(s))
+	return sb.String()
+}
+
 // SetImageEncoding sets the image encoding to Loss or Lossless.
 func (r *SVG) SetImageEncoding(enc canvas.ImageEncoding) {
 	r.opts.ImageEncoding = enc
@@ -160,10 +363,16 @@ func (r *SVG) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 	if style.HasStroke() && style.Stroke.IsGradient() {
 		r.getPattern(style.Stroke.Gradient)
 	}
-
-	stroke := path
-	path = path.Transform(canvas.Identity.ReflectYAbout(r.height / 2.0).Mul(m))
-	fmt.Fprintf(r.w, `<path d="%s`, path.ToSVG())
+	if style.HasFill() && style.Fill.IsPattern() {
+		if hatch, ok := style.Fill.Pattern.(*canvas.HatchPattern); ok {
+			r.getHatchPattern(hatch)
+		}
+	}
+	if style.HasStroke() && style.Stroke.IsPattern() {
+		if hatch, ok := style.Stroke.Pattern.(*canvas.HatchPattern); ok {
+			r.getHatchPattern(hatch)
+		}
+	}
 
 	strokeUnsupported := false
 	if arcs, ok := style.StrokeJoiner.(canvas.ArcsJoiner); ok && math.IsNaN(arcs.Limit) {
@@ -190,17 +399,20 @@ func (r *SVG) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 		}
 	}
 
+	stroke := path
+	path = path.Transform(canvas.Identity.ReflectYAbout(r.height / 2.0).Mul(m))
+	attrs := &strings.Builder{}
 	if !style.HasStroke() {
 		if style.HasFill() {
 			if !style.Fill.IsColor() || style.Fill.Color != canvas.Black {
-				fmt.Fprintf(r.w, `" fill="`)
-				r.writePaint(r.w, style.Fill)
+				fmt.Fprintf(attrs, `" fill="`)
+				r.writePaint(attrs, style.Fill)
 			}
 			if style.FillRule == canvas.EvenOdd {
-				fmt.Fprintf(r.w, `" fill-rule="evenodd`)
+				fmt.Fprintf(attrs, `" fill-rule="evenodd`)
 			}
 		} else {
-			fmt.Fprintf(r.w, `" fill="none`)
+			fmt.Fprintf(attrs, `" fill="none`)
 		}
 	} else {
 		b := &strings.Builder{}
@@ -257,11 +469,29 @@ func (r *SVG) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 			}
 		}
 		if 0 < b.Len() {
-			fmt.Fprintf(r.w, `" style="%s`, b.String()[1:])
+			fmt.Fprintf(attrs, `" style="%s`, b.String()[1:])
 		}
 	}
-	r.writeClasses(r.w)
-	fmt.Fprintf(r.w, `"/>`)
+	r.writeClasses(attrs)
+
+	if r.opts.MergePaths && !r.inText && !(style.HasStroke() && strokeUnsupported) && r.attrs.Empty() && isOpaque(style) {
+		// paths that overlap may have opposite orientations, which would cut holes when merged
+		bounds := path.FastBounds()
+		if r.merge != nil && r.merge.attrs == attrs.String() && !r.merge.bounds.Overlaps(bounds) {
+			r.merge.path = r.merge.path.Append(path)
+			r.merge.bounds = r.merge.bounds.Add(bounds)
+		} else {
+			r.beginElement(false)
+			r.merge = &svgPath{path, attrs.String(), bounds}
+		}
+		return
+	}
+
+	r.beginElement(style.HasStroke() && strokeUnsupported)
+	name := r.writePath(path)
+	fmt.Fprintf(r.w, "%s", attrs.String())
+	r.writeAttributes()
+	r.closeTag(name, true)
 
 	if style.HasStroke() && strokeUnsupported {
 		// stroke settings unsupported by SVG, draw stroke explicitly
@@ -270,7 +500,7 @@ func (r *SVG) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 		}
 		stroke = stroke.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner, canvas.Tolerance)
 		stroke = stroke.Transform(canvas.Identity.ReflectYAbout(r.height / 2.0).Mul(m))
-		fmt.Fprintf(r.w, `<path d="%s`, stroke.ToSVG())
+		r.writePath(stroke)
 		if !style.Stroke.IsColor() || style.Stroke.Color != canvas.Black {
 			fmt.Fprintf(r.w, `" fill="`)
 			r.writePaint(r.w, style.Stroke)
@@ -281,6 +511,59 @@ func (r *SVG) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 		r.writeClasses(r.w)
 		fmt.Fprintf(r.w, `"/>`)
 	}
+	r.endElement()
+}
+
+// writePath writes the start of a path element with its path data, or of a use element that references the path data when it was written before and ReusePaths is set. It returns the name of the element.
+func (r *SVG) writePath(path *canvas.Path) string {
+	if r.opts.ReusePaths {
+		start := path.StartPos()
+		d := quantize(path.Translate(-start.X, -start.Y), r.opts.Precision).ToSVG()
+		if id, ok := r.paths[d]; ok {
+			if id == "" {
+				r.pathID++
+				id = fmt.Sprintf("p%d", r.pathID)
+				r.paths[d] = id
+				fmt.Fprintf(r.w, `<defs><path id="%s" d="%s"/></defs>`, id, d)
+			}
+			x, y := start.X, start.Y
+			if r.opts.Precision != 0 {
+				x, y = round(x, r.opts.Precision), round(y, r.opts.Precision)
+			}
+			fmt.Fprintf(r.w, `<use xlink:href="#%s`, id)
+			if x != 0.0 {
+				fmt.Fprintf(r.w, `" x="%v`, num(x))
+			}
+			if y != 0.0 {
+				fmt.Fprintf(r.w, `" y="%v`, num(y))
+			}
+			return "use"
+		}
+		r.paths[d] = "" // path data is defined when it is used a second time
+	}
+	fmt.Fprintf(r.w, `<path d="%s`, quantize(path, r.opts.Precision).ToSVG())
+	return "path"
+}
+
+// flushPath writes the pending path of merged paths.
+func (r *SVG) flushPath() {
+	if r.merge == nil {
+		return
+	}
+	merge := r.merge
+	r.merge = nil
+	r.writePath(merge.path)
+	fmt.Fprintf(r.w, `%s"/>`, merge.attrs)
+}
+
+// isOpaque returns true if the fill and stroke are opaque colors and the fill rule is non-zero, so that merging paths that don't overlap doesn't change the result.
+func isOpaque(style canvas.Style) bool {
+	if style.HasFill() && (!style.Fill.IsColor() || style.Fill.Color.A != 255 || style.FillRule == canvas.EvenOdd) {
+		return false
+	} else if style.HasStroke() && (!style.Stroke.IsColor() || style.Stroke.Color.A != 255) {
+		return false
+	}
+	return true
 }
 
 func (r *SVG) writeFontStyle(face, faceMain *canvas.FontFace, rtl bool) {
@@ -365,6 +648,19 @@ func (r *SVG) RenderText(text *canvas.Text, m canvas.Matrix) {
 		return
 	}
 
+	multiple := false
+	text.WalkDecorations(func(canvas.Paint, *canvas.Path) {
+		multiple = true
+	})
+	text.WalkSpans(func(x, y float64, span canvas.TextSpan) {
+		if !span.IsText() {
+			multiple = true
+		}
+	})
+	r.beginElement(multiple)
+	attrs, inText := r.attrs, r.inText
+	r.inText = true
+
 	text.WalkDecorations(func(paint canvas.Paint, p *canvas.Path) {
 		style := canvas.DefaultStyle
 		style.Fill = paint
@@ -378,6 +674,7 @@ func (r *SVG) RenderText(text *canvas.Text, m canvas.Matrix) {
 			}
 		}
 	})
+	r.attrs, r.inText = attrs, inText
 
 	faceMain := text.MostCommonFontFace()
 	x0, y0 := 0.0, 0.0
@@ -414,7 +711,8 @@ func (r *SVG) RenderText(text *canvas.Text, m canvas.Matrix) {
 		}
 	}
 	r.writeClasses(r.w)
-	fmt.Fprintf(r.w, `">`)
+	r.writeAttributes()
+	r.closeTag("text", false)
 
 	text.WalkSpans(func(x, y float64, span canvas.TextSpan) {
 		if span.IsText() {
@@ -428,13 +726,41 @@ func (r *SVG) RenderText(text *canvas.Text, m canvas.Matrix) {
 				glyphID := span.Face.Font.SFNT.GlyphIndex(r)
 				_ = subset.Get(glyphID) // register usage of glyph for subsetting
 			}
+			for _, glyph := range span.Glyphs {
+				_ = subset.Get(glyph.ID) // register glyphs from shaping such as ligatures and vertical forms
+			}
 
-			x += x0
-			y = y0 - y
-			if span.Direction == canvasText.RightToLeft {
-				x += span.Width
+			if r.opts.GlyphPositions && 0 < len(span.Glyphs) {
+				xs, ys := glyphPositions(span)
+				fmt.Fprintf(r.w, `<tspan x="`)
+				for i := range xs {
+					if i != 0 {
+						fmt.Fprintf(r.w, ` `)
+					}
+					fmt.Fprintf(r.w, `%v`, num(x0+x+xs[i]))
+				}
+				fmt.Fprintf(r.w, `" y="`)
+				for i := range ys {
+					if i != 0 {
+						fmt.Fprintf(r.w, ` `)
+					}
+					fmt.Fprintf(r.w, `%v`, num(y0-y-ys[i]))
+				}
+				if text.WritingMode != canvas.HorizontalTB && span.Rotation != canvasText.NoRotation {
+					// sideways glyphs are rotated clockwise by the viewer and placed on the alphabetic baseline like in canvas
+					fmt.Fprintf(r.w, `" dominant-baseline="alphabetic`)
+					if span.Rotation == canvasText.CCW {
+						fmt.Fprintf(r.w, `" rotate="180`)
+					}
+				}
+			} else {
+				x += x0
+				y = y0 - y
+				if span.Direction == canvasText.RightToLeft {
+					x += span.Width
+				}
+				fmt.Fprintf(r.w, `<tspan x="%v" y="%v`, num(x), num(y))
 			}
-			fmt.Fprintf(r.w, `<tspan x="%v" y="%v`, num(x), num(y))
 			r.writeFontStyle(span.Face, faceMain, span.Direction == canvasText.RightToLeft)
 			r.writeClasses(r.w)
 			fmt.Fprintf(r.w, `">`)
@@ -443,6 +769,55 @@ func (r *SVG) RenderText(text *canvas.Text, m canvas.Matrix) {
 		}
 	})
 	fmt.Fprintf(r.w, `</text>`)
+	r.endElement()
+}
+
+// glyphPositions returns the position of each character of a text span relative to the origin of the span. Characters are placed at the position of the cluster of glyphs from shaping they belong to, which is the start of the glyph for left-to-right text, the end of the glyph for right-to-left text, and the vertical origin for upright glyphs in vertical text. Positions of sideways glyphs in vertical text are rotated along with the span.
+func glyphPositions(span canvas.TextSpan) ([]float64, []float64) {
+	f := span.Face.MmPerEm
+	rtl := span.Direction == canvasText.RightToLeft
+	rot := canvas.Identity.Rotate(float64(span.Rotation))
+
+	// glyphs are in visual order, the first glyph of a cluster in logical order sets the position
+	base := span.Glyphs[0].Cluster
+	clusters := map[uint32]canvas.Point{}
+	x, y := int32(0), int32(0)
+	for _, glyph := range span.Glyphs {
+		pos := canvas.Point{X: f * float64(x), Y: f * float64(y)}
+		if !glyph.Vertical {
+			pos = canvas.Point{X: f * float64(x+glyph.XOffset), Y: f * float64(y+glyph.YOffset)}
+			if rtl {
+				pos.X += f * float64(glyph.XAdvance)
+			}
+		}
+		if _, ok := clusters[glyph.Cluster]; !ok || rtl {
+			clusters[glyph.Cluster] = rot.Dot(pos)
+		}
+		if glyph.Cluster < base {
+			base = glyph.Cluster
+		}
+		x += glyph.XAdvance
+		y += glyph.YAdvance
+	}
+
+	starts := make([]uint32, 0, len(clusters))
+	for start := range clusters {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	// all characters of a cluster get the same position, viewers ignore positions of characters within a ligature
+	j := 0
+	xs, ys := []float64{}, []float64{}
+	for i := range span.Text {
+		for j+1 < len(starts) && starts[j+1] <= base+uint32(i) {
+			j++
+		}
+		pos := clusters[starts[j]]
+		xs = append(xs, pos.X)
+		ys = append(ys, pos.Y)
+	}
+	return xs, ys
 }
 
 // RenderImage renders an image to the canvas using a transformation matrix.
@@ -451,8 +826,15 @@ func (r *SVG) RenderImage(img image.Image, m canvas.Matrix) {
 	writeTo, refMask, mimetype := r.encodableImage(img)
 
 	m = m.Translate(0.0, float64(size.Y))
-	fmt.Fprintf(r.w, `<image transform="%s" width="%d" height="%d" xlink:href="data:%s;base64,`,
-		m.ToSVG(r.height), size.X, size.Y, mimetype)
+	r.beginElement(false)
+	fmt.Fprintf(r.w, `<image transform="%s" width="%d" height="%d"`, m.ToSVG(r.height), size.X, size.Y)
+	switch canvas.ImageInterpolation(img) {
+	case canvas.NearestInterpolation:
+		fmt.Fprintf(r.w, ` image-rendering="pixelated"`)
+	case canvas.BicubicInterpolation, canvas.LanczosInterpolation, canvas.AreaInterpolation:
+		fmt.Fprintf(r.w, ` image-rendering="optimizeQuality"`)
+	}
+	fmt.Fprintf(r.w, ` xlink:href="data:%s;base64,`, mimetype)
 
 	encoder := base64.NewEncoder(base64.StdEncoding, r.w)
 	err := writeTo(encoder)
@@ -467,13 +849,86 @@ func (r *SVG) RenderImage(img image.Image, m canvas.Matrix) {
 		fmt.Fprintf(r.w, `" mask="url(#%s)`, refMask)
 	}
 	r.writeClasses(r.w)
-	fmt.Fprintf(r.w, `"/>`)
+	r.writeAttributes()
+	r.closeTag("image", true)
+	r.endElement()
+}
+
+// RenderFilter renders a group with a filter effect to the canvas using a transformation matrix. The filter is written as an SVG filter that applies to a group element containing the layers of the group.
+func (r *SVG) RenderFilter(group *canvas.Canvas, filter *canvas.Filter, m canvas.Matrix) {
+	view := canvas.Identity.ReflectYAbout(r.height / 2.0).Mul(m)
+	bounds := filter.Bounds(group.Bounds()).Transform(view)
+	filter = filter.Transform(view)
+
+	r.filterID++
+	ref := fmt.Sprintf("f%v", r.filterID)
+	fmt.Fprintf(r.w, `<defs><filter id="%v" filterUnits="userSpaceOnUse" x="%v" y="%v" width="%v" height="%v">`, ref, dec(bounds.X), dec(bounds.Y), dec(bounds.W), dec(bounds.H))
+	for _, primitive := range filter.Primitives {
+		inputs := ""
+		if primitive.In != "" {
+			inputs += fmt.Sprintf(` in="%v"`, escapeAttr(primitive.In))
+		}
+		if primitive.In2 != "" {
+			inputs += fmt.Sprintf(` in2="%v"`, escapeAttr(primitive.In2))
+		}
+		if primitive.Result != "" {
+			inputs += fmt.Sprintf(` result="%v"`, escapeAttr(primitive.Result))
+		}
+
+		switch effect := primitive.Effect.(type) {
+		case canvas.GaussianBlurEffect:
+			if effect.StdDevX == effect.StdDevY {
+				fmt.Fprintf(r.w, `<feGaussianBlur%v stdDeviation="%v"/>`, inputs, dec(effect.StdDevX))
+			} else {
+				fmt.Fprintf(r.w, `<feGaussianBlur%v stdDeviation="%v %v"/>`, inputs, dec(effect.StdDevX), dec(effect.StdDevY))
+			}
+		case canvas.OffsetEffect:
+			fmt.Fprintf(r.w, `<feOffset%v dx="%v" dy="%v"/>`, inputs, dec(effect.DX), dec(effect.DY))
+		case canvas.FloodEffect:
+			fmt.Fprintf(r.w, `<feFlood%v flood-color="%v"/>`, inputs, canvas.CSSColor(effect.Color))
+		case canvas.CompositeEffect:
+			if effect.Operator == canvas.CompositeArithmetic {
+				fmt.Fprintf(r.w, `<feComposite%v operator="arithmetic" k1="%v" k2="%v" k3="%v" k4="%v"/>`, inputs, dec(effect.K1), dec(effect.K2), dec(effect.K3), dec(effect.K4))
+			} else {
+				fmt.Fprintf(r.w, `<feComposite%v operator="%v"/>`, inputs, effect.Operator)
+			}
+		case canvas.MergeEffect:
+			fmt.Fprintf(r.w, `<feMerge%v>`, inputs)
+			for _, in := range effect.In {
+				if in == "" {
+					fmt.Fprintf(r.w, `<feMergeNode/>`)
+				} else {
+					fmt.Fprintf(r.w, `<feMergeNode in="%v"/>`, escapeAttr(in))
+				}
+			}
+			fmt.Fprintf(r.w, `</feMerge>`)
+		case canvas.ColorMatrixEffect:
+			values := make([]string, len(effect.Matrix))
+			for i, v := range effect.Matrix {
+				values[i] = dec(v).String()
+			}
+			fmt.Fprintf(r.w, `<feColorMatrix%v values="%v"/>`, inputs, strings.Join(values, " "))
+		}
+	}
+	fmt.Fprintf(r.w, `</filter></defs>`)
+
+	r.beginElement(false)
+	fmt.Fprintf(r.w, `<g filter="url(#%v)`, ref)
+	r.writeAttributes()
+	r.closeTag("g", false)
+	attrs, elem := r.attrs, r.elem
+	r.attrs = canvas.Attributes{}
+	group.RenderViewTo(r, m)
+	r.flushPath()
+	r.attrs, r.elem = attrs, elem
+	fmt.Fprintf(r.w, `</g>`)
+	r.endElement()
 }
 
 // return a WriterTo, a refMask and a mimetype
 func (r *SVG) encodableImage(img image.Image) (func(io.Writer) error, string, string) {
 	if cimg, ok := img.(canvas.Image); ok && 0 < len(cimg.Bytes) {
-		if cimg.Mimetype == "image/jpeg" || cimg.Mimetype == "image/png" {
+		if cimg.Mimetype == "image/jpeg" || cimg.Mimetype == "image/png" || cimg.Mimetype == "image/webp" {
 			return func(w io.Writer) error {
 				_, err := w.Write(cimg.Bytes)
 				return err
@@ -574,9 +1029,43 @@ func (r *SVG) getPattern(gradient canvas.Gradient) string {
 	return ref
 }
 
+// getHatchPattern writes the hatch pattern as a pattern that tiles the primitive cell, the hatch is stroked beforehand.
+func (r *SVG) getHatchPattern(hatch *canvas.HatchPattern) string {
+	if ref, ok := r.patterns[hatch]; ok {
+		return ref
+	}
+	if hatch.Fill.IsGradient() {
+		r.getPattern(hatch.Fill.Gradient)
+	}
+
+	ref := fmt.Sprintf("p%v", len(r.patterns)+1)
+	r.patterns[hatch] = ref
+
+	// the hatch covers the neighbouring cells as content is clipped to the unit cell
+	cell := hatch.Cell()
+	tile := hatch.Hatch(-1.0, -1.0, 2.0, 2.0)
+	if hatch.Thickness != 0.0 {
+		tile = tile.Stroke(hatch.Thickness, canvas.ButtCap, canvas.MiterJoin, canvas.Tolerance)
+	}
+	tile = tile.Transform(cell.Inv())
+
+	m := canvas.Identity.ReflectYAbout(r.height / 2.0).Mul(cell)
+	fmt.Fprintf(r.w, `<defs><pattern id="%v" patternUnits="userSpaceOnUse" width="1" height="1" patternTransform="matrix(%v,%v,%v,%v,%v,%v)"><path d="%s`, ref, dec(m[0][0]), dec(m[1][0]), dec(m[0][1]), dec(m[1][1]), dec(m[0][2]), dec(m[1][2]), tile.ToSVG())
+	if !hatch.Fill.IsColor() || hatch.Fill.Color != canvas.Black {
+		fmt.Fprintf(r.w, `" fill="`)
+		r.writePaint(r.w, hatch.Fill)
+	}
+	fmt.Fprintf(r.w, `"/></pattern></defs>`)
+	return ref
+}
+
 func (r *SVG) writePaint(w io.Writer, paint canvas.Paint) {
 	if paint.IsPattern() {
-		// TODO
+		if hatch, ok := paint.Pattern.(*canvas.HatchPattern); ok {
+			fmt.Fprintf(w, "url(#%v)", r.getHatchPattern(hatch))
+		} else {
+			fmt.Fprintf(w, "none")
+		}
 	} else if paint.IsGradient() {
 		fmt.Fprintf(w, "url(#%v)", r.getPattern(paint.Gradient))
 	} else {
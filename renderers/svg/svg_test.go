@@ -1,9 +1,78 @@
 package svg
 
 import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/tdewolff/canvas"
+	canvasText "github.com/tdewolff/canvas/text"
+	"github.com/tdewolff/test"
 )
 
+type pathRecorder struct {
+	styles []canvas.Style
+}
+
+func (r *pathRecorder) Size() (float64, float64) {
+	return 0.0, 0.0
+}
+
+func (r *pathRecorder) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	r.styles = append(r.styles, style)
+}
+
+func (r *pathRecorder) RenderText(text *canvas.Text, m canvas.Matrix) {}
+
+func (r *pathRecorder) RenderImage(img image.Image, m canvas.Matrix) {}
+
+func TestSVGRoundTrip(t *testing.T) {
+	linear := canvas.NewLinearGradient(canvas.Point{X: 1.0, Y: 2.0}, canvas.Point{X: 9.0, Y: 3.0})
+	linear.Add(0.0, canvas.Red)
+	linear.Add(1.0, canvas.Blue)
+	radial := canvas.NewRadialGradient(canvas.Point{X: 4.0, Y: 5.0}, 1.0, canvas.Point{X: 5.0, Y: 5.0}, 4.0)
+	radial.Add(0.25, canvas.Green)
+	radial.Add(0.75, canvas.Yellow)
+	hatch := canvas.NewLineHatch(canvas.Purple, 0.0, 2.0, 0.5)
+
+	w := &bytes.Buffer{}
+	svg := New(w, 10.0, 10.0, nil)
+	style := canvas.DefaultStyle
+	for _, paint := range []canvas.Paint{{Gradient: linear}, {Gradient: radial}, {Pattern: hatch}} {
+		style.Fill = paint
+		svg.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+	}
+	test.Error(t, svg.Close())
+
+	c, err := canvas.ParseSVG(w)
+	test.Error(t, err)
+	r := &pathRecorder{}
+	c.RenderTo(r)
+	test.T(t, len(r.styles), 3)
+
+	linear2 := r.styles[0].Fill.Gradient.(*canvas.LinearGradient)
+	test.T(t, linear2.Start, linear.Start)
+	test.T(t, linear2.End, linear.End)
+	test.T(t, linear2.Stops, linear.Stops)
+
+	radial2 := r.styles[1].Fill.Gradient.(*canvas.RadialGradient)
+	test.T(t, radial2.C0, radial.C0)
+	test.T(t, radial2.C1, radial.C1)
+	test.Float(t, radial2.R0, radial.R0)
+	test.Float(t, radial2.R1, radial.R1)
+	test.T(t, radial2.Stops, radial.Stops)
+
+	hatch2 := r.styles[2].Fill.Pattern.(*canvas.HatchPattern)
+	test.T(t, hatch2.Fill, hatch.Fill)
+	test.T(t, hatch2.Cell(), hatch.Cell())
+	for _, line := range hatch2.Hatch(0.0, 0.0, 1.0, 1.0).Split() {
+		test.Float(t, line.Bounds().H, 0.5) // stroked lines
+	}
+}
+
 func TestSVGText(t *testing.T) {
 	//dejaVuSerif := NewFontFamily("dejavu-serif")
 	//dejaVuSerif.LoadFontFile("font/DejaVuSerif.ttf", FontRegular)
@@ -30,3 +99,235 @@ func TestSVGText(t *testing.T) {
 	//s := regexp.MustCompile(`base64,.+'`).ReplaceAllString(buf.String(), "base64,'") // remove embedded font
 	//test.String(t, s, `<style>`+"\n"+`@font-face{font-family:'dejavu-serif';src:url('data:font/truetype;base64,');}`+"\n"+`@font-face{font-family:'eb-garamond';src:url('data:font/opentype;base64,');}`+"\n"+`</style><text x="0" y="0" style="font: 12px dejavu-serif"><tspan x="0" y="7.421875" style="font:8px dejavu-serif">dejaVu8</tspan><tspan x="0" y="20.453125" letter-spacing="1" style="font-style:italic;fill:#f00">glyphspacing</tspan><tspan x="0" y="33.725625" style="font:700 6.996px dejavu-serif">dejaVu12sub</tspan><tspan x="0" y="38.5" style="font:700 10px eb-garamond">garamond10</tspan></text><path d="M0 22.703125H91.71875V21.803125H0z" fill="#f00"/>`)
 }
+
+type filterRecorder struct {
+	pathRecorder
+	filters []*canvas.Filter
+}
+
+func (r *filterRecorder) RenderFilter(group *canvas.Canvas, filter *canvas.Filter, m canvas.Matrix) {
+	r.filters = append(r.filters, filter)
+	group.RenderViewTo(&r.pathRecorder, m)
+}
+
+func TestSVGFilter(t *testing.T) {
+	group := canvas.New(10.0, 10.0)
+	canvas.NewContext(group).DrawPath(2.0, 2.0, canvas.Rectangle(6.0, 6.0))
+	filter := canvas.DropShadow(1.0, -1.0, 0.5, canvas.RGBA(0, 0, 0, 0.5))
+	filter.Primitives = append(filter.Primitives, canvas.FilterPrimitive{Effect: canvas.CompositeEffect{Operator: canvas.CompositeArithmetic, K2: 1.0, K3: 0.5}})
+
+	w := &bytes.Buffer{}
+	svg := New(w, 10.0, 10.0, nil)
+	svg.RenderFilter(group, filter, canvas.Identity)
+	test.Error(t, svg.Close())
+
+	c, err := canvas.ParseSVG(w)
+	test.Error(t, err)
+	r := &filterRecorder{}
+	c.RenderTo(r)
+	test.T(t, len(r.styles), 1)
+	test.T(t, len(r.filters), 1)
+	test.T(t, len(r.filters[0].Primitives), len(filter.Primitives))
+	for i, primitive := range r.filters[0].Primitives {
+		test.T(t, primitive.In, filter.Primitives[i].In)
+		test.T(t, primitive.In2, filter.Primitives[i].In2)
+		test.T(t, primitive.Result, filter.Primitives[i].Result)
+	}
+	test.Float(t, r.filters[0].Primitives[0].Effect.(canvas.GaussianBlurEffect).StdDevX, 0.5)
+	test.Float(t, r.filters[0].Primitives[1].Effect.(canvas.OffsetEffect).DX, 1.0)
+	test.Float(t, r.filters[0].Primitives[1].Effect.(canvas.OffsetEffect).DY, -1.0)
+	test.T(t, r.filters[0].Primitives[2].Effect, filter.Primitives[2].Effect)
+	test.T(t, r.filters[0].Primitives[4].Effect, filter.Primitives[4].Effect)
+	test.T(t, r.filters[0].Primitives[5].Effect, filter.Primitives[5].Effect)
+
+	// merged paths stay within the filtered group
+	group = canvas.New(10.0, 10.0)
+	canvas.NewContext(group).DrawPath(2.0, 2.0, canvas.Rectangle(2.0, 2.0))
+	w.Reset()
+	svg = New(w, 10.0, 10.0, &Options{MergePaths: true})
+	svg.RenderFilter(group, filter, canvas.Identity)
+	svg.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	test.Error(t, svg.Close())
+	s := w.String()
+	s = s[strings.Index(s, "<g filter"):]
+	test.That(t, strings.HasPrefix(s, `<g filter="url(#f1)"><path `), s)
+	test.T(t, strings.Count(s[strings.Index(s, "</g>"):], "<path"), 1)
+
+	// names are escaped
+	filter = &canvas.Filter{Primitives: []canvas.FilterPrimitive{
+		{Result: `a"<b`, Effect: canvas.OffsetEffect{DX: 1.0}},
+		{In: `a"<b`, In2: "c&d", Effect: canvas.MergeEffect{In: []string{`a"<b`, ""}}},
+	}}
+	w.Reset()
+	svg = New(w, 10.0, 10.0, nil)
+	svg.RenderFilter(group, filter, canvas.Identity)
+	test.Error(t, svg.Close())
+	s = w.String()
+	test.That(t, strings.Contains(s, `<feOffset result="a&#34;&lt;b"`), s)
+	test.That(t, strings.Contains(s, `<feMerge in="a&#34;&lt;b" in2="c&amp;d"><feMergeNode in="a&#34;&lt;b"/><feMergeNode/></feMerge>`), s)
+}
+
+func TestSVGAttributes(t *testing.T) {
+	w := &bytes.Buffer{}
+	svg := New(w, 10.0, 10.0, nil)
+	ctx := canvas.NewContext(svg)
+	ctx.SetID("chart")
+	ctx.SetTitle("Sales & costs")
+	ctx.Push()
+	ctx.Push() // empty groups are omitted
+	ctx.Pop()
+	ctx.SetID("bar")
+	ctx.SetData("value", "<5>")
+	ctx.SetHref("https://example.com/?a=1&b=2")
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(2.0, 2.0))
+	ctx.ResetAttributes()
+	ctx.SetDesc("dot")
+	ctx.DrawPath(0.0, 0.0, canvas.Circle(1.0))
+	ctx.Pop()
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(2.0, 2.0))
+	test.Error(t, svg.Close())
+
+	s := w.String()
+	s = s[strings.Index(s, "<g"):strings.LastIndex(s, "</svg>")]
+	s = regexp.MustCompile(` d="[^"]*"`).ReplaceAllString(s, ` d=""`)
+	test.String(t, s, `<g id="chart"><title>Sales &amp; costs</title><a xlink:href="https://example.com/?a=1&amp;b=2"><path d="" id="bar" data-value="&lt;5&gt;"/></a><path d=""><desc>dot</desc></path></g><path d=""/>`)
+}
+
+func TestSVGUniqueID(t *testing.T) {
+	w := &bytes.Buffer{}
+	svg := New(w, 10.0, 10.0, nil)
+	ctx := canvas.NewContext(svg)
+	ctx.SetID("a")
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(2.0, 2.0))
+	ctx.DrawPath(0.0, 0.0, canvas.Circle(1.0))
+	test.Error(t, svg.Close())
+	test.T(t, strings.Count(w.String(), `id="a"`), 1)
+
+	// group split over z-indices
+	c := canvas.New(10.0, 10.0)
+	ctx = canvas.NewContext(c)
+	ctx.SetID("g")
+	ctx.Push()
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(2.0, 2.0))
+	ctx.SetZIndex(1)
+	ctx.DrawPath(0.0, 0.0, canvas.Circle(1.0))
+	ctx.DrawPath(0.0, 0.0, canvas.Circle(1.0))
+	ctx.Pop()
+
+	w.Reset()
+	svg = New(w, c.W, c.H, nil)
+	c.RenderTo(svg)
+	test.Error(t, svg.Close())
+	test.T(t, strings.Count(w.String(), `id="g"`), 1)
+}
+
+func TestSVGOptimize(t *testing.T) {
+	draw := func(opts *Options) string {
+		w := &bytes.Buffer{}
+		svg := New(w, 10.0, 10.0, opts)
+		ctx := canvas.NewContext(svg)
+		for i := 0; i < 4; i++ {
+			ctx.DrawPath(float64(i)+0.123456, 1.0, canvas.Circle(0.5))
+		}
+		ctx.SetFillColor(canvas.Red)
+		ctx.DrawPath(0.0, 0.0, canvas.Rectangle(1.0, 1.0))
+		test.Error(t, svg.Close())
+		return w.String()
+	}
+
+	s := draw(&Options{ReusePaths: true, Precision: 2})
+	test.T(t, strings.Count(s, "<path"), 3) // first circle, its definition, and the rectangle
+	test.T(t, strings.Count(s, `<use xlink:href="#p1"`), 3)
+	test.That(t, strings.Contains(s, `<use xlink:href="#p1" x="1.62" y="9"/>`), s)
+
+	s = draw(&Options{MergePaths: true})
+	test.T(t, strings.Count(s, "<path"), 2)
+	test.T(t, strings.Count(s, "M"), 5)
+
+	// overlapping paths with opposite orientations are not merged
+	w := &bytes.Buffer{}
+	svg := New(w, 10.0, 10.0, &Options{MergePaths: true})
+	ctx := canvas.NewContext(svg)
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(4.0, 4.0))
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(4.0, 4.0).Translate(1.0, 1.0).Reverse())
+	test.Error(t, svg.Close())
+	test.T(t, strings.Count(w.String(), "<path"), 2)
+
+	s = draw(&Options{Minify: true})
+	test.That(t, len(s) < len(draw(nil)))
+	test.That(t, strings.HasSuffix(s, "</svg>"), s)
+	_, err := canvas.ParseSVG(strings.NewReader(s))
+	test.Error(t, err)
+}
+
+func TestSVGGlyphPositions(t *testing.T) {
+	family := canvas.NewFontFamily("dejavu-serif")
+	test.Error(t, family.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular))
+	face := family.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	draw := func(mode canvas.WritingMode) string {
+		w := &bytes.Buffer{}
+		svg := New(w, 100.0, 100.0, &Options{GlyphPositions: true})
+		rt := canvas.NewRichText(face)
+		rt.SetWritingMode(mode)
+		rt.WriteString("office")
+		svg.RenderText(rt.ToText(0.0, 0.0, canvas.Left, canvas.Top, 0.0, 0.0), canvas.Identity.Translate(10.0, 90.0))
+		return w.String()
+	}
+
+	positions := regexp.MustCompile(`<tspan x="([^"]*)" y="([^"]*)"`)
+	s := draw(canvas.HorizontalTB)
+	match := positions.FindStringSubmatch(s)
+	test.That(t, match != nil, s)
+	xs, ys := strings.Fields(match[1]), strings.Fields(match[2])
+	test.T(t, len(xs), 6)
+	test.T(t, len(ys), 6)
+	test.T(t, xs[0], "10")
+	test.T(t, xs[1], xs[2]) // ff ligature
+	test.That(t, xs[2] != xs[3], s)
+
+	s = draw(canvas.VerticalRL)
+	test.That(t, strings.Contains(s, "writing-mode:vertical-rl"), s)
+	test.That(t, strings.Contains(s, `dominant-baseline="alphabetic"`), s)
+	match = positions.FindStringSubmatch(s)
+	test.That(t, match != nil, s)
+	xs, ys = strings.Fields(match[1]), strings.Fields(match[2])
+	test.T(t, xs[0], xs[5])
+	test.T(t, ys[0], "10")
+}
+
+func TestSVGSubsetFonts(t *testing.T) {
+	family := canvas.NewFontFamily("dejavu-serif")
+	test.Error(t, family.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular))
+	face := family.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	glyphs := func(face *canvas.FontFace) []canvasText.Glyph {
+		glyphs := []canvasText.Glyph{}
+		canvas.NewTextLine(face, "office", canvas.Left).WalkSpans(func(x, y float64, span canvas.TextSpan) {
+			glyphs = append(glyphs, span.Glyphs...)
+		})
+		return glyphs
+	}
+
+	w := &bytes.Buffer{}
+	svg := New(w, 100.0, 100.0, nil)
+	svg.RenderText(canvas.NewTextLine(face, "office", canvas.Left), canvas.Identity.Translate(10.0, 90.0))
+	test.Error(t, svg.Close())
+
+	match := regexp.MustCompile(`base64,([^']*)'`).FindStringSubmatch(w.String())
+	test.That(t, match != nil, "no embedded font")
+	b, err := base64.StdEncoding.DecodeString(match[1])
+	test.Error(t, err)
+	subset, err := canvas.LoadFont(b, 0, canvas.FontRegular)
+	test.Error(t, err)
+	test.That(t, subset.SFNT.Gsub != nil, "no GSUB table in subset")
+
+	// the ffi ligature is substituted using the subset font
+	orig := glyphs(face)
+	sub := glyphs(subset.Face(12.0, canvas.Black))
+	test.That(t, len(orig) < 6, "no ligature in original font")
+	test.T(t, len(sub), len(orig))
+	for i := range orig {
+		test.T(t, sub[i].XAdvance, orig[i].XAdvance)
+		test.T(t, sub[i].Cluster, orig[i].Cluster)
+	}
+}
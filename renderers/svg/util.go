@@ -35,3 +35,34 @@ func (f dec) String() string {
 	}
 	return s
 }
+
+// quantize returns the path with its coordinates rounded to a number of decimals, or the path itself if precision is zero.
+func quantize(p *canvas.Path, precision int) *canvas.Path {
+	if precision == 0 {
+		return p
+	}
+	p = p.Copy()
+	d := p.Data()
+	for i := 0; i < len(d); {
+		n := 4
+		switch d[i] {
+		case canvas.QuadToCmd:
+			n = 6
+		case canvas.CubeToCmd, canvas.ArcToCmd:
+			n = 8
+		}
+		for j := i + 1; j < i+n-1; j++ {
+			if d[i] == canvas.ArcToCmd && (j == i+3 || j == i+4) {
+				continue // rotation and flags
+			}
+			d[j] = round(d[j], precision)
+		}
+		i += n
+	}
+	return p
+}
+
+func round(f float64, precision int) float64 {
+	pow := math.Pow(10.0, float64(precision))
+	return math.Round(f*pow) / pow
+}
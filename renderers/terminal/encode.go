@@ -0,0 +1,279 @@
+package terminal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+// opaqueColor returns the color composited over an opaque background, or the un-premultiplied color if the background is transparent. It returns false if the color is (mostly) transparent and there is no background.
+func opaqueColor(c, bg color.RGBA) (color.RGBA, bool) {
+	if bg.A == 255 {
+		a := 255 - uint32(c.A)
+		return color.RGBA{
+			uint8(uint32(c.R) + (uint32(bg.R)*a+127)/255),
+			uint8(uint32(c.G) + (uint32(bg.G)*a+127)/255),
+			uint8(uint32(c.B) + (uint32(bg.B)*a+127)/255),
+			255,
+		}, true
+	} else if c.A < 128 {
+		return color.RGBA{}, false
+	} else if c.A == 255 {
+		return c, true
+	}
+	a := uint32(c.A)
+	return color.RGBA{uint8(uint32(c.R) * 255 / a), uint8(uint32(c.G) * 255 / a), uint8(uint32(c.B) * 255 / a), 255}, true
+}
+
+// ansiWriter writes 24-bit color escape sequences only when the colors change.
+type ansiWriter struct {
+	*bufio.Writer
+	fg, bg       color.RGBA
+	hasFG, hasBG bool
+}
+
+func (w *ansiWriter) setFG(c color.RGBA) {
+	if !w.hasFG || w.fg != c {
+		fmt.Fprintf(w, "\x1b[38;2;%d;%d;%dm", c.R, c.G, c.B)
+		w.fg, w.hasFG = c, true
+	}
+}
+
+func (w *ansiWriter) setBG(c color.RGBA) {
+	if !w.hasBG || w.bg != c {
+		fmt.Fprintf(w, "\x1b[48;2;%d;%d;%dm", c.R, c.G, c.B)
+		w.bg, w.hasBG = c, true
+	}
+}
+
+func (w *ansiWriter) resetBG() {
+	if w.hasBG {
+		w.WriteString("\x1b[49m")
+		w.hasBG = false
+	}
+}
+
+func (w *ansiWriter) endLine() {
+	if w.hasFG || w.hasBG {
+		w.WriteString("\x1b[0m")
+		w.hasFG, w.hasBG = false, false
+	}
+	w.WriteString("\n")
+}
+
+// writeHalfBlocks writes the image using upper and lower half blocks, where each character cell holds two vertical pixels.
+func writeHalfBlocks(w io.Writer, img *image.RGBA, bg color.RGBA) error {
+	aw := &ansiWriter{Writer: bufio.NewWriter(w)}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 2 {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			top, hasTop := opaqueColor(img.RGBAAt(x, y), bg)
+			bottom, hasBottom := bg, bg.A == 255
+			if y+1 < bounds.Max.Y {
+				bottom, hasBottom = opaqueColor(img.RGBAAt(x, y+1), bg)
+			}
+
+			if hasTop && hasBottom {
+				if top == bottom {
+					aw.setBG(top)
+					aw.WriteString(" ")
+				} else {
+					aw.setFG(top)
+					aw.setBG(bottom)
+					aw.WriteString("▀")
+				}
+			} else if hasTop {
+				aw.resetBG()
+				aw.setFG(top)
+				aw.WriteString("▀")
+			} else if hasBottom {
+				aw.resetBG()
+				aw.setFG(bottom)
+				aw.WriteString("▄")
+			} else {
+				aw.resetBG()
+				aw.WriteString(" ")
+			}
+		}
+		aw.endLine()
+	}
+	return aw.Flush()
+}
+
+// braille dot bits for each pixel in a 2x4 cell
+var brailleDots = [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+
+// writeBraille writes the image using braille patterns, where each character cell holds 2x4 dots. Dots are set for pixels that differ from the background (white if transparent), and the dots of a cell share the average color of their pixels.
+func writeBraille(w io.Writer, img *image.RGBA, bg color.RGBA) error {
+	ref := color.RGBA{255, 255, 255, 255}
+	if bg.A == 255 {
+		ref = bg
+	}
+
+	aw := &ansiWriter{Writer: bufio.NewWriter(w)}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 4 {
+		if bg.A == 255 {
+			aw.setBG(bg)
+		}
+		for x := bounds.Min.X; x < bounds.Max.X; x += 2 {
+			dots := rune(0)
+			var r, g, b, n int
+			for dy := 0; dy < 4 && y+dy < bounds.Max.Y; dy++ {
+				for dx := 0; dx < 2 && x+dx < bounds.Max.X; dx++ {
+					c, _ := opaqueColor(img.RGBAAt(x+dx, y+dy), ref)
+					if 96 < absDiff(c.R, ref.R)+absDiff(c.G, ref.G)+absDiff(c.B, ref.B) {
+						dots |= brailleDots[dy][dx]
+						r += int(c.R)
+						g += int(c.G)
+						b += int(c.B)
+						n++
+					}
+				}
+			}
+			if dots == 0 {
+				aw.WriteString(" ")
+				continue
+			}
+			aw.setFG(color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 255})
+			aw.WriteRune(0x2800 + dots)
+		}
+		aw.endLine()
+	}
+	return aw.Flush()
+}
+
+func absDiff(a, b uint8) int {
+	if a < b {
+		return int(b - a)
+	}
+	return int(a - b)
+}
+
+// writeKitty writes the image as PNG using the Kitty graphics protocol, transmitted in chunks of base64 data.
+func writeKitty(w io.Writer, img *image.RGBA) error {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return err
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	bw := bufio.NewWriter(w)
+	const chunkSize = 4096
+	for i := 0; i < len(data); i += chunkSize {
+		j := i + chunkSize
+		more := 1
+		if len(data) <= j {
+			j, more = len(data), 0
+		}
+		if i == 0 {
+			fmt.Fprintf(bw, "\x1b_Ga=T,f=100,q=2,m=%d;%s\x1b\\", more, data[i:j])
+		} else {
+			fmt.Fprintf(bw, "\x1b_Gm=%d;%s\x1b\\", more, data[i:j])
+		}
+	}
+	bw.WriteString("\n")
+	return bw.Flush()
+}
+
+// sixelPalette returns a palette of a transparent color followed by a 6x7x6 color cube.
+func sixelPalette() color.Palette {
+	palette := color.Palette{color.RGBA{}}
+	for r := 0; r < 6; r++ {
+		for g := 0; g < 7; g++ {
+			for b := 0; b < 6; b++ {
+				palette = append(palette, color.RGBA{uint8(r * 255 / 5), uint8(g * 255 / 6), uint8(b * 255 / 5), 255})
+			}
+		}
+	}
+	return palette
+}
+
+// writeSixel writes the image using Sixel graphics with a fixed palette and Floyd-Steinberg dithering. Pixels that are less than half opaque are left transparent.
+func writeSixel(w io.Writer, img *image.RGBA) error {
+	bounds := img.Bounds()
+	src := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if c, ok := opaqueColor(img.RGBAAt(x, y), color.RGBA{}); ok {
+				src.SetRGBA(x, y, c)
+			}
+		}
+	}
+	palette := sixelPalette()
+	paletted := image.NewPaletted(bounds, palette)
+	draw.FloydSteinberg.Draw(paletted, bounds, src, bounds.Min)
+
+	bw := bufio.NewWriter(w)
+	width, height := bounds.Dx(), bounds.Dy()
+	fmt.Fprintf(bw, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+
+	used := make([]bool, len(palette))
+	for _, index := range paletted.Pix {
+		used[index] = true
+	}
+	for index := 1; index < len(palette); index++ {
+		if used[index] {
+			c := palette[index].(color.RGBA)
+			fmt.Fprintf(bw, "#%d;2;%d;%d;%d", index, (int(c.R)*100+127)/255, (int(c.G)*100+127)/255, (int(c.B)*100+127)/255)
+		}
+	}
+
+	sixels := make([]byte, width)
+	for y := 0; y < height; y += 6 {
+		first := true
+		for index := 1; index < len(palette); index++ {
+			if !used[index] {
+				continue
+			}
+
+			any := false
+			for x := 0; x < width; x++ {
+				bits := byte(0)
+				for k := 0; k < 6 && y+k < height; k++ {
+					if paletted.Pix[paletted.PixOffset(bounds.Min.X+x, bounds.Min.Y+y+k)] == uint8(index) {
+						bits |= 1 << k
+					}
+				}
+				sixels[x] = '?' + bits
+				any = any || bits != 0
+			}
+			if !any {
+				continue
+			}
+
+			if !first {
+				bw.WriteByte('$') // carriage return
+			}
+			first = false
+			fmt.Fprintf(bw, "#%d", index)
+			n := width
+			for 0 < n && sixels[n-1] == '?' {
+				n--
+			}
+			for x := 0; x < n; {
+				run := 1
+				for x+run < n && sixels[x+run] == sixels[x] {
+					run++
+				}
+				if 3 < run {
+					fmt.Fprintf(bw, "!%d%c", run, sixels[x])
+				} else {
+					for k := 0; k < run; k++ {
+						bw.WriteByte(sixels[x])
+					}
+				}
+				x += run
+			}
+		}
+		bw.WriteByte('-') // next line
+	}
+	bw.WriteString("\x1b\\\n")
+	return bw.Flush()
+}
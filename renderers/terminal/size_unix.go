@@ -0,0 +1,26 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package terminal
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func terminalSize(f *os.File) Size {
+	ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return Size{}
+	}
+	size := Size{
+		Columns: int(ws.Col),
+		Rows:    int(ws.Row),
+	}
+	if ws.Col != 0 && ws.Row != 0 {
+		size.CellWidth = int(ws.Xpixel) / int(ws.Col)
+		size.CellHeight = int(ws.Ypixel) / int(ws.Row)
+	}
+	return size
+}
@@ -0,0 +1,188 @@
+package terminal
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/rasterizer"
+)
+
+// Protocol is the way images are displayed in the terminal.
+type Protocol int
+
+// see Protocol
+const (
+	AutoProtocol      Protocol = iota // detect from the environment
+	SixelProtocol                     // DEC Sixel graphics
+	KittyProtocol                     // Kitty graphics protocol with PNG payload
+	HalfBlockProtocol                 // Unicode upper half blocks with 24-bit ANSI colors, two pixels per cell
+	BrailleProtocol                   // Unicode braille patterns with 24-bit ANSI colors, eight dots per cell
+)
+
+func (protocol Protocol) String() string {
+	switch protocol {
+	case AutoProtocol:
+		return "Auto"
+	case SixelProtocol:
+		return "Sixel"
+	case KittyProtocol:
+		return "Kitty"
+	case HalfBlockProtocol:
+		return "HalfBlock"
+	case BrailleProtocol:
+		return "Braille"
+	}
+	return fmt.Sprintf("Protocol(%d)", int(protocol))
+}
+
+type Options struct {
+	Protocol
+	Columns, Rows int        // maximum size in character cells, zero uses the terminal size
+	Background    color.RGBA // background for Unicode output, transparent keeps the terminal's background
+	canvas.ColorSpace
+	*rasterizer.Options
+}
+
+var DefaultOptions = Options{
+	Protocol:   AutoProtocol,
+	ColorSpace: canvas.DefaultColorSpace,
+}
+
+// Terminal is a renderer that draws to a terminal. The canvas is scaled to fit the terminal (or the columns and rows given in the options) while keeping its aspect ratio, rasterized, and written when closing using Sixel graphics, the Kitty graphics protocol, or Unicode half blocks or braille patterns with 24-bit colors. Character cells are assumed to be twice as high as they are wide when the terminal doesn't report its size in pixels.
+type Terminal struct {
+	*rasterizer.Rasterizer
+	w        io.Writer
+	img      *image.RGBA
+	protocol Protocol
+	opts     *Options
+}
+
+// New returns a terminal renderer for a canvas of the given size in millimeters.
+func New(w io.Writer, width, height float64, opts *Options) *Terminal {
+	if opts == nil {
+		defaultOptions := DefaultOptions
+		opts = &defaultOptions
+	}
+
+	protocol := opts.Protocol
+	if protocol == AutoProtocol {
+		protocol = DetectProtocol()
+	}
+
+	size := detectSize(w)
+	columns, rows := size.Columns, size.Rows-1 // keep a line for the prompt
+	if 0 < opts.Columns {
+		columns = opts.Columns
+	}
+	if 0 < opts.Rows {
+		rows = opts.Rows
+	}
+	columns, rows = maxInt(columns, 1), maxInt(rows, 1)
+
+	// pixels per cell
+	cellWidth, cellHeight := 1.0, 2.0
+	switch protocol {
+	case SixelProtocol, KittyProtocol:
+		cellWidth, cellHeight = float64(size.CellWidth), float64(size.CellHeight)
+	case BrailleProtocol:
+		cellWidth, cellHeight = 2.0, 4.0
+	}
+
+	// pixels are assumed to be square
+	dpmm := math.Min(float64(columns)*cellWidth/width, float64(rows)*cellHeight/height)
+	if math.IsInf(dpmm, 0) || math.IsNaN(dpmm) || dpmm <= 0.0 {
+		dpmm = 1.0
+	}
+	img := image.NewRGBA(image.Rect(0, 0, maxInt(int(width*dpmm+0.5), 1), maxInt(int(height*dpmm+0.5), 1)))
+	return &Terminal{
+		Rasterizer: rasterizer.FromImageWithOptions(img, canvas.DPMM(dpmm), opts.ColorSpace, opts.Options),
+		w:          w,
+		img:        img,
+		protocol:   protocol,
+		opts:       opts,
+	}
+}
+
+// Protocol returns the protocol used to display the image.
+func (r *Terminal) Protocol() Protocol {
+	return r.protocol
+}
+
+// Close writes the rasterized canvas to the terminal.
+func (r *Terminal) Close() error {
+	r.Rasterizer.Close()
+	switch r.protocol {
+	case SixelProtocol:
+		return writeSixel(r.w, r.img)
+	case KittyProtocol:
+		return writeKitty(r.w, r.img)
+	case BrailleProtocol:
+		return writeBraille(r.w, r.img, r.opts.Background)
+	default:
+		return writeHalfBlocks(r.w, r.img, r.opts.Background)
+	}
+}
+
+// DetectProtocol returns the best supported protocol of the terminal, using the TERM, TERM_PROGRAM, and KITTY_WINDOW_ID environment variables which are typically forwarded over SSH.
+func DetectProtocol() Protocol {
+	term := os.Getenv("TERM")
+	program := os.Getenv("TERM_PROGRAM")
+	if os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || term == "xterm-ghostty" || program == "ghostty" || program == "WezTerm" {
+		return KittyProtocol
+	} else if strings.Contains(term, "sixel") || strings.HasPrefix(term, "foot") || strings.HasPrefix(term, "mlterm") || term == "yaft-256color" || program == "iTerm.app" || program == "mintty" {
+		return SixelProtocol
+	}
+	return HalfBlockProtocol
+}
+
+// Size is the size of the terminal in character cells and the size of a cell in pixels.
+type Size struct {
+	Columns, Rows         int
+	CellWidth, CellHeight int
+}
+
+// detectSize returns the size of the terminal of the writer or of the standard output. It falls back to the COLUMNS and LINES environment variables and to 80x24 cells of 10x20 pixels.
+func detectSize(w io.Writer) Size {
+	size := Size{}
+	if f, ok := w.(*os.File); ok {
+		size = terminalSize(f)
+	}
+	if size.Columns == 0 || size.Rows == 0 {
+		size = terminalSize(os.Stdout)
+	}
+	if size.Columns == 0 {
+		size.Columns, _ = strconv.Atoi(os.Getenv("COLUMNS"))
+	}
+	if size.Rows == 0 {
+		size.Rows, _ = strconv.Atoi(os.Getenv("LINES"))
+	}
+	if size.Columns <= 0 {
+		size.Columns = 80
+	}
+	if size.Rows <= 0 {
+		size.Rows = 24
+	}
+	if size.CellWidth <= 0 || size.CellHeight <= 0 {
+		size.CellWidth, size.CellHeight = 10, 20
+	}
+	return size
+}
+
+// DetectSize returns the size of the terminal of the standard output.
+func DetectSize() Size {
+	return detectSize(os.Stdout)
+}
+
+func maxInt(a, b int) int {
+	if a < b {
+		return b
+	}
+	return a
+}
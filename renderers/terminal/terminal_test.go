@@ -0,0 +1,77 @@
+package terminal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/test"
+)
+
+func render(t *testing.T, opts *Options) string {
+	c := canvas.New(40.0, 20.0)
+	ctx := canvas.NewContext(c)
+	ctx.SetFillColor(canvas.Red)
+	ctx.DrawPath(0.0, 0.0, canvas.Rectangle(20.0, 20.0))
+	ctx.SetFillColor(canvas.Blue)
+	ctx.DrawPath(20.0, 10.0, canvas.Rectangle(20.0, 10.0))
+
+	buf := &bytes.Buffer{}
+	r := New(buf, c.W, c.H, opts)
+	c.RenderTo(r)
+	test.Error(t, r.Close())
+	return buf.String()
+}
+
+func TestHalfBlocks(t *testing.T) {
+	s := render(t, &Options{Protocol: HalfBlockProtocol, Columns: 8, Rows: 10})
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	test.T(t, len(lines), 2) // 8x4 pixels
+	test.T(t, lines[0], "\x1b[48;2;255;0;0m    \x1b[48;2;0;0;255m    \x1b[0m")
+	test.T(t, lines[1], "\x1b[48;2;255;0;0m    \x1b[49m    ")
+
+	s = render(t, &Options{Protocol: HalfBlockProtocol, Columns: 8, Rows: 10, Background: canvas.White})
+	lines = strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	test.T(t, lines[1], "\x1b[48;2;255;0;0m    \x1b[48;2;255;255;255m    \x1b[0m")
+}
+
+func TestBraille(t *testing.T) {
+	s := render(t, &Options{Protocol: BrailleProtocol, Columns: 4, Rows: 10})
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	test.T(t, len(lines), 1) // 8x4 pixels
+	test.T(t, lines[0], "\x1b[38;2;255;0;0m⣿⣿\x1b[38;2;0;0;255m⠛⠛\x1b[0m")
+}
+
+func TestSixel(t *testing.T) {
+	s := render(t, &Options{Protocol: SixelProtocol, Columns: 4, Rows: 1})
+	test.That(t, strings.HasPrefix(s, "\x1bP0;1;0q\"1;1;40;20#6;2;0;0;100#211;2;100;0;0#"), s[:50])
+	test.That(t, strings.HasSuffix(s, "\x1b\\\n"))
+	test.That(t, strings.Contains(s, "#6!20?!20~$#211!20~-"), s)
+	test.T(t, strings.Count(s, "-"), 4) // 20 pixels in bands of 6
+}
+
+func TestKitty(t *testing.T) {
+	s := render(t, &Options{Protocol: KittyProtocol, Columns: 4, Rows: 1})
+	test.That(t, strings.HasPrefix(s, "\x1b_Ga=T,f=100,q=2,m=0;"), s)
+	data := strings.TrimSuffix(strings.TrimPrefix(s, "\x1b_Ga=T,f=100,q=2,m=0;"), "\x1b\\\n")
+	b, err := base64.StdEncoding.DecodeString(data)
+	test.Error(t, err)
+	img, err := png.Decode(bytes.NewReader(b))
+	test.Error(t, err)
+	test.T(t, img.Bounds().Dx(), 40)
+	test.T(t, img.Bounds().Dy(), 20)
+}
+
+func TestDetectProtocol(t *testing.T) {
+	t.Setenv("KITTY_WINDOW_ID", "")
+	t.Setenv("TERM_PROGRAM", "")
+	t.Setenv("TERM", "xterm-kitty")
+	test.T(t, DetectProtocol(), KittyProtocol)
+	t.Setenv("TERM", "foot")
+	test.T(t, DetectProtocol(), SixelProtocol)
+	t.Setenv("TERM", "xterm-256color")
+	test.T(t, DetectProtocol(), HalfBlockProtocol)
+}
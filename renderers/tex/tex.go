@@ -1,27 +1,59 @@
 package tex
 
 import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
 	"fmt"
 	"image"
 	"image/color"
+	"image/png"
 	"io"
 	"math"
+	"os"
 
 	"github.com/tdewolff/canvas"
 )
 
-// TeX is a TeX/PGF renderer. Be aware that TeX/PGF does not support transparency of colors.
+const ptPerMm = 72.0 / 25.4
+
+// Options are the TeX/PGF renderer options.
+type Options struct {
+	TextAsPath bool   // render text as filled paths instead of \pgftext nodes that use the document's fonts
+	ImagePath  string // path prefix of image files written next to the TeX file and included with \pgfimage, if empty images are embedded as PDF inline images
+}
+
+// DefaultOptions are the default TeX/PGF renderer options.
+var DefaultOptions = Options{
+	TextAsPath: true,
+}
+
+// TeX is a TeX/PGF renderer. Gradients are drawn using PGF shadings, where the opacity of the stops is averaged. Embedded images require a PDF output driver (such as pdfLaTeX, LuaLaTeX, or XeLaTeX) and ignore transparency, while external images require the graphicx package. Text rendered as \pgftext nodes requires the xcolor package and uses the fonts of the document, so that its size and position are approximated.
 type TeX struct {
 	w             io.Writer
 	width, height float64
+	opts          *Options
 
 	style      canvas.Style
 	miterLimit float64
 	colors     map[color.RGBA]string
+	shadings   int
+	images     int
+	err        error
 }
 
 // New returns a TeX/PGF renderer.
 func New(w io.Writer, width, height float64) *TeX {
+	return NewWithOptions(w, width, height, nil)
+}
+
+// NewWithOptions returns a TeX/PGF renderer using the given options, such as rendering text as \pgftext nodes. See New.
+func NewWithOptions(w io.Writer, width, height float64, opts *Options) *TeX {
+	if opts == nil {
+		defaultOptions := DefaultOptions
+		opts = &defaultOptions
+	}
+
 	fmt.Fprintf(w, "\\begin{pgfpicture}")
 	style := canvas.DefaultStyle
 	style.StrokeWidth = 0.0
@@ -29,16 +61,19 @@ func New(w io.Writer, width, height float64) *TeX {
 		w:          w,
 		width:      width,
 		height:     height,
+		opts:       opts,
 		style:      style,
 		miterLimit: 10.0,
 		colors:     map[color.RGBA]string{},
 	}
 }
 
-// Close finished and closes the TeX file.
+// Close finished and closes the TeX file. It returns the first error that occurred when writing external image files.
 func (r *TeX) Close() error {
-	_, err := fmt.Fprintf(r.w, "\n\\end{pgfpicture}")
-	return err
+	if _, err := fmt.Fprintf(r.w, "\n\\end{pgfpicture}"); err != nil {
+		return err
+	}
+	return r.err
 }
 
 // Size returns the size of the canvas in millimeters.
@@ -46,17 +81,15 @@ func (r *TeX) Size() (float64, float64) {
 	return r.width, r.height
 }
 
+// getColor returns the name of the color without opacity, which is defined on first use. Since color definitions are local to the current group, it must not be called first within a scope.
 func (r *TeX) getColor(col color.RGBA) string {
+	col = opaqueColor(col)
 	if name, ok := r.colors[col]; ok {
 		return name
 	}
 
 	name := fmt.Sprintf("canvasColor%v", len(r.colors))
-	A := float64(col.A) / 255.0
-	R := float64(col.R) / A
-	G := float64(col.G) / A
-	B := float64(col.B) / A
-	fmt.Fprintf(r.w, "\n\\definecolor{%v}{RGB}{%v,%v,%v}", name, dec(R), dec(G), dec(B))
+	fmt.Fprintf(r.w, "\n\\definecolor{%v}{RGB}{%v,%v,%v}", name, col.R, col.G, col.B)
 	r.colors[col] = name
 	return name
 }
@@ -121,6 +154,13 @@ func (r *TeX) setStroke(paint canvas.Paint) {
 	}
 }
 
+// setScopeOpacity sets the fill opacity within a scope, which is restored at the end of the scope.
+func (r *TeX) setScopeOpacity(alpha float64) {
+	if alpha != float64(r.style.Fill.Color.A)/255.0 {
+		fmt.Fprintf(r.w, "\n\\pgfsetfillopacity{%v}", dec(alpha))
+	}
+}
+
 func (r *TeX) setStrokeWidth(width float64) {
 	if width != r.style.StrokeWidth {
 		fmt.Fprintf(r.w, "\n\\pgfsetlinewidth{%vmm}", dec(width))
@@ -182,12 +222,129 @@ func (r *TeX) setDashes(offset float64, dashes []float64) {
 	}
 }
 
+func (r *TeX) setFillRule(fillRule canvas.FillRule) {
+	if fillRule != r.style.FillRule {
+		if fillRule == canvas.EvenOdd {
+			fmt.Fprintf(r.w, "\n\\pgfseteorule")
+		} else {
+			fmt.Fprintf(r.w, "\n\\pgfsetnonzerorule")
+		}
+		r.style.FillRule = fillRule
+	}
+}
+
+// writeShading fills a path in canvas coordinates with a gradient. The path is used as a clipping path for a horizontal or radial PGF shading, which is extended with the colors of the first and last stops so that it covers the path.
+func (r *TeX) writeShading(path *canvas.Path, fillRule canvas.FillRule, gradient canvas.Gradient) {
+	bounds := path.FastBounds()
+	corners := []canvas.Point{
+		{X: bounds.X, Y: bounds.Y},
+		{X: bounds.X + bounds.W, Y: bounds.Y},
+		{X: bounds.X, Y: bounds.Y + bounds.H},
+		{X: bounds.X + bounds.W, Y: bounds.Y + bounds.H},
+	}
+
+	var stops canvas.Stops
+	var declaration, transformation string
+	name := fmt.Sprintf("canvasShading%v", r.shadings)
+	switch g := gradient.(type) {
+	case *canvas.LinearGradient:
+		stops = g.Stops
+		d := g.End.Sub(g.Start)
+		length := d.Length()
+		if len(stops) == 0 || length == 0.0 {
+			break
+		}
+
+		// project the bounds onto the gradient's axis and its normal
+		dir := d.Div(length)
+		normal := dir.Rot90CCW()
+		tmin, tmax := 0.0, length
+		smin, smax := math.Inf(1), math.Inf(-1)
+		for _, corner := range corners {
+			p := corner.Sub(g.Start)
+			t, s := p.Dot(dir), p.Dot(normal)
+			tmin, tmax = math.Min(tmin, t), math.Max(tmax, t)
+			smin, smax = math.Min(smin, s), math.Max(smax, s)
+		}
+		height := math.Max(smax-smin, 1.0)
+
+		specs := shadingSpecs(stops, -tmin, length, tmax-tmin)
+		declaration = fmt.Sprintf("\\pgfdeclarehorizontalshading{%v}{%vmm}{%v}", name, dec(height), specs)
+
+		// the center of the shading is placed at the origin
+		center := g.Start.Add(dir.Mul((tmin + tmax) / 2.0)).Add(normal.Mul((smin + smax) / 2.0))
+		transformation = fmt.Sprintf("\\pgftransformcm{%v}{%v}{%v}{%v}{\\pgfpoint{%vmm}{%vmm}}", dec(dir.X), dec(dir.Y), dec(normal.X), dec(normal.Y), dec(center.X), dec(center.Y))
+	case *canvas.RadialGradient:
+		stops = g.Stops
+		if len(stops) == 0 || g.R1 <= g.R0 {
+			break
+		}
+
+		rmax := g.R1
+		for _, corner := range corners {
+			rmax = math.Max(rmax, corner.Sub(g.C1).Length()+g.C0.Sub(g.C1).Length())
+		}
+
+		specs := shadingSpecs(stops, g.R0, g.R1-g.R0, rmax)
+		focus := g.C0.Sub(g.C1)
+		declaration = fmt.Sprintf("\\pgfdeclareradialshading{%v}{\\pgfpoint{%vmm}{%vmm}}{%v}", name, dec(focus.X), dec(focus.Y), specs)
+		transformation = fmt.Sprintf("\\pgftransformshift{\\pgfpoint{%vmm}{%vmm}}", dec(g.C1.X), dec(g.C1.Y))
+	}
+
+	if declaration == "" {
+		// degenerate or unsupported gradient, fill with the color at the center
+		center := canvas.Point{X: bounds.X + bounds.W/2.0, Y: bounds.Y + bounds.H/2.0}
+		r.writePath(path)
+		r.setFillRule(fillRule)
+		r.setFill(canvas.Paint{Color: gradient.At(center.X, center.Y)})
+		fmt.Fprintf(r.w, "\n\\pgfusepath{fill}")
+		return
+	}
+	r.shadings++
+
+	alpha := 0.0
+	for _, stop := range stops {
+		alpha += float64(stop.Color.A) / 255.0
+	}
+	alpha /= float64(len(stops))
+
+	r.setFillRule(fillRule)
+	fmt.Fprintf(r.w, "\n%v", declaration)
+	fmt.Fprintf(r.w, "\n\\begin{pgfscope}")
+	r.writePath(path)
+	fmt.Fprintf(r.w, "\n\\pgfusepath{clip}")
+	r.setScopeOpacity(alpha)
+	fmt.Fprintf(r.w, "\n\\pgflowlevel{%v}", transformation)
+	fmt.Fprintf(r.w, "\n\\pgfuseshading{%v}", name)
+	fmt.Fprintf(r.w, "\n\\end{pgfscope}")
+}
+
 // RenderPath renders a path to the canvas using a style and a transformation matrix.
 func (r *TeX) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
 	if path.Empty() {
 		return
 	}
 
+	if style.HasFill() && style.Fill.IsGradient() {
+		r.writeShading(path.Transform(m), style.FillRule, style.Fill.Gradient)
+		style.Fill = canvas.Paint{}
+	}
+	if style.HasStroke() && style.Stroke.IsGradient() {
+		if style.HasFill() {
+			fillStyle := style
+			fillStyle.Stroke = canvas.Paint{}
+			r.RenderPath(path, fillStyle, m)
+		}
+
+		// shadings can only fill, draw stroke explicitly
+		if style.IsDashed() {
+			path = path.Dash(style.DashOffset, style.Dashes...)
+		}
+		path = path.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner, canvas.Tolerance)
+		r.writeShading(path.Transform(m), canvas.NonZero, style.Stroke.Gradient)
+		return
+	}
+
 	strokeUnsupported := false
 	if m.IsSimilarity() {
 		scale := math.Sqrt(math.Abs(m.Det()))
@@ -207,6 +364,7 @@ func (r *TeX) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 	}
 
 	if style.HasFill() {
+		r.setFillRule(style.FillRule)
 		r.setFill(style.Fill)
 	}
 
@@ -232,18 +390,127 @@ func (r *TeX) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 		}
 		path = path.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner, canvas.Tolerance)
 		r.writePath(path.Transform(m))
+		r.setFillRule(canvas.NonZero)
 		r.setFill(style.Stroke)
 		fmt.Fprintf(r.w, "\n\\pgfusepath{fill}")
 	}
 }
 
-// RenderText renders a text object to the canvas using a transformation matrix.
+// RenderText renders a text object to the canvas using a transformation matrix. Unless text is rendered as paths, each text span is written as a \pgftext node at the position of the span, which is typeset by TeX using the document's font family with the size, weight, and style of the span's font face. Vertical text is always rendered as paths.
 func (r *TeX) RenderText(text *canvas.Text, m canvas.Matrix) {
-	// TODO: (TeX) write text natively
-	text.RenderAsPath(r, m, 0.0)
+	if r.opts.TextAsPath || text.WritingMode != canvas.HorizontalTB {
+		text.RenderAsPath(r, m, 0.0)
+		return
+	}
+
+	text.WalkDecorations(func(paint canvas.Paint, p *canvas.Path) {
+		style := canvas.DefaultStyle
+		style.Fill = paint
+		r.RenderPath(p, style, m)
+	})
+
+	text.WalkSpans(func(x, y float64, span canvas.TextSpan) {
+		if !span.IsText() {
+			for _, obj := range span.Objects {
+				obj.Canvas.RenderViewTo(r, m.Mul(obj.View(x, y, span.Face)))
+			}
+			return
+		}
+
+		pos := m.Dot(canvas.Point{X: x, Y: y})
+		col := span.Face.Fill.Color
+		if span.Face.Fill.IsGradient() {
+			col = span.Face.Fill.Gradient.At(pos.X, pos.Y)
+		}
+		name := r.getColor(col)
+
+		fmt.Fprintf(r.w, "\n\\begin{pgfscope}")
+		r.setScopeOpacity(float64(col.A) / 255.0)
+		fmt.Fprintf(r.w, "\n\\pgflowlevel{\\pgftransformcm{%v}{%v}{%v}{%v}{\\pgfpoint{%vmm}{%vmm}}}", dec(m[0][0]), dec(m[1][0]), dec(m[0][1]), dec(m[1][1]), dec(pos.X), dec(pos.Y))
+		fmt.Fprintf(r.w, "\n\\pgftext[left,base]{\\fontsize{%vmm}{%vmm}\\selectfont", dec(span.Face.Size), dec(1.2*span.Face.Size))
+		if canvas.FontSemiBold <= span.Face.Style.Weight() {
+			fmt.Fprintf(r.w, "\\bfseries")
+		}
+		if span.Face.Style.Italic() {
+			fmt.Fprintf(r.w, "\\itshape")
+		}
+		if span.Face.Variant == canvas.FontSmallcaps {
+			fmt.Fprintf(r.w, "\\scshape")
+		}
+		fmt.Fprintf(r.w, "\\color{%v}%v}", name, escape(span.Text))
+		fmt.Fprintf(r.w, "\n\\end{pgfscope}")
+	})
 }
 
 // RenderImage renders an image to the canvas using a transformation matrix.
 func (r *TeX) RenderImage(img image.Image, m canvas.Matrix) {
-	// TODO: (TeX) write image
+	size := img.Bounds().Size()
+	if size.X == 0 || size.Y == 0 {
+		return
+	}
+
+	// transformation of the unit square to the image in canvas coordinates
+	m = m.Scale(float64(size.X), float64(size.Y))
+	if r.opts.ImagePath != "" {
+		filename, err := r.writeImageFile(img)
+		if err != nil {
+			if r.err == nil {
+				r.err = err
+			}
+			return
+		}
+
+		// normalize the transformation so that the image has the size of its sides
+		width := math.Hypot(m[0][0], m[1][0])
+		height := math.Hypot(m[0][1], m[1][1])
+		if width == 0.0 || height == 0.0 {
+			return
+		}
+		fmt.Fprintf(r.w, "\n\\begin{pgfscope}")
+		r.setScopeOpacity(1.0)
+		fmt.Fprintf(r.w, "\n\\pgflowlevel{\\pgftransformcm{%v}{%v}{%v}{%v}{\\pgfpoint{%vmm}{%vmm}}}", dec(m[0][0]/width), dec(m[1][0]/width), dec(m[0][1]/height), dec(m[1][1]/height), dec(m[0][2]), dec(m[1][2]))
+		fmt.Fprintf(r.w, "\n\\pgftext[left,bottom]{\\pgfimage[width=%vmm,height=%vmm]{%v}}", dec(width), dec(height), filename)
+		fmt.Fprintf(r.w, "\n\\end{pgfscope}")
+		return
+	}
+
+	// embed as PDF inline image with hexadecimal and deflate filters, in PDF units
+	interpolate := canvas.ImageInterpolation(img) != canvas.NearestInterpolation
+	m = canvas.Identity.Scale(ptPerMm, ptPerMm).Mul(m)
+	fmt.Fprintf(r.w, "\n\\begin{pgfscope}")
+	r.setScopeOpacity(1.0)
+	fmt.Fprintf(r.w, "\n\\csname pgfsys@invoke\\endcsname{q %v %v %v %v %v %v cm", dec(m[0][0]), dec(m[1][0]), dec(m[0][1]), dec(m[1][1]), dec(m[0][2]), dec(m[1][2]))
+	fmt.Fprintf(r.w, " BI /W %d /H %d /CS /RGB /BPC 8 /F [/AHx /Fl] /I %v ID\n", size.X, size.Y, interpolate)
+
+	bw := bufio.NewWriter(r.w)
+	zw := zlib.NewWriter(&hexWriter{w: bw})
+	writeImagePixels(zw, img)
+	zw.Close()
+	bw.Flush()
+	fmt.Fprintf(r.w, ">\nEI Q}")
+	fmt.Fprintf(r.w, "\n\\end{pgfscope}")
+}
+
+// writeImageFile writes the image to the next external image file and returns its filename. PNG and JPEG images are written as is.
+func (r *TeX) writeImageFile(img image.Image) (string, error) {
+	r.images++
+	data, ext := []byte(nil), ".png"
+	if cimg, ok := img.(canvas.Image); ok && 0 < len(cimg.Bytes) && (cimg.Mimetype == "image/png" || cimg.Mimetype == "image/jpeg") {
+		data = cimg.Bytes
+		if cimg.Mimetype == "image/jpeg" {
+			ext = ".jpg"
+		}
+	} else {
+		buf := &bytes.Buffer{}
+		if err := png.Encode(buf, img); err != nil {
+			return "", err
+		}
+		data = buf.Bytes()
+	}
+
+	filename := fmt.Sprintf("%v%v%v", r.opts.ImagePath, r.images, ext)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return "", err
+	}
+	return filename, nil
 }
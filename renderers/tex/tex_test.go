@@ -0,0 +1,104 @@
+package tex
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/test"
+)
+
+func TestTeXGradient(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r := New(buf, 20.0, 10.0)
+
+	gradient := canvas.NewLinearGradient(canvas.Point{X: 0.0, Y: 0.0}, canvas.Point{X: 10.0, Y: 0.0})
+	gradient.Add(0.0, canvas.Red)
+	gradient.Add(1.0, canvas.Blue)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Gradient: gradient}
+	r.RenderPath(canvas.Rectangle(20.0, 5.0), style, canvas.Identity)
+
+	radial := canvas.NewRadialGradient(canvas.Point{X: 5.0, Y: 5.0}, 1.0, canvas.Point{X: 5.0, Y: 5.0}, 4.0)
+	radial.Add(0.0, color.RGBA{0, 0, 0, 128})
+	radial.Add(1.0, color.RGBA{0, 0, 0, 128})
+	style.Fill = canvas.Paint{Gradient: radial}
+	r.RenderPath(canvas.Rectangle(10.0, 10.0), style, canvas.Identity)
+	test.Error(t, r.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, `\pgfdeclarehorizontalshading{canvasShading0}{5mm}{rgb(0mm)=(1,0,0); rgb(10mm)=(0,0,1); rgb(20mm)=(0,0,1)}`), s)
+	test.That(t, strings.Contains(s, `\pgflowlevel{\pgftransformcm{1}{0}{0}{1}{\pgfpoint{10mm}{2.5mm}}}`+"\n"+`\pgfuseshading{canvasShading0}`), s)
+	test.That(t, strings.Contains(s, `\pgfdeclareradialshading{canvasShading1}{\pgfpoint{0mm}{0mm}}{rgb(0mm)=(0,0,0); rgb(1mm)=(0,0,0); rgb(4mm)=(0,0,0); rgb(7.0710678mm)=(0,0,0)}`), s)
+	test.That(t, strings.Contains(s, `\pgfsetfillopacity{.50196078}`+"\n"+`\pgflowlevel{\pgftransformshift{\pgfpoint{5mm}{5mm}}}`), s)
+}
+
+func TestTeXOpacity(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r := New(buf, 10.0, 10.0)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Color: color.RGBA{128, 0, 0, 128}}
+	r.RenderPath(canvas.Rectangle(1.0, 1.0), style, canvas.Identity)
+	test.Error(t, r.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, `\definecolor{canvasColor0}{RGB}{255,0,0}`), s)
+	test.That(t, strings.Contains(s, `\pgfsetfillopacity{.50196078}`), s)
+}
+
+func TestTeXText(t *testing.T) {
+	family := canvas.NewFontFamily("dejavu")
+	if err := family.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, canvas.Red, canvas.FontBold)
+	text := canvas.NewTextLine(face, "50% of {x}_1", canvas.Left)
+
+	buf := &bytes.Buffer{}
+	r := NewWithOptions(buf, 10.0, 10.0, &Options{})
+	r.RenderText(text, canvas.Identity.Translate(2.0, 3.0))
+	test.Error(t, r.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, `\pgflowlevel{\pgftransformcm{1}{0}{0}{1}{\pgfpoint{2mm}{3mm}}}`), s)
+	test.That(t, strings.Contains(s, `\pgftext[left,base]{\fontsize{4.2333333mm}{5.08mm}\selectfont\bfseries\color{canvasColor0}50\% of \{x\}\_1}`), s)
+
+	buf.Reset()
+	r = New(buf, 10.0, 10.0)
+	r.RenderText(text, canvas.Identity)
+	test.Error(t, r.Close())
+	test.That(t, !strings.Contains(buf.String(), `\pgftext`))
+}
+
+func TestTeXImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, canvas.Red)
+	img.Set(1, 0, canvas.Blue)
+
+	buf := &bytes.Buffer{}
+	r := New(buf, 10.0, 10.0)
+	r.RenderImage(img, canvas.Identity.Translate(1.0, 2.0))
+	test.Error(t, r.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, `cm BI /W 2 /H 1 /CS /RGB /BPC 8 /F [/AHx /Fl] /I true ID`), s)
+	test.That(t, strings.Contains(s, ">\nEI Q}"), s)
+
+	dir := t.TempDir()
+	buf.Reset()
+	r = NewWithOptions(buf, 10.0, 10.0, &Options{TextAsPath: true, ImagePath: filepath.Join(dir, "img")})
+	r.RenderImage(img, canvas.Identity.Translate(1.0, 2.0).Rotate(90.0))
+	test.Error(t, r.Close())
+
+	s = buf.String()
+	filename := filepath.Join(dir, "img1.png")
+	test.That(t, strings.Contains(s, `\pgflowlevel{\pgftransformcm{0}{1}{-1}{0}{\pgfpoint{1mm}{2mm}}}`), s)
+	test.That(t, strings.Contains(s, `\pgftext[left,bottom]{\pgfimage[width=2mm,height=1mm]{`+filename+`}}`), s)
+	_, err := os.Stat(filename)
+	test.Error(t, err)
+}
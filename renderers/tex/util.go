@@ -2,6 +2,9 @@ package tex
 
 import (
 	"fmt"
+	"image"
+	"image/color"
+	"io"
 	"math"
 	"strings"
 
@@ -33,3 +36,101 @@ func (f dec) String() string {
 	}
 	return s
 }
+
+// opaqueColor returns the un-premultiplied color without opacity.
+func opaqueColor(col color.RGBA) color.RGBA {
+	if col.A == 0 {
+		return color.RGBA{0, 0, 0, 255}
+	} else if col.A == 255 {
+		return col
+	}
+	A := uint32(col.A)
+	return color.RGBA{
+		uint8((uint32(col.R)*255 + A/2) / A),
+		uint8((uint32(col.G)*255 + A/2) / A),
+		uint8((uint32(col.B)*255 + A/2) / A),
+		255,
+	}
+}
+
+// shadingSpecs returns the PGF color specification of the gradient stops, where a stop at offset t is at position offset+t*length in millimeters. The first and last colors are extended to the positions zero and total respectively, and positions are made strictly increasing.
+func shadingSpecs(stops canvas.Stops, offset, length, total float64) string {
+	sb := strings.Builder{}
+	prev := math.Inf(-1)
+	writeSpec := func(pos float64, col color.RGBA) {
+		if pos <= prev {
+			pos = prev + 0.001
+		}
+		if !math.IsInf(prev, -1) {
+			sb.WriteString("; ")
+		}
+		col = opaqueColor(col)
+		fmt.Fprintf(&sb, "rgb(%vmm)=(%v,%v,%v)", dec(pos), dec(float64(col.R)/255.0), dec(float64(col.G)/255.0), dec(float64(col.B)/255.0))
+		prev = pos
+	}
+
+	if first := offset + stops[0].Offset*length; 0.0 < first {
+		writeSpec(0.0, stops[0].Color)
+	}
+	for _, stop := range stops {
+		writeSpec(offset+stop.Offset*length, stop.Color)
+	}
+	if last := offset + stops[len(stops)-1].Offset*length; last < total {
+		writeSpec(total, stops[len(stops)-1].Color)
+	}
+	return sb.String()
+}
+
+var escapeReplacer = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`$`, `\$`,
+	`&`, `\&`,
+	`#`, `\#`,
+	`^`, `\^{}`,
+	`_`, `\_`,
+	`%`, `\%`,
+	`~`, `\~{}`,
+)
+
+// escape escapes the special characters of TeX.
+func escape(s string) string {
+	return escapeReplacer.Replace(s)
+}
+
+// hexWriter writes bytes in hexadecimal in lines of 64 characters.
+type hexWriter struct {
+	w io.Writer
+	n int
+}
+
+func (w *hexWriter) Write(b []byte) (int, error) {
+	buf := make([]byte, 0, 2*len(b)+len(b)/16+1)
+	for _, c := range b {
+		buf = append(buf, "0123456789abcdef"[c>>4], "0123456789abcdef"[c&0x0F])
+		w.n += 2
+		if w.n == 64 {
+			buf = append(buf, '\n')
+			w.n = 0
+		}
+	}
+	if _, err := w.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// writeImagePixels writes the un-premultiplied RGB components of the image, ignoring transparency.
+func writeImagePixels(w io.Writer, img image.Image) {
+	bounds := img.Bounds()
+	line := make([]byte, 3*bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			i := 3 * (x - bounds.Min.X)
+			line[i+0], line[i+1], line[i+2] = c.R, c.G, c.B
+		}
+		w.Write(line)
+	}
+}
@@ -0,0 +1,403 @@
+package webp
+
+import (
+	"math/bits"
+	"sort"
+)
+
+type bitWriter struct {
+	buf  []byte
+	bits uint64
+	n    uint
+}
+
+// write writes the n least significant bits of v, least significant bit first.
+func (w *bitWriter) write(v uint32, n uint) {
+	w.bits |= uint64(v) << w.n
+	w.n += n
+	for 8 <= w.n {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.n -= 8
+	}
+}
+
+func (w *bitWriter) flush() []byte {
+	if 0 < w.n {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.n = 0, 0
+	}
+	return w.buf
+}
+
+// token is either a literal pixel or a backward reference when length is non-zero.
+type token struct {
+	argb     uint32
+	length   int
+	distCode int
+}
+
+// backwardReferences returns the pixels as a sequence of literals and backward references using a hash chain of pixel pairs.
+func backwardReferences(pix []uint32, width int) []token {
+	// distance codes for the two-dimensional neighbourhood
+	distCodes := map[int]int{}
+	for i := len(distanceMapTable) - 1; 0 <= i; i-- {
+		yOffset, xOffset := int(distanceMapTable[i]>>4), 8-int(distanceMapTable[i]&0xf)
+		if dist := yOffset*width + xOffset; 1 <= dist {
+			distCodes[dist] = i + 1
+		}
+	}
+
+	const hashBits = 16
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, len(pix))
+	hash := func(i int) uint32 {
+		return ((pix[i] * 0x1e35a7bd) ^ (pix[i+1] * 0x9e3779b1)) >> (32 - hashBits) & (1<<hashBits - 1)
+	}
+	insert := func(i int) {
+		if i+1 < len(pix) {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+	matchLength := func(i, j int) int {
+		n := 0
+		for i+n < len(pix) && n < maxLength && pix[i+n] == pix[j+n] {
+			n++
+		}
+		return n
+	}
+
+	tokens := []token{}
+	for i := 0; i < len(pix); {
+		bestLength, bestDist := 0, 0
+		if i+1 < len(pix) {
+			// prefer the cheap distances to the left and top pixels
+			for _, dist := range []int{1, width} {
+				if dist <= i {
+					if n := matchLength(i, i-dist); bestLength < n {
+						bestLength, bestDist = n, dist
+					}
+				}
+			}
+			chain := 0
+			for j := int(head[hash(i)]); 0 <= j && i-j <= maxDistance && chain < maxChainLength; j = int(prev[j]) {
+				if n := matchLength(i, j); bestLength < n {
+					bestLength, bestDist = n, i-j
+					if n == maxLength {
+						break
+					}
+				}
+				chain++
+			}
+		}
+
+		if minLength <= bestLength {
+			distCode, ok := distCodes[bestDist]
+			if !ok {
+				distCode = bestDist + len(distanceMapTable)
+			}
+			tokens = append(tokens, token{length: bestLength, distCode: distCode})
+			for k := 0; k < bestLength; k++ {
+				insert(i + k)
+			}
+			i += bestLength
+		} else {
+			tokens = append(tokens, token{argb: pix[i]})
+			insert(i)
+			i++
+		}
+	}
+	return tokens
+}
+
+// prefixEncode returns the prefix symbol and the extra bits of a length or distance.
+func prefixEncode(v int) (int, uint, uint32) {
+	n := v - 1
+	if n < 4 {
+		return n, 0, 0
+	}
+	h := bits.Len(uint(n)) - 1
+	second := (n >> (h - 1)) & 1
+	extraBits := uint(h - 1)
+	return 2*h + second, extraBits, uint32(n) & (1<<extraBits - 1)
+}
+
+// huffmanCode is a canonical Huffman code with the bit-reversed codes ready to be written.
+type huffmanCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+func (c huffmanCode) write(bw *bitWriter, symbol int) {
+	bw.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// writeEntropyImage writes an entropy coded image without color cache and a single group of prefix codes.
+func writeEntropyImage(bw *bitWriter, pix []uint32, width, height int, main bool) {
+	bw.write(0, 1) // no color cache
+	if main {
+		bw.write(0, 1) // no meta prefix codes
+	}
+
+	tokens := backwardReferences(pix, width)
+	histograms := [5][]int{
+		make([]int, numLiteralCodes+numLengthCodes),
+		make([]int, 256),
+		make([]int, 256),
+		make([]int, 256),
+		make([]int, numDistCodes),
+	}
+	for _, t := range tokens {
+		if t.length == 0 {
+			histograms[0][(t.argb>>8)&0xff]++
+			histograms[1][(t.argb>>16)&0xff]++
+			histograms[2][t.argb&0xff]++
+			histograms[3][t.argb>>24]++
+		} else {
+			lengthSymbol, _, _ := prefixEncode(t.length)
+			distSymbol, _, _ := prefixEncode(t.distCode)
+			histograms[0][numLiteralCodes+lengthSymbol]++
+			histograms[4][distSymbol]++
+		}
+	}
+
+	var codes [5]huffmanCode
+	for i, histogram := range histograms {
+		codes[i] = writeHuffmanCode(bw, histogram)
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].write(bw, int((t.argb>>8)&0xff))
+			codes[1].write(bw, int((t.argb>>16)&0xff))
+			codes[2].write(bw, int(t.argb&0xff))
+			codes[3].write(bw, int(t.argb>>24))
+		} else {
+			symbol, n, extra := prefixEncode(t.length)
+			codes[0].write(bw, numLiteralCodes+symbol)
+			bw.write(extra, n)
+			symbol, n, extra = prefixEncode(t.distCode)
+			codes[4].write(bw, symbol)
+			bw.write(extra, n)
+		}
+	}
+}
+
+// writeHuffmanCode writes the prefix code for a histogram of symbols and returns it. Codes with only one used symbol take zero bits per symbol.
+func writeHuffmanCode(bw *bitWriter, histogram []int) huffmanCode {
+	symbols := []int{}
+	for symbol, count := range histogram {
+		if count != 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	if len(symbols) == 0 {
+		symbols = append(symbols, 0)
+	}
+
+	if len(symbols) <= 2 && symbols[len(symbols)-1] < 256 {
+		// simple code
+		bw.write(1, 1)
+		bw.write(uint32(len(symbols)-1), 1)
+		if symbols[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(symbols[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(symbols[0]), 8)
+		}
+		code := huffmanCode{
+			lengths: make([]uint8, len(histogram)),
+			codes:   make([]uint32, len(histogram)),
+		}
+		if len(symbols) == 2 {
+			bw.write(uint32(symbols[1]), 8)
+			code.lengths[symbols[0]], code.lengths[symbols[1]] = 1, 1
+			code.codes[symbols[1]] = 1
+		}
+		return code
+	}
+
+	lengths := huffmanLengths(histogram, 15)
+	code := canonicalCode(lengths)
+	if len(symbols) == 1 {
+		code.lengths[symbols[0]] = 0
+	}
+
+	// run-length encode the code lengths
+	type clToken struct {
+		symbol int
+		extra  uint32
+	}
+	clTokens := []clToken{}
+	for i := 0; i < len(lengths); {
+		value := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == value {
+			run++
+		}
+		i += run
+		if value == 0 {
+			for 11 <= run {
+				n := min(run, 138)
+				clTokens = append(clTokens, clToken{18, uint32(n - 11)})
+				run -= n
+			}
+			if 3 <= run {
+				clTokens = append(clTokens, clToken{17, uint32(run - 3)})
+				run = 0
+			}
+		} else {
+			clTokens = append(clTokens, clToken{int(value), 0})
+			run--
+			for 3 <= run {
+				n := min(run, 6)
+				clTokens = append(clTokens, clToken{16, uint32(n - 3)})
+				run -= n
+			}
+		}
+		for ; 0 < run; run-- {
+			clTokens = append(clTokens, clToken{int(value), 0})
+		}
+	}
+
+	clHistogram := make([]int, 19)
+	for _, t := range clTokens {
+		clHistogram[t.symbol]++
+	}
+	clLengths := huffmanLengths(clHistogram, 7)
+	clCode := canonicalCode(clLengths)
+	clUsed := 0
+	for _, length := range clLengths {
+		if length != 0 {
+			clUsed++
+		}
+	}
+	if clUsed == 1 {
+		for i := range clCode.lengths {
+			clCode.lengths[i] = 0
+		}
+	}
+
+	numCodes := 4
+	for i, symbol := range codeLengthCodeOrder {
+		if clLengths[symbol] != 0 && numCodes < i+1 {
+			numCodes = i + 1
+		}
+	}
+	bw.write(0, 1) // normal code
+	bw.write(uint32(numCodes-4), 4)
+	for _, symbol := range codeLengthCodeOrder[:numCodes] {
+		bw.write(uint32(clLengths[symbol]), 3)
+	}
+	bw.write(0, 1) // code lengths for all symbols
+	for _, t := range clTokens {
+		clCode.write(bw, t.symbol)
+		switch t.symbol {
+		case 16:
+			bw.write(t.extra, 2)
+		case 17:
+			bw.write(t.extra, 3)
+		case 18:
+			bw.write(t.extra, 7)
+		}
+	}
+	return code
+}
+
+// huffmanLengths returns the code lengths of a Huffman code of at most maxLength bits. If the optimal code is too long, the smallest counts are increased until it fits.
+func huffmanLengths(histogram []int, maxLength int) []uint8 {
+	type node struct {
+		count       int
+		left, right int // children indices, or -1 for leaves
+		symbol      int
+	}
+
+	lengths := make([]uint8, len(histogram))
+	minCount := 1
+	for {
+		nodes := []node{}
+		for symbol, count := range histogram {
+			if count != 0 {
+				if count < minCount {
+					count = minCount
+				}
+				nodes = append(nodes, node{count, -1, -1, symbol})
+			}
+		}
+		if len(nodes) == 0 {
+			return lengths
+		} else if len(nodes) == 1 {
+			lengths[nodes[0].symbol] = 1
+			return lengths
+		}
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].count < nodes[j].count })
+
+		// two-queue Huffman construction of leaves sorted by count
+		numLeaves := len(nodes)
+		leaf, internal := 0, numLeaves
+		pick := func() int {
+			if leaf < numLeaves && (len(nodes) <= internal || nodes[leaf].count <= nodes[internal].count) {
+				leaf++
+				return leaf - 1
+			}
+			internal++
+			return internal - 1
+		}
+		for k := 0; k < numLeaves-1; k++ {
+			a := pick()
+			b := pick()
+			nodes = append(nodes, node{nodes[a].count + nodes[b].count, a, b, -1})
+		}
+
+		// assign depths from the root
+		depths := make([]int, len(nodes))
+		tooLong := false
+		for i := len(nodes) - 1; 0 <= i; i-- {
+			if nodes[i].left != -1 {
+				depths[nodes[i].left] = depths[i] + 1
+				depths[nodes[i].right] = depths[i] + 1
+			} else if maxLength < depths[i] {
+				tooLong = true
+			}
+		}
+		if !tooLong {
+			for i := 0; i < numLeaves; i++ {
+				lengths[nodes[i].symbol] = uint8(depths[i])
+			}
+			return lengths
+		}
+		minCount *= 2
+	}
+}
+
+// canonicalCode returns the canonical code for the code lengths, with the codes bit-reversed since they are read one bit at a time.
+func canonicalCode(lengths []uint8) huffmanCode {
+	var count, next [16]uint32
+	for _, length := range lengths {
+		count[length]++
+	}
+	count[0] = 0
+	code := uint32(0)
+	for length := 1; length < 16; length++ {
+		code = (code + count[length-1]) << 1
+		next[length] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for symbol, length := range lengths {
+		if length != 0 {
+			codes[symbol] = bits.Reverse32(next[length]) >> (32 - length)
+			next[length]++
+		}
+	}
+	return huffmanCode{
+		lengths: append([]uint8{}, lengths...),
+		codes:   codes,
+	}
+}
@@ -0,0 +1,356 @@
+// Package webp implements a lossless WebP (VP8L) encoder in pure Go.
+package webp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+const (
+	maxSize         = 1 << 14
+	numLiteralCodes = 256
+	numLengthCodes  = 24
+	numDistCodes    = 40
+	maxLength       = 4096
+	maxDistance     = 1<<20 - 120
+	minLength       = 3
+	maxChainLength  = 64
+	predictorBits   = 4 // predictor blocks of 16x16 pixels
+
+	predictorTransform     = 0
+	subtractGreenTransform = 2
+	colorIndexingTransform = 3
+)
+
+// distanceMapTable maps the 120 short distance codes to two-dimensional offsets, where the high nibble is the y-offset and 8 minus the low nibble is the x-offset.
+var distanceMapTable = [120]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+// codeLengthCodeOrder is the order in which the code lengths of the code length code are written.
+var codeLengthCodeOrder = [19]uint8{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// Encode writes the image in the lossless WebP format. Images with at most 256 colors are encoded using a color palette, other images are encoded using the subtract green and predictor transforms. All images are compressed using LZ77 backward references and Huffman coding.
+func Encode(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || maxSize < width || maxSize < height {
+		return fmt.Errorf("webp: invalid image size %dx%d", width, height)
+	}
+
+	pix := toARGB(img)
+	alpha := false
+	for _, c := range pix {
+		if c>>24 != 0xff {
+			alpha = true
+			break
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8) // signature
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if alpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+
+	if palette := colorPalette(pix, 256); palette != nil {
+		pix, width = applyColorIndexing(bw, pix, width, height, palette)
+	} else {
+		applySubtractGreen(bw, pix)
+		applyPredictor(bw, pix, width, height)
+	}
+	bw.write(0, 1) // no more transforms
+	writeEntropyImage(bw, pix, width, height, true)
+	data := bw.flush()
+
+	size := len(data)
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+size+size%2))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(size))
+	if size%2 == 1 {
+		data = append(data, 0)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// toARGB returns the non-premultiplied pixels of an image as 0xAARRGGBB.
+func toARGB(img image.Image) []uint32 {
+	bounds := img.Bounds()
+	pix := make([]uint32, 0, bounds.Dx()*bounds.Dy())
+	switch m := img.(type) {
+	case *image.NRGBA:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				i := m.PixOffset(x, y)
+				pix = append(pix, uint32(m.Pix[i+3])<<24|uint32(m.Pix[i+0])<<16|uint32(m.Pix[i+1])<<8|uint32(m.Pix[i+2]))
+			}
+		}
+	default:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				pix = append(pix, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+			}
+		}
+	}
+	return pix
+}
+
+// colorPalette returns the sorted colors of the pixels, or nil if there are more than n colors.
+func colorPalette(pix []uint32, n int) []uint32 {
+	colors := map[uint32]bool{}
+	for _, c := range pix {
+		if !colors[c] {
+			if len(colors) == n {
+				return nil
+			}
+			colors[c] = true
+		}
+	}
+	palette := make([]uint32, 0, len(colors))
+	for c := range colors {
+		palette = append(palette, c)
+	}
+	sort.Slice(palette, func(i, j int) bool { return palette[i] < palette[j] })
+	return palette
+}
+
+// applyColorIndexing writes the color indexing transform and returns the pixels replaced by their palette index, where multiple indices are bundled into one pixel for small palettes.
+func applyColorIndexing(bw *bitWriter, pix []uint32, width, height int, palette []uint32) ([]uint32, int) {
+	bw.write(1, 1)
+	bw.write(colorIndexingTransform, 2)
+	bw.write(uint32(len(palette)-1), 8)
+
+	// palette is delta coded
+	deltas := make([]uint32, len(palette))
+	indices := make(map[uint32]uint32, len(palette))
+	for i, c := range palette {
+		deltas[i] = c
+		if 0 < i {
+			deltas[i] = subPixels(c, palette[i-1])
+		}
+		indices[c] = uint32(i)
+	}
+	writeEntropyImage(bw, deltas, len(palette), 1, false)
+
+	widthBits := 0
+	if len(palette) <= 2 {
+		widthBits = 3
+	} else if len(palette) <= 4 {
+		widthBits = 2
+	} else if len(palette) <= 16 {
+		widthBits = 1
+	}
+	packedWidth := (width + 1<<widthBits - 1) >> widthBits
+	bitsPerPixel := 8 >> widthBits
+	xMask := 1<<widthBits - 1
+
+	packed := make([]uint32, packedWidth*height)
+	for i := range packed {
+		packed[i] = 0xff000000
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			index := indices[pix[y*width+x]]
+			packed[y*packedWidth+x>>widthBits] |= index << (8 + bitsPerPixel*(x&xMask))
+		}
+	}
+	return packed, packedWidth
+}
+
+// applySubtractGreen writes the subtract green transform and subtracts the green channel from the red and blue channels.
+func applySubtractGreen(bw *bitWriter, pix []uint32) {
+	bw.write(1, 1)
+	bw.write(subtractGreenTransform, 2)
+	for i, c := range pix {
+		green := (c >> 8) & 0xff
+		redBlue := (0xff00ff00 + (c & 0x00ff00ff) - (green<<16 | green)) & 0x00ff00ff
+		pix[i] = c&0xff00ff00 | redBlue
+	}
+}
+
+// applyPredictor writes the predictor transform with the best predictor for each block, and replaces the pixels by their residuals.
+func applyPredictor(bw *bitWriter, pix []uint32, width, height int) {
+	tilesX := (width + 1<<predictorBits - 1) >> predictorBits
+	tilesY := (height + 1<<predictorBits - 1) >> predictorBits
+	modes := make([]uint32, tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, y0 := tx<<predictorBits, ty<<predictorBits
+			x1, y1 := min(x0+1<<predictorBits, width), min(y0+1<<predictorBits, height)
+			bestMode, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := max(y0, 1); y < y1; y++ {
+					for x := max(x0, 1); x < x1; x++ {
+						i := y*width + x
+						cost += residualCost(subPixels(pix[i], predict(mode, pix, i, width)))
+					}
+				}
+				if bestCost == -1 || cost < bestCost {
+					bestMode, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(bestMode)<<8
+		}
+	}
+
+	bw.write(1, 1)
+	bw.write(predictorTransform, 2)
+	bw.write(predictorBits-2, 3)
+	writeEntropyImage(bw, modes, tilesX, tilesY, false)
+
+	// compute residuals backwards so that the predictions use the original pixels
+	for y := height - 1; 0 <= y; y-- {
+		for x := width - 1; 0 <= x; x-- {
+			i := y*width + x
+			var prediction uint32
+			if x == 0 && y == 0 {
+				prediction = 0xff000000
+			} else if y == 0 {
+				prediction = pix[i-1]
+			} else if x == 0 {
+				prediction = pix[i-width]
+			} else {
+				mode := int(modes[(y>>predictorBits)*tilesX+x>>predictorBits]>>8) & 0x0f
+				prediction = predict(mode, pix, i, width)
+			}
+			pix[i] = subPixels(pix[i], prediction)
+		}
+	}
+}
+
+func residualCost(c uint32) int {
+	cost := 0
+	for k := 0; k < 32; k += 8 {
+		d := int((c >> k) & 0xff)
+		if 128 < d {
+			d = 256 - d
+		}
+		cost += d
+	}
+	return cost
+}
+
+// predict returns the prediction of the pixel at index i, which may not be on the first row or column.
+func predict(mode int, pix []uint32, i, width int) uint32 {
+	L, T, TL, TR := pix[i-1], pix[i-width], pix[i-width-1], pix[i-width+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return L
+	case 2:
+		return T
+	case 3:
+		return TR
+	case 4:
+		return TL
+	case 5:
+		return average2(average2(L, TR), T)
+	case 6:
+		return average2(L, TL)
+	case 7:
+		return average2(L, T)
+	case 8:
+		return average2(TL, T)
+	case 9:
+		return average2(T, TR)
+	case 10:
+		return average2(average2(L, TL), average2(T, TR))
+	case 11:
+		// predicts the left or top pixel, whichever is closest to the gradient
+		pL, pT := 0, 0
+		for k := 0; k < 32; k += 8 {
+			l, t, tl := int((L>>k)&0xff), int((T>>k)&0xff), int((TL>>k)&0xff)
+			pL += abs(tl - t)
+			pT += abs(tl - l)
+		}
+		if pL < pT {
+			return L
+		}
+		return T
+	case 12:
+		var c uint32
+		for k := 0; k < 32; k += 8 {
+			l, t, tl := int((L>>k)&0xff), int((T>>k)&0xff), int((TL>>k)&0xff)
+			c |= uint32(clamp255(l+t-tl)) << k
+		}
+		return c
+	default:
+		avg := average2(L, T)
+		var c uint32
+		for k := 0; k < 32; k += 8 {
+			a, tl := int((avg>>k)&0xff), int((TL>>k)&0xff)
+			c |= uint32(clamp255(a+(a-tl)/2)) << k
+		}
+		return c
+	}
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+// subPixels subtracts each channel modulo 256.
+func subPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+func clamp255(v int) int {
+	if v < 0 {
+		return 0
+	} else if 255 < v {
+		return 255
+	}
+	return v
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a < b {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,96 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/tdewolff/test"
+	"golang.org/x/image/webp"
+)
+
+func testRoundTrip(t *testing.T, img *image.NRGBA) {
+	buf := &bytes.Buffer{}
+	test.Error(t, Encode(buf, img))
+
+	dec, err := webp.Decode(buf)
+	test.Error(t, err)
+	test.T(t, dec.Bounds().Size(), img.Bounds().Size())
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			c := color.NRGBAModel.Convert(dec.At(x, y)).(color.NRGBA)
+			if c != img.NRGBAAt(x, y) {
+				test.T(t, c, img.NRGBAAt(x, y), "pixel", x, y)
+				return
+			}
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	var tests = []struct {
+		name          string
+		width, height int
+		f             func(x, y int) color.NRGBA
+	}{
+		{"single", 1, 1, func(x, y int) color.NRGBA { return color.NRGBA{1, 2, 3, 4} }},
+		{"two colors", 37, 5, func(x, y int) color.NRGBA {
+			if (x+y)%3 == 0 {
+				return color.NRGBA{255, 0, 0, 255}
+			}
+			return color.NRGBA{0, 0, 0, 0}
+		}},
+		{"three colors", 13, 11, func(x, y int) color.NRGBA { return color.NRGBA{uint8(x % 3 * 100), 50, 0, 255} }},
+		{"sixteen colors", 33, 9, func(x, y int) color.NRGBA { return color.NRGBA{uint8(x * y % 16), 0, 200, 255} }},
+		{"palette", 40, 40, func(x, y int) color.NRGBA { return color.NRGBA{uint8(x * 5), uint8(y % 5), 7, 255} }},
+		{"gradient", 70, 35, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 3), uint8(y * 7), uint8(x * y), uint8(255 - x)}
+		}},
+		{"noise", 23, 19, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))}
+		}},
+		{"runs", 300, 200, func(x, y int) color.NRGBA {
+			if x < 150 {
+				return color.NRGBA{uint8(y), uint8(x / 50), 255, 255}
+			}
+			return color.NRGBA{255, uint8(x + y), uint8(x / 10 * 3), 128}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height))
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					img.SetNRGBA(x, y, tt.f(x, y))
+				}
+			}
+			testRoundTrip(t, img)
+		})
+	}
+}
+
+func TestHuffmanLengths(t *testing.T) {
+	// Fibonacci counts give the longest codes
+	histogram := make([]int, 30)
+	a, b := 1, 1
+	for i := range histogram {
+		histogram[i] = a
+		a, b = b, a+b
+	}
+	lengths := huffmanLengths(histogram, 15)
+	kraft := 0.0
+	for _, length := range lengths {
+		test.That(t, 0 < length && length <= 15, "bad length", length)
+		kraft += 1.0 / float64(uint(1)<<length)
+	}
+	test.T(t, kraft, 1.0)
+}
+
+func TestEncodeSize(t *testing.T) {
+	test.Error(t, Encode(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, 1, 1))))
+	test.That(t, Encode(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, 0, 1))) != nil)
+	test.That(t, Encode(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, maxSize+1, 1))) != nil)
+}
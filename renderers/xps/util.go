@@ -0,0 +1,79 @@
+package xps
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+)
+
+type dec float64
+
+func (f dec) String() string {
+	s := strconv.FormatFloat(float64(f), 'f', canvas.Precision, 64)
+	if strings.IndexByte(s, '.') != -1 {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
+
+// xpsColor returns a non-premultiplied sRGB color with alpha as #AARRGGBB.
+func xpsColor(c color.RGBA) string {
+	if c.A == 0 {
+		return "#00000000"
+	} else if c.A == 255 {
+		return fmt.Sprintf("#FF%02X%02X%02X", c.R, c.G, c.B)
+	}
+	a := uint32(c.A)
+	return fmt.Sprintf("#%02X%02X%02X%02X", c.A, uint32(c.R)*255/a, uint32(c.G)*255/a, uint32(c.B)*255/a)
+}
+
+// writePathData writes a path in the abbreviated geometry syntax.
+func writePathData(w io.Writer, p *canvas.Path) {
+	first := true
+	for scanner := p.Scanner(); scanner.Scan(); {
+		if !first {
+			fmt.Fprintf(w, " ")
+		}
+		first = false
+
+		end := scanner.End()
+		switch scanner.Cmd() {
+		case canvas.MoveToCmd:
+			fmt.Fprintf(w, "M %v,%v", dec(end.X), dec(end.Y))
+		case canvas.LineToCmd:
+			fmt.Fprintf(w, "L %v,%v", dec(end.X), dec(end.Y))
+		case canvas.QuadToCmd:
+			cp := scanner.CP1()
+			fmt.Fprintf(w, "Q %v,%v %v,%v", dec(cp.X), dec(cp.Y), dec(end.X), dec(end.Y))
+		case canvas.CubeToCmd:
+			cp1, cp2 := scanner.CP1(), scanner.CP2()
+			fmt.Fprintf(w, "C %v,%v %v,%v %v,%v", dec(cp1.X), dec(cp1.Y), dec(cp2.X), dec(cp2.Y), dec(end.X), dec(end.Y))
+		case canvas.ArcToCmd:
+			rx, ry, rot, large, sweep := scanner.Arc()
+			fmt.Fprintf(w, "A %v,%v %v %d %d %v,%v", dec(rx), dec(ry), dec(rot), boolInt(large), boolInt(sweep), dec(end.X), dec(end.Y))
+		case canvas.CloseCmd:
+			fmt.Fprintf(w, "Z")
+		}
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var xmlReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func escapeXML(s string) string {
+	return xmlReplacer.Replace(s)
+}
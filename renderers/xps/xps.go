@@ -0,0 +1,482 @@
+package xps
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+	canvasFont "github.com/tdewolff/canvas/font"
+)
+
+// pxPerMm is the number of XPS units (1/96 inch) per millimeter.
+const pxPerMm = 96.0 / 25.4
+
+const xpsNamespace = "http://schemas.openxps.org/oxps/v1.0"
+
+// Options are the XPS renderer options.
+type Options struct {
+	SubsetFonts bool // embed only the glyphs that are used
+	canvas.ImageEncoding
+}
+
+// DefaultOptions are the default XPS renderer options.
+var DefaultOptions = Options{
+	SubsetFonts:   true,
+	ImageEncoding: canvas.Lossless,
+}
+
+// XPS is an OpenXPS (ECMA-388) document renderer. It writes an OPC zip package with a fixed document sequence of a single fixed document, of which each page is a FixedPage with Path and Glyphs elements. Fonts are subsetted and embedded obfuscated. Be aware that radial gradients with a non-zero start radius are approximated for non-concentric circles, and that pattern fills other than hatch patterns are not supported.
+type XPS struct {
+	zip           *zip.Writer
+	width, height float64
+	opts          *Options
+
+	page   *bytes.Buffer
+	rels   []string // required resources of the current page
+	pages  int
+	fonts  map[*canvas.Font]*xpsFont
+	fontsL []*canvas.Font
+	images int
+	err    error
+}
+
+type xpsFont struct {
+	uri    string
+	key    [16]byte
+	subset *canvas.FontSubsetter
+}
+
+// New returns an OpenXPS document renderer.
+func New(w io.Writer, width, height float64, opts *Options) *XPS {
+	if opts == nil {
+		defaultOptions := DefaultOptions
+		opts = &defaultOptions
+	}
+
+	r := &XPS{
+		zip:   zip.NewWriter(w),
+		opts:  opts,
+		fonts: map[*canvas.Font]*xpsFont{},
+	}
+	r.writeFile("[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="fdseq" ContentType="application/vnd.ms-package.xps-fixeddocumentsequence+xml"/><Default Extension="fdoc" ContentType="application/vnd.ms-package.xps-fixeddocument+xml"/><Default Extension="fpage" ContentType="application/vnd.ms-package.xps-fixedpage+xml"/><Default Extension="odttf" ContentType="application/vnd.ms-package.obfuscated-opentype"/><Default Extension="png" ContentType="image/png"/><Default Extension="jpg" ContentType="image/jpeg"/></Types>`)
+	r.writeFile("_rels/.rels", `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="R0" Type="http://schemas.openxps.org/oxps/v1.0/fixedrepresentation" Target="/FixedDocumentSequence.fdseq"/></Relationships>`)
+	r.writeFile("FixedDocumentSequence.fdseq", `<?xml version="1.0" encoding="UTF-8"?>
+<FixedDocumentSequence xmlns="`+xpsNamespace+`"><DocumentReference Source="/Documents/1/FixedDocument.fdoc"/></FixedDocumentSequence>`)
+	r.NewPage(width, height)
+	return r
+}
+
+func (r *XPS) writeFile(name, content string) {
+	r.writeFileBytes(name, []byte(content))
+}
+
+func (r *XPS) writeFileBytes(name string, content []byte) {
+	if r.err != nil {
+		return
+	}
+	w, err := r.zip.Create(name)
+	if err != nil {
+		r.err = err
+		return
+	}
+	_, r.err = w.Write(content)
+}
+
+// NewPage adds a new page where further rendering will be written to.
+func (r *XPS) NewPage(width, height float64) {
+	r.finishPage()
+	r.width, r.height = width, height
+	r.pages++
+	r.page = &bytes.Buffer{}
+	r.rels = r.rels[:0]
+	fmt.Fprintf(r.page, `<?xml version="1.0" encoding="UTF-8"?>
+<FixedPage xmlns="%s" xml:lang="und" Width="%v" Height="%v">`, xpsNamespace, dec(width*pxPerMm), dec(height*pxPerMm))
+}
+
+func (r *XPS) finishPage() {
+	if r.page == nil {
+		return
+	}
+	fmt.Fprintf(r.page, `</FixedPage>`)
+	r.writeFileBytes(fmt.Sprintf("Documents/1/Pages/%d.fpage", r.pages), r.page.Bytes())
+	if 0 < len(r.rels) {
+		sb := strings.Builder{}
+		sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+		for i, rel := range r.rels {
+			fmt.Fprintf(&sb, `<Relationship Id="R%d" Type="http://schemas.openxps.org/oxps/v1.0/required-resource" Target="%s"/>`, i, rel)
+		}
+		sb.WriteString(`</Relationships>`)
+		r.writeFile(fmt.Sprintf("Documents/1/Pages/_rels/%d.fpage.rels", r.pages), sb.String())
+	}
+	r.page = nil
+}
+
+func (r *XPS) addRel(uri string) {
+	for _, rel := range r.rels {
+		if rel == uri {
+			return
+		}
+	}
+	r.rels = append(r.rels, uri)
+}
+
+// Close writes the fixed document and the fonts, and closes the XPS package.
+func (r *XPS) Close() error {
+	r.finishPage()
+
+	sb := strings.Builder{}
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<FixedDocument xmlns="` + xpsNamespace + `">`)
+	for i := 1; i <= r.pages; i++ {
+		fmt.Fprintf(&sb, `<PageContent Source="/Documents/1/Pages/%d.fpage"/>`, i)
+	}
+	sb.WriteString(`</FixedDocument>`)
+	r.writeFile("Documents/1/FixedDocument.fdoc", sb.String())
+
+	for _, font := range r.fontsL {
+		f := r.fonts[font]
+		fontProgram := font.SFNT.Data
+		if r.opts.SubsetFonts && !font.SFNT.IsCFF {
+			fontProgram, _ = font.SFNT.Subset(f.subset.List(), canvasFont.WriteMinTables)
+		}
+		r.writeFileBytes(f.uri[1:], obfuscate(fontProgram, f.key))
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+	return r.zip.Close()
+}
+
+// Size returns the size of the canvas in millimeters.
+func (r *XPS) Size() (float64, float64) {
+	return r.width, r.height
+}
+
+// pageMatrix returns the transformation from canvas coordinates to page coordinates, which have their origin in the top-left corner.
+func (r *XPS) pageMatrix() canvas.Matrix {
+	return canvas.Identity.Scale(pxPerMm, -pxPerMm).Translate(0.0, -r.height)
+}
+
+// RenderPath renders a path to the canvas using a style and a transformation matrix.
+func (r *XPS) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	if path.Empty() {
+		return
+	}
+
+	// XPS doesn't support the arcs joiner, miter joiner (not clipped), or miter joiner (clipped) with non-bevel fallback
+	strokeUnsupported := !m.IsSimilarity()
+	if _, ok := style.StrokeJoiner.(canvas.ArcsJoiner); ok {
+		strokeUnsupported = true
+	} else if miter, ok := style.StrokeJoiner.(canvas.MiterJoiner); ok {
+		if math.IsNaN(miter.Limit) {
+			strokeUnsupported = true
+		} else if _, ok := miter.GapJoiner.(canvas.BevelJoiner); !ok {
+			strokeUnsupported = true
+		}
+	}
+
+	if style.HasFill() && style.Fill.IsPattern() {
+		if hatch, ok := style.Fill.Pattern.(*canvas.HatchPattern); ok {
+			r.RenderPath(hatch.Tile(path.Transform(m)), canvas.Style{Fill: hatch.Fill}, canvas.Identity)
+		}
+		style.Fill = canvas.Paint{}
+	}
+	if style.HasStroke() && strokeUnsupported {
+		if style.HasFill() {
+			r.writePath(path.Transform(r.pageMatrix().Mul(m)), style.Fill, style.FillRule, canvas.Paint{}, canvas.Style{})
+		}
+
+		// stroke settings unsupported by XPS, draw stroke explicitly
+		if style.IsDashed() {
+			path = path.Dash(style.DashOffset, style.Dashes...)
+		}
+		path = path.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner, canvas.Tolerance)
+		r.writePath(path.Transform(r.pageMatrix().Mul(m)), style.Stroke, canvas.NonZero, canvas.Paint{}, canvas.Style{})
+		return
+	}
+
+	m = r.pageMatrix().Mul(m)
+	scale := math.Sqrt(math.Abs(m.Det()))
+	style.StrokeWidth *= scale
+	style.DashOffset *= scale
+	dashes := make([]float64, len(style.Dashes))
+	for i := range style.Dashes {
+		dashes[i] = style.Dashes[i] * scale
+	}
+	style.Dashes = dashes
+	r.writePath(path.Transform(m), style.Fill, style.FillRule, style.Stroke, style)
+}
+
+// writePath writes a path in page coordinates.
+func (r *XPS) writePath(path *canvas.Path, fill canvas.Paint, fillRule canvas.FillRule, stroke canvas.Paint, style canvas.Style) {
+	if !fill.Has() && !stroke.Has() {
+		return
+	}
+
+	fmt.Fprintf(r.page, `<Path Data="`)
+	if fillRule == canvas.EvenOdd {
+		fmt.Fprintf(r.page, `F 0 `)
+	} else {
+		fmt.Fprintf(r.page, `F 1 `)
+	}
+	writePathData(r.page, path)
+	fmt.Fprintf(r.page, `"`)
+	if fill.IsColor() {
+		fmt.Fprintf(r.page, ` Fill="%s"`, xpsColor(fill.Color))
+	}
+	if stroke.Has() {
+		if stroke.IsColor() {
+			fmt.Fprintf(r.page, ` Stroke="%s"`, xpsColor(stroke.Color))
+		}
+		fmt.Fprintf(r.page, ` StrokeThickness="%v"`, dec(style.StrokeWidth))
+
+		lineCap := "Round"
+		if _, ok := style.StrokeCapper.(canvas.ButtCapper); ok {
+			lineCap = "Flat"
+		} else if _, ok := style.StrokeCapper.(canvas.SquareCapper); ok {
+			lineCap = "Square"
+		}
+		if lineCap != "Flat" {
+			fmt.Fprintf(r.page, ` StrokeStartLineCap="%s" StrokeEndLineCap="%s"`, lineCap, lineCap)
+		}
+		if _, ok := style.StrokeJoiner.(canvas.BevelJoiner); ok {
+			fmt.Fprintf(r.page, ` StrokeLineJoin="Bevel"`)
+		} else if _, ok := style.StrokeJoiner.(canvas.RoundJoiner); ok {
+			fmt.Fprintf(r.page, ` StrokeLineJoin="Round"`)
+		} else if miter, ok := style.StrokeJoiner.(canvas.MiterJoiner); ok && miter.Limit != 10.0 {
+			fmt.Fprintf(r.page, ` StrokeMiterLimit="%v"`, dec(miter.Limit))
+		}
+		if style.IsDashed() && 0.0 < style.StrokeWidth {
+			// dashes are relative to the stroke thickness
+			fmt.Fprintf(r.page, ` StrokeDashArray="`)
+			dashes := style.Dashes
+			if len(dashes)%2 == 1 {
+				dashes = append(dashes, dashes...)
+			}
+			for i, dash := range dashes {
+				if i != 0 {
+					fmt.Fprintf(r.page, ` `)
+				}
+				fmt.Fprintf(r.page, `%v`, dec(dash/style.StrokeWidth))
+			}
+			fmt.Fprintf(r.page, `"`)
+			if style.DashOffset != 0.0 {
+				fmt.Fprintf(r.page, ` StrokeDashOffset="%v"`, dec(style.DashOffset/style.StrokeWidth))
+			}
+			if lineCap != "Flat" {
+				fmt.Fprintf(r.page, ` StrokeDashCap="%s"`, lineCap)
+			}
+		}
+	}
+	if fill.IsGradient() || stroke.IsGradient() {
+		fmt.Fprintf(r.page, `>`)
+		if fill.IsGradient() {
+			fmt.Fprintf(r.page, `<Path.Fill>`)
+			r.writeGradient(fill.Gradient)
+			fmt.Fprintf(r.page, `</Path.Fill>`)
+		}
+		if stroke.IsGradient() {
+			fmt.Fprintf(r.page, `<Path.Stroke>`)
+			r.writeGradient(stroke.Gradient)
+			fmt.Fprintf(r.page, `</Path.Stroke>`)
+		}
+		fmt.Fprintf(r.page, `</Path>`)
+	} else {
+		fmt.Fprintf(r.page, `/>`)
+	}
+}
+
+// writeGradient writes a gradient brush, where the gradient is in canvas coordinates.
+func (r *XPS) writeGradient(gradient canvas.Gradient) {
+	m := r.pageMatrix()
+	switch g := gradient.(type) {
+	case *canvas.LinearGradient:
+		start, end := m.Dot(g.Start), m.Dot(g.End)
+		fmt.Fprintf(r.page, `<LinearGradientBrush MappingMode="Absolute" StartPoint="%v,%v" EndPoint="%v,%v"><LinearGradientBrush.GradientStops>`, dec(start.X), dec(start.Y), dec(end.X), dec(end.Y))
+		writeGradientStops(r.page, g.Stops, 0.0)
+		fmt.Fprintf(r.page, `</LinearGradientBrush.GradientStops></LinearGradientBrush>`)
+	case *canvas.RadialGradient:
+		// XPS radial gradients start at a point, stops are remapped to start at the inner radius
+		origin, center := m.Dot(g.C0), m.Dot(g.C1)
+		radius := g.R1 * pxPerMm
+		t0 := 0.0
+		if 0.0 < g.R1 {
+			t0 = math.Max(0.0, math.Min(1.0, g.R0/g.R1))
+		}
+		fmt.Fprintf(r.page, `<RadialGradientBrush MappingMode="Absolute" Center="%v,%v" GradientOrigin="%v,%v" RadiusX="%v" RadiusY="%v"><RadialGradientBrush.GradientStops>`, dec(center.X), dec(center.Y), dec(origin.X), dec(origin.Y), dec(radius), dec(radius))
+		writeGradientStops(r.page, g.Stops, t0)
+		fmt.Fprintf(r.page, `</RadialGradientBrush.GradientStops></RadialGradientBrush>`)
+	default:
+		center := canvas.Point{X: r.width / 2.0, Y: r.height / 2.0}
+		fmt.Fprintf(r.page, `<SolidColorBrush Color="%s"/>`, xpsColor(gradient.At(center.X, center.Y)))
+	}
+}
+
+func writeGradientStops(w io.Writer, stops canvas.Stops, t0 float64) {
+	if len(stops) == 0 {
+		fmt.Fprintf(w, `<GradientStop Color="#00000000" Offset="0"/>`)
+		return
+	}
+	if t0 != 0.0 {
+		fmt.Fprintf(w, `<GradientStop Color="%s" Offset="0"/>`, xpsColor(stops[0].Color))
+	}
+	for _, stop := range stops {
+		fmt.Fprintf(w, `<GradientStop Color="%s" Offset="%v"/>`, xpsColor(stop.Color), dec(t0+stop.Offset*(1.0-t0)))
+	}
+}
+
+// RenderText renders a text object to the canvas using a transformation matrix.
+func (r *XPS) RenderText(text *canvas.Text, m canvas.Matrix) {
+	if text.WritingMode != canvas.HorizontalTB {
+		text.RenderAsPath(r, m, canvas.DefaultResolution)
+		return
+	}
+
+	text.WalkDecorations(func(paint canvas.Paint, p *canvas.Path) {
+		style := canvas.DefaultStyle
+		style.Fill = paint
+		r.RenderPath(p, style, m)
+	})
+
+	text.WalkSpans(func(x, y float64, span canvas.TextSpan) {
+		if !span.IsText() {
+			for _, obj := range span.Objects {
+				obj.Canvas.RenderViewTo(r, m.Mul(obj.View(x, y, span.Face)))
+			}
+		} else if 0 < len(span.Glyphs) {
+			r.writeGlyphs(x, y, span, m)
+		}
+	})
+}
+
+// writeGlyphs writes a text span as a Glyphs element with glyph indices of the embedded font.
+func (r *XPS) writeGlyphs(x, y float64, span canvas.TextSpan, m canvas.Matrix) {
+	face := span.Face
+	font := r.getFont(face.Font)
+	unitsPerEm := float64(face.Font.Head.UnitsPerEm)
+
+	// glyph coordinates are in millimeters with the y-axis pointing down
+	m = r.pageMatrix().Mul(m).Scale(1.0, -1.0)
+	fmt.Fprintf(r.page, `<Glyphs RenderTransform="%v,%v,%v,%v,%v,%v" FontUri="%s" FontRenderingEmSize="%v" OriginX="%v" OriginY="%v"`, dec(m[0][0]), dec(m[1][0]), dec(m[0][1]), dec(m[1][1]), dec(m[0][2]), dec(m[1][2]), font.uri, dec(face.Size), dec(x), dec(-y))
+	if face.Fill.IsColor() {
+		fmt.Fprintf(r.page, ` Fill="%s"`, xpsColor(face.Fill.Color))
+	}
+	if face.FauxBold != 0.0 && face.FauxItalic != 0.0 {
+		fmt.Fprintf(r.page, ` StyleSimulations="BoldItalicSimulation"`)
+	} else if face.FauxBold != 0.0 {
+		fmt.Fprintf(r.page, ` StyleSimulations="BoldSimulation"`)
+	} else if face.FauxItalic != 0.0 {
+		fmt.Fprintf(r.page, ` StyleSimulations="ItalicSimulation"`)
+	}
+
+	// the Unicode string can only be given without a cluster map when each character maps to one glyph
+	runes := []rune(span.Text)
+	if len(runes) == len(span.Glyphs) {
+		s := string(runes)
+		if strings.HasPrefix(s, "{") {
+			s = "{}" + s
+		}
+		fmt.Fprintf(r.page, ` UnicodeString="%s"`, escapeXML(s))
+	}
+
+	fmt.Fprintf(r.page, ` Indices="`)
+	for i, glyph := range span.Glyphs {
+		if i != 0 {
+			fmt.Fprintf(r.page, `;`)
+		}
+		glyphID := glyph.ID
+		if !face.Font.SFNT.IsCFF && r.opts.SubsetFonts {
+			glyphID = font.subset.Get(glyph.ID)
+		}
+		fmt.Fprintf(r.page, `%d,%v`, glyphID, dec(float64(glyph.XAdvance)/unitsPerEm*100.0))
+		if glyph.XOffset != 0 || glyph.YOffset != 0 {
+			fmt.Fprintf(r.page, `,%v,%v`, dec(float64(glyph.XOffset)/unitsPerEm*100.0), dec(float64(glyph.YOffset)/unitsPerEm*100.0))
+		}
+	}
+	fmt.Fprintf(r.page, `"`)
+
+	if face.Fill.IsGradient() {
+		fmt.Fprintf(r.page, `><Glyphs.Fill>`)
+		r.writeGradient(face.Fill.Gradient)
+		fmt.Fprintf(r.page, `</Glyphs.Fill></Glyphs>`)
+	} else {
+		fmt.Fprintf(r.page, `/>`)
+	}
+}
+
+func (r *XPS) getFont(font *canvas.Font) *xpsFont {
+	f, ok := r.fonts[font]
+	if !ok {
+		// the obfuscation key is the GUID of the font's name
+		hash := md5.Sum([]byte(fmt.Sprintf("%s-%d", font.Name(), len(r.fontsL))))
+		hash[6] = hash[6]&0x0f | 0x30 // version 3
+		hash[8] = hash[8]&0x3f | 0x80 // variant
+		guid := fmt.Sprintf("%X-%X-%X-%X-%X", hash[0:4], hash[4:6], hash[6:8], hash[8:10], hash[10:16])
+
+		f = &xpsFont{
+			uri:    "/Resources/Fonts/" + guid + ".odttf",
+			key:    hash,
+			subset: canvas.NewFontSubsetter(),
+		}
+		r.fonts[font] = f
+		r.fontsL = append(r.fontsL, font)
+	}
+	r.addRel(f.uri)
+	return f
+}
+
+// obfuscate obfuscates a font by XOR-ing the first 32 bytes with the GUID of its file name in reverse order.
+func obfuscate(b []byte, key [16]byte) []byte {
+	b = append([]byte{}, b...)
+	for i := 0; i < 32 && i < len(b); i++ {
+		b[i] ^= key[15-i%16]
+	}
+	return b
+}
+
+// RenderImage renders an image to the canvas using a transformation matrix.
+func (r *XPS) RenderImage(img image.Image, m canvas.Matrix) {
+	size := img.Bounds().Size()
+	if size.X == 0 || size.Y == 0 {
+		return
+	}
+
+	var data []byte
+	ext := "png"
+	if cimg, ok := img.(canvas.Image); ok && 0 < len(cimg.Bytes) && (cimg.Mimetype == "image/png" || cimg.Mimetype == "image/jpeg") {
+		data = cimg.Bytes
+		if cimg.Mimetype == "image/jpeg" {
+			ext = "jpg"
+		}
+	} else {
+		buf := &bytes.Buffer{}
+		opaque, _ := img.(interface{ Opaque() bool })
+		if r.opts.ImageEncoding == canvas.Lossy && opaque != nil && opaque.Opaque() {
+			ext = "jpg"
+			r.err = jpeg.Encode(buf, img, nil)
+		} else {
+			r.err = png.Encode(buf, img)
+		}
+		data = buf.Bytes()
+	}
+	r.images++
+	uri := fmt.Sprintf("/Resources/Images/%d.%s", r.images, ext)
+	r.writeFileBytes(uri[1:], data)
+	r.addRel(uri)
+
+	// transformation from pixel coordinates with a top-left origin to page coordinates
+	m = r.pageMatrix().Mul(m).Translate(0.0, float64(size.Y)).Scale(1.0, -1.0)
+	fmt.Fprintf(r.page, `<Path RenderTransform="%v,%v,%v,%v,%v,%v" Data="M 0,0 L %d,0 %d,%d 0,%d Z"><Path.Fill><ImageBrush ImageSource="%s" Viewbox="0,0,%d,%d" ViewboxUnits="Absolute" Viewport="0,0,%d,%d" ViewportUnits="Absolute" TileMode="None"/></Path.Fill></Path>`, dec(m[0][0]), dec(m[1][0]), dec(m[0][1]), dec(m[1][1]), dec(m[0][2]), dec(m[1][2]), size.X, size.X, size.Y, size.Y, uri, size.X, size.Y, size.X, size.Y)
+}
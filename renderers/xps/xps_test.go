@@ -0,0 +1,107 @@
+package xps
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/test"
+)
+
+func readParts(t *testing.T, b []byte) map[string]string {
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	test.Error(t, err)
+	parts := map[string]string{}
+	for _, f := range z.File {
+		rc, err := f.Open()
+		test.Error(t, err)
+		data, err := io.ReadAll(rc)
+		test.Error(t, err)
+		parts[f.Name] = string(data)
+	}
+	return parts
+}
+
+func TestXPS(t *testing.T) {
+	gradient := canvas.NewLinearGradient(canvas.Point{X: 0.0, Y: 0.0}, canvas.Point{X: 10.0, Y: 0.0})
+	gradient.Add(0.0, canvas.Red)
+	gradient.Add(1.0, canvas.Blue)
+
+	buf := &bytes.Buffer{}
+	xps := New(buf, 50.0, 30.0, nil)
+	xps.RenderPath(canvas.Rectangle(10.0, 10.0), canvas.Style{Fill: canvas.Paint{Gradient: gradient}}, canvas.Identity)
+	xps.NewPage(25.4, 25.4)
+	style := canvas.DefaultStyle
+	style.Fill = canvas.Paint{Color: canvas.RGBA(255, 0, 0, 0.5)}
+	style.Stroke = canvas.Paint{Color: canvas.Black}
+	style.StrokeWidth = 1.0
+	xps.RenderPath(canvas.MustParseSVGPath("M0 0L10 0Q10 10 0 10z"), style, canvas.Identity)
+	test.Error(t, xps.Close())
+
+	parts := readParts(t, buf.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "FixedDocumentSequence.fdseq", "Documents/1/FixedDocument.fdoc", "Documents/1/Pages/1.fpage", "Documents/1/Pages/2.fpage"} {
+		_, ok := parts[name]
+		test.That(t, ok, "missing part", name)
+	}
+	test.That(t, strings.Contains(parts["Documents/1/FixedDocument.fdoc"], `<PageContent Source="/Documents/1/Pages/2.fpage"/>`))
+
+	page1 := parts["Documents/1/Pages/1.fpage"]
+	test.That(t, strings.Contains(page1, `Width="188.97637795" Height="113.38582677"`), page1)
+	test.That(t, strings.Contains(page1, `<Path Data="F 1 M 0,113.38582677 L 37.79527559,113.38582677 L 37.79527559,75.59055118 L 0,75.59055118 Z"><Path.Fill><LinearGradientBrush MappingMode="Absolute" StartPoint="0,113.38582677" EndPoint="37.79527559,113.38582677">`), page1)
+	test.That(t, strings.Contains(page1, `<GradientStop Color="#FFFF0000" Offset="0"/><GradientStop Color="#FF0000FF" Offset="1"/>`), page1)
+
+	page2 := parts["Documents/1/Pages/2.fpage"]
+	test.That(t, strings.Contains(page2, `Width="96" Height="96"`), page2)
+	test.That(t, strings.Contains(page2, `Data="F 1 M 0,96 L 37.79527559,96 Q 37.79527559,58.20472441 0,58.20472441 Z" Fill="#7FFF0000" Stroke="#FF000000" StrokeThickness="3.77952756"`), page2)
+}
+
+func TestXPSText(t *testing.T) {
+	family := canvas.NewFontFamily("dejavu-serif")
+	if err := family.LoadFontFile("../../resources/DejaVuSerif.ttf", canvas.FontRegular); err != nil {
+		test.Error(t, err)
+	}
+	face := family.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	c := canvas.New(50.0, 30.0)
+	ctx := canvas.NewContext(c)
+	ctx.DrawText(5.0, 5.0, canvas.NewTextLine(face, "Paper", canvas.Left))
+
+	buf := &bytes.Buffer{}
+	xps := New(buf, c.W, c.H, nil)
+	c.RenderTo(xps)
+	test.Error(t, xps.Close())
+
+	parts := readParts(t, buf.Bytes())
+	page := parts["Documents/1/Pages/1.fpage"]
+	test.That(t, strings.Contains(page, `UnicodeString="Paper"`), page)
+	test.That(t, strings.Contains(page, `Indices="1,`), page)
+
+	rels := parts["Documents/1/Pages/_rels/1.fpage.rels"]
+	i := strings.Index(rels, `Target="/`)
+	test.That(t, i != -1, rels)
+	uri := rels[i+len(`Target="/`):]
+	uri = uri[:strings.IndexByte(uri, '"')]
+	test.That(t, strings.HasSuffix(uri, ".odttf"), uri)
+
+	// deobfuscating gives back the sfnt version
+	var key [16]byte
+	guid := strings.ReplaceAll(strings.TrimSuffix(uri[len("Resources/Fonts/"):], ".odttf"), "-", "")
+	for j := 0; j < 16; j++ {
+		var v byte
+		for _, c := range guid[2*j : 2*j+2] {
+			v <<= 4
+			if c <= '9' {
+				v |= byte(c - '0')
+			} else {
+				v |= byte(c-'A') + 10
+			}
+		}
+		key[j] = v
+	}
+	font := obfuscate([]byte(parts[uri]), key)
+	test.Bytes(t, font[:4], []byte{0, 1, 0, 0})
+	test.That(t, len(font) < 100000, "font not subsetted")
+}
@@ -3,9 +3,13 @@ package canvas
 import (
 	"bytes"
 	"fmt"
+	"image"
 	"image/color"
+	"image/draw"
 	"io"
+	"io/ioutil"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -22,15 +26,51 @@ type svgElem struct {
 	tag   string
 	id    string
 	attrs map[string]string
+	node  *svgTag
+}
+
+func newSVGElem(tag *svgTag) svgElem {
+	return svgElem{tag.name, tag.attrs["id"], tag.attrs, tag}
+}
+
+// siblings returns the element siblings of the element, including itself, and its index among them.
+func (elem svgElem) siblings() ([]*svgTag, int) {
+	if elem.node == nil || elem.node.parent == nil {
+		return []*svgTag{elem.node}, 0
+	}
+	index := 0
+	siblings := []*svgTag{}
+	for _, child := range elem.node.parent.content {
+		if child == elem.node {
+			index = len(siblings)
+		}
+		if child.name != "" {
+			siblings = append(siblings, child)
+		}
+	}
+	return siblings, index
 }
 
 type svgState struct {
 	strokeMiterLimit float64
-	textX            float64
-	textY            float64
 	textAnchor       string
+	dominantBaseline string
 	fontFamily       string
 	fontSize         float64
+	fontStyle        FontStyle
+	letterSpacing    float64
+	fillOpacity      float64
+	strokeOpacity    float64
+	hidden           bool // visibility
+
+	// inherited definitions for attributes
+	fillDef, strokeDef                svgDef
+	markerStart, markerMid, markerEnd svgDef
+
+	// not inherited
+	clipPath, mask, filter *svgTag
+	opacity                float64
+	display                string
 }
 
 var svgDefaultState = svgState{
@@ -38,6 +78,62 @@ var svgDefaultState = svgState{
 	textAnchor:       "start",
 	fontFamily:       "serif",
 	fontSize:         16.0, // in px
+	fillOpacity:      1.0,
+	strokeOpacity:    1.0,
+	opacity:          1.0,
+}
+
+// svgFont is a font family loaded from the system fonts for a font-family property.
+type svgFont struct {
+	family   *FontFamily
+	name     string
+	filename string             // of the regular font, empty if resolved
+	styles   map[FontStyle]bool // styles that have been looked up
+}
+
+// svgTextList holds the positioning attributes of a text or tspan element, which apply to its characters in order.
+type svgTextList struct {
+	x, y, dx, dy, rotate []float64
+	i                    int // index of the next character
+}
+
+// svgTextPath is the path of a textPath element along which characters are placed.
+type svgTextPath struct {
+	points []Point
+	dists  []float64 // distance along the path for each point
+	offset float64
+}
+
+// svgChar is a character of a text element with the styling and positioning attributes that apply to it, unset positions are NaN.
+type svgChar struct {
+	r             rune
+	face          *FontFace
+	anchor        string
+	baseline      float64 // shift of the baseline
+	letterSpacing float64
+	hidden        bool
+	x, y, dx, dy  float64
+	rotate        float64
+	path          *svgTextPath
+}
+
+// svgText collects the characters of a text element.
+type svgText struct {
+	chars []svgChar
+	lists []*svgTextList
+	path  *svgTextPath
+	space bool // previous character is white space, or at the start
+}
+
+// svgTextPiece is a run of characters that is shaped and drawn together.
+type svgTextPiece struct {
+	x, y, rotate float64
+	baseline     float64
+	anchor       string
+	hidden       bool
+	path         *svgTextPath
+	text         *Text
+	width        float64
 }
 
 type svgCanvas struct {
@@ -55,69 +151,133 @@ type svgParser struct {
 	stateStack []svgState
 	state      svgState
 
-	cssRules []cssRule // from <style>
+	cssRules []cssRule          // from <style>
+	tags     map[string]*svgTag // elements by ID
 	defs     map[string]svgDef
-	fonts    map[string]*FontFamily
-
-	// active definitions for attributes
-	activeDefs map[string]svgDef
+	fonts    map[string]*svgFont // by font-family
+	useStack []*svgTag           // referenced elements being drawn, to detect circular references
+	defStack []*svgTag           // pattern, clipPath, and mask elements being drawn, to detect circular references
+
+	offset   int // position in the source of the element or attribute being processed
+	strict   bool
+	resolver SVGResolver
+	warnings []SVGWarning
+	warned   map[string]bool // by position and message
 }
 
 func (svg *svgParser) parseViewBox(attrWidth, attrHeight, attrViewBox string) (float64, float64, [4]float64) {
-	var err error
 	var viewbox [4]float64
 	var width, height float64
 	if attrViewBox != "" {
-		vals := strings.Split(attrViewBox, " ")
+		vals := svg.parsePoints(attrViewBox)
 		if len(vals) != 4 {
-			svg.err = parse.NewErrorLexer(svg.z, "bad viewBox")
-		} else {
-			for i := 0; i < 4; i++ {
-				viewbox[i], err = strconv.ParseFloat(vals[i], 64)
-				if err != nil && svg.err == nil {
-					svg.err = parse.NewErrorLexer(svg.z, "bad viewBox: %w", err)
-				}
+			if svg.err == nil {
+				svg.err = svg.newError("bad viewBox")
 			}
+		} else {
+			copy(viewbox[:], vals)
 		}
 	}
 	if attrWidth != "" {
 		width = svg.parseDimension(attrWidth, 0.0)
 	} else {
-		width = (viewbox[2] - viewbox[0]) * 25.4 / 96.0
+		width = viewbox[2]
 	}
 	if attrHeight != "" {
 		height = svg.parseDimension(attrHeight, 0.0)
 	} else {
-		height = (viewbox[3] - viewbox[1]) * 25.4 / 96.0
+		height = viewbox[3]
 	}
 	return width, height, viewbox
 }
 
-func (svg *svgParser) init(width, height float64, viewbox [4]float64) {
-	svg.width, svg.height = width*96.0/25.4, height*96.0/25.4
-	svg.diagonal = math.Sqrt((svg.width*svg.width + svg.height*svg.height) / 2.0)
+// parseViewBoxTransform returns the transformation from the viewBox (min-x, min-y, width, height) to a viewport of the given size, respecting the preserveAspectRatio attribute.
+func (svg *svgParser) parseViewBoxTransform(width, height float64, viewbox [4]float64, preserveAspectRatio string) Matrix {
+	if viewbox[2] <= 0.0 || viewbox[3] <= 0.0 {
+		return Identity
+	}
+
+	align, meetOrSlice := "xmidymid", "meet"
+	if fields := strings.Fields(strings.ToLower(preserveAspectRatio)); 0 < len(fields) {
+		align = fields[0]
+		if 1 < len(fields) {
+			meetOrSlice = fields[1]
+		}
+	}
+
+	sx, sy := width/viewbox[2], height/viewbox[3]
+	if align != "none" {
+		if meetOrSlice == "slice" {
+			sx = math.Max(sx, sy)
+		} else {
+			sx = math.Min(sx, sy)
+		}
+		sy = sx
+	}
+
+	tx, ty := -viewbox[0]*sx, -viewbox[1]*sy
+	if strings.Contains(align, "xmid") {
+		tx += (width - viewbox[2]*sx) / 2.0
+	} else if strings.Contains(align, "xmax") {
+		tx += width - viewbox[2]*sx
+	}
+	if strings.Contains(align, "ymid") {
+		ty += (height - viewbox[3]*sy) / 2.0
+	} else if strings.Contains(align, "ymax") {
+		ty += height - viewbox[3]*sy
+	}
+	return Identity.Translate(tx, ty).Scale(sx, sy)
+}
 
+// init creates a canvas with the given size in millimeters, where view transforms user units to millimeters.
+func (svg *svgParser) init(width, height float64, view Matrix) {
 	svg.c = New(width, height)
 	svg.ctx = NewContext(svg.c)
 	svg.ctx.SetCoordSystem(CartesianIV)
-	if 0.0 < (viewbox[2]-viewbox[0]) && 0.0 < (viewbox[3]-viewbox[1]) {
-		m := Identity.Scale(width/(viewbox[2]-viewbox[0]), height/(viewbox[3]-viewbox[1])).Translate(-viewbox[0], -viewbox[1])
-		svg.ctx.SetView(m)
-		svg.ctx.SetCoordView(m)
-	}
+	svg.ctx.SetView(view)
 	svg.ctx.SetStrokeJoiner(MiterJoiner{BevelJoin, svgDefaultState.strokeMiterLimit})
 	svg.state = svgDefaultState
 }
 
-func (svg *svgParser) push(tag string, attrs map[string]string) {
+// setViewport sets the size of the viewport in user units, which is used for percentages.
+func (svg *svgParser) setViewport(width, height float64) {
+	svg.width, svg.height = width, height
+	svg.diagonal = math.Sqrt((svg.width*svg.width + svg.height*svg.height) / 2.0)
+}
+
+// newError returns an error at the position of the element or attribute being processed.
+func (svg *svgParser) newError(message string, a ...interface{}) error {
+	return parse.NewError(bytes.NewReader(svg.z.Bytes()), svg.offset, message, a...)
+}
+
+// warn adds a warning for unsupported content at a position in the source. In strict mode it is an error.
+func (svg *svgParser) warn(offset int, message string, a ...interface{}) {
+	err := parse.NewError(bytes.NewReader(svg.z.Bytes()), offset, message, a...)
+	key := fmt.Sprintf("%d:%s", offset, err.Message)
+	if svg.warned[key] {
+		return
+	}
+	svg.warned[key] = true
+	svg.warnings = append(svg.warnings, SVGWarning{err.Line, err.Column, err.Message})
+	if svg.strict && svg.err == nil {
+		svg.err = err
+	}
+}
+
+func (svg *svgParser) push(tag *svgTag) {
+	svg.offset = tag.offset
 	svg.ctx.Push()
 	svg.stateStack = append(svg.stateStack, svg.state)
-	svg.elemStack = append(svg.elemStack, svgElem{tag, attrs["id"], attrs})
+	svg.elemStack = append(svg.elemStack, newSVGElem(tag))
+
+	// reset properties that are not inherited
+	svg.state.opacity = 1.0
+	svg.state.display = ""
 }
 
 func (svg *svgParser) pop() {
 	if len(svg.stateStack) == 0 {
-		svg.err = parse.NewErrorLexer(svg.z, "invalid SVG")
+		svg.err = svg.newError("invalid SVG")
 		return
 	}
 	svg.elemStack = svg.elemStack[:len(svg.elemStack)-1]
@@ -137,7 +297,7 @@ func (svg *svgParser) parseNumber(v string) float64 {
 	num, err := strconv.ParseFloat(v, 64)
 	if err != nil {
 		if svg.err == nil {
-			svg.err = parse.NewErrorLexer(svg.z, "bad number: %w: %s", err, v)
+			svg.err = svg.newError("bad number: %w: %s", err, v)
 		}
 		return 0.0
 	}
@@ -156,7 +316,7 @@ func (svg *svgParser) parseDimension(v string, parent float64) float64 {
 	num, err := strconv.ParseFloat(v[:nn], 64)
 	if err != nil {
 		if svg.err == nil {
-			svg.err = parse.NewErrorLexer(svg.z, "bad dimension: %w: %s", err, v)
+			svg.err = svg.newError("bad dimension: %w: %s", err, v)
 		}
 		return 0.0
 	}
@@ -178,6 +338,10 @@ func (svg *svgParser) parseDimension(v string, parent float64) float64 {
 		return num * 96.0 / 72.0
 	case "", "px":
 		return num
+	case "em":
+		return num * svg.state.fontSize
+	case "ex":
+		return num * svg.state.fontSize / 2.0
 
 	// angles
 	case "deg":
@@ -194,7 +358,7 @@ func (svg *svgParser) parseDimension(v string, parent float64) float64 {
 		return num * parent / 100.0
 	}
 	if svg.err == nil {
-		svg.err = parse.NewErrorLexer(svg.z, "unknown dimension: %s", dim)
+		svg.err = svg.newError("unknown dimension: %s", dim)
 	}
 	return 0.0
 }
@@ -206,13 +370,13 @@ func (svg *svgParser) parseColorComponent(v string) uint8 {
 	} else if v[len(v)-1] == '%' {
 		num, err := strconv.ParseFloat(v[:len(v)-1], 64)
 		if err != nil && svg.err == nil {
-			svg.err = parse.NewErrorLexer(svg.z, "bad color component: %w: %s", err, v)
+			svg.err = svg.newError("bad color component: %w: %s", err, v)
 		}
-		return uint8(num*255.0 + 0.5)
+		return uint8(math.Min(math.Max(num, 0.0), 100.0)/100.0*255.0 + 0.5)
 	}
 	num, err := strconv.ParseUint(v, 10, 8)
 	if err != nil && svg.err == nil {
-		svg.err = parse.NewErrorLexer(svg.z, "bad color component: %w: %s", err, v)
+		svg.err = svg.newError("bad color component: %w: %s", err, v)
 	}
 	return uint8(num)
 }
@@ -239,7 +403,7 @@ func (svg *svgParser) parseColor(v string) color.RGBA {
 		comps := strings.Split(v[4:len(v)-1], ",")
 		if len(comps) != 3 {
 			if svg.err == nil {
-				svg.err = parse.NewErrorLexer(svg.z, "bad rgb function: %s", v)
+				svg.err = svg.newError("bad rgb function: %s", v)
 			}
 			return Black
 		}
@@ -251,11 +415,12 @@ func (svg *svgParser) parseColor(v string) color.RGBA {
 		comps := strings.Split(v[5:len(v)-1], ",")
 		if len(comps) != 4 {
 			if svg.err == nil {
-				svg.err = parse.NewErrorLexer(svg.z, "bad rgba function: %s", v)
+				svg.err = svg.newError("bad rgba function: %s", v)
 			}
 			return Black
 		}
-		col.A = svg.parseColorComponent(comps[3])
+		// alpha is a number or percentage
+		col.A = uint8(math.Min(math.Max(svg.parseNumber(strings.TrimSpace(comps[3])), 0.0), 1.0)*255.0 + 0.5)
 		col.R = uint8(float64(svg.parseColorComponent(comps[0]))*float64(col.A)/255.0 + 0.5)
 		col.G = uint8(float64(svg.parseColorComponent(comps[1]))*float64(col.A)/255.0 + 0.5)
 		col.B = uint8(float64(svg.parseColorComponent(comps[2]))*float64(col.A)/255.0 + 0.5)
@@ -275,7 +440,7 @@ func (svg *svgParser) parsePoints(v string) []float64 {
 		if 0 < len(item) {
 			val, err := strconv.ParseFloat(item, 64)
 			if err != nil && svg.err == nil {
-				svg.err = parse.NewErrorLexer(svg.z, "bad number array: %w: %s", err, v)
+				svg.err = svg.newError("bad number array: %w: %s", err, v)
 			}
 			vals = append(vals, val)
 		}
@@ -296,13 +461,13 @@ func (svg *svgParser) parseTransform(v string) Matrix {
 			switch fun {
 			case "matrix":
 				if len(d) != 6 {
-					svg.err = parse.NewErrorLexer(svg.z, "bad transform matrix")
+					svg.err = svg.newError("bad transform matrix")
 				} else {
 					m = m.Mul(Matrix{{d[0], d[2], d[4]}, {d[1], d[3], d[5]}})
 				}
 			case "translate":
 				if len(d) != 1 && len(d) != 2 {
-					svg.err = parse.NewErrorLexer(svg.z, "bad transform translate")
+					svg.err = svg.newError("bad transform translate")
 				} else if len(d) == 1 {
 					m = m.Translate(d[0], 0.0)
 				} else {
@@ -310,7 +475,7 @@ func (svg *svgParser) parseTransform(v string) Matrix {
 				}
 			case "scale":
 				if len(d) != 1 && len(d) != 2 {
-					svg.err = parse.NewErrorLexer(svg.z, "bad transform scale")
+					svg.err = svg.newError("bad transform scale")
 				} else if len(d) == 1 {
 					m = m.Scale(d[0], d[0])
 				} else {
@@ -318,7 +483,7 @@ func (svg *svgParser) parseTransform(v string) Matrix {
 				}
 			case "rotate":
 				if len(d) != 1 && len(d) != 3 {
-					svg.err = parse.NewErrorLexer(svg.z, "bad transform rotate")
+					svg.err = svg.newError("bad transform rotate")
 				} else if len(d) == 1 {
 					m = m.Rotate(d[0])
 				} else {
@@ -326,15 +491,15 @@ func (svg *svgParser) parseTransform(v string) Matrix {
 				}
 			case "skewx":
 				if len(d) != 1 {
-					svg.err = parse.NewErrorLexer(svg.z, "bad transform skewX")
+					svg.err = svg.newError("bad transform skewX")
 				} else {
-					// TODO
+					m = m.Shear(math.Tan(d[0]*math.Pi/180.0), 0.0)
 				}
 			case "skewy":
 				if len(d) != 1 {
-					svg.err = parse.NewErrorLexer(svg.z, "bad transform skewY")
+					svg.err = svg.newError("bad transform skewY")
 				} else {
-					// TODO
+					m = m.Shear(0.0, math.Tan(d[0]*math.Pi/180.0))
 				}
 			}
 			j = i + 1
@@ -344,31 +509,55 @@ func (svg *svgParser) parseTransform(v string) Matrix {
 	return m
 }
 
-func (svg *svgParser) parseAttributes(l *xml.Lexer) (xml.TokenType, []string, map[string]string) {
+func (svg *svgParser) parseAttributes(l *xml.Lexer) (xml.TokenType, []string, map[string]string, []int) {
 	// get all attributes
 	var tt xml.TokenType
+	var data []byte
 	attrs := map[string]string{}
 	attrNames := []string{}
+	attrOffsets := []int{}
 	for {
-		// TODO: attribute errors point to wrong position
-		tt, _ = l.Next()
+		tt, data = l.Next()
 		if tt != xml.AttributeToken {
 			break
 		}
 		val := l.AttrVal()
 		val = val[1 : len(val)-1]
 		attrNames = append(attrNames, string(l.Text()))
+		attrOffsets = append(attrOffsets, svg.z.Offset()-len(data)+bytes.Index(data, l.Text()))
 		attrs[string(l.Text())] = string(val)
 	}
-	return tt, attrNames, attrs
+	return tt, attrNames, attrs, attrOffsets
 }
 
 type svgTag struct {
-	parent    *svgTag
-	name      string
-	attrNames []string
-	attrs     map[string]string
-	content   []*svgTag
+	parent      *svgTag
+	name        string // empty for text nodes
+	attrNames   []string
+	attrs       map[string]string
+	content     []*svgTag
+	text        string // only for text nodes
+	offset      int    // position in the source
+	attrOffsets []int  // positions of the attributes in the source
+}
+
+// attrOffset returns the position of an attribute in the source, or the position of the element if it has no such attribute.
+func (tag *svgTag) attrOffset(name string) int {
+	for i, attrName := range tag.attrNames {
+		if attrName == name {
+			return tag.attrOffsets[i]
+		}
+	}
+	return tag.offset
+}
+
+// props returns the attributes in order of appearance.
+func (tag *svgTag) props() []cssProperty {
+	props := []cssProperty{}
+	for _, key := range tag.attrNames {
+		props = append(props, cssProperty{key, tag.attrs[key], false})
+	}
+	return props
 }
 
 func (svg *svgParser) parseTag(l *xml.Lexer) *svgTag {
@@ -383,14 +572,18 @@ func (svg *svgParser) parseTag(l *xml.Lexer) *svgTag {
 			}
 			break
 		} else if tt == xml.StartTagToken {
+			offset := svg.z.Offset() - len(data)
 			var attrNames []string
 			var attrs map[string]string
-			tt, attrNames, attrs = svg.parseAttributes(l)
+			var attrOffsets []int
+			tt, attrNames, attrs, attrOffsets = svg.parseAttributes(l)
 			tag := &svgTag{
-				parent:    parent,
-				name:      string(data[1:]),
-				attrNames: attrNames,
-				attrs:     attrs,
+				parent:      parent,
+				name:        string(data[1:]),
+				attrNames:   attrNames,
+				attrs:       attrs,
+				offset:      offset,
+				attrOffsets: attrOffsets,
 			}
 
 			if parent == nil {
@@ -406,6 +599,14 @@ func (svg *svgParser) parseTag(l *xml.Lexer) *svgTag {
 			} else {
 				parent = tag
 			}
+		} else if (tt == xml.TextToken || tt == xml.CDATAToken) && parent != nil {
+			if tt == xml.CDATAToken {
+				data = l.Text()
+			}
+			parent.content = append(parent.content, &svgTag{
+				parent: parent,
+				text:   string(data),
+			})
 		} else if tt == xml.EndTagToken {
 			if parent == nil {
 				break // when starting on an end tag
@@ -419,540 +620,2144 @@ func (svg *svgParser) parseTag(l *xml.Lexer) *svgTag {
 	return root
 }
 
-func (svg *svgParser) parseDefs(l *xml.Lexer) {
-	for {
-		tag := svg.parseTag(l)
-		if tag == nil {
-			break
-		}
-		id := tag.attrs["id"]
-		if id == "" {
-			continue
-		}
-		switch tag.name {
-		case "linearGradient":
-			if _, ok := tag.attrs["x2"]; !ok {
-				tag.attrs["x2"] = "100%"
-			}
-			x1p := strings.HasSuffix(tag.attrs["x1"], "%")
-			y1p := strings.HasSuffix(tag.attrs["y1"], "%")
-			x2p := strings.HasSuffix(tag.attrs["x2"], "%")
-			y2p := strings.HasSuffix(tag.attrs["y2"], "%")
-			x1 := svg.parseDimension(tag.attrs["x1"], 1.0)
-			x2 := svg.parseDimension(tag.attrs["x2"], 1.0)
-			y1 := svg.parseDimension(tag.attrs["y1"], 1.0)
-			y2 := svg.parseDimension(tag.attrs["y2"], 1.0)
-
-			stops := Stops{}
-			for _, tag := range tag.content {
-				if tag.name != "stop" {
-					continue
-				}
+// checkTag adds warnings for the elements, attributes, and style properties that are not supported. Elements and attributes with a namespace prefix are ignored.
+func (svg *svgParser) checkTag(tag *svgTag) {
+	if tag.name == "" || strings.Contains(tag.name, ":") {
+		return
+	} else if !svgElements[tag.name] && (tag.name != "foreignObject" || tag.parent == nil || tag.parent.name != "switch") {
+		// foreign objects are supported as the alternative of a switch element
+		svg.warn(tag.offset, "unsupported element: %s", tag.name)
+		return
+	}
 
-				offset := svg.parseNumber(tag.attrs["offset"])
-				stopColor := svg.parseColor(tag.attrs["stop-color"])
-				if v, ok := tag.attrs["stop-opacity"]; ok {
-					stopOpacity := svg.parseNumber(v)
-					stopColor.R = uint8(float64(stopColor.R) / float64(stopColor.A) * stopOpacity * 255.0)
-					stopColor.G = uint8(float64(stopColor.G) / float64(stopColor.A) * stopOpacity * 255.0)
-					stopColor.B = uint8(float64(stopColor.B) / float64(stopColor.A) * stopOpacity * 255.0)
-					stopColor.A = uint8(stopOpacity * 255.0)
+	for i, name := range tag.attrNames {
+		if name == "style" {
+			for _, prop := range svg.parseStyleAttribute(tag.attrs[name]) {
+				if !svgAttributes[prop.key] {
+					svg.warn(tag.attrOffsets[i], "unsupported property: %s", prop.key)
 				}
-				stops.Add(offset, stopColor)
 			}
-			svg.defs[id] = func(attr string, c *Canvas) {
-				layers := c.layers[c.zindex]
-				if len(layers) == 0 || layers[len(layers)-1].path == nil {
-					return
-				}
-				layer := &layers[len(layers)-1]
-
-				rect := layer.path.FastBounds()
-				x1t, y1t, x2t, y2t := x1, y1, x2, y2
-				if x1p {
-					x1t = (rect.X + rect.W*x1t) * 25.4 / 96.0
-				}
-				if y1p {
-					y1t = (rect.Y + rect.H*y1t) * 25.4 / 96.0
-				}
-				if x2p {
-					x2t = (rect.X + rect.W*x2t) * 25.4 / 96.0
-				}
-				if y2p {
-					y2t = (rect.Y + rect.H*y2t) * 25.4 / 96.0
-				}
-				linearGradient := NewLinearGradient(Point{x1t, y1t}, Point{x2t, y2t})
-				linearGradient.Stops = stops
+		} else if !svgAttributes[name] && !strings.Contains(name, ":") && !strings.HasPrefix(name, "data-") && !strings.HasPrefix(name, "aria-") {
+			svg.warn(tag.attrOffsets[i], "unsupported attribute: %s", name)
+		}
+	}
 
-				if attr == "fill" {
-					layer.style.Fill = Paint{Gradient: linearGradient}
-				} else if attr == "stroke" {
-					layer.style.Stroke = Paint{Gradient: linearGradient}
-				}
-			}
-		case "marker":
-			width, height, viewbox := svg.parseViewBox(tag.attrs["markerWidth"], tag.attrs["markerHeight"], tag.attrs["viewBox"])
-			if width == 0.0 {
-				width = 3.0
-			}
-			if height == 0.0 {
-				height = 3.0
-			}
+	switch tag.name {
+	case "title", "desc", "metadata", "style", "foreignObject":
+		return
+	}
+	for _, child := range tag.content {
+		svg.checkTag(child)
+	}
+}
 
-			units := tag.attrs["markerUnits"]
-			if units != "userSpaceOnUse" {
-				units = "strokeWidth"
+// parseDefs indexes all elements by ID, parses the style sheets, and parses the gradients and markers.
+func (svg *svgParser) parseDefs(tag *svgTag) {
+	if tag.name == "" {
+		return
+	} else if tag.name == "style" {
+		n := len(svg.cssRules)
+		for _, child := range tag.content {
+			if child.name == "" {
+				svg.parseStyle([]byte(child.text))
 			}
-
-			var refx, refy float64
-			switch tag.attrs["refX"] {
-			case "left":
-				refx = 0.0
-			case "center":
-				refx = width / 2.0
-			case "right":
-				refx = width
-			default:
-				refx = svg.parseDimension(tag.attrs["refX"], 0.0)
-			}
-			switch tag.attrs["refY"] {
-			case "top":
-				refy = 0.0
-			case "center":
-				refy = height / 2.0
-			case "bottom":
-				refy = height
-			default:
-				refy = svg.parseDimension(tag.attrs["refY"], 0.0)
+		}
+		for _, rule := range svg.cssRules[n:] {
+			for _, prop := range rule.props {
+				if !svgAttributes[prop.key] {
+					svg.warn(tag.offset, "unsupported property: %s", prop.key)
+				}
 			}
+		}
+		return
+	}
+	if id := tag.attrs["id"]; id != "" {
+		if _, ok := svg.tags[id]; !ok {
+			svg.tags[id] = tag
+		}
+	}
+	for _, child := range tag.content {
+		svg.parseDefs(child)
+	}
+}
 
-			angle := 0.0
-			orient := tag.attrs["orient"]
-			if orient != "auto" && orient != "auto-start-reverse" {
-				angle = svg.parseDimension(tag.attrs["orient"], 0.0)
-			}
+// parseDef parses a gradient or marker definition.
+func (svg *svgParser) parseDef(id string, tag *svgTag) {
+	switch tag.name {
+	case "linearGradient", "radialGradient":
+		svg.parseGradient(id, tag)
+	case "pattern":
+		svg.parsePattern(id, tag)
+	case "marker":
+		width, height, viewbox := svg.parseViewBox(tag.attrs["markerWidth"], tag.attrs["markerHeight"], tag.attrs["viewBox"])
+		if width == 0.0 {
+			width = 3.0
+		}
+		if height == 0.0 {
+			height = 3.0
+		}
 
-			origSVGCanvas := svg.svgCanvas
-			svg.push(tag.name, tag.attrs)
-			svg.init(width, height, [4]float64{})
-			for _, tag := range tag.content {
-				svg.push(tag.name, tag.attrs)
+		units := tag.attrs["markerUnits"]
+		if units != "userSpaceOnUse" {
+			units = "strokeWidth"
+		}
 
-				props := []cssProperty{}
-				for _, key := range tag.attrNames {
-					props = append(props, cssProperty{key, tag.attrs[key]})
-				}
-				svg.setStyling(props)
+		var refx, refy float64
+		switch tag.attrs["refX"] {
+		case "left":
+			refx = 0.0
+		case "center":
+			refx = width / 2.0
+		case "right":
+			refx = width
+		default:
+			refx = svg.parseDimension(tag.attrs["refX"], 0.0)
+		}
+		switch tag.attrs["refY"] {
+		case "top":
+			refy = 0.0
+		case "center":
+			refy = height / 2.0
+		case "bottom":
+			refy = height
+		default:
+			refy = svg.parseDimension(tag.attrs["refY"], 0.0)
+		}
 
-				svg.drawShape(tag.name, tag.attrs)
+		angle := 0.0
+		orient := tag.attrs["orient"]
+		if orient != "auto" && orient != "auto-start-reverse" {
+			angle = svg.parseDimension(tag.attrs["orient"], 0.0)
+		}
 
-				svg.pop()
+		origSVGCanvas := svg.svgCanvas
+		origState, origStateStack := svg.state, svg.stateStack
+		svg.init(width, height, Identity)
+		svg.setViewport(width*96.0/25.4, height*96.0/25.4)
+		svg.push(tag)
+		for _, child := range tag.content {
+			svg.drawTag(child)
+		}
+		svg.pop()
+		marker := svg.c
+		svg.svgCanvas = origSVGCanvas
+		svg.state, svg.stateStack = origState, origStateStack
+
+		svg.defs[id] = func(attr string, c *Canvas) {
+			layers := c.layers[c.zindex]
+			if len(layers) == 0 || layers[len(layers)-1].path == nil {
+				return
 			}
-			marker := svg.c
-			svg.svgCanvas = origSVGCanvas
-			svg.pop()
-
-			svg.defs[id] = func(attr string, c *Canvas) {
-				layers := c.layers[c.zindex]
-				if len(layers) == 0 || layers[len(layers)-1].path == nil {
-					return
-				}
-				layer := layers[len(layers)-1]
-				path := layer.path
-				strokeWidth := layer.style.StrokeWidth
-
-				a := angle
-				coordPos := path.Coords()
-				coordDir := path.CoordDirections()
-				for i := range coordPos {
-					if attr == "marker-start" && i == 0 || attr == "marker-end" && i == len(coordPos)-1 || attr == "marker-mid" && i != 0 && i != len(coordPos)-1 {
-						pos, dir := coordPos[i], coordDir[i]
-						if orient == "auto" || orient == "auto-start-reverse" {
-							a = dir.Angle()
-							if orient == "auto-start-reverse" {
-								a += 180.0
-							}
+			layer := layers[len(layers)-1]
+			path := layer.path
+			strokeWidth := layer.style.StrokeWidth
+
+			a := angle
+			coordPos := path.Coords()
+			coordDir := path.CoordDirections()
+			for i := range coordPos {
+				if attr == "marker-start" && i == 0 || attr == "marker-end" && i == len(coordPos)-1 || attr == "marker-mid" && i != 0 && i != len(coordPos)-1 {
+					pos, dir := coordPos[i], coordDir[i]
+					if orient == "auto" || orient == "auto-start-reverse" {
+						a = dir.Angle()
+						if orient == "auto-start-reverse" {
+							a += 180.0
 						}
+					}
 
-						view := Identity.ReflectYAbout(c.H/2.0).Mul(svg.ctx.View()).Translate(pos.X, pos.Y).Rotate(a * 180.0 / math.Pi)
-						if units == "strokeWidth" {
-							view = view.Scale(strokeWidth, strokeWidth)
-						}
+					view := layer.m.Translate(pos.X, pos.Y).Rotate(a * 180.0 / math.Pi)
+					if units == "strokeWidth" {
+						view = view.Scale(strokeWidth, strokeWidth)
+					}
 
-						f := height / (viewbox[3] - viewbox[1])
-						view = view.Translate(-refx*f, -refy*f).Scale(f, f).ReflectYAbout(height / 2.0)
-						marker.RenderViewTo(c, view)
+					f := 1.0
+					if viewbox[3] != 0.0 {
+						f = height / viewbox[3]
 					}
+					view = view.Translate(-refx*f, -refy*f).Scale(f, f).ReflectYAbout(height / 2.0)
+					marker.RenderViewTo(c, view)
 				}
 			}
 		}
 	}
 }
 
-func (svg *svgParser) parseStyle(b []byte) {
-	p := css.NewParser(parse.NewInputBytes(b), false)
-	selectors := []cssSelector{}
+// hrefChain returns the element followed by the elements it references through href, from which gradients and patterns inherit their attributes and content.
+func (svg *svgParser) hrefChain(tag *svgTag) []*svgTag {
+	chain := []*svgTag{tag}
 	for {
-		gt, _, _ := p.Next()
-		if gt == css.ErrorGrammar {
-			break
-		} else if gt == css.BeginRulesetGrammar || gt == css.QualifiedRuleGrammar {
-			selector := cssSelector{}
-			node := cssSelectorNode{op: ' '}
-			vals := p.Values()
-			for i := 0; i < len(vals); i++ {
-				t := vals[i]
-				if t.TokenType == css.WhitespaceToken || t.TokenType == css.DelimToken && t.Data[0] == '>' {
-					selector = append(selector, node)
-					node = cssSelectorNode{op: ' '}
-					if t.TokenType == css.DelimToken {
-						node.op = '>'
-					}
-				} else if t.TokenType == css.IdentToken || t.TokenType == css.DelimToken && t.Data[0] == '*' {
-					node.typ = string(t.Data)
-				} else if t.TokenType == css.DelimToken && (t.Data[0] == '.' || t.Data[0] == '#') && i+1 < len(vals) && vals[i+1].TokenType == css.IdentToken {
-					if t.Data[0] == '#' {
-						node.attrs = append(node.attrs, cssAttrSelector{op: '=', attr: "id", val: string(vals[i+1].Data)})
-					} else {
-						node.attrs = append(node.attrs, cssAttrSelector{op: '~', attr: "class", val: string(vals[i+1].Data)})
-					}
-					i++
-				} else if t.TokenType == css.DelimToken && t.Data[0] == '[' && i+2 < len(vals) && vals[i+1].TokenType == css.IdentToken && vals[i+2].TokenType == css.DelimToken {
-					if vals[i+2].Data[0] == ']' {
-						node.attrs = append(node.attrs, cssAttrSelector{op: 0, attr: string(vals[i+1].Data)})
-						i += 2
-					} else if i+4 < len(vals) && vals[i+3].TokenType == css.IdentToken && vals[i+4].TokenType == css.DelimToken && vals[i+4].Data[0] == ']' {
-						node.attrs = append(node.attrs, cssAttrSelector{op: vals[i+2].Data[0], attr: string(vals[i+1].Data), val: string(vals[i+3].Data)})
-						i += 4
-					}
-				}
-			}
-			selector = append(selector, node)
-			selectors = append(selectors, selector)
+		href, ok := tag.attrs["href"]
+		if !ok {
+			href = tag.attrs["xlink:href"]
 		}
-
-		if gt == css.BeginRulesetGrammar {
-			props := []cssProperty{}
-			for {
-				gt, _, data := p.Next()
-				if gt != css.DeclarationGrammar {
-					break
-				}
-
-				val := strings.Builder{}
-				for _, t := range p.Values() {
-					val.Write(t.Data)
-				}
-				props = append(props, cssProperty{string(data), val.String()})
+		if !strings.HasPrefix(href, "#") {
+			return chain
+		}
+		ref, ok := svg.tags[href[1:]]
+		if !ok || ref.name != "linearGradient" && ref.name != "radialGradient" && ref.name != "pattern" {
+			return chain
+		}
+		for _, tag := range chain {
+			if tag == ref {
+				return chain // circular reference
 			}
-			svg.cssRules = append(svg.cssRules, cssRule{
-				selectors: selectors,
-				props:     props,
-			})
-			selectors = selectors[:0:0]
 		}
+		chain = append(chain, ref)
+		tag = ref
 	}
 }
 
-func (svg *svgParser) parseStyleAttribute(style string) []cssProperty {
-	props := []cssProperty{}
-	p := css.NewParser(parse.NewInput(bytes.NewBufferString(style)), true)
-	for {
-		gt, _, data := p.Next()
-		if gt == css.ErrorGrammar {
-			break
-		} else if gt == css.DeclarationGrammar {
-			val := strings.Builder{}
-			for _, t := range p.Values() {
-				val.Write(t.Data)
-			}
-			props = append(props, cssProperty{string(data), val.String()})
+// chainAttr returns the first attribute value found along the href chain, or the default value.
+func chainAttr(chain []*svgTag, name, def string) string {
+	for _, tag := range chain {
+		if val, ok := tag.attrs[name]; ok {
+			return val
 		}
 	}
-	return props
+	return def
 }
 
-func (svg *svgParser) setStyling(props []cssProperty) {
-	// apply CSS from <style>
-	for _, rule := range svg.cssRules {
-		// TODO: this is in order of appearance, use selector specificity/precedence?
-		if rule.AppliesTo(svg.elemStack) {
-			for _, prop := range rule.props {
-				svg.setAttribute(prop.key, prop.val)
+// chainContent returns the first element along the href chain that has child elements.
+func chainContent(chain []*svgTag) *svgTag {
+	for _, tag := range chain {
+		for _, child := range tag.content {
+			if child.name != "" {
+				return tag
 			}
 		}
 	}
+	return chain[0]
+}
 
-	// apply attributes in order
-	for _, prop := range props {
-		if prop.key == "style" {
-			for _, styleProp := range svg.parseStyleAttribute(prop.val) {
-				svg.setAttribute(styleProp.key, styleProp.val)
-			}
-		} else {
-			svg.setAttribute(prop.key, prop.val)
+// parseGradient parses a linear or radial gradient. Coordinates are relative to the bounding box of the path unless gradientUnits is userSpaceOnUse, and spreadMethod is emulated by repeating the color stops over the extent of the path. Radial gradients are kept circular under non-uniform transformations.
+func (svg *svgParser) parseGradient(id string, tag *svgTag) {
+	chain := svg.hrefChain(tag)
+	userSpaceOnUse := chainAttr(chain, "gradientUnits", "") == "userSpaceOnUse"
+	gradientTransform := svg.parseTransform(chainAttr(chain, "gradientTransform", ""))
+	spreadMethod := chainAttr(chain, "spreadMethod", "pad")
+	dimension := func(name, def string, parent float64) float64 {
+		v := chainAttr(chain, name, def)
+		if !userSpaceOnUse {
+			parent = 1.0 // fraction of the bounding box
 		}
+		return svg.parseDimension(v, parent)
 	}
-}
 
-func (svg *svgParser) parseUrlID(val string) string {
-	if strings.HasPrefix(val, "url(") && strings.HasSuffix(val, ")") {
-		if 6 < len(val) && (val[4] == '#' || val[5] == '#') {
-			id := val[6 : len(val)-2]
-			if val[4] == '#' {
-				id = val[5 : len(val)-1]
-			}
-			return id
+	stops := Stops{}
+	for _, tag := range chainContent(chain).content {
+		if tag.name != "stop" {
+			continue
 		}
-	}
-	return ""
-}
 
-func (svg *svgParser) setAttribute(key, val string) {
-	switch key {
-	case "fill":
-		if id := svg.parseUrlID(val); id != "" {
-			svg.activeDefs["fill"] = svg.defs[id]
-		} else {
-			svg.ctx.SetFill(svg.parsePaint(val))
+		props := tag.props()
+		for _, prop := range props {
+			if prop.key == "style" {
+				props = append(props, svg.parseStyleAttribute(prop.val)...)
+			}
 		}
-	case "stroke":
-		if id := svg.parseUrlID(val); id != "" {
-			svg.activeDefs["stroke"] = svg.defs[id]
-		} else {
-			svg.ctx.SetStroke(svg.parsePaint(val))
+		stopColor, stopOpacity := Black, 1.0
+		for _, prop := range props {
+			if prop.key == "stop-color" {
+				stopColor = svg.parseColor(prop.val)
+			} else if prop.key == "stop-opacity" {
+				stopOpacity = math.Min(math.Max(svg.parseNumber(prop.val), 0.0), 1.0)
+			}
 		}
-	case "stroke-width":
-		svg.ctx.SetStrokeWidth(svg.parseDimension(val, svg.diagonal))
-	case "stroke-dashoffset":
-		svg.ctx.Style.DashOffset = svg.parseDimension(val, svg.diagonal)
-	case "stroke-dasharray":
-		if val == "none" {
-			svg.ctx.Style.Dashes = []float64{}
-		} else {
-			svg.ctx.Style.Dashes = svg.parsePoints(val)
+		stopColor.R = uint8(float64(stopColor.R)*stopOpacity + 0.5)
+		stopColor.G = uint8(float64(stopColor.G)*stopOpacity + 0.5)
+		stopColor.B = uint8(float64(stopColor.B)*stopOpacity + 0.5)
+		stopColor.A = uint8(float64(stopColor.A)*stopOpacity + 0.5)
+
+		// offsets must be monotonically increasing
+		offset := math.Min(math.Max(svg.parseNumber(tag.attrs["offset"]), 0.0), 1.0)
+		if 0 < len(stops) {
+			offset = math.Max(offset, stops[len(stops)-1].Offset)
 		}
-	case "stroke-linecap":
-		if val == "butt" {
-			svg.ctx.SetStrokeCapper(ButtCap)
-		} else if val == "round" {
-			svg.ctx.SetStrokeCapper(RoundCap)
-		} else if val == "square" {
-			svg.ctx.SetStrokeCapper(SquareCap)
+		stops = append(stops, Stop{offset, stopColor})
+	}
+
+	var newGradient func(Matrix) Gradient
+	if tag.name == "linearGradient" {
+		x1 := dimension("x1", "0%", svg.width)
+		y1 := dimension("y1", "0%", svg.height)
+		x2 := dimension("x2", "100%", svg.width)
+		y2 := dimension("y2", "0%", svg.height)
+		newGradient = func(m Matrix) Gradient {
+			// keep the isolines perpendicular to the gradient vector after transformation
+			start, end := m.Dot(Point{x1, y1}), m.Dot(Point{x2, y2})
+			normal := m.Dot(Point{y1 - y2, x2 - x1}).Sub(m.Dot(Origin)).Rot90CW()
+			if !normal.IsZero() {
+				end = start.Add(normal.Mul(end.Sub(start).Dot(normal) / normal.Dot(normal)))
+			}
+			linearGradient := NewLinearGradient(start, end)
+			linearGradient.Stops = stops
+			return linearGradient
 		}
-	case "stroke-linejoin":
-		if val == "arcs" {
-			svg.ctx.SetStrokeJoiner(ArcsJoin)
-		} else if val == "bevel" {
-			svg.ctx.SetStrokeJoiner(BevelJoin)
-		} else if val == "miter" {
-			svg.ctx.SetStrokeJoiner(MiterJoiner{BevelJoin, svg.state.strokeMiterLimit})
-		} else if val == "miter-clip" {
-			// not exactly correct
-			svg.ctx.SetStrokeJoiner(MiterJoiner{BevelJoin, svg.state.strokeMiterLimit})
-		} else if val == "round" {
-			svg.ctx.SetStrokeJoiner(RoundJoin)
+	} else {
+		cx := dimension("cx", "50%", svg.width)
+		cy := dimension("cy", "50%", svg.height)
+		r := dimension("r", "50%", svg.diagonal)
+		fx := dimension("fx", chainAttr(chain, "cx", "50%"), svg.width)
+		fy := dimension("fy", chainAttr(chain, "cy", "50%"), svg.height)
+		fr := dimension("fr", "0%", svg.diagonal)
+		newGradient = func(m Matrix) Gradient {
+			scale := math.Sqrt(math.Abs(m.Det()))
+			radialGradient := NewRadialGradient(m.Dot(Point{fx, fy}), fr*scale, m.Dot(Point{cx, cy}), r*scale)
+			radialGradient.Stops = stops
+			return radialGradient
 		}
-	case "stroke-miterlimit":
-		svg.state.strokeMiterLimit = svg.parseDimension(val, svg.diagonal)
-		if miter, ok := svg.ctx.StrokeJoiner.(MiterJoiner); ok {
-			miter.Limit = svg.state.strokeMiterLimit
+	}
+
+	svg.defs[id] = func(attr string, c *Canvas) {
+		layers := c.layers[c.zindex]
+		if len(layers) == 0 || layers[len(layers)-1].path == nil {
+			return
 		}
-	case "transform":
-		svg.ctx.ComposeView(svg.parseTransform(val))
-	case "text-anchor":
-		svg.state.textAnchor = val
-	case "font-family":
-		svg.state.fontFamily = val
-	case "font-size":
-		svg.state.fontSize = svg.parseDimension(val, svg.height)
-	case "marker-start":
-		if id := svg.parseUrlID(val); id != "" {
-			svg.activeDefs["marker-start"] = svg.defs[id]
+		layer := &layers[len(layers)-1]
+
+		// gradients are in canvas coordinates
+		m := layer.m
+		if !userSpaceOnUse {
+			rect := layer.path.Bounds()
+			if rect.W == 0.0 || rect.H == 0.0 {
+				return
+			}
+			m = m.Translate(rect.X, rect.Y).Scale(rect.W, rect.H)
 		}
-	case "marker-mid":
-		if id := svg.parseUrlID(val); id != "" {
-			svg.activeDefs["marker-mid"] = svg.defs[id]
+		gradient := newGradient(m.Mul(gradientTransform))
+		if spreadMethod == "reflect" || spreadMethod == "repeat" {
+			gradient = spreadGradient(gradient, spreadMethod == "reflect", layer.path.Transform(layer.m).FastBounds())
 		}
-	case "marker-end":
-		if id := svg.parseUrlID(val); id != "" {
-			svg.activeDefs["marker-end"] = svg.defs[id]
+
+		if attr == "fill" {
+			layer.style.Fill = Paint{Gradient: gradient}
+		} else if attr == "stroke" {
+			layer.style.Stroke = Paint{Gradient: gradient}
 		}
 	}
 }
 
-func (svg *svgParser) getFontFace() *FontFace {
-	fontFamily, ok := svg.fonts[svg.state.fontFamily]
-	if !ok {
-		fontFamily = NewFontFamily(svg.state.fontFamily)
-		if err := fontFamily.LoadSystemFont(svg.state.fontFamily, FontRegular); err != nil {
-			panic(err)
+// spreadGradient repeats or reflects the color stops of the gradient to cover the given rectangle, the gradient is extended by whole periods.
+func spreadGradient(gradient Gradient, reflect bool, rect Rect) Gradient {
+	corners := []Point{{rect.X, rect.Y}, {rect.X + rect.W, rect.Y}, {rect.X + rect.W, rect.Y + rect.H}, {rect.X, rect.Y + rect.H}}
+	t0, t1 := 0.0, 1.0
+	for _, corner := range corners {
+		var t float64
+		switch g := gradient.(type) {
+		case *LinearGradient:
+			if g.d2 == 0.0 {
+				return gradient
+			}
+			t = g.offset(corner.X, corner.Y)
+		case *RadialGradient:
+			var ok bool
+			if t, ok = g.offset(corner.X, corner.Y); !ok {
+				continue
+			}
 		}
-		svg.fonts[svg.state.fontFamily] = fontFamily
+		t0, t1 = math.Min(t0, t), math.Max(t1, t)
+	}
+	if _, ok := gradient.(*RadialGradient); ok {
+		t0 = 0.0 // radii cannot be negative
 	}
-	fontSize := svg.state.fontSize * 72.0 / 25.4 // pt/mm
-	return fontFamily.Face(fontSize)
-}
 
-func (svg *svgParser) drawShape(tag string, attrs map[string]string) {
-	switch tag {
-	case "circle":
-		cx := svg.parseDimension(attrs["cx"], svg.width)
-		cy := svg.parseDimension(attrs["cy"], svg.height)
-		r := svg.parseDimension(attrs["r"], svg.diagonal)
-		svg.ctx.DrawPath(cx, cy, Circle(r))
-	case "ellipse":
-		cx := svg.parseDimension(attrs["cx"], svg.width)
-		cy := svg.parseDimension(attrs["cy"], svg.height)
+	const maxPeriods = 100
+	k0, k1 := math.Floor(t0), math.Ceil(t1)
+	if maxPeriods < k1-k0 {
+		return gradient
+	}
+
+	var stops Stops
+	switch g := gradient.(type) {
+	case *LinearGradient:
+		stops = g.Stops
+	case *RadialGradient:
+		stops = g.Stops
+	}
+	if len(stops) == 0 {
+		return gradient
+	}
+
+	// each period starts and ends with a stop
+	period := Stops{}
+	if 0.0 < stops[0].Offset {
+		period = append(period, Stop{0.0, stops[0].Color})
+	}
+	period = append(period, stops...)
+	if stops[len(stops)-1].Offset < 1.0 {
+		period = append(period, Stop{1.0, stops[len(stops)-1].Color})
+	}
+
+	spread := Stops{}
+	for k := k0; k < k1; k++ {
+		for i := range period {
+			stop := period[i]
+			if reflect && math.Mod(math.Abs(k), 2.0) == 1.0 {
+				stop = period[len(period)-1-i]
+				stop.Offset = 1.0 - stop.Offset
+			}
+			stop.Offset = (k + stop.Offset - k0) / (k1 - k0)
+			spread = append(spread, stop)
+		}
+	}
+
+	switch g := gradient.(type) {
+	case *LinearGradient:
+		linearGradient := NewLinearGradient(g.Start.Add(g.d.Mul(k0)), g.Start.Add(g.d.Mul(k1)))
+		linearGradient.Stops = spread
+		return linearGradient
+	case *RadialGradient:
+		radialGradient := NewRadialGradient(g.C0, g.R0, g.C0.Add(g.cd.Mul(k1)), g.R0+g.dr*k1)
+		radialGradient.Stops = spread
+		return radialGradient
+	}
+	return gradient
+}
+
+// parsePattern parses a pattern into a hatch pattern that repeats the pattern's content. The content is filled with a single color and overflow of the pattern tile is not clipped.
+func (svg *svgParser) parsePattern(id string, tag *svgTag) {
+	chain := svg.hrefChain(tag)
+	userSpaceOnUse := chainAttr(chain, "patternUnits", "") == "userSpaceOnUse"
+	contentObjectBoundingBox := chainAttr(chain, "patternContentUnits", "") == "objectBoundingBox"
+	patternTransform := svg.parseTransform(chainAttr(chain, "patternTransform", ""))
+	_, _, viewbox := svg.parseViewBox("", "", chainAttr(chain, "viewBox", ""))
+	preserveAspectRatio := chainAttr(chain, "preserveAspectRatio", "")
+	dimension := func(name string, parent float64) float64 {
+		v := chainAttr(chain, name, "0")
+		if !userSpaceOnUse {
+			parent = 1.0 // fraction of the bounding box
+		}
+		return svg.parseDimension(v, parent)
+	}
+	x := dimension("x", svg.width)
+	y := dimension("y", svg.height)
+	width := dimension("width", svg.width)
+	height := dimension("height", svg.height)
+
+	var fill Paint
+	tile := &Path{}
+	for _, l := range svgPathLayers(svg.drawContent(chainContent(chain))) {
+		if l.style.HasFill() {
+			if fill == (Paint{}) {
+				fill = l.style.Fill
+			}
+			tile = tile.Append(l.path.Transform(l.m))
+		}
+		if l.style.HasStroke() {
+			if fill == (Paint{}) {
+				fill = l.style.Stroke
+			}
+			tile = tile.Append(svgStrokeOutline(l).Transform(l.m))
+		}
+	}
+	if !fill.IsColor() {
+		fill = Paint{Color: Black}
+	}
+
+	svg.defs[id] = func(attr string, c *Canvas) {
+		layers := c.layers[c.zindex]
+		if len(layers) == 0 || layers[len(layers)-1].path == nil {
+			return
+		}
+		layer := &layers[len(layers)-1]
+
+		var rect Rect
+		px, py, pw, ph := x, y, width, height
+		if !userSpaceOnUse || contentObjectBoundingBox {
+			rect = layer.path.Bounds()
+		}
+		if !userSpaceOnUse {
+			px, py = rect.X+px*rect.W, rect.Y+py*rect.H
+			pw, ph = pw*rect.W, ph*rect.H
+		}
+
+		var paint Paint
+		if 0.0 < pw && 0.0 < ph {
+			// the tile is in the unit cell's coordinates
+			content := Identity
+			if 0.0 < viewbox[2] && 0.0 < viewbox[3] {
+				content = svg.parseViewBoxTransform(pw, ph, viewbox, preserveAspectRatio)
+			} else if contentObjectBoundingBox {
+				content = Identity.Scale(rect.W, rect.H)
+			}
+			cell := layer.m.Mul(patternTransform).Translate(px, py).Scale(pw, ph)
+
+			// content is clipped to the tile, keep the shapes centered within the tile so that content that repeats in neighbouring tiles is not duplicated
+			unitTile := &Path{}
+			for _, p := range tile.Transform(Identity.Scale(1.0/pw, 1.0/ph).Mul(content)).Split() {
+				r := p.FastBounds()
+				cx, cy := r.X+r.W/2.0, r.Y+r.H/2.0
+				if -Epsilon <= cx && cx < 1.0-Epsilon && -Epsilon <= cy && cy < 1.0-Epsilon {
+					unitTile = unitTile.Append(p)
+				}
+			}
+			paint = Paint{Pattern: NewTileHatch(fill, unitTile, cell, 0.0)}
+		}
+
+		if attr == "fill" {
+			layer.style.Fill = paint
+		} else if attr == "stroke" {
+			layer.style.Stroke = paint
+		}
+	}
+}
+
+// userSpace returns the transformation from the current user space to canvas coordinates, which equals the matrix of paths drawn at the origin.
+func (svg *svgParser) userSpace() Matrix {
+	return Identity.Translate(0.0, svg.c.H).ReflectY().Mul(svg.ctx.View())
+}
+
+// drawContent draws the children of a pattern, clipPath, or mask element to a separate canvas and returns its layers, where the matrix of each layer transforms to the user space of the content. Elements that refer to themselves while being drawn have no content.
+func (svg *svgParser) drawContent(tag *svgTag) []layer {
+	for _, def := range svg.defStack {
+		if def == tag {
+			svg.warn(tag.offset, "circular reference: %s", tag.name)
+			return nil
+		}
+	}
+	svg.defStack = append(svg.defStack, tag)
+	defer func() {
+		svg.defStack = svg.defStack[:len(svg.defStack)-1]
+	}()
+
+	origSVGCanvas := svg.svgCanvas
+	origState, origStateStack := svg.state, svg.stateStack
+	svg.init(0.0, 0.0, Identity)
+	svg.push(tag)
+	svg.setStyling(tag.props())
+	for _, child := range tag.content {
+		svg.drawTag(child)
+	}
+	svg.pop()
+	layers := svg.c.layers[svg.c.zindex]
+	svg.svgCanvas = origSVGCanvas
+	svg.state, svg.stateStack = origState, origStateStack
+
+	for i := range layers {
+		layers[i].m = Identity.ReflectY().Mul(layers[i].m)
+	}
+	return layers
+}
+
+// svgPathLayers returns the layers with text converted to paths, images are removed.
+func svgPathLayers(layers []layer) []layer {
+	c := New(0.0, 0.0)
+	for _, l := range layers {
+		if l.path != nil {
+			c.layers[c.zindex] = append(c.layers[c.zindex], l)
+		} else if l.text != nil {
+			l.text.RenderAsPath(c, l.m, DefaultResolution)
+		}
+	}
+	return c.layers[c.zindex]
+}
+
+// svgStrokeOutline returns the outline of the stroke of a path layer.
+func svgStrokeOutline(l layer) *Path {
+	p := l.path
+	if 0 < len(l.style.Dashes) {
+		p = p.Dash(l.style.DashOffset, l.style.Dashes...)
+	}
+	return p.Stroke(l.style.StrokeWidth, l.style.StrokeCapper, l.style.StrokeJoiner, Tolerance)
+}
+
+// clipRegion returns the region in canvas coordinates of a clipPath or mask element that applies to the layers drawn since index n, where userSpace is the user space of the referencing element. For masks it also returns the opacity, which is the luminance of the content if it is filled with a single color.
+func (svg *svgParser) clipRegion(tag *svgTag, n int, userSpace Matrix) (*Path, float64) {
+	contentUnits := tag.attrs["clipPathUnits"]
+	if tag.name == "mask" {
+		contentUnits = tag.attrs["maskContentUnits"]
+	}
+
+	m := userSpace
+	if contentUnits == "objectBoundingBox" {
+		bounds := svg.layerBounds(n, userSpace)
+		m = m.Translate(bounds.X, bounds.Y).Scale(bounds.W, bounds.H)
+	}
+
+	opacity := -1.0
+	clip := &Path{}
+	for _, l := range svgPathLayers(svg.drawContent(tag)) {
+		if tag.name == "mask" {
+			// content with a single color has uniform luminance
+			paints := []Paint{}
+			if l.style.HasFill() {
+				paints = append(paints, l.style.Fill)
+			}
+			if l.style.HasStroke() {
+				paints = append(paints, l.style.Stroke)
+			}
+			for _, paint := range paints {
+				luminance := 1.0
+				if paint.IsColor() {
+					col := paint.Color
+					luminance = (0.2125*float64(col.R) + 0.7154*float64(col.G) + 0.0721*float64(col.B)) / 255.0
+				}
+				if opacity == -1.0 {
+					opacity = luminance
+				} else if !Equal(opacity, luminance) {
+					opacity = 1.0
+				}
+			}
+		} else if !l.style.HasFill() {
+			l.style.Fill = Paint{Color: Black} // clipping paths ignore fill and stroke
+		}
+
+		// fill regions go counter clockwise to make their union
+		var ps []*Path
+		if l.style.HasFill() {
+			ps = append(ps, l.path)
+		}
+		if tag.name == "mask" && l.style.HasStroke() {
+			ps = append(ps, svgStrokeOutline(l))
+		}
+		for _, p := range ps {
+			p = p.Transform(m.Mul(l.m))
+			if 1 < len(p.Split()) {
+				p = p.Settle()
+			} else if !p.CCW() {
+				p = p.Reverse()
+			}
+			clip = clip.Append(p)
+		}
+	}
+	if opacity == -1.0 {
+		opacity = 1.0
+	}
+	return clip, opacity
+}
+
+// filterLayers moves the layers drawn since index n into a group with the filter effect of a filter element, where userSpace is the user space of the referencing element.
+func (svg *svgParser) filterLayers(tag *svgTag, n int, userSpace Matrix) {
+	layers := svg.c.layers[svg.c.zindex]
+	if len(layers) == n {
+		return
+	}
+	filter := svg.parseFilter(tag, n, userSpace)
+	group := New(svg.c.W, svg.c.H)
+	group.layers[group.zindex] = append([]layer{}, layers[n:]...)
+	svg.c.layers[svg.c.zindex] = append(layers[:n], layer{group: group, m: Identity, filter: filter})
+}
+
+// parseFilter parses the primitives of a filter element into a filter in canvas coordinates for the layers drawn since index n. Lengths are in the user space of the referencing element, or are fractions of its bounding box when primitiveUnits is objectBoundingBox. Unsupported primitives are skipped.
+func (svg *svgParser) parseFilter(tag *svgTag, n int, userSpace Matrix) *Filter {
+	w, h := 1.0, 1.0
+	if tag.attrs["primitiveUnits"] == "objectBoundingBox" {
+		bounds := svg.layerBounds(n, userSpace)
+		w, h = bounds.W, bounds.H
+	}
+
+	filter := &Filter{}
+	for _, child := range tag.content {
+		svg.offset = child.offset
+		primitive := FilterPrimitive{In: child.attrs["in"], In2: child.attrs["in2"], Result: child.attrs["result"]}
+		switch child.name {
+		case "feGaussianBlur":
+			stdDev := svg.parsePoints(child.attrs["stdDeviation"])
+			if len(stdDev) == 0 {
+				stdDev = append(stdDev, 0.0)
+			}
+			if len(stdDev) == 1 {
+				stdDev = append(stdDev, stdDev[0])
+			}
+			primitive.Effect = GaussianBlurEffect{stdDev[0] * w, stdDev[1] * h}
+		case "feOffset":
+			primitive.Effect = OffsetEffect{svg.parseNumber(child.attrs["dx"]) * w, svg.parseNumber(child.attrs["dy"]) * h}
+		case "feFlood":
+			props := child.props()
+			for _, prop := range props {
+				if prop.key == "style" {
+					props = append(props, svg.parseStyleAttribute(prop.val)...)
+				}
+			}
+			floodColor, floodOpacity := Black, 1.0
+			for _, prop := range props {
+				if prop.key == "flood-color" {
+					floodColor = svg.parseColor(prop.val)
+				} else if prop.key == "flood-opacity" {
+					floodOpacity = math.Min(math.Max(svg.parseNumber(prop.val), 0.0), 1.0)
+				}
+			}
+			primitive.Effect = FloodEffect{svgPaintOpacity(Paint{Color: floodColor}, floodOpacity).Color}
+		case "feComposite":
+			effect := CompositeEffect{}
+			switch child.attrs["operator"] {
+			case "in":
+				effect.Operator = CompositeIn
+			case "out":
+				effect.Operator = CompositeOut
+			case "atop":
+				effect.Operator = CompositeAtop
+			case "xor":
+				effect.Operator = CompositeXor
+			case "arithmetic":
+				effect.Operator = CompositeArithmetic
+				effect.K1 = svg.parseNumber(child.attrs["k1"])
+				effect.K2 = svg.parseNumber(child.attrs["k2"])
+				effect.K3 = svg.parseNumber(child.attrs["k3"])
+				effect.K4 = svg.parseNumber(child.attrs["k4"])
+			}
+			primitive.Effect = effect
+		case "feMerge":
+			effect := MergeEffect{}
+			for _, node := range child.content {
+				if node.name == "feMergeNode" {
+					effect.In = append(effect.In, node.attrs["in"])
+				}
+			}
+			primitive.Effect = effect
+		case "feColorMatrix":
+			values := svg.parsePoints(child.attrs["values"])
+			switch child.attrs["type"] {
+			case "saturate":
+				if len(values) == 0 {
+					values = append(values, 1.0)
+				}
+				primitive.Effect = SaturateColorMatrix(values[0])
+			case "hueRotate":
+				if len(values) == 0 {
+					values = append(values, 0.0)
+				}
+				primitive.Effect = HueRotateColorMatrix(values[0])
+			case "luminanceToAlpha":
+				primitive.Effect = LuminanceToAlphaColorMatrix()
+			default:
+				effect := IdentityColorMatrix
+				if len(values) == 20 {
+					copy(effect.Matrix[:], values)
+				} else if len(values) != 0 && svg.err == nil {
+					svg.err = svg.newError("bad color matrix: %s", child.attrs["values"])
+				}
+				primitive.Effect = effect
+			}
+		default:
+			continue
+		}
+		filter.Primitives = append(filter.Primitives, primitive)
+	}
+	return filter.Transform(userSpace)
+}
+
+// layerBounds returns the bounding box in user space of the layers drawn since index n.
+func (svg *svgParser) layerBounds(n int, userSpace Matrix) Rect {
+	bounds := Rect{}
+	inv := userSpace.Inv()
+	for i, l := range svg.c.layers[svg.c.zindex][n:] {
+		var rect Rect
+		if l.path != nil {
+			rect = l.path.Transform(inv.Mul(l.m)).Bounds()
+		} else if l.text != nil {
+			rect = l.text.Bounds().Transform(inv.Mul(l.m))
+		} else if l.img != nil {
+			size := l.img.Bounds().Size()
+			rect = Rect{0.0, 0.0, float64(size.X), float64(size.Y)}.Transform(inv.Mul(l.m))
+		} else if l.group != nil {
+			rect = l.group.Bounds().Transform(inv.Mul(l.m))
+		}
+		if i == 0 {
+			bounds = rect
+		} else {
+			bounds = bounds.Add(rect)
+		}
+	}
+	return bounds
+}
+
+// clipLayers clips the layers drawn since index n to the clipping region in canvas coordinates and multiplies their opacity. Strokes are converted to filled paths and text is converted to paths, while images and filtered groups are not clipped.
+func (svg *svgParser) clipLayers(n int, clip *Path, opacity float64) {
+	layers := svg.c.layers[svg.c.zindex]
+	clipped := []layer{}
+	for _, l := range layers[n:] {
+		if l.img != nil || l.group != nil {
+			clipped = append(clipped, l)
+			continue
+		}
+		for _, l := range svgPathLayers([]layer{l}) {
+			q := clip.Transform(l.m.Inv())
+			if l.style.HasStroke() {
+				stroke := l
+				stroke.path = svgStrokeOutline(l).And(q)
+				stroke.style.Fill = svgPaintOpacity(l.style.Stroke, opacity)
+				stroke.style.Stroke = Paint{}
+				stroke.style.FillRule = NonZero
+				if l.style.HasFill() {
+					l.path = l.path.And(q)
+					l.style.Fill = svgPaintOpacity(l.style.Fill, opacity)
+					l.style.Stroke = Paint{}
+					clipped = append(clipped, l)
+				}
+				clipped = append(clipped, stroke)
+			} else if l.style.HasFill() {
+				l.path = l.path.And(q)
+				l.style.Fill = svgPaintOpacity(l.style.Fill, opacity)
+				clipped = append(clipped, l)
+			}
+		}
+	}
+	svg.c.layers[svg.c.zindex] = append(layers[:n], clipped...)
+}
+
+// svgPaintOpacity returns the paint with its opacity multiplied.
+func svgPaintOpacity(paint Paint, opacity float64) Paint {
+	if opacity == 1.0 {
+		return paint
+	}
+	scale := func(col color.RGBA) color.RGBA {
+		return color.RGBA{
+			uint8(float64(col.R)*opacity + 0.5),
+			uint8(float64(col.G)*opacity + 0.5),
+			uint8(float64(col.B)*opacity + 0.5),
+			uint8(float64(col.A)*opacity + 0.5),
+		}
+	}
+	if paint.IsColor() {
+		paint.Color = scale(paint.Color)
+	} else if paint.IsGradient() {
+		var stops Stops
+		switch g := paint.Gradient.(type) {
+		case *LinearGradient:
+			gradient := *g
+			paint.Gradient = &gradient
+			stops = make(Stops, len(g.Stops))
+			copy(stops, g.Stops)
+			gradient.Stops = stops
+		case *RadialGradient:
+			gradient := *g
+			paint.Gradient = &gradient
+			stops = make(Stops, len(g.Stops))
+			copy(stops, g.Stops)
+			gradient.Stops = stops
+		}
+		for i := range stops {
+			stops[i].Color = scale(stops[i].Color)
+		}
+	}
+	return paint
+}
+
+func (svg *svgParser) parseStyle(b []byte) {
+	p := css.NewParser(parse.NewInputBytes(b), false)
+	selectors := []cssSelector{}
+	vals := []css.Token{} // selector tokens, which may span commas within parentheses
+	for {
+		gt, _, _ := p.Next()
+		if gt == css.ErrorGrammar {
+			break
+		} else if gt == css.BeginRulesetGrammar || gt == css.QualifiedRuleGrammar {
+			if 0 < len(vals) {
+				vals = append(vals, css.Token{TokenType: css.CommaToken, Data: []byte(",")})
+			}
+			vals = append(vals, p.Values()...)
+
+			depth := 0
+			for _, t := range vals {
+				if t.TokenType == css.FunctionToken || t.TokenType == css.LeftParenthesisToken {
+					depth++
+				} else if t.TokenType == css.RightParenthesisToken {
+					depth--
+				}
+			}
+			if depth <= 0 || gt == css.BeginRulesetGrammar {
+				selectors = append(selectors, parseCSSSelector(vals))
+				vals = vals[:0:0]
+			}
+		}
+
+		if gt == css.BeginRulesetGrammar {
+			props := []cssProperty{}
+			for {
+				gt, _, data := p.Next()
+				if gt != css.DeclarationGrammar {
+					break
+				}
+				val, important := cssValue(p.Values())
+				props = append(props, cssProperty{string(data), val, important})
+			}
+			svg.cssRules = append(svg.cssRules, cssRule{
+				selectors: selectors,
+				props:     props,
+			})
+			selectors = selectors[:0:0]
+		}
+	}
+}
+
+func (svg *svgParser) parseStyleAttribute(style string) []cssProperty {
+	props := []cssProperty{}
+	p := css.NewParser(parse.NewInput(bytes.NewBufferString(style)), true)
+	for {
+		gt, _, data := p.Next()
+		if gt == css.ErrorGrammar {
+			break
+		} else if gt == css.DeclarationGrammar {
+			val, important := cssValue(p.Values())
+			props = append(props, cssProperty{string(data), val, important})
+		}
+	}
+	return props
+}
+
+// setStyling applies the properties of the current element in cascading order. Presentation attributes come first, then the rules from style sheets in order of specificity and appearance, then the style attribute, and finally important declarations in the same order. Only the winning declaration of each property is applied.
+func (svg *svgParser) setStyling(props []cssProperty) {
+	tag := svg.elemStack[len(svg.elemStack)-1].node
+	decls := []cssDeclaration{}
+	for _, prop := range props {
+		if prop.key != "style" {
+			prop.important = false
+			decls = append(decls, cssDeclaration{prop, cssPresentationOrigin, 0, tag.attrOffset(prop.key)})
+		}
+	}
+	for _, rule := range svg.cssRules {
+		if specificity, ok := rule.Specificity(svg.elemStack); ok {
+			for _, prop := range rule.props {
+				decls = append(decls, cssDeclaration{prop, cssStyleSheetOrigin, specificity, tag.offset})
+			}
+		}
+	}
+	for _, prop := range props {
+		if prop.key == "style" {
+			for _, styleProp := range svg.parseStyleAttribute(prop.val) {
+				decls = append(decls, cssDeclaration{styleProp, cssStyleAttributeOrigin, 0, tag.attrOffset("style")})
+			}
+		}
+	}
+	sort.SliceStable(decls, func(i, j int) bool {
+		return decls[i].Less(decls[j])
+	})
+
+	// the font size applies first as other lengths may be relative to it
+	winners := map[string]int{}
+	for i, decl := range decls {
+		winners[decl.key] = i
+	}
+	if i, ok := winners["font-size"]; ok && decls[i].val != "inherit" {
+		svg.offset = decls[i].offset
+		svg.setAttribute(decls[i].key, decls[i].val)
+	}
+	for i, decl := range decls {
+		if winners[decl.key] == i && decl.key != "font-size" && decl.val != "inherit" {
+			svg.offset = decl.offset
+			svg.setAttribute(decl.key, decl.val)
+		}
+	}
+	svg.offset = tag.offset
+}
+
+// setOpacity multiplies the opacity of the layers drawn since index n, using the fill opacity for fills, text, and images, and the stroke opacity for strokes. Overlapping layers are not composited as a group.
+func (svg *svgParser) setOpacity(n int, fillOpacity, strokeOpacity float64) {
+	if fillOpacity == 1.0 && strokeOpacity == 1.0 {
+		return
+	}
+	layers := svg.c.layers[svg.c.zindex]
+	for i := n; i < len(layers); i++ {
+		if layers[i].path != nil {
+			layers[i].style.Fill = svgPaintOpacity(layers[i].style.Fill, fillOpacity)
+			layers[i].style.Stroke = svgPaintOpacity(layers[i].style.Stroke, strokeOpacity)
+		} else if layers[i].text != nil {
+			layers[i].text = svgTextOpacity(layers[i].text, fillOpacity)
+		} else if layers[i].img != nil {
+			layers[i].img = svgImageOpacity(layers[i].img, fillOpacity)
+		} else if layers[i].group != nil && fillOpacity != 1.0 {
+			// scale the alpha of the filter result, which composites the group as a whole
+			opacity := IdentityColorMatrix
+			opacity.Matrix[18] = fillOpacity
+			primitives := append([]FilterPrimitive{}, layers[i].filter.Primitives...)
+			layers[i].filter = &Filter{append(primitives, FilterPrimitive{Effect: opacity})}
+		}
+	}
+}
+
+// svgTextOpacity returns a copy of the text with the opacity of its font faces multiplied.
+func svgTextOpacity(text *Text, opacity float64) *Text {
+	if opacity == 1.0 {
+		return text
+	}
+	faces := map[*FontFace]*FontFace{}
+	t := *text
+	t.lines = make([]line, len(text.lines))
+	for j, l := range text.lines {
+		l.spans = append([]TextSpan{}, l.spans...)
+		for k, span := range l.spans {
+			face, ok := faces[span.Face]
+			if !ok {
+				faceCopy := *span.Face
+				faceCopy.Fill = svgPaintOpacity(faceCopy.Fill, opacity)
+				face = &faceCopy
+				faces[span.Face] = face
+			}
+			l.spans[k].Face = face
+		}
+		t.lines[j] = l
+	}
+	return &t
+}
+
+// svgImageOpacity returns a copy of the image with its opacity multiplied.
+func svgImageOpacity(img image.Image, opacity float64) image.Image {
+	if opacity == 1.0 {
+		return img
+	}
+	bounds := img.Bounds()
+	dst := image.NewRGBA(bounds)
+	mask := image.NewUniform(color.Alpha{uint8(opacity*255.0 + 0.5)})
+	draw.DrawMask(dst, bounds, img, bounds.Min, mask, image.Point{}, draw.Over)
+	return WithInterpolation(dst, ImageInterpolation(img))
+}
+
+func (svg *svgParser) parseUrlID(val string) string {
+	if strings.HasPrefix(val, "url(") && strings.HasSuffix(val, ")") {
+		// optionally quoted, as in url(#id) or url('#id')
+		val = strings.TrimSpace(val[4 : len(val)-1])
+		if 2 <= len(val) && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+		if 1 < len(val) && val[0] == '#' {
+			return val[1:]
+		}
+	}
+	return ""
+}
+
+func (svg *svgParser) setAttribute(key, val string) {
+	switch key {
+	case "fill":
+		if id := svg.parseUrlID(val); id != "" {
+			// the fill is replaced by the definition after drawing
+			svg.state.fillDef = svg.getDef(id)
+			svg.ctx.SetFill(Black)
+		} else {
+			svg.state.fillDef = nil
+			svg.ctx.SetFill(svg.parsePaint(val))
+		}
+	case "stroke":
+		if id := svg.parseUrlID(val); id != "" {
+			svg.state.strokeDef = svg.getDef(id)
+			svg.ctx.SetStroke(Black)
+		} else {
+			svg.state.strokeDef = nil
+			svg.ctx.SetStroke(svg.parsePaint(val))
+		}
+	case "fill-rule":
+		if val == "evenodd" {
+			svg.ctx.SetFillRule(EvenOdd)
+		} else {
+			svg.ctx.SetFillRule(NonZero)
+		}
+	case "fill-opacity":
+		svg.state.fillOpacity = math.Max(0.0, math.Min(1.0, svg.parseNumber(val)))
+	case "stroke-opacity":
+		svg.state.strokeOpacity = math.Max(0.0, math.Min(1.0, svg.parseNumber(val)))
+	case "opacity":
+		svg.state.opacity = math.Max(0.0, math.Min(1.0, svg.parseNumber(val)))
+	case "display":
+		svg.state.display = val
+	case "visibility":
+		svg.state.hidden = val == "hidden" || val == "collapse"
+	case "clip-path":
+		svg.state.clipPath = svg.getTag(svg.parseUrlID(val), "clipPath")
+	case "mask":
+		svg.state.mask = svg.getTag(svg.parseUrlID(val), "mask")
+	case "filter":
+		svg.state.filter = svg.getTag(svg.parseUrlID(val), "filter")
+	case "stroke-width":
+		svg.ctx.SetStrokeWidth(svg.parseDimension(val, svg.diagonal))
+	case "stroke-dashoffset":
+		svg.ctx.Style.DashOffset = svg.parseDimension(val, svg.diagonal)
+	case "stroke-dasharray":
+		if val == "none" {
+			svg.ctx.Style.Dashes = []float64{}
+		} else {
+			svg.ctx.Style.Dashes = svg.parsePoints(val)
+		}
+	case "stroke-linecap":
+		if val == "butt" {
+			svg.ctx.SetStrokeCapper(ButtCap)
+		} else if val == "round" {
+			svg.ctx.SetStrokeCapper(RoundCap)
+		} else if val == "square" {
+			svg.ctx.SetStrokeCapper(SquareCap)
+		}
+	case "stroke-linejoin":
+		if val == "arcs" {
+			svg.ctx.SetStrokeJoiner(ArcsJoin)
+		} else if val == "bevel" {
+			svg.ctx.SetStrokeJoiner(BevelJoin)
+		} else if val == "miter" {
+			svg.ctx.SetStrokeJoiner(MiterJoiner{BevelJoin, svg.state.strokeMiterLimit})
+		} else if val == "miter-clip" {
+			// not exactly correct
+			svg.ctx.SetStrokeJoiner(MiterJoiner{BevelJoin, svg.state.strokeMiterLimit})
+		} else if val == "round" {
+			svg.ctx.SetStrokeJoiner(RoundJoin)
+		}
+	case "stroke-miterlimit":
+		svg.state.strokeMiterLimit = svg.parseDimension(val, svg.diagonal)
+		if miter, ok := svg.ctx.StrokeJoiner.(MiterJoiner); ok {
+			miter.Limit = svg.state.strokeMiterLimit
+		}
+	case "transform":
+		svg.ctx.ComposeView(svg.parseTransform(val))
+	case "text-anchor":
+		svg.state.textAnchor = val
+	case "dominant-baseline":
+		svg.state.dominantBaseline = val
+	case "font-family":
+		svg.state.fontFamily = val
+	case "font-size":
+		svg.state.fontSize = svg.parseDimension(val, svg.height)
+	case "font-weight":
+		weight := svg.state.fontStyle.Weight()
+		switch val {
+		case "normal":
+			weight = FontRegular
+		case "bold":
+			weight = FontBold
+		case "bolder":
+			if weight.FauxWeight() < FontBold.FauxWeight() {
+				weight = FontBold
+			} else {
+				weight = FontBlack
+			}
+		case "lighter":
+			if FontBold.FauxWeight() <= weight.FauxWeight() {
+				weight = FontRegular
+			} else {
+				weight = FontThin
+			}
+		default:
+			weights := []FontStyle{FontThin, FontExtraLight, FontLight, FontRegular, FontMedium, FontSemiBold, FontBold, FontExtraBold, FontBlack}
+			if i := int(math.Round(svg.parseNumber(val)/100.0)) - 1; 0 <= i && i < len(weights) {
+				weight = weights[i]
+			}
+		}
+		svg.state.fontStyle = svg.state.fontStyle&FontItalic | weight
+	case "font-style":
+		if val == "italic" || strings.HasPrefix(val, "oblique") {
+			svg.state.fontStyle |= FontItalic
+		} else {
+			svg.state.fontStyle &^= FontItalic
+		}
+	case "letter-spacing":
+		if val == "normal" {
+			svg.state.letterSpacing = 0.0
+		} else {
+			svg.state.letterSpacing = svg.parseDimension(val, svg.width)
+		}
+	case "marker":
+		svg.setAttribute("marker-start", val)
+		svg.setAttribute("marker-mid", val)
+		svg.setAttribute("marker-end", val)
+	case "marker-start":
+		svg.state.markerStart = svg.getDef(svg.parseUrlID(val))
+	case "marker-mid":
+		svg.state.markerMid = svg.getDef(svg.parseUrlID(val))
+	case "marker-end":
+		svg.state.markerEnd = svg.getDef(svg.parseUrlID(val))
+	}
+}
+
+// getTag returns the element for an ID if it has the given name.
+func (svg *svgParser) getTag(id, name string) *svgTag {
+	if tag, ok := svg.tags[id]; ok && tag.name == name {
+		return tag
+	}
+	return nil
+}
+
+// getDef returns the definition for an ID, which is parsed on first use.
+func (svg *svgParser) getDef(id string) svgDef {
+	if id == "" {
+		return nil
+	} else if def, ok := svg.defs[id]; ok {
+		return def
+	}
+	svg.defs[id] = nil // prevent circular references
+	if tag, ok := svg.tags[id]; ok {
+		svg.parseDef(id, tag)
+	}
+	return svg.defs[id]
+}
+
+// applyDefs applies the gradients and markers to the last drawn path.
+func (svg *svgParser) applyDefs() {
+	if svg.state.fillDef != nil {
+		svg.state.fillDef("fill", svg.c)
+	}
+	if svg.state.strokeDef != nil {
+		svg.state.strokeDef("stroke", svg.c)
+	}
+	if svg.state.markerStart != nil {
+		svg.state.markerStart("marker-start", svg.c)
+	}
+	if svg.state.markerMid != nil {
+		svg.state.markerMid("marker-mid", svg.c)
+	}
+	if svg.state.markerEnd != nil {
+		svg.state.markerEnd("marker-end", svg.c)
+	}
+}
+
+// getFontFace returns the font face for the current font properties, using the first family of the font-family list that is available. Styles that are not available are synthesized from the regular font.
+func (svg *svgParser) getFontFace() *FontFace {
+	font, ok := svg.fonts[svg.state.fontFamily]
+	if !ok {
+		names := strings.Split(svg.state.fontFamily, ",")
+		for i, name := range append(names, svgDefaultState.fontFamily) {
+			if i == len(names) {
+				svg.warn(svg.offset, "unavailable font-family: %s", svg.state.fontFamily)
+			}
+			if font = svg.loadFont(strings.Trim(strings.TrimSpace(name), `"'`)); font != nil {
+				break
+			}
+		}
+		svg.fonts[svg.state.fontFamily] = font
+	}
+	if font == nil {
+		if svg.err == nil {
+			svg.err = fmt.Errorf("failed to find font '%s'", svg.state.fontFamily)
+		}
+		return nil
+	}
+
+	style := svg.state.fontStyle
+	if !font.styles[style] {
+		if font.filename == "" {
+			if b := svg.resolveFont(font.name, style); b != nil {
+				font.family.LoadFont(b, 0, style)
+			}
+		} else if filename, ok := FindSystemFont(font.name, style); ok && filename != font.filename {
+			// only load fonts that differ from the regular font, otherwise the style is synthesized
+			font.family.LoadFontFile(filename, style)
+		}
+		font.styles[style] = true
+	}
+	fontSize := svg.state.fontSize * 72.0 / 25.4 // pt/mm
+	return font.family.Face(fontSize, svgPaintOpacity(svg.ctx.Style.Fill, svg.state.fillOpacity), style)
+}
+
+// loadFont loads the regular font of a font family from the resolver, or from the system fonts if the resolver does not resolve it. It returns nil if the font family is not available.
+func (svg *svgParser) loadFont(name string) *svgFont {
+	family := NewFontFamily(name)
+	if b := svg.resolveFont(name, FontRegular); b != nil {
+		if err := family.LoadFont(b, 0, FontRegular); err != nil {
+			if svg.err == nil {
+				svg.err = fmt.Errorf("bad font '%s': %w", name, err)
+			}
+			return nil
+		}
+		return &svgFont{family, name, "", map[FontStyle]bool{FontRegular: true}}
+	} else if filename, ok := FindSystemFont(name, FontRegular); ok {
+		if err := family.LoadFontFile(filename, FontRegular); err == nil {
+			return &svgFont{family, name, filename, map[FontStyle]bool{FontRegular: true}}
+		}
+	}
+	return nil
+}
+
+// resolveFont returns the font data from the resolver, or nil if there is no resolver or if it does not resolve the font.
+func (svg *svgParser) resolveFont(name string, style FontStyle) []byte {
+	if svg.resolver == nil {
+		return nil
+	}
+	b, err := svg.resolver.Font(name, style)
+	if err != nil {
+		if svg.err == nil {
+			svg.err = fmt.Errorf("failed to resolve font '%s': %w", name, err)
+		}
+		return nil
+	}
+	return b
+}
+
+func (svg *svgParser) drawShape(tag string, attrs map[string]string) {
+	switch tag {
+	case "circle":
+		cx := svg.parseDimension(attrs["cx"], svg.width)
+		cy := svg.parseDimension(attrs["cy"], svg.height)
+		r := svg.parseDimension(attrs["r"], svg.diagonal)
+		svg.ctx.DrawPath(0.0, 0.0, Circle(r).Translate(cx, cy))
+	case "ellipse":
+		cx := svg.parseDimension(attrs["cx"], svg.width)
+		cy := svg.parseDimension(attrs["cy"], svg.height)
 		rx := svg.parseDimension(attrs["rx"], svg.width)
 		ry := svg.parseDimension(attrs["ry"], svg.height)
-		svg.ctx.DrawPath(cx, cy, Ellipse(rx, ry))
+		svg.ctx.DrawPath(0.0, 0.0, Ellipse(rx, ry).Translate(cx, cy))
 	case "path":
+		svg.offset = svg.elemStack[len(svg.elemStack)-1].node.attrOffset("d")
 		p, err := ParseSVGPath(attrs["d"])
-		if err != nil && svg.err == nil {
-			svg.err = parse.NewErrorLexer(svg.z, "bad path: %w", err)
+		if err != nil {
+			if svg.err == nil {
+				svg.err = svg.newError("bad path: %w", err)
+			}
+			return
+		}
+		svg.ctx.DrawPath(0, 0, p)
+	case "polygon", "polyline":
+		points := svg.parsePoints(attrs["points"])
+		p := &Path{}
+		for i := 0; i+1 < len(points); i += 2 {
+			if i == 0 {
+				p.MoveTo(points[0], points[1])
+			} else {
+				p.LineTo(points[i], points[i+1])
+			}
+		}
+		if tag == "polygon" {
+			p.Close()
+		}
+		svg.ctx.DrawPath(0.0, 0.0, p)
+	case "line":
+		p := &Path{}
+		x1 := svg.parseDimension(attrs["x1"], svg.width)
+		y1 := svg.parseDimension(attrs["y1"], svg.height)
+		x2 := svg.parseDimension(attrs["x2"], svg.width)
+		y2 := svg.parseDimension(attrs["y2"], svg.height)
+
+		p.MoveTo(x1, y1)
+		p.LineTo(x2, y2)
+		svg.ctx.DrawPath(0.0, 0.0, p)
+	case "rect":
+		x := svg.parseDimension(attrs["x"], svg.width)
+		y := svg.parseDimension(attrs["y"], svg.height)
+		width := svg.parseDimension(attrs["width"], svg.width)
+		height := svg.parseDimension(attrs["height"], svg.height)
+		svg.ctx.DrawPath(0.0, 0.0, Rectangle(width, height).Translate(x, y))
+	case "image":
+		svg.drawImage(attrs)
+	}
+}
+
+// parseTextList returns the positioning attributes of a text or tspan element.
+func (svg *svgParser) parseTextList(attrs map[string]string) *svgTextList {
+	list := &svgTextList{}
+	for _, attr := range []struct {
+		name   string
+		list   *[]float64
+		parent float64
+	}{
+		{"x", &list.x, svg.width},
+		{"y", &list.y, svg.height},
+		{"dx", &list.dx, svg.width},
+		{"dy", &list.dy, svg.height},
+		{"rotate", &list.rotate, 0.0},
+	} {
+		for _, v := range strings.FieldsFunc(attrs[attr.name], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r' }) {
+			*attr.list = append(*attr.list, svg.parseDimension(v, attr.parent))
+		}
+	}
+	return list
+}
+
+// parseTextPath returns the path referenced by a textPath element, flattened to line segments.
+func (svg *svgParser) parseTextPath(tag *svgTag) *svgTextPath {
+	href, ok := tag.attrs["href"]
+	if !ok {
+		href = tag.attrs["xlink:href"]
+	}
+	ref := svg.getTag(strings.TrimPrefix(href, "#"), "path")
+	if ref == nil {
+		return nil
+	}
+	p, err := ParseSVGPath(ref.attrs["d"])
+	if err != nil || p.Empty() {
+		return nil
+	}
+	if transform, ok := ref.attrs["transform"]; ok {
+		p = p.Transform(svg.parseTransform(transform))
+	}
+
+	path := &svgTextPath{}
+	coords := p.Flatten(Tolerance).Coords()
+	path.points = coords
+	path.dists = make([]float64, len(coords))
+	for i := 1; i < len(coords); i++ {
+		path.dists[i] = path.dists[i-1] + coords[i].Sub(coords[i-1]).Length()
+	}
+	path.offset = svg.parseDimension(tag.attrs["startOffset"], path.dists[len(path.dists)-1])
+	return path
+}
+
+// at returns the position and the angle in degrees of the tangent at a distance along the path. It returns false if the distance is outside the path.
+func (path *svgTextPath) at(d float64) (Point, float64, bool) {
+	for i := 1; i < len(path.points); i++ {
+		if d <= path.dists[i] && path.dists[i-1] <= d {
+			if path.dists[i] == path.dists[i-1] {
+				continue
+			}
+			t := (d - path.dists[i-1]) / (path.dists[i] - path.dists[i-1])
+			dir := path.points[i].Sub(path.points[i-1])
+			return path.points[i-1].Add(dir.Mul(t)), math.Atan2(dir.Y, dir.X) * 180.0 / math.Pi, true
+		}
+	}
+	return Point{}, 0.0, false
+}
+
+// collectText collects the characters of the text nodes of a text, tspan, or textPath element and its descendants.
+func (svg *svgParser) collectText(text *svgText, tag *svgTag) {
+	for _, child := range tag.content {
+		switch child.name {
+		case "":
+			svg.addText(text, html.UnescapeString(child.text))
+		case "tspan", "textPath", "a":
+			svg.push(child)
+			svg.setStyling(child.props())
+			origPath := text.path
+			if child.name == "textPath" {
+				if text.path = svg.parseTextPath(child); text.path == nil {
+					// text is not rendered for invalid references
+					text.path = origPath
+					svg.pop()
+					continue
+				}
+			}
+			text.lists = append(text.lists, svg.parseTextList(child.attrs))
+			svg.collectText(text, child)
+			text.lists = text.lists[:len(text.lists)-1]
+			text.path = origPath
+			svg.pop()
+		}
+	}
+}
+
+// addText adds the characters of a text node, where white space is collapsed. Each character takes the positioning attributes of the innermost element that specifies them at its index.
+func (svg *svgParser) addText(text *svgText, s string) {
+	face := svg.getFontFace()
+	if face == nil {
+		return
+	}
+
+	baseline := 0.0
+	metrics := face.Metrics()
+	switch svg.state.dominantBaseline {
+	case "hanging", "text-before-edge":
+		baseline = metrics.Ascent
+	case "middle":
+		baseline = metrics.XHeight / 2.0
+	case "central":
+		baseline = (metrics.Ascent - metrics.Descent) / 2.0
+	case "text-after-edge", "ideographic":
+		baseline = -metrics.Descent
+	}
+
+	for _, r := range s {
+		if r == '\n' || r == '\r' || r == '\t' {
+			r = ' '
+		}
+		if r == ' ' && text.space {
+			continue
+		}
+		text.space = r == ' '
+
+		char := svgChar{
+			r:             r,
+			face:          face,
+			anchor:        svg.state.textAnchor,
+			baseline:      baseline,
+			letterSpacing: svg.state.letterSpacing,
+			hidden:        svg.state.hidden,
+			x:             math.NaN(),
+			y:             math.NaN(),
+			dx:            math.NaN(),
+			dy:            math.NaN(),
+			rotate:        math.NaN(),
+			path:          text.path,
+		}
+		for k := len(text.lists) - 1; 0 <= k; k-- {
+			list := text.lists[k]
+			if math.IsNaN(char.x) && list.i < len(list.x) {
+				char.x = list.x[list.i]
+			}
+			if math.IsNaN(char.y) && list.i < len(list.y) {
+				char.y = list.y[list.i]
+			}
+			if math.IsNaN(char.dx) && list.i < len(list.dx) {
+				char.dx = list.dx[list.i]
+			}
+			if math.IsNaN(char.dy) && list.i < len(list.dy) {
+				char.dy = list.dy[list.i]
+			}
+			if math.IsNaN(char.rotate) && 0 < len(list.rotate) {
+				// the last rotation repeats for the remaining characters
+				if list.i < len(list.rotate) {
+					char.rotate = list.rotate[list.i]
+				} else {
+					char.rotate = list.rotate[len(list.rotate)-1]
+				}
+			}
+		}
+		if math.IsNaN(char.dx) {
+			char.dx = 0.0
+		}
+		if math.IsNaN(char.dy) {
+			char.dy = 0.0
+		}
+		if math.IsNaN(char.rotate) {
+			char.rotate = 0.0
+		}
+		for _, list := range text.lists {
+			list.i++
+		}
+		text.chars = append(text.chars, char)
+	}
+}
+
+// drawText lays out and draws the characters of a text element. Consecutive characters are shaped together as a piece, and a new piece starts at characters that are positioned, rotated, spaced, or placed on a path individually. Text anchoring applies to each text chunk, which starts at absolutely positioned characters.
+func (svg *svgParser) drawText(tag *svgTag) {
+	text := &svgText{
+		lists: []*svgTextList{svg.parseTextList(tag.attrs)},
+		space: true,
+	}
+	svg.collectText(text, tag)
+	chars := text.chars
+	for 0 < len(chars) && chars[len(chars)-1].r == ' ' {
+		chars = chars[:len(chars)-1]
+	}
+
+	var pen Point
+	var rt *RichText
+	pieces := []svgTextPiece{}
+	chunk := 0 // first piece of the current text chunk
+	endPiece := func(prev svgChar) {
+		if rt == nil {
+			return
+		}
+		piece := &pieces[len(pieces)-1]
+		piece.text = rt.ToText(0.0, 0.0, Left, Top, 0.0, 0.0)
+		piece.text.WalkSpans(func(x, y float64, span TextSpan) {
+			piece.width = math.Max(piece.width, x+span.Width)
+		})
+		pen.X += piece.width + prev.letterSpacing
+		rt = nil
+	}
+	endChunk := func() {
+		if len(pieces) <= chunk {
+			return
+		}
+		anchor := pieces[chunk].anchor
+		if anchor == "middle" || anchor == "end" {
+			shift := pen.X - pieces[chunk].x
+			if anchor == "middle" {
+				shift /= 2.0
+			}
+			for i := chunk; i < len(pieces); i++ {
+				pieces[i].x -= shift
+			}
+		}
+		chunk = len(pieces)
+	}
+	for i, char := range chars {
+		var prev svgChar
+		if 0 < i {
+			prev = chars[i-1]
+		}
+		newChunk := i == 0 || !math.IsNaN(char.x) || !math.IsNaN(char.y) || char.path != prev.path
+		if newChunk || char.dx != 0.0 || char.dy != 0.0 || char.rotate != 0.0 || prev.rotate != 0.0 || char.letterSpacing != 0.0 || char.path != nil || char.baseline != prev.baseline || char.hidden != prev.hidden {
+			endPiece(prev)
+			if newChunk {
+				endChunk()
+				if prev.path != nil && char.path == nil {
+					// continue at the end of the text on the path
+					if pos, _, ok := prev.path.at(pen.X); ok {
+						pen = pos
+					}
+				} else if char.path != prev.path {
+					pen = Point{char.path.offset, 0.0}
+				}
+			}
+			if !math.IsNaN(char.x) {
+				pen.X = char.x
+			}
+			if !math.IsNaN(char.y) {
+				pen.Y = char.y
+			}
+			pen = pen.Add(Point{char.dx, char.dy})
+
+			rt = NewRichText(char.face)
+			pieces = append(pieces, svgTextPiece{
+				x:        pen.X,
+				y:        pen.Y,
+				rotate:   char.rotate,
+				baseline: char.baseline,
+				anchor:   char.anchor,
+				hidden:   char.hidden,
+				path:     char.path,
+			})
+		}
+		rt.WriteFace(char.face, string(char.r))
+	}
+	if 0 < len(chars) {
+		endPiece(chars[len(chars)-1])
+		endChunk()
+	}
+
+	for _, piece := range pieces {
+		if piece.hidden {
+			continue
 		}
-		svg.ctx.DrawPath(0, 0, p)
-	case "polygon", "polyline":
-		points := svg.parsePoints(attrs["points"])
-		p := &Path{}
-		for i := 0; i+1 < len(points); i += 2 {
-			if i == 0 {
-				p.MoveTo(points[0], points[1])
-			} else {
-				p.LineTo(points[i], points[i+1])
+
+		// draw at the baseline of the first line
+		top, first := 0.0, true
+		piece.text.WalkLines(func(y float64, _ []TextSpan) {
+			if first {
+				top, first = y, false
 			}
+		})
+
+		m := Identity.Translate(piece.x, piece.y+piece.baseline)
+		if piece.path != nil {
+			// characters are placed at the point on the path at their horizontal center
+			pos, angle, ok := piece.path.at(piece.x + piece.width/2.0)
+			if !ok {
+				continue
+			}
+			m = Identity.Translate(pos.X, pos.Y).Rotate(angle).Translate(-piece.width/2.0, piece.y+piece.baseline)
 		}
-		if tag == "polygon" {
-			p.Close()
+		svg.ctx.Push()
+		svg.ctx.ComposeView(m.Rotate(piece.rotate).Translate(0.0, top))
+		svg.ctx.DrawText(0.0, 0.0, piece.text)
+		svg.ctx.Pop()
+	}
+}
+
+// loadImage loads a PNG, JPEG, or WebP image from a data URI, from the resolver, or from a file path relative to the working directory.
+func (svg *svgParser) loadImage(href string) (Image, error) {
+	var b []byte
+	if strings.HasPrefix(href, "data:") {
+		var err error
+		if _, b, err = parse.DataURI([]byte(href)); err != nil {
+			return Image{}, err
 		}
-		svg.ctx.DrawPath(0.0, 0.0, p)
-	case "line":
-		p := &Path{}
-		x1, _ := strconv.ParseInt(attrs["x1"], 10, 64)
-		y1, _ := strconv.ParseInt(attrs["y1"], 10, 64)
-		x2, _ := strconv.ParseInt(attrs["x2"], 10, 64)
-		y2, _ := strconv.ParseInt(attrs["y2"], 10, 64)
+	} else if svg.resolver != nil {
+		var err error
+		if b, err = svg.resolver.Image(href); err != nil {
+			return Image{}, err
+		}
+	}
+	if b == nil && !strings.HasPrefix(href, "data:") {
+		var err error
+		if b, err = ioutil.ReadFile(strings.TrimPrefix(href, "file://")); err != nil {
+			return Image{}, err
+		}
+	}
 
-		p.MoveTo(float64(x1), float64(y1))
-		p.LineTo(float64(x2), float64(y2))
-		svg.ctx.DrawPath(0.0, 0.0, p)
-	case "rect":
-		x := svg.parseDimension(attrs["x"], svg.width)
-		y := svg.parseDimension(attrs["y"], svg.height)
-		width := svg.parseDimension(attrs["width"], svg.width)
-		height := svg.parseDimension(attrs["height"], svg.height)
-		svg.ctx.DrawPath(x, y, Rectangle(width, height))
+	r := bytes.NewReader(b)
+	if bytes.HasPrefix(b, []byte("\x89PNG")) {
+		return NewPNGImage(r)
+	} else if bytes.HasPrefix(b, []byte("\xFF\xD8")) {
+		return NewJPEGImage(r)
+	} else if 12 <= len(b) && bytes.Equal(b[:4], []byte("RIFF")) && bytes.Equal(b[8:12], []byte("WEBP")) {
+		return NewWEBPImage(r)
+	}
+	return Image{}, fmt.Errorf("unsupported image format")
+}
+
+// drawImage draws an image element. When only one of width and height is given, the other follows from the aspect ratio of the image. The image is fit into the viewport using preserveAspectRatio, but overflow is not clipped.
+func (svg *svgParser) drawImage(attrs map[string]string) {
+	href, ok := attrs["href"]
+	if !ok {
+		href = attrs["xlink:href"]
+	}
+	img, err := svg.loadImage(href)
+	if err != nil {
+		if svg.err == nil {
+			svg.err = fmt.Errorf("bad image: %w", err)
+		}
+		return
+	}
+	size := img.Bounds().Size()
+	if size.X == 0 || size.Y == 0 {
+		return
+	}
+
+	x := svg.parseDimension(attrs["x"], svg.width)
+	y := svg.parseDimension(attrs["y"], svg.height)
+	width, height := float64(size.X), float64(size.Y)
+	attrWidth, attrHeight := attrs["width"], attrs["height"]
+	if attrWidth == "auto" {
+		attrWidth = ""
+	}
+	if attrHeight == "auto" {
+		attrHeight = ""
+	}
+	if attrWidth != "" {
+		width = svg.parseDimension(attrWidth, svg.width)
+		if attrHeight == "" {
+			height = width * float64(size.Y) / float64(size.X)
+		}
+	}
+	if attrHeight != "" {
+		height = svg.parseDimension(attrHeight, svg.height)
+		if attrWidth == "" {
+			width = height * float64(size.X) / float64(size.Y)
+		}
+	}
+	if width <= 0.0 || height <= 0.0 {
+		return
+	}
+
+	viewbox := [4]float64{0.0, 0.0, float64(size.X), float64(size.Y)}
+	svg.ctx.Push()
+	svg.ctx.ComposeView(Identity.Translate(x, y).Mul(svg.parseViewBoxTransform(width, height, viewbox, attrs["preserveAspectRatio"])))
+	svg.ctx.DrawImage(0.0, 0.0, img, DPMM(1.0))
+	svg.ctx.Pop()
+}
+
+// drawTag draws an element and its children. Elements that are not rendered directly, such as definitions, are skipped.
+func (svg *svgParser) drawTag(tag *svgTag) {
+	switch tag.name {
+	case "", "defs", "style", "symbol", "marker", "linearGradient", "radialGradient", "pattern", "clipPath", "mask", "filter", "title", "desc", "metadata", "script", "foreignObject":
+		return
+	}
+
+	svg.push(tag)
+	svg.setStyling(tag.props())
+	if svg.state.display == "none" {
+		svg.pop()
+		return
+	}
+
+	// clipping paths, masks, and opacity apply to the element and its children as a whole
+	clipPath, mask, filter := svg.state.clipPath, svg.state.mask, svg.state.filter
+	svg.state.clipPath, svg.state.mask, svg.state.filter = nil, nil, nil
+	n, userSpace := len(svg.c.layers[svg.c.zindex]), svg.userSpace()
+
+	switch tag.name {
+	case "svg":
+		svg.drawViewport(tag, tag.attrs["width"], tag.attrs["height"])
+	case "use":
+		svg.drawUse(tag)
 	case "text":
-		svg.state.textX = svg.parseDimension(attrs["x"], svg.width)
-		svg.state.textY = svg.parseDimension(attrs["y"], svg.height)
+		svg.drawText(tag)
+	case "switch":
+		// draw the first child that is supported, which excludes foreign objects
+		for _, child := range tag.content {
+			if child.name != "" && child.name != "foreignObject" {
+				svg.drawTag(child)
+				break
+			}
+		}
+	default:
+		// draw shapes such as circles, paths, etc.
+		n := len(svg.c.layers[svg.c.zindex])
+		if !svg.state.hidden {
+			svg.drawShape(tag.name, tag.attrs)
+		}
+		if n < len(svg.c.layers[svg.c.zindex]) {
+			// set linearGradient, markers, etc.
+			// these defs depend on the shape or size of the path
+			svg.applyDefs()
+			if tag.name != "image" {
+				svg.setOpacity(n, svg.state.fillOpacity, svg.state.strokeOpacity)
+			}
+		}
+
+		// container elements such as g and a
+		for _, child := range tag.content {
+			svg.drawTag(child)
+		}
+	}
+	if filter != nil {
+		svg.filterLayers(filter, n, userSpace)
+	}
+	if clipPath != nil {
+		clip, _ := svg.clipRegion(clipPath, n, userSpace)
+		svg.clipLayers(n, clip, 1.0)
+	}
+	if mask != nil {
+		clip, opacity := svg.clipRegion(mask, n, userSpace)
+		svg.clipLayers(n, clip, opacity)
+	}
+	svg.setOpacity(n, svg.state.opacity, svg.state.opacity)
+	svg.pop()
+}
+
+// drawViewport draws the children of a nested svg element or of a symbol, which establish a new viewport with the given width and height that default to 100%. The viewBox is fit into the viewport using preserveAspectRatio, but overflow is not clipped.
+func (svg *svgParser) drawViewport(tag *svgTag, attrWidth, attrHeight string) {
+	if attrWidth == "" {
+		attrWidth = "100%"
+	}
+	if attrHeight == "" {
+		attrHeight = "100%"
+	}
+	x := svg.parseDimension(tag.attrs["x"], svg.width)
+	y := svg.parseDimension(tag.attrs["y"], svg.height)
+	width := svg.parseDimension(attrWidth, svg.width)
+	height := svg.parseDimension(attrHeight, svg.height)
+	if width <= 0.0 || height <= 0.0 {
+		return
+	}
+	_, _, viewbox := svg.parseViewBox("", "", tag.attrs["viewBox"])
+	svg.ctx.ComposeView(Identity.Translate(x, y).Mul(svg.parseViewBoxTransform(width, height, viewbox, tag.attrs["preserveAspectRatio"])))
+
+	origSVGCanvas := svg.svgCanvas
+	if 0.0 < viewbox[2] && 0.0 < viewbox[3] {
+		svg.setViewport(viewbox[2], viewbox[3])
+	} else {
+		svg.setViewport(width, height)
+	}
+	for _, child := range tag.content {
+		svg.drawTag(child)
+	}
+	svg.svgCanvas = origSVGCanvas
+}
+
+// drawUse draws the element referenced by a use element, translated by its x and y attributes. Referenced elements inherit the styling of the use element. Only references within the document are supported.
+func (svg *svgParser) drawUse(tag *svgTag) {
+	href, ok := tag.attrs["href"]
+	if !ok {
+		href = tag.attrs["xlink:href"]
+	}
+	if !strings.HasPrefix(href, "#") {
+		svg.warn(tag.attrOffset("href"), "unsupported external reference: %s", href)
+		return
+	}
+	ref, ok := svg.tags[href[1:]]
+	if !ok {
+		return
+	}
+	for _, tag := range svg.useStack {
+		if tag == ref {
+			return // circular reference
+		}
+	}
+	svg.useStack = append(svg.useStack, ref)
+
+	x := svg.parseDimension(tag.attrs["x"], svg.width)
+	y := svg.parseDimension(tag.attrs["y"], svg.height)
+	svg.ctx.ComposeView(Identity.Translate(x, y))
+	if ref.name == "symbol" || ref.name == "svg" {
+		// width and height of use override those of the referenced element
+		width, ok := tag.attrs["width"]
+		if !ok {
+			width = ref.attrs["width"]
+		}
+		height, ok := tag.attrs["height"]
+		if !ok {
+			height = ref.attrs["height"]
+		}
+		svg.push(ref)
+		svg.setStyling(ref.props())
+		svg.drawViewport(ref, width, height)
+		svg.pop()
+	} else {
+		svg.drawTag(ref)
 	}
+	svg.useStack = svg.useStack[:len(svg.useStack)-1]
+}
+
+// SVGWarning is a diagnostic for an element, attribute, or style property of an SVG document that is not supported and will not be rendered faithfully.
+type SVGWarning struct {
+	Line, Column int
+	Message      string
+}
+
+func (w SVGWarning) String() string {
+	return fmt.Sprintf("%s on line %d and column %d", w.Message, w.Line, w.Column)
+}
+
+// SVGResolver resolves external resources of an SVG document. Images are referenced by the href of image elements, and fonts by a family of the font-family property and the font style. When it returns nil without an error, the resource is loaded by default from the file path relative to the working directory for images, or from the system fonts for fonts.
+type SVGResolver interface {
+	Image(href string) ([]byte, error)
+	Font(family string, style FontStyle) ([]byte, error)
+}
+
+// SVGOptions are the options for parsing SVG documents.
+type SVGOptions struct {
+	Strict   bool        // fail on unsupported content
+	Resolver SVGResolver // resolves external resources, optional
 }
 
+// DefaultSVGOptions are the default options for parsing SVG documents.
+var DefaultSVGOptions = SVGOptions{}
+
+// ParseSVG parses an SVG document into a canvas.
 func ParseSVG(r io.Reader) (*Canvas, error) {
+	c, _, err := ParseSVGWithOptions(r, nil)
+	return c, err
+}
+
+// ParseSVGWithOptions parses an SVG document into a canvas and returns warnings for the content that is not supported. In strict mode, unsupported content returns an error instead. A nil opts uses the default options.
+func ParseSVGWithOptions(r io.Reader, opts *SVGOptions) (*Canvas, []SVGWarning, error) {
+	if opts == nil {
+		defaultOptions := DefaultSVGOptions
+		opts = &defaultOptions
+	}
+
 	z := parse.NewInput(r)
 	defer z.Restore()
 
 	l := xml.NewLexer(z)
 	svg := svgParser{
-		z:          z,
-		defs:       map[string]svgDef{},
-		fonts:      map[string]*FontFamily{},
-		activeDefs: map[string]svgDef{},
+		z:        z,
+		tags:     map[string]*svgTag{},
+		defs:     map[string]svgDef{},
+		fonts:    map[string]*svgFont{},
+		strict:   opts.Strict,
+		resolver: opts.Resolver,
+		warned:   map[string]bool{},
+	}
+	root := svg.parseTag(l)
+	if svg.err != nil {
+		return nil, nil, svg.err
+	} else if root == nil || root.name != "svg" {
+		return nil, nil, fmt.Errorf("expected SVG tag")
+	}
+	svg.checkTag(root)
+	if svg.err != nil {
+		return nil, svg.warnings, svg.err
 	}
-	for {
-		tt, data := l.Next()
-		switch tt {
-		case xml.ErrorToken:
-			if l.Err() != io.EOF {
-				return svg.c, l.Err()
-			} else if svg.err != nil {
-				return svg.c, svg.err
-			} else if svg.c == nil {
-				return svg.c, fmt.Errorf("expected SVG tag")
-			}
-			if svg.c.W == 0.0 || svg.c.H == 0.0 {
-				svg.c.Fit(0.0)
-			}
-			return svg.c, nil
-		case xml.StartTagToken:
-			tag := string(data[1:])
-			tt, attrNames, attrs := svg.parseAttributes(l)
-
-			// handle SVG tag and create canvas
-			if tag == "svg" && svg.c == nil {
-				width, height, viewbox := svg.parseViewBox(attrs["width"], attrs["height"], attrs["viewBox"])
-				svg.init(width, height, viewbox)
-			} else if tag != "svg" && svg.c == nil {
-				return svg.c, fmt.Errorf("expected SVG tag")
-			}
-
-			// handle special tags
-			if tag == "style" {
-				tt, data = l.Next()
-				if tt == xml.TextToken {
-					svg.parseStyle(data)
-					tt, data = l.Next() // end token
-				} else {
-					return svg.c, fmt.Errorf("bad style tag")
-				}
-				break
-			} else if tag == "defs" {
-				if tt != xml.StartTagCloseVoidToken {
-					svg.parseDefs(l)
-				}
-				break
-			}
 
-			// push new state
-			svg.push(tag, attrs)
+	// create canvas, user units are in pixels
+	width, height, viewbox := svg.parseViewBox(root.attrs["width"], root.attrs["height"], root.attrs["viewBox"])
+	view := Identity.Scale(25.4/96.0, 25.4/96.0).Mul(svg.parseViewBoxTransform(width, height, viewbox, root.attrs["preserveAspectRatio"]))
+	svg.init(width*25.4/96.0, height*25.4/96.0, view)
+	if 0.0 < viewbox[2] && 0.0 < viewbox[3] {
+		svg.setViewport(viewbox[2], viewbox[3])
+	} else {
+		svg.setViewport(width, height)
+	}
+	svg.parseDefs(root)
+	if svg.err != nil {
+		return nil, svg.warnings, svg.err
+	}
 
-			// set styling and presentation attributes
-			props := []cssProperty{}
-			for _, key := range attrNames {
-				props = append(props, cssProperty{key, attrs[key]})
-			}
-			svg.setStyling(props)
+	svg.push(root)
+	svg.setStyling(root.props())
+	for _, tag := range root.content {
+		svg.drawTag(tag)
+	}
+	svg.pop()
+
+	if svg.err != nil {
+		if svg.strict {
+			return nil, svg.warnings, svg.err
+		}
+		return svg.c, svg.warnings, svg.err
+	} else if svg.c.W == 0.0 || svg.c.H == 0.0 {
+		svg.c.Fit(0.0)
+	}
+	return svg.c, svg.warnings, nil
+}
 
-			// draw shapes such as circles, paths, etc.
-			svg.drawShape(tag, attrs)
+// svgElements are the supported elements.
+var svgElements = map[string]bool{
+	"svg": true, "g": true, "a": true, "defs": true, "style": true, "symbol": true, "use": true, "switch": true,
+	"title": true, "desc": true, "metadata": true,
+	"circle": true, "ellipse": true, "line": true, "path": true, "polygon": true, "polyline": true, "rect": true,
+	"text": true, "tspan": true, "textPath": true, "image": true,
+	"linearGradient": true, "radialGradient": true, "stop": true, "pattern": true, "marker": true, "clipPath": true, "mask": true,
+	"filter": true, "feGaussianBlur": true, "feOffset": true, "feFlood": true, "feComposite": true, "feMerge": true, "feMergeNode": true, "feColorMatrix": true,
+}
 
-			// set linearGradient, markers, etc.
-			// these defs depend on the shape or size of the path
-			for attr, applyDef := range svg.activeDefs {
-				if applyDef != nil {
-					applyDef(attr, svg.c)
+// svgAttributes are the supported attributes and style properties, including those without effect on rendering.
+var svgAttributes = map[string]bool{
+	// core
+	"id": true, "class": true, "style": true, "xmlns": true, "version": true, "baseProfile": true, "lang": true,
+	"href": true, "target": true, "role": true, "tabindex": true, "focusable": true,
+	"requiredFeatures": true, "requiredExtensions": true, "systemLanguage": true,
+
+	// geometry
+	"x": true, "y": true, "width": true, "height": true, "cx": true, "cy": true, "r": true, "rx": true, "ry": true,
+	"x1": true, "y1": true, "x2": true, "y2": true, "points": true, "d": true, "transform": true,
+	"viewBox": true, "preserveAspectRatio": true, "dx": true, "dy": true, "rotate": true, "startOffset": true,
+
+	// paint servers, markers, clipping, and masking
+	"gradientUnits": true, "gradientTransform": true, "spreadMethod": true, "fx": true, "fy": true, "fr": true,
+	"offset": true, "stop-color": true, "stop-opacity": true,
+	"patternUnits": true, "patternContentUnits": true, "patternTransform": true,
+	"markerWidth": true, "markerHeight": true, "markerUnits": true, "refX": true, "refY": true, "orient": true,
+	"clipPathUnits": true, "maskUnits": true, "maskContentUnits": true,
+	"filterUnits": true, "primitiveUnits": true, "in": true, "in2": true, "result": true, "stdDeviation": true, "edgeMode": true,
+	"operator": true, "k1": true, "k2": true, "k3": true, "k4": true, "type": true, "values": true, "flood-color": true, "flood-opacity": true,
+
+	// presentation
+	"fill": true, "fill-rule": true, "fill-opacity": true, "stroke": true, "stroke-width": true, "stroke-opacity": true,
+	"stroke-linecap": true, "stroke-linejoin": true, "stroke-miterlimit": true, "stroke-dasharray": true, "stroke-dashoffset": true,
+	"opacity": true, "display": true, "visibility": true, "clip-path": true, "mask": true, "filter": true,
+	"marker": true, "marker-start": true, "marker-mid": true, "marker-end": true,
+	"font-family": true, "font-size": true, "font-weight": true, "font-style": true, "letter-spacing": true,
+	"text-anchor": true, "dominant-baseline": true,
+
+	// rendering hints
+	"shape-rendering": true, "text-rendering": true, "image-rendering": true, "color-rendering": true,
+	"color-interpolation": true, "color-interpolation-filters": true,
+}
+
+// parseCSSSelector parses a complex selector, which are compound selectors separated by descendant, child, next-sibling, or subsequent-sibling combinators.
+func parseCSSSelector(vals []css.Token) cssSelector {
+	selector := cssSelector{}
+	op := byte(' ')
+	for i := 0; i < len(vals); {
+		t := vals[i]
+		if t.TokenType == css.WhitespaceToken {
+			i++
+			continue
+		} else if t.TokenType == css.DelimToken && (t.Data[0] == '>' || t.Data[0] == '+' || t.Data[0] == '~') {
+			op = t.Data[0]
+			i++
+			continue
+		}
+
+		var node cssSelectorNode
+		node, i = parseCSSSelectorNode(vals, i)
+		node.op = op
+		selector = append(selector, node)
+		op = ' '
+	}
+	return selector
+}
+
+// parseCSSSelectorNode parses a compound selector starting at index i and returns the index after it.
+func parseCSSSelectorNode(vals []css.Token, i int) (cssSelectorNode, int) {
+	node := cssSelectorNode{}
+	start := i
+	for ; i < len(vals); i++ {
+		t := vals[i]
+		if t.TokenType == css.WhitespaceToken || t.TokenType == css.CommaToken || t.TokenType == css.DelimToken && (t.Data[0] == '>' || t.Data[0] == '+' || t.Data[0] == '~') {
+			break
+		}
+
+		switch {
+		case t.TokenType == css.IdentToken || t.TokenType == css.DelimToken && t.Data[0] == '*':
+			node.typ = string(t.Data)
+		case t.TokenType == css.HashToken:
+			node.attrs = append(node.attrs, cssAttrSelector{op: '=', attr: "id", val: string(t.Data[1:])})
+		case t.TokenType == css.DelimToken && (t.Data[0] == '.' || t.Data[0] == '#') && i+1 < len(vals) && vals[i+1].TokenType == css.IdentToken:
+			if t.Data[0] == '#' {
+				node.attrs = append(node.attrs, cssAttrSelector{op: '=', attr: "id", val: string(vals[i+1].Data)})
+			} else {
+				node.attrs = append(node.attrs, cssAttrSelector{op: '~', attr: "class", val: string(vals[i+1].Data)})
+			}
+			i++
+		case t.TokenType == css.LeftBracketToken:
+			args := []css.Token{}
+			for i++; i < len(vals) && vals[i].TokenType != css.RightBracketToken; i++ {
+				if vals[i].TokenType != css.WhitespaceToken {
+					args = append(args, vals[i])
 				}
-				svg.activeDefs[attr] = nil
 			}
-
-			// tag is self-closing
-			if tt == xml.StartTagCloseVoidToken {
-				svg.pop()
-			}
-		case xml.TextToken:
-			if 0 < len(svg.elemStack) {
-				tag := svg.elemStack[len(svg.elemStack)-1].tag
-				if tag == "text" {
-					textAlign := Left
-					if svg.state.textAnchor == "middle" {
-						textAlign = Center
-					} else if svg.state.textAnchor == "end" {
-						textAlign = Right
+			if len(args) == 1 && args[0].TokenType == css.IdentToken {
+				node.attrs = append(node.attrs, cssAttrSelector{op: 0, attr: string(args[0].Data)})
+			} else if len(args) == 3 && args[0].TokenType == css.IdentToken {
+				val := string(args[2].Data)
+				if args[2].TokenType == css.StringToken {
+					val = val[1 : len(val)-1]
+				}
+				node.attrs = append(node.attrs, cssAttrSelector{op: args[1].Data[0], attr: string(args[0].Data), val: val})
+			} else {
+				node.attrs = append(node.attrs, cssAttrSelector{op: '?'}) // unsupported
+			}
+		case t.TokenType == css.ColonToken && i+1 < len(vals):
+			i++
+			pseudo := cssPseudoSelector{}
+			if vals[i].TokenType == css.IdentToken {
+				pseudo.name = strings.ToLower(string(vals[i].Data))
+			} else if vals[i].TokenType == css.FunctionToken {
+				pseudo.name = strings.ToLower(strings.TrimSuffix(string(vals[i].Data), "("))
+
+				// find closing parenthesis
+				j, depth := i+1, 0
+				for ; j < len(vals); j++ {
+					if vals[j].TokenType == css.FunctionToken || vals[j].TokenType == css.LeftParenthesisToken {
+						depth++
+					} else if vals[j].TokenType == css.RightParenthesisToken {
+						if depth == 0 {
+							break
+						}
+						depth--
+					}
+				}
+				args := vals[i+1 : j]
+				i = j
+
+				switch pseudo.name {
+				case "nth-child", "nth-last-child":
+					arg := strings.Builder{}
+					for _, t := range args {
+						arg.Write(t.Data)
+					}
+					var ok bool
+					if pseudo.a, pseudo.b, ok = parseCSSNth(arg.String()); !ok {
+						pseudo.name = "" // never applies
+					}
+				case "not":
+					for k := 0; k < len(args); k++ {
+						if args[k].TokenType != css.WhitespaceToken && args[k].TokenType != css.CommaToken {
+							var not cssSelectorNode
+							not, k = parseCSSSelectorNode(args, k)
+							pseudo.not = append(pseudo.not, not)
+						}
 					}
-					t := html.UnescapeString(string(data))
-					text := NewTextLine(svg.getFontFace(), t, textAlign)
-					svg.ctx.DrawText(svg.state.textX, svg.state.textY, text)
 				}
 			}
-		case xml.EndTagToken:
-			svg.pop()
+			node.pseudos = append(node.pseudos, pseudo)
+		}
+	}
+	if i == start {
+		i++ // skip unsupported token
+	}
+	return node, i
+}
+
+// parseCSSNth parses the an+b argument of the nth-child pseudo-classes.
+func parseCSSNth(s string) (int, int, bool) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	if s == "odd" {
+		return 2, 1, true
+	} else if s == "even" {
+		return 2, 0, true
+	}
+
+	n := strings.IndexByte(s, 'n')
+	if n == -1 {
+		b, err := strconv.Atoi(strings.TrimPrefix(s, "+"))
+		return 0, b, err == nil
+	}
+
+	a, b := 1, 0
+	if sa := strings.TrimPrefix(s[:n], "+"); sa == "-" {
+		a = -1
+	} else if sa != "" {
+		var err error
+		if a, err = strconv.Atoi(sa); err != nil {
+			return 0, 0, false
 		}
 	}
+	if sb := strings.TrimPrefix(s[n+1:], "+"); sb != "" {
+		var err error
+		if b, err = strconv.Atoi(sb); err != nil {
+			return 0, 0, false
+		}
+	}
+	return a, b, true
+}
+
+// cssValue returns the value of a declaration and whether it is important.
+func cssValue(vals []css.Token) (string, bool) {
+	trim := func(vals []css.Token) []css.Token {
+		for 0 < len(vals) && vals[len(vals)-1].TokenType == css.WhitespaceToken {
+			vals = vals[:len(vals)-1]
+		}
+		return vals
+	}
+
+	important := false
+	vals = trim(vals)
+	if 2 <= len(vals) && vals[len(vals)-1].TokenType == css.IdentToken && strings.EqualFold(string(vals[len(vals)-1].Data), "important") {
+		if excl := trim(vals[:len(vals)-1]); 0 < len(excl) && excl[len(excl)-1].TokenType == css.DelimToken && excl[len(excl)-1].Data[0] == '!' {
+			important = true
+			vals = trim(excl[:len(excl)-1])
+		}
+	}
+
+	val := strings.Builder{}
+	for _, t := range vals {
+		val.Write(t.Data)
+	}
+	return val.String(), important
 }
 
 type cssAttrSelector struct {
-	op   byte // empty, =, ~, |
+	op   byte // empty, =, ~, |, ^, $, *
 	attr string
 	val  string
 }
@@ -974,6 +2779,12 @@ func (sel cssAttrSelector) AppliesTo(elem svgElem) bool {
 		return false
 	case '|':
 		return elem.attrs[sel.attr] == sel.val || strings.HasPrefix(elem.attrs[sel.attr], sel.val+"-")
+	case '^':
+		return sel.val != "" && strings.HasPrefix(elem.attrs[sel.attr], sel.val)
+	case '$':
+		return sel.val != "" && strings.HasSuffix(elem.attrs[sel.attr], sel.val)
+	case '*':
+		return sel.val != "" && strings.Contains(elem.attrs[sel.attr], sel.val)
 	}
 	return false
 }
@@ -993,10 +2804,78 @@ func (attr cssAttrSelector) String() string {
 	return sb.String()
 }
 
+type cssPseudoSelector struct {
+	name string            // first-child, last-child, only-child, nth-child, nth-last-child, or not
+	a, b int               // for nth-child as an+b
+	not  []cssSelectorNode // for not
+}
+
+func (sel cssPseudoSelector) AppliesTo(elem svgElem) bool {
+	siblings, index := elem.siblings()
+	switch sel.name {
+	case "first-child":
+		return index == 0
+	case "last-child":
+		return index == len(siblings)-1
+	case "only-child":
+		return len(siblings) == 1
+	case "nth-child", "nth-last-child":
+		pos := index + 1
+		if sel.name == "nth-last-child" {
+			pos = len(siblings) - index
+		}
+		if sel.a == 0 {
+			return pos == sel.b
+		}
+		return (pos-sel.b)/sel.a >= 0 && (pos-sel.b)%sel.a == 0
+	case "not":
+		for _, not := range sel.not {
+			if not.AppliesTo(elem) {
+				return false
+			}
+		}
+		return true
+	}
+	return false // unsupported, such as dynamic pseudo-classes
+}
+
+func (sel cssPseudoSelector) specificity() int {
+	if sel.name == "not" {
+		specificity := 0
+		for _, not := range sel.not {
+			if s := not.specificity(); specificity < s {
+				specificity = s
+			}
+		}
+		return specificity
+	}
+	return 100
+}
+
+func (sel cssPseudoSelector) String() string {
+	switch sel.name {
+	case "nth-child", "nth-last-child":
+		return fmt.Sprintf(":%s(%dn%+d)", sel.name, sel.a, sel.b)
+	case "not":
+		sb := strings.Builder{}
+		sb.WriteString(":not(")
+		for i, not := range sel.not {
+			if i != 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(not.String()[1:])
+		}
+		sb.WriteString(")")
+		return sb.String()
+	}
+	return ":" + sel.name
+}
+
 type cssSelectorNode struct {
-	op    byte   // space or >, first is always space
-	typ   string // is * for universal
-	attrs []cssAttrSelector
+	op      byte   // combinator with the previous node: space, >, +, or ~, first is always space
+	typ     string // is * for universal
+	attrs   []cssAttrSelector
+	pseudos []cssPseudoSelector
 }
 
 func (sel cssSelectorNode) AppliesTo(elem svgElem) bool {
@@ -1008,9 +2887,33 @@ func (sel cssSelectorNode) AppliesTo(elem svgElem) bool {
 			return false
 		}
 	}
+	for _, pseudo := range sel.pseudos {
+		if !pseudo.AppliesTo(elem) {
+			return false
+		}
+	}
 	return true
 }
 
+// specificity returns the specificity as a single number, with IDs weighing 10000, classes, attributes, and pseudo-classes 100, and types 1.
+func (sel cssSelectorNode) specificity() int {
+	specificity := 0
+	if sel.typ != "*" && sel.typ != "" {
+		specificity++
+	}
+	for _, attr := range sel.attrs {
+		if attr.attr == "id" && attr.op == '=' {
+			specificity += 10000
+		} else {
+			specificity += 100
+		}
+	}
+	for _, pseudo := range sel.pseudos {
+		specificity += pseudo.specificity()
+	}
+	return specificity
+}
+
 func (sel cssSelectorNode) String() string {
 	sb := strings.Builder{}
 	sb.WriteByte(sel.op)
@@ -1028,44 +2931,56 @@ func (sel cssSelectorNode) String() string {
 			sb.WriteByte(']')
 		}
 	}
+	for _, pseudo := range sel.pseudos {
+		sb.WriteString(pseudo.String())
+	}
 	return sb.String()
 }
 
 type cssSelector []cssSelectorNode
 
+// AppliesTo returns true if the selector applies to the last element, where the other elements are its ancestors.
 func (sels cssSelector) AppliesTo(elems []svgElem) bool {
-	ielem := 0
-Retry:
-	isel := 0
-	ielemNext := len(elems)
-	for isel < len(sels) && ielem < len(elems) {
-		switch sels[isel].op {
-		case ' ':
-			for {
-				if ielem == len(elems) {
-					ielem = ielemNext
-					goto Retry
-				} else if sels[isel].AppliesTo(elems[ielem]) {
-					ielem++
-					break
-				}
-				ielem++
-			}
-			if ielemNext == len(elems) {
-				ielemNext = ielem
+	return 0 < len(sels) && 0 < len(elems) && sels.appliesTo(len(sels)-1, elems)
+}
+
+func (sels cssSelector) appliesTo(k int, elems []svgElem) bool {
+	elem := elems[len(elems)-1]
+	if !sels[k].AppliesTo(elem) {
+		return false
+	} else if k == 0 {
+		return true
+	}
+
+	switch sels[k].op {
+	case ' ':
+		for i := len(elems) - 1; 0 < i; i-- {
+			if sels.appliesTo(k-1, elems[:i]) {
+				return true
 			}
-		case '>':
-			if !sels[isel].AppliesTo(elems[ielem]) {
-				ielem = ielemNext
-				goto Retry
+		}
+	case '>':
+		return 1 < len(elems) && sels.appliesTo(k-1, elems[:len(elems)-1])
+	case '+', '~':
+		siblings, index := elem.siblings()
+		ancestors := elems[: len(elems)-1 : len(elems)-1]
+		for i := index - 1; 0 <= i; i-- {
+			if sels.appliesTo(k-1, append(ancestors, newSVGElem(siblings[i]))) {
+				return true
+			} else if sels[k].op == '+' {
+				break
 			}
-			ielem++
-		default:
-			return false
 		}
-		isel++
 	}
-	return len(sels) != 0 && isel == len(sels)
+	return false
+}
+
+func (sels cssSelector) specificity() int {
+	specificity := 0
+	for _, sel := range sels {
+		specificity += sel.specificity()
+	}
+	return specificity
 }
 
 func (sels cssSelector) String() string {
@@ -1073,20 +2988,52 @@ func (sels cssSelector) String() string {
 		return ""
 	}
 	sb := strings.Builder{}
-	for _, sel := range sels {
+	for i, sel := range sels {
+		if i != 0 && sel.op != ' ' {
+			sb.WriteByte(' ')
+		}
 		sb.WriteString(sel.String())
 	}
 	return sb.String()[1:]
 }
 
 type cssProperty struct {
-	key, val string
+	key, val  string
+	important bool
 }
 
 func (prop cssProperty) String() string {
+	if prop.important {
+		return prop.key + ":" + prop.val + "!important"
+	}
 	return prop.key + ":" + prop.val
 }
 
+// see cssDeclaration
+const (
+	cssPresentationOrigin = iota
+	cssStyleSheetOrigin
+	cssStyleAttributeOrigin
+)
+
+// cssDeclaration is a property that applies to an element, with its origin and the specificity of the selector for style sheet rules.
+type cssDeclaration struct {
+	cssProperty
+	origin      int
+	specificity int
+	offset      int // position in the source
+}
+
+// Less returns true if the declaration has lower precedence in the cascade than the other, ignoring the order of appearance.
+func (decl cssDeclaration) Less(other cssDeclaration) bool {
+	if decl.important != other.important {
+		return other.important
+	} else if decl.origin != other.origin {
+		return decl.origin < other.origin
+	}
+	return decl.specificity < other.specificity
+}
+
 type cssRule struct {
 	selectors []cssSelector
 	props     []cssProperty
@@ -1101,6 +3048,20 @@ func (rule cssRule) AppliesTo(elems []svgElem) bool {
 	return false
 }
 
+// Specificity returns the highest specificity of the selectors that apply to the last element, or false if none applies.
+func (rule cssRule) Specificity(elems []svgElem) (int, bool) {
+	specificity, ok := 0, false
+	for _, sels := range rule.selectors {
+		if sels.AppliesTo(elems) {
+			if s := sels.specificity(); !ok || specificity < s {
+				specificity = s
+			}
+			ok = true
+		}
+	}
+	return specificity, ok
+}
+
 func (rule cssRule) String() string {
 	sb := strings.Builder{}
 	for i, sel := range rule.selectors {
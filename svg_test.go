@@ -0,0 +1,381 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/test"
+)
+
+func svgLayers(t *testing.T, s string) []layer {
+	t.Helper()
+	c, err := ParseSVG(strings.NewReader(s))
+	test.Error(t, err)
+	return c.layers[0]
+}
+
+func TestParseSVG(t *testing.T) {
+	c, err := ParseSVG(strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg" width="192" height="96" viewBox="0 0 100 50"><rect x="10" y="10" width="20" height="10" fill="red"/></svg>`))
+	test.Error(t, err)
+	test.Float(t, c.W, 50.8)
+	test.Float(t, c.H, 25.4)
+
+	layers := c.layers[0]
+	test.T(t, len(layers), 1)
+	test.T(t, layers[0].path.Transform(layers[0].m).Bounds(), Rect{5.08, 15.24, 10.16, 5.08})
+	test.T(t, layers[0].style.Fill.Color, Red)
+
+	_, err = ParseSVG(strings.NewReader(`<html></html>`))
+	test.That(t, err != nil)
+}
+
+func TestParseSVGUse(t *testing.T) {
+	var tts = []struct {
+		name   string
+		svg    string
+		bounds Rect
+	}{
+		{"use", `<defs><rect id="r" width="10" height="10"/></defs><use href="#r" x="20" y="30"/>`, Rect{20.0, 60.0, 10.0, 10.0}},
+		{"xlink", `<defs><rect id="r" width="10" height="10"/></defs><use xlink:href="#r" x="20"/>`, Rect{20.0, 90.0, 10.0, 10.0}},
+		{"symbol", `<symbol id="s" viewBox="0 0 10 10"><rect width="10" height="10"/></symbol><use href="#s" x="10" y="10" width="40" height="20"/>`, Rect{20.0, 70.0, 20.0, 20.0}},
+		{"symbol slice", `<symbol id="s" viewBox="0 0 10 10" preserveAspectRatio="xMinYMin slice"><rect width="10" height="10"/></symbol><use href="#s" width="40" height="20"/>`, Rect{0.0, 60.0, 40.0, 40.0}},
+		{"nested svg", `<svg x="50" y="50" width="20" height="40" viewBox="0 0 1 1" preserveAspectRatio="none"><rect width="1" height="1"/></svg>`, Rect{50.0, 10.0, 20.0, 40.0}},
+		{"nested percentage", `<svg x="50" width="50" height="50"><rect width="50%" height="100%"/></svg>`, Rect{50.0, 50.0, 25.0, 50.0}},
+		{"transform", `<g transform="translate(10,20)"><circle cx="10" cy="10" r="5"/></g>`, Rect{15.0, 65.0, 10.0, 10.0}},
+		{"skewX", `<rect width="10" height="10" transform="skewX(45)"/>`, Rect{0.0, 90.0, 20.0, 10.0}},
+		{"skewY", `<rect width="10" height="10" transform="skewY(45)"/>`, Rect{0.0, 80.0, 10.0, 20.0}},
+	}
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			layers := svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="100" height="100" viewBox="0 0 100 100">`+tt.svg+`</svg>`)
+			test.T(t, len(layers), 1)
+			test.T(t, layers[0].path.Transform(Identity.Scale(96.0/25.4, 96.0/25.4).Mul(layers[0].m)).Bounds(), tt.bounds)
+		})
+	}
+
+	// circular references are not drawn
+	layers := svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="100"><g id="g"><rect width="10" height="10"/><use href="#g"/></g></svg>`)
+	test.T(t, len(layers), 2)
+}
+
+func TestParseSVGInheritance(t *testing.T) {
+	layers := svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="100">
+<defs><linearGradient id="g"><stop offset="0" stop-color="red"/><stop offset="1" stop-color="blue"/></linearGradient></defs>
+<symbol id="s"><rect width="10" height="10"/></symbol>
+<g fill="url(#g)" stroke="green"><rect width="10" height="10"/><rect width="10" height="10" fill="lime"/><use href="#s"/></g>
+<g fill="none"><rect width="10" height="10" fill="url(#g)"/></g>
+</svg>`)
+	test.T(t, len(layers), 4)
+	test.That(t, layers[0].style.Fill.IsGradient())
+	test.T(t, layers[0].style.Stroke.Color, Green)
+	test.T(t, layers[1].style.Fill.Color, Lime)
+	test.That(t, layers[2].style.Fill.IsGradient())
+	test.That(t, layers[3].style.Fill.IsGradient())
+}
+
+func TestParseSVGGradient(t *testing.T) {
+	layers := svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" width="96" height="96" viewBox="0 0 100 100">
+<linearGradient id="a" x1="10%" x2="90%"><stop offset="0" stop-color="red"/><stop offset="1" stop-color="blue" stop-opacity="0"/></linearGradient>
+<linearGradient id="b" href="#a" gradientUnits="userSpaceOnUse" x1="10" y1="20" x2="10" y2="40"/>
+<linearGradient id="c" href="#a" gradientTransform="rotate(90)"/>
+<radialGradient id="d" cx="0" cy="0" r="10" fx="5" gradientUnits="userSpaceOnUse" gradientTransform="translate(50,50) scale(2)"><stop offset="0" stop-color="red"/></radialGradient>
+<linearGradient id="e" href="#a" x1="0" x2="0.5" spreadMethod="reflect"/>
+<rect width="50" height="100" fill="url(#a)"/>
+<rect width="50" height="100" fill="url(#b)"/>
+<rect width="50" height="100" fill="url(#c)"/>
+<rect width="50" height="100" fill="url(#d)"/>
+<rect width="100" height="100" fill="url(#e)"/>
+</svg>`)
+	test.T(t, len(layers), 5)
+
+	g := layers[0].style.Fill.Gradient.(*LinearGradient)
+	test.T(t, g.Start, Point{1.27, 25.4})
+	test.T(t, g.End, Point{11.43, 25.4})
+	test.T(t, g.Stops, Stops{{0.0, Red}, {1.0, Transparent}})
+
+	g = layers[1].style.Fill.Gradient.(*LinearGradient)
+	test.T(t, g.Start, Point{2.54, 20.32})
+	test.T(t, g.End, Point{2.54, 15.24})
+
+	// the gradient vector remains perpendicular to the isolines in the non-square bounding box
+	g = layers[2].style.Fill.Gradient.(*LinearGradient)
+	test.T(t, g.Start, Point{0.0, 22.86})
+	test.T(t, g.End, Point{0.0, 2.54})
+
+	r := layers[3].style.Fill.Gradient.(*RadialGradient)
+	test.T(t, r.C0, Point{15.24, 12.7})
+	test.T(t, r.C1, Point{12.7, 12.7})
+	test.Float(t, r.R0, 0.0)
+	test.Float(t, r.R1, 5.08)
+
+	g = layers[4].style.Fill.Gradient.(*LinearGradient)
+	test.T(t, g.Start, Point{0.0, 25.4})
+	test.T(t, g.End, Point{25.4, 25.4})
+	test.T(t, len(g.Stops), 4)
+	test.T(t, g.Stops[2], Stop{0.5, Transparent})
+	test.T(t, g.Stops[3], Stop{1.0, Red})
+}
+
+func TestParseSVGPattern(t *testing.T) {
+	layers := svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" width="96" height="96" viewBox="0 0 100 100">
+<pattern id="p" width="10" height="20" patternUnits="userSpaceOnUse"><rect width="5" height="5" fill="green"/><rect x="20" width="5" height="5"/></pattern>
+<pattern id="q" href="#p" width="0.5" height="0.25" patternUnits="objectBoundingBox" patternTransform="translate(10,0)"/>
+<rect width="100" height="100" fill="url(#p)"/>
+<rect width="40" height="40" fill="url(#q)"/>
+</svg>`)
+	test.T(t, len(layers), 2)
+
+	hatch := layers[0].style.Fill.Pattern.(*HatchPattern)
+	test.T(t, hatch.Fill.Color, Green)
+	test.T(t, hatch.Cell(), Identity.Translate(0.0, 25.4).Scale(2.54, -5.08))
+	test.T(t, len(hatch.Hatch(0.0, 0.0, 0.5, 0.5).Split()), 16) // one shape per tile, shapes outside the tile are removed
+
+	hatch = layers[1].style.Fill.Pattern.(*HatchPattern)
+	test.T(t, hatch.Cell(), Identity.Translate(2.54, 25.4).Scale(5.08, -2.54))
+}
+
+func TestParseSVGClipPath(t *testing.T) {
+	layers := svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" width="96" height="96" viewBox="0 0 100 100">
+<clipPath id="c"><rect x="10" y="10" width="20" height="20"/></clipPath>
+<clipPath id="d" clipPathUnits="objectBoundingBox"><rect width="0.5" height="1"/></clipPath>
+<mask id="m"><rect width="100" height="100" fill="white" fill-opacity="0.5" style="fill:#808080"/></mask>
+<g clip-path="url(#c)"><rect width="20" height="20" fill="red"/><rect width="20" height="20" stroke="blue" fill="none" stroke-width="2"/></g>
+<rect x="50" y="50" width="40" height="40" clip-path="url(#d)"/>
+<rect x="50" y="50" width="20" height="20" fill="red" mask="url(#m)"/>
+</svg>`)
+	test.T(t, len(layers), 4)
+	test.T(t, layers[0].path.Transform(layers[0].m).Bounds(), Rect{2.54, 20.32, 2.54, 2.54})
+	test.T(t, layers[1].style.Fill.Color, Blue)
+	test.That(t, !layers[1].style.HasStroke())
+	test.T(t, layers[1].path.Transform(layers[1].m).Bounds(), Rect{2.54, 20.066, 2.794, 2.794})
+	test.T(t, layers[2].path.Transform(layers[2].m).Bounds(), Rect{12.7, 2.54, 5.08, 10.16})
+	test.T(t, layers[3].style.Fill.Color, color.RGBA{64, 0, 0, 64}) // luminance times opacity of the mask
+}
+
+func TestParseSVGClipPathCircular(t *testing.T) {
+	var tts = []struct {
+		name     string
+		svg      string
+		warnings int
+	}{
+		{"clipPath", `<clipPath id="c" clip-path="url(#c)"><rect width="10" height="10"/></clipPath><rect width="20" height="20" clip-path="url(#c)"/>`, 1},
+		{"mask", `<mask id="m"><rect width="10" height="10" fill="white" mask="url(#m)"/></mask><rect width="20" height="20" mask="url(#m)"/>`, 1},
+		{"pattern", `<pattern id="p" width="10" height="10" patternUnits="userSpaceOnUse"><rect width="5" height="5" fill="url(#p)"/></pattern><rect width="20" height="20" fill="url(#p)"/>`, 0},
+	}
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, warnings, err := ParseSVGWithOptions(strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg" width="100" height="100">`+tt.svg+`</svg>`), nil)
+			test.Error(t, err)
+			test.T(t, len(warnings), tt.warnings)
+		})
+	}
+}
+
+func TestParseSVGFilter(t *testing.T) {
+	layers := svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" width="96" height="96" viewBox="0 0 100 100">
+<filter id="f"><feGaussianBlur in="SourceAlpha" stdDeviation="4"/><feOffset dx="2" dy="4" result="o"/><feFlood style="flood-color:red" flood-opacity="0.5"/><feComposite in2="o" operator="in"/><feMerge><feMergeNode/><feMergeNode in="SourceGraphic"/></feMerge></filter>
+<filter id="g" primitiveUnits="objectBoundingBox"><feGaussianBlur stdDeviation="0.1 0.2"/><feColorMatrix type="saturate" values="0"/></filter>
+<g filter="url(#f)" opacity="0.5"><rect width="20" height="20"/><circle cx="10" cy="10" r="5"/></g>
+<rect x="50" y="50" width="40" height="20" filter="url(#g)"/>
+</svg>`)
+	test.T(t, len(layers), 2)
+	test.T(t, len(layers[0].group.layers[0]), 2)
+	primitives := layers[0].filter.Primitives
+	test.T(t, len(primitives), 6)
+	test.T(t, primitives[0].In, SourceAlpha)
+	test.Float(t, primitives[0].Effect.(GaussianBlurEffect).StdDevX, 1.016)
+	test.T(t, primitives[1].Result, "o")
+	test.Float(t, primitives[1].Effect.(OffsetEffect).DX, 0.508)
+	test.Float(t, primitives[1].Effect.(OffsetEffect).DY, -1.016)
+	test.T(t, primitives[2].Effect, FilterEffect(FloodEffect{color.RGBA{128, 0, 0, 128}}))
+	test.T(t, primitives[3].Effect, FilterEffect(CompositeEffect{Operator: CompositeIn}))
+	test.T(t, primitives[4].Effect, FilterEffect(MergeEffect{[]string{"", SourceGraphic}}))
+	test.Float(t, primitives[5].Effect.(ColorMatrixEffect).Matrix[18], 0.5) // group opacity
+
+	primitives = layers[1].filter.Primitives
+	test.T(t, len(primitives), 2)
+	test.Float(t, primitives[0].Effect.(GaussianBlurEffect).StdDevX, 1.016)
+	test.Float(t, primitives[0].Effect.(GaussianBlurEffect).StdDevY, 1.016)
+	test.T(t, primitives[1].Effect, FilterEffect(SaturateColorMatrix(0.0)))
+}
+
+func TestParseSVGText(t *testing.T) {
+	if _, ok := FindSystemFont("serif", FontRegular); !ok {
+		t.Skip("no system fonts")
+	}
+
+	var tts = []struct {
+		name string
+		svg  string
+		text []string
+		x    []float64
+	}{
+		{"whitespace", `<text x="10" y="20">  a  <tspan>
+	b</tspan>  </text>`, []string{"a b"}, []float64{10.0}},
+		{"positions", `<text x="10 30 50" y="20">abcd</text>`, []string{"a", "b", "cd"}, []float64{10.0, 30.0, 50.0}},
+		{"tspan", `<text x="10" y="20">a<tspan x="40">b</tspan><tspan dx="5" rotate="0 90">cd</tspan></text>`, []string{"a", "b", "c", "d"}, []float64{10.0, 40.0, 0.0, 0.0}},
+		{"textPath", `<defs><path id="p" d="M0 50H100"/></defs><text><textPath href="#p" startOffset="20">ab</textPath></text>`, []string{"a", "b"}, []float64{20.0, 0.0}},
+	}
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			layers := svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" width="96" height="96">`+tt.svg+`</svg>`)
+			test.T(t, len(layers), len(tt.text))
+			for i, l := range layers {
+				test.T(t, l.text.Text, tt.text[i])
+				if tt.x[i] != 0.0 {
+					test.Float(t, l.m.Dot(Point{}).X*96.0/25.4, tt.x[i])
+				}
+			}
+		})
+	}
+
+	// anchors apply to the text chunk
+	layers := svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" width="96" height="96"><text x="50" text-anchor="end" letter-spacing="2">ab</text></svg>`)
+	test.T(t, len(layers), 2)
+	b := layers[1].text.Bounds()
+	test.Float(t, layers[1].m.Dot(Point{b.X + b.W, 0.0}).X*96.0/25.4, 50.0-2.0)
+
+	// font styles
+	layers = svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" width="96" height="96"><text font-weight="bold" fill="red">a<tspan font-weight="normal" font-style="italic">b</tspan></text></svg>`)
+	test.T(t, len(layers), 1)
+	faces := []*FontFace{}
+	layers[0].text.WalkSpans(func(x, y float64, span TextSpan) {
+		faces = append(faces, span.Face)
+	})
+	test.T(t, len(faces), 2)
+	test.T(t, faces[0].Style, FontBold)
+	test.T(t, faces[0].Fill.Color, Red)
+	test.T(t, faces[1].Style, FontRegular|FontItalic)
+}
+
+func TestParseSVGImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	var buf bytes.Buffer
+	test.Error(t, png.Encode(&buf, img))
+	uri := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	layers := svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" width="96" height="96"><image x="10" y="20" width="40" href="`+uri+`"/><image x="10" width="40" height="40" xlink:href="`+uri+`"/></svg>`)
+	test.T(t, len(layers), 2)
+	m := Identity.Scale(96.0/25.4, 96.0/25.4).Mul(layers[0].m)
+	test.T(t, Rect{0.0, 0.0, 4.0, 2.0}.Transform(m), Rect{10.0, 56.0, 40.0, 20.0})
+	m = Identity.Scale(96.0/25.4, 96.0/25.4).Mul(layers[1].m)
+	test.T(t, Rect{0.0, 0.0, 4.0, 2.0}.Transform(m), Rect{10.0, 66.0, 40.0, 20.0}) // centered by preserveAspectRatio
+
+	_, err := ParseSVG(strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg" width="96" height="96"><image href="data:image/png;base64,AAAA"/></svg>`))
+	test.That(t, err != nil)
+}
+
+func TestParseSVGStyle(t *testing.T) {
+	var tts = []struct {
+		name  string
+		style string
+		svg   string
+		fills []color.RGBA
+	}{
+		{"specificity", `#a { fill: red } .b { fill: blue } rect { fill: green }`, `<rect id="a" class="b"/><rect class="b"/><rect/>`, []color.RGBA{Red, Blue, Green}},
+		{"order", `rect { fill: red } rect { fill: blue }`, `<rect/>`, []color.RGBA{Blue}},
+		{"presentation attribute", `rect { fill: blue }`, `<rect fill="red"/>`, []color.RGBA{Blue}},
+		{"style attribute", `#a { fill: blue }`, `<rect id="a" style="fill: red"/>`, []color.RGBA{Red}},
+		{"important", `rect { fill: blue !important } #a { fill: green }`, `<rect id="a" style="fill: red"/>`, []color.RGBA{Blue}},
+		{"inherit", `g { fill: blue }`, `<g><rect fill="inherit"/></g>`, []color.RGBA{Blue}},
+		{"descendant", `g rect { fill: blue }`, `<g><a><rect/></a></g><rect/>`, []color.RGBA{Blue, Black}},
+		{"child", `g > rect { fill: blue }`, `<g><a><rect/></a><rect/></g>`, []color.RGBA{Black, Blue}},
+		{"next sibling", `circle + rect { fill: blue }`, `<circle r="1"/><rect/><rect/>`, []color.RGBA{Blue, Black}},
+		{"subsequent sibling", `circle ~ rect { fill: blue }`, `<rect/><circle r="1"/><rect/><rect/>`, []color.RGBA{Black, Blue, Blue}},
+		{"first-child", `rect:first-child { fill: blue } rect:last-child { fill: red }`, `<g><rect/><rect/><rect/></g>`, []color.RGBA{Blue, Black, Red}},
+		{"nth-child", `rect:nth-child(2n+1) { fill: blue } rect:nth-child(2) { fill: red }`, `<g><rect/><rect/><rect/></g>`, []color.RGBA{Blue, Red, Blue}},
+		{"not", `rect:not(.a, #b) { fill: blue }`, `<rect class="a"/><rect id="b"/><rect/>`, []color.RGBA{Black, Black, Blue}},
+		{"attribute", `[data-x="y"] { fill: blue }`, `<rect data-x="y"/><rect/>`, []color.RGBA{Blue, Black}},
+		{"hover", `rect:hover { fill: blue }`, `<rect/>`, []color.RGBA{Black}},
+		{"display", `.a { display: none }`, `<g class="a"><rect/></g><rect/>`, []color.RGBA{Black}},
+		{"visibility", `g { visibility: hidden } .a { visibility: visible }`, `<g><rect/><rect class="a"/></g>`, []color.RGBA{Black}},
+		{"fill-opacity", ``, `<g fill-opacity="0.5"><rect fill="red"/></g>`, []color.RGBA{{128, 0, 0, 128}}},
+		{"opacity", ``, `<g opacity="0.5"><rect fill="red" opacity="50%"/></g>`, []color.RGBA{{64, 0, 0, 64}}},
+	}
+	for _, tt := range tts {
+		t.Run(tt.name, func(t *testing.T) {
+			layers := svgLayers(t, `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="100"><style>`+tt.style+`</style>`+strings.ReplaceAll(tt.svg, "<rect", `<rect width="1" height="1"`)+`</svg>`)
+			fills := []color.RGBA{}
+			for _, l := range layers {
+				if l.path.Bounds().W == 1.0 {
+					fills = append(fills, l.style.Fill.Color)
+				}
+			}
+			test.T(t, fills, tt.fills)
+		})
+	}
+}
+
+type svgTestResolver struct {
+	images map[string][]byte
+	fonts  map[string][]byte
+}
+
+func (r svgTestResolver) Image(href string) ([]byte, error) {
+	return r.images[href], nil
+}
+
+func (r svgTestResolver) Font(family string, style FontStyle) ([]byte, error) {
+	if style != FontRegular {
+		return nil, nil
+	}
+	return r.fonts[family], nil
+}
+
+func TestParseSVGWithOptions(t *testing.T) {
+	s := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape" width="100" height="100">
+<inkscape:grid/>
+<rect width="10" height="10" inkscape:label="a" data-x="y" style="fill:red;mix-blend-mode:multiply"/>
+<filter id="f"><feTurbulence/></filter>
+  <circle r="5" vector-effect="non-scaling-stroke"/>
+</svg>`
+	c, warnings, err := ParseSVGWithOptions(strings.NewReader(s), nil)
+	test.Error(t, err)
+	test.T(t, len(c.layers[0]), 2)
+	test.T(t, warnings, []SVGWarning{
+		{3, 60, "unsupported property: mix-blend-mode"},
+		{4, 16, "unsupported element: feTurbulence"},
+		{5, 17, "unsupported attribute: vector-effect"},
+	})
+
+	_, _, err = ParseSVGWithOptions(strings.NewReader(s), &SVGOptions{Strict: true})
+	test.That(t, err != nil)
+
+	// errors point to the attribute
+	_, err = ParseSVG(strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg">
+<path
+  d="M0 0Lx"/></svg>`))
+	perr, ok := err.(*parse.Error)
+	test.That(t, ok)
+	test.T(t, perr.Line, 3)
+	test.T(t, perr.Column, 3)
+}
+
+func TestParseSVGResolver(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	var buf bytes.Buffer
+	test.Error(t, png.Encode(&buf, img))
+	font, err := ioutil.ReadFile("resources/DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	resolver := svgTestResolver{
+		images: map[string][]byte{"icon.png": buf.Bytes()},
+		fonts:  map[string][]byte{"Custom": font},
+	}
+	c, warnings, err := ParseSVGWithOptions(strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg" width="100" height="100"><image href="icon.png"/><text font-family="Custom" font-weight="bold">a</text></svg>`), &SVGOptions{Resolver: resolver})
+	test.Error(t, err)
+	test.T(t, len(warnings), 0)
+	test.T(t, len(c.layers[0]), 2)
+	test.T(t, c.layers[0][0].img.Bounds().Dx(), 4)
+	c.layers[0][1].text.WalkSpans(func(x, y float64, span TextSpan) {
+		test.T(t, span.Face.Font.Name(), "Custom")
+		test.That(t, span.Face.FauxBold != 0.0) // bold is synthesized
+	})
+}